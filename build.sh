@@ -1,6 +1,19 @@
 #!/bin/bash
 go build -mod=readonly github.com/glennhartmann/ledger-tools/src/transactionsorter
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/journalmerge
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/transfermatch
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/csvimport
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/ofximport
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/qifimport
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/camtimport
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/categorize
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/journalfmt
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/checkassertions
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/journallint
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/journalsplit
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/closebooks
 go build -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbfetcher
 go build -mod=readonly github.com/glennhartmann/ledger-tools/src/questrademain
 go build -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbtocsv
 go build -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbmain
+go build -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbmerge
@@ -84,7 +84,7 @@ func SortResponsesByDateThenBySymbol(rs []Response, closeTime string) ([]*priceu
 			})
 		}
 	}
-	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{tsiws})
+	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{TSIWS: tsiws})
 	return tsiws, nil
 }
 
@@ -27,10 +27,10 @@ type TimeSeries map[string]DayData
 
 type DayData interface {
 	priceutils.PriceData
-	GetOpen() string
-	GetHigh() string
-	GetLow() string
-	GetClose() string
+	GetOpen() priceutils.Decimal
+	GetHigh() priceutils.Decimal
+	GetLow() priceutils.Decimal
+	GetClose() priceutils.Decimal
 }
 
 func ResponseDebugString(r Response) string {
@@ -146,30 +146,30 @@ func (sm *StockMetadata) GetLastRefreshed() (time.Time, error) {
 }
 
 type StockDayData struct {
-	Open   string `json:"1. open"`
-	High   string `json:"2. high"`
-	Low    string `json:"3. low"`
-	Close  string `json:"4. close"`
-	Volume string `json:"5 volume"`
+	Open   priceutils.Decimal `json:"1. open"`
+	High   priceutils.Decimal `json:"2. high"`
+	Low    priceutils.Decimal `json:"3. low"`
+	Close  priceutils.Decimal `json:"4. close"`
+	Volume string             `json:"5 volume"`
 }
 
-func (sdd *StockDayData) GetLastPrice() string {
+func (sdd *StockDayData) GetLastPrice() priceutils.Decimal {
 	return sdd.GetClose()
 }
 
-func (sdd *StockDayData) GetOpen() string {
+func (sdd *StockDayData) GetOpen() priceutils.Decimal {
 	return sdd.Open
 }
 
-func (sdd *StockDayData) GetHigh() string {
+func (sdd *StockDayData) GetHigh() priceutils.Decimal {
 	return sdd.High
 }
 
-func (sdd *StockDayData) GetLow() string {
+func (sdd *StockDayData) GetLow() priceutils.Decimal {
 	return sdd.Low
 }
 
-func (sdd *StockDayData) GetClose() string {
+func (sdd *StockDayData) GetClose() priceutils.Decimal {
 	return sdd.Close
 }
 
@@ -225,29 +225,29 @@ func (sm *ForexMetadata) GetLastRefreshed() (time.Time, error) {
 }
 
 type ForexDayData struct {
-	Open  string `json:"1. open"`
-	High  string `json:"2. high"`
-	Low   string `json:"3. low"`
-	Close string `json:"4. close"`
+	Open  priceutils.Decimal `json:"1. open"`
+	High  priceutils.Decimal `json:"2. high"`
+	Low   priceutils.Decimal `json:"3. low"`
+	Close priceutils.Decimal `json:"4. close"`
 }
 
-func (sdd *ForexDayData) GetLastPrice() string {
+func (sdd *ForexDayData) GetLastPrice() priceutils.Decimal {
 	return sdd.GetClose()
 }
 
-func (sdd *ForexDayData) GetOpen() string {
+func (sdd *ForexDayData) GetOpen() priceutils.Decimal {
 	return sdd.Open
 }
 
-func (sdd *ForexDayData) GetHigh() string {
+func (sdd *ForexDayData) GetHigh() priceutils.Decimal {
 	return sdd.High
 }
 
-func (sdd *ForexDayData) GetLow() string {
+func (sdd *ForexDayData) GetLow() priceutils.Decimal {
 	return sdd.Low
 }
 
-func (sdd *ForexDayData) GetClose() string {
+func (sdd *ForexDayData) GetClose() priceutils.Decimal {
 	return sdd.Close
 }
 
@@ -304,35 +304,35 @@ func (sm *CryptocurrencyMetadata) GetLastRefreshed() (time.Time, error) {
 }
 
 type CryptocurrencyDayData struct {
-	CADOpen      string `json:"1a. open (CAD)"`
-	CADHigh      string `json:"2a. high (CAD)"`
-	CADLow       string `json:"3a. low (CAD)"`
-	CADClose     string `json:"4a. close (CAD)"`
-	USDOpen      string `json:"1b. open (USD)"`
-	USDHigh      string `json:"2b. high (USD)"`
-	USDLow       string `json:"3b. low (USD)"`
-	USDClose     string `json:"4b. close (USD)"`
-	Volume       string `json:"5 volume"`
-	USDMarketCap string `json:"6. market cap (USD)"`
-}
-
-func (sdd *CryptocurrencyDayData) GetLastPrice() string {
+	CADOpen      priceutils.Decimal `json:"1a. open (CAD)"`
+	CADHigh      priceutils.Decimal `json:"2a. high (CAD)"`
+	CADLow       priceutils.Decimal `json:"3a. low (CAD)"`
+	CADClose     priceutils.Decimal `json:"4a. close (CAD)"`
+	USDOpen      priceutils.Decimal `json:"1b. open (USD)"`
+	USDHigh      priceutils.Decimal `json:"2b. high (USD)"`
+	USDLow       priceutils.Decimal `json:"3b. low (USD)"`
+	USDClose     priceutils.Decimal `json:"4b. close (USD)"`
+	Volume       string             `json:"5 volume"`
+	USDMarketCap string             `json:"6. market cap (USD)"`
+}
+
+func (sdd *CryptocurrencyDayData) GetLastPrice() priceutils.Decimal {
 	return sdd.GetClose()
 }
 
-func (sdd *CryptocurrencyDayData) GetOpen() string {
+func (sdd *CryptocurrencyDayData) GetOpen() priceutils.Decimal {
 	return sdd.CADOpen
 }
 
-func (sdd *CryptocurrencyDayData) GetHigh() string {
+func (sdd *CryptocurrencyDayData) GetHigh() priceutils.Decimal {
 	return sdd.CADHigh
 }
 
-func (sdd *CryptocurrencyDayData) GetLow() string {
+func (sdd *CryptocurrencyDayData) GetLow() priceutils.Decimal {
 	return sdd.CADLow
 }
 
-func (sdd *CryptocurrencyDayData) GetClose() string {
+func (sdd *CryptocurrencyDayData) GetClose() priceutils.Decimal {
 	return sdd.CADClose
 }
 
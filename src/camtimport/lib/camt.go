@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The camt types only have the elements that are imported. The element names
+// are the same in all the camt.052 and camt.053 versions, except where noted.
+// Namespaces are ignored, so any version can be read.
+
+type document struct {
+	// Statements are from camt.053 files.
+	Statements []*statement `xml:"BkToCstmrStmt>Stmt"`
+	// Reports are from camt.052 files. They're laid out the same way.
+	Reports []*statement `xml:"BkToCstmrAcctRpt>Rpt"`
+}
+
+type statement struct {
+	Account account  `xml:"Acct"`
+	Entries []*entry `xml:"Ntry"`
+}
+
+type account struct {
+	IBAN     string `xml:"Id>IBAN"`
+	Other    string `xml:"Id>Othr>Id"`
+	Currency string `xml:"Ccy"`
+}
+
+// id returns the account's IBAN, or its other ID if it doesn't have one.
+func (a *account) id() string {
+	if a.IBAN != "" {
+		return a.IBAN
+	}
+	return a.Other
+}
+
+type amount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type date struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// status is written as text before camt.053.001.08, and as a code after.
+type status struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+func (s *status) String() string {
+	if s.Code != "" {
+		return strings.TrimSpace(s.Code)
+	}
+	return strings.TrimSpace(s.Value)
+}
+
+type entry struct {
+	Ref         string          `xml:"NtryRef"`
+	Amount      amount          `xml:"Amt"`
+	CreditDebit string          `xml:"CdtDbtInd"`
+	Reversal    bool            `xml:"RvslInd"`
+	Status      status          `xml:"Sts"`
+	BookingDate date            `xml:"BookgDt"`
+	ValueDate   date            `xml:"ValDt"`
+	ServicerRef string          `xml:"AcctSvcrRef"`
+	Info        string          `xml:"AddtlNtryInf"`
+	Charges     []*charges      `xml:"Chrgs"`
+	Details     []*entryDetails `xml:"NtryDtls"`
+}
+
+// entryDetails describe the transactions an entry is made of. A batch entry
+// (like a salary run) has several.
+type entryDetails struct {
+	Transactions []*transactionDetails `xml:"TxDtls"`
+}
+
+type transactionDetails struct {
+	// Amount and CreditDebit are only in camt.053.001.03 and later. Before
+	// that, the amount is in AmountDetails.Transaction.
+	Amount        *amount        `xml:"Amt"`
+	CreditDebit   string         `xml:"CdtDbtInd"`
+	AmountDetails amountDetails  `xml:"AmtDtls"`
+	Charges       []*charges     `xml:"Chrgs"`
+	Parties       relatedParties `xml:"RltdPties"`
+	Remittance    struct {
+		Unstructured []string `xml:"Ustrd"`
+		References   []string `xml:"Strd>CdtrRefInf>Ref"`
+	} `xml:"RmtInf"`
+	Info string `xml:"AddtlTxInf"`
+}
+
+type amountDetails struct {
+	Instructed   amountAndExchange `xml:"InstdAmt"`
+	Transaction  amountAndExchange `xml:"TxAmt"`
+	CounterValue amountAndExchange `xml:"CntrValAmt"`
+}
+
+type amountAndExchange struct {
+	Amount   *amount   `xml:"Amt"`
+	Exchange *exchange `xml:"CcyXchg"`
+}
+
+type exchange struct {
+	Source string `xml:"SrcCcy"`
+	Target string `xml:"TrgtCcy"`
+	Rate   string `xml:"XchgRate"`
+}
+
+type relatedParties struct {
+	Debtor   party `xml:"Dbtr"`
+	Creditor party `xml:"Cdtr"`
+}
+
+// party names are in Pty from camt.053.001.08 on.
+type party struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p *party) name() string {
+	if p.Name != "" {
+		return strings.TrimSpace(p.Name)
+	}
+	return strings.TrimSpace(p.PartyName)
+}
+
+// charges are the fees taken by the banks involved in a transaction. Before
+// camt.053.001.03, there's no way to tell if they're part of the entry
+// amount, so only the records of later versions are used.
+type charges struct {
+	Records []*charge `xml:"Rcrd"`
+}
+
+type charge struct {
+	Amount      amount `xml:"Amt"`
+	CreditDebit string `xml:"CdtDbtInd"`
+	// Included is whether the charge was taken out of the entry amount,
+	// rather than booked separately. It's true if it's not given.
+	Included *bool `xml:"ChrgInclInd"`
+}
+
+func parseCamt(r io.Reader) (*document, error) {
+	doc := &document{}
+	if err := xml.NewDecoder(r).Decode(doc); err != nil {
+		return nil, errors.Wrap(err, "Decode()")
+	}
+	if len(doc.Statements) == 0 && len(doc.Reports) == 0 {
+		return nil, errors.New("no camt.053 statements or camt.052 reports")
+	}
+	return doc, nil
+}
+
+// parseDate parses a camt date, or the date part of a date and time, which
+// is in the bank's local time.
+func parseDate(d *date) (time.Time, error) {
+	s := strings.TrimSpace(d.Date)
+	if s == "" {
+		s = strings.TrimSpace(d.DateTime)
+	}
+	if len(s) < 10 {
+		return time.Time{}, errors.Errorf("invalid date %q", s)
+	}
+	t, err := time.Parse("2006-01-02", s[:10])
+	return t, errors.Wrapf(err, "time.Parse(%s)", s)
+}
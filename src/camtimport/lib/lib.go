@@ -0,0 +1,433 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+const (
+	DefaultIDTag          = "import-id"
+	DefaultExpenseAccount = "Expenses:Unknown"
+	DefaultIncomeAccount  = "Income:Unknown"
+	DefaultFeeAccount     = "Expenses:Bank Fees"
+)
+
+type Importer struct {
+	// Accounts maps IBANs (or other account IDs, for accounts without one)
+	// to ledger accounts. Other accounts are named `Assets:Bank:<IBAN>`.
+	Accounts map[string]string
+	// Currencies maps ISO currency codes to the symbols to write them with,
+	// like `EUR` to `€`. Other currencies are written as their codes.
+	Currencies map[string]string
+	// ExpenseAccount and IncomeAccount balance transactions that take money
+	// out of, or put money into, an account.
+	ExpenseAccount string
+	IncomeAccount  string
+	// FeeAccount gets the bank charges that were taken out of a
+	// transaction's amount.
+	FeeAccount string
+	// IDTag is the metadata tag for each entry's ID, which is its IBAN and
+	// the bank's reference for it (see entryID).
+	IDTag string
+	importer.Appender
+}
+
+// Import is what was read from a camt file.
+type Import struct {
+	// Transactions are the imported ledger transactions, sorted.
+	Transactions string
+	// Skipped describes entries that were left out because they're only
+	// informational.
+	Skipped []string
+}
+
+// money is a signed amount of a currency.
+type money struct {
+	q        *big.Rat
+	prec     int
+	currency string
+}
+
+// Convert reads a camt.053 or camt.052 file from r.
+func (im *Importer) Convert(r io.Reader) (*Import, error) {
+	doc, err := parseCamt(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseCamt()")
+	}
+	c := &converter{Importer: im, ids: make(map[string]int)}
+	for _, s := range append(doc.Statements, doc.Reports...) {
+		if err := c.statement(s); err != nil {
+			return nil, errors.Wrapf(err, "statement(%s)", s.Account.id())
+		}
+	}
+
+	out, err := im.Sort(c.transactions)
+	if err != nil {
+		return nil, errors.Wrap(err, "Sort()")
+	}
+	return &Import{Transactions: out, Skipped: c.skipped}, nil
+}
+
+// ConvertFile is like Convert, reading the camt file at path.
+func (im *Importer) ConvertFile(path string) (*Import, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.Open(%s)", path)
+	}
+	defer f.Close()
+	imp, err := im.Convert(f)
+	return imp, errors.Wrapf(err, "Convert(%s)", path)
+}
+
+type converter struct {
+	*Importer
+	transactions []*importer.Transaction
+	skipped      []string
+	// ids counts the entries without a bank reference that have the same
+	// contents, so they still get different IDs.
+	ids map[string]int
+}
+
+func (c *converter) statement(s *statement) error {
+	acctID := s.Account.id()
+	account, ok := c.Accounts[acctID]
+	if !ok {
+		account = "Assets:Bank:" + acctID
+	}
+	for i, e := range s.Entries {
+		if err := c.entry(s, account, e); err != nil {
+			return errors.Wrapf(err, "entry %d", i+1)
+		}
+	}
+	return nil
+}
+
+func (c *converter) entry(s *statement, account string, e *entry) error {
+	var state journal.State
+	switch st := e.Status.String(); st {
+	case "BOOK":
+		state = journal.Cleared
+	case "PDNG":
+		state = journal.Pending
+	default:
+		// INFO entries (and any future statuses) aren't on the account
+		c.skipped = append(c.skipped, fmt.Sprintf("%s %s %s: status %s", dateText(e), e.CreditDebit, e.Amount.Value, st))
+		return nil
+	}
+
+	d := &e.BookingDate
+	if d.Date == "" && d.DateTime == "" {
+		// pending entries might not have a booking date yet
+		d = &e.ValueDate
+	}
+	date, err := parseDate(d)
+	if err != nil {
+		return errors.Wrap(err, "parseDate(BookgDt)")
+	}
+	var auxDate time.Time
+	if e.ValueDate.Date != "" || e.ValueDate.DateTime != "" {
+		if auxDate, err = parseDate(&e.ValueDate); err != nil {
+			return errors.Wrap(err, "parseDate(ValDt)")
+		}
+	}
+
+	m, err := parseMoney(&e.Amount, e.CreditDebit, s.Account.Currency)
+	if err != nil {
+		return errors.Wrap(err, "parseMoney(Amt)")
+	}
+	id := c.entryID(s, e)
+
+	var details []*transactionDetails
+	for _, ed := range e.Details {
+		details = append(details, ed.Transactions...)
+	}
+	if len(details) > 1 {
+		if amounts, ok := batchAmounts(details, e.CreditDebit, m); ok {
+			for i, td := range details {
+				t := &importer.Transaction{Date: date, AuxDate: auxDate, State: state}
+				if c.IDTag != "" {
+					t.Notes = append(t.Notes, fmt.Sprintf("%s: %s.%d", c.IDTag, id, i+1))
+				}
+				if err := c.details(t, account, td, amounts[i], nil, e); err != nil {
+					return errors.Wrapf(err, "TxDtls %d", i+1)
+				}
+			}
+			return nil
+		}
+	}
+
+	t := &importer.Transaction{Date: date, AuxDate: auxDate, State: state}
+	if c.IDTag != "" {
+		t.Notes = append(t.Notes, fmt.Sprintf("%s: %s", c.IDTag, id))
+	}
+	if len(details) > 1 {
+		// the batch's amounts couldn't be split out, so it's one transaction
+		// listing what's in it
+		t.Payee = strings.TrimSpace(e.Info)
+		if t.Payee == "" {
+			t.Payee = fmt.Sprintf("Batch of %d transactions", len(details))
+		}
+		for _, td := range details {
+			if n := batchNote(td, m.q.Sign()); n != "" {
+				t.Notes = append(t.Notes, n)
+			}
+		}
+		if e.Reversal {
+			t.Notes = append(t.Notes, "reversal")
+		}
+		t.Postings = []*importer.Posting{
+			{Account: account, Amount: c.format(m)},
+			{Account: c.otherAccount(m)},
+		}
+		c.transactions = append(c.transactions, t)
+		return nil
+	}
+
+	td := &transactionDetails{}
+	if len(details) == 1 {
+		td = details[0]
+	}
+	err = c.details(t, account, td, m, e.Charges, e)
+	return errors.Wrap(err, "details()")
+}
+
+// entryID returns the ID of an entry, made from its IBAN and the bank's
+// reference for it. Entries without a reference get a hash of their
+// contents instead.
+func (c *converter) entryID(s *statement, e *entry) string {
+	ref := strings.TrimSpace(e.ServicerRef)
+	if ref == "" {
+		ref = strings.TrimSpace(e.Ref)
+	}
+	if ref == "" {
+		key := strings.Join([]string{dateText(e), e.CreditDebit, e.Amount.Value, e.Amount.Currency, e.Info}, "\x1f")
+		ref = importer.RowID(key, c.ids[key])
+		c.ids[key]++
+	}
+	if id := s.Account.id(); id != "" {
+		return id + "." + ref
+	}
+	return ref
+}
+
+// details adds a transaction for one of an entry's transactions, with the
+// amount m. Charges are the entry's, for entries with a single transaction.
+func (c *converter) details(t *importer.Transaction, account string, td *transactionDetails, m *money, entryCharges []*charges, e *entry) error {
+	counterparty := td.Parties.Debtor.name()
+	if m.q.Sign() < 0 {
+		counterparty = td.Parties.Creditor.name()
+	}
+	remittance := strings.TrimSpace(strings.Join(td.Remittance.Unstructured, " "))
+	info := strings.TrimSpace(td.Info)
+	entryInfo := strings.TrimSpace(e.Info)
+	for _, p := range []string{counterparty, remittance, info, entryInfo, "Unknown"} {
+		if p != "" {
+			t.Payee = p
+			break
+		}
+	}
+	for _, n := range []string{remittance, info, entryInfo} {
+		if n != "" && n != t.Payee && !contains(t.Notes, n) {
+			t.Notes = append(t.Notes, n)
+		}
+	}
+	for _, r := range td.Remittance.References {
+		if r = strings.TrimSpace(r); r != "" {
+			t.Notes = append(t.Notes, "reference: "+r)
+		}
+	}
+	if e.Reversal {
+		t.Notes = append(t.Notes, "reversal")
+	}
+	ad := &td.AmountDetails
+	for _, ae := range []*amountAndExchange{&ad.Instructed, &ad.Transaction, &ad.CounterValue} {
+		if x := ae.Exchange; x != nil && x.Rate != "" {
+			t.Notes = append(t.Notes, fmt.Sprintf("exchange rate: %s %s/%s", strings.TrimSpace(x.Rate), x.Source, x.Target))
+			break
+		}
+	}
+
+	chrgs := td.Charges
+	if len(chrgs) == 0 {
+		chrgs = entryCharges
+	}
+	fees, err := includedFees(chrgs, m.currency)
+	if err != nil {
+		return errors.Wrap(err, "includedFees()")
+	}
+
+	t.Postings = []*importer.Posting{{Account: account, Amount: c.format(m)}}
+	// whatever isn't fees went to (or came from) the other side
+	rest := &money{q: new(big.Rat).Neg(m.q), prec: m.prec, currency: m.currency}
+	if fees != nil {
+		t.Postings = append(t.Postings, &importer.Posting{Account: c.FeeAccount, Amount: c.format(fees)})
+		rest.q.Sub(rest.q, fees.q)
+		rest.prec = max(rest.prec, fees.prec)
+	}
+
+	other := &importer.Posting{Account: c.otherAccount(m)}
+	if instd := ad.Instructed.Amount; instd != nil && instd.Currency != "" && instd.Currency != m.currency && rest.q.Sign() != 0 {
+		// the transaction was in another currency, so record what it was, and
+		// what it cost
+		foreign, err := parseMoney(instd, "CRDT", "")
+		if err != nil {
+			return errors.Wrap(err, "parseMoney(InstdAmt)")
+		}
+		if rest.q.Sign() < 0 {
+			foreign.q.Neg(foreign.q)
+		}
+		cost := &money{q: new(big.Rat).Abs(rest.q), prec: rest.prec, currency: rest.currency}
+		other.Amount = c.format(foreign) + " @@ " + c.format(cost)
+	}
+	t.Postings = append(t.Postings, other)
+	c.transactions = append(c.transactions, t)
+	return nil
+}
+
+func (c *converter) otherAccount(m *money) string {
+	if m.q.Sign() > 0 {
+		return c.IncomeAccount
+	}
+	return c.ExpenseAccount
+}
+
+// batchAmounts returns the amounts of a batch entry's transactions, if they
+// all have one, in the entry's currency, that add up to the entry's amount
+// total.
+func batchAmounts(details []*transactionDetails, creditDebit string, total *money) ([]*money, bool) {
+	var amounts []*money
+	sum := new(big.Rat)
+	for _, td := range details {
+		a := td.Amount
+		if a == nil {
+			a = td.AmountDetails.Transaction.Amount
+		}
+		if a == nil {
+			return nil, false
+		}
+		cd := td.CreditDebit
+		if cd == "" {
+			cd = creditDebit
+		}
+		m, err := parseMoney(a, cd, total.currency)
+		if err != nil || m.currency != total.currency {
+			return nil, false
+		}
+		amounts = append(amounts, m)
+		sum.Add(sum, m.q)
+	}
+	return amounts, sum.Cmp(total.q) == 0
+}
+
+// batchNote describes one of the transactions in a batch.
+func batchNote(td *transactionDetails, sign int) string {
+	name := td.Parties.Debtor.name()
+	if sign < 0 {
+		name = td.Parties.Creditor.name()
+	}
+	var parts []string
+	for _, s := range []string{name, strings.TrimSpace(strings.Join(td.Remittance.Unstructured, " "))} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
+
+// includedFees returns the total of the charges that were taken out of an
+// amount in currency, as an expense, or nil if there aren't any.
+func includedFees(chrgs []*charges, currency string) (*money, error) {
+	var total *money
+	for _, cs := range chrgs {
+		for _, ch := range cs.Records {
+			if ch.Included != nil && !*ch.Included {
+				continue
+			}
+			// a debited charge is an expense
+			cd := "CRDT"
+			if ch.CreditDebit == "CRDT" {
+				cd = "DBIT"
+			}
+			m, err := parseMoney(&ch.Amount, cd, currency)
+			if err != nil {
+				return nil, errors.Wrap(err, "parseMoney(Rcrd)")
+			}
+			if m.currency != currency {
+				continue
+			}
+			if total == nil {
+				total = &money{q: new(big.Rat), currency: currency}
+			}
+			total.q.Add(total.q, m.q)
+			total.prec = max(total.prec, m.prec)
+		}
+	}
+	if total != nil && total.q.Sign() == 0 {
+		return nil, nil
+	}
+	return total, nil
+}
+
+// parseMoney parses a camt amount, which is always positive, negating it if
+// creditDebit is `DBIT`. Amounts without a currency are in defaultCurrency.
+func parseMoney(a *amount, creditDebit, defaultCurrency string) (*money, error) {
+	n := strings.TrimSpace(a.Value)
+	q, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return nil, errors.Errorf("invalid amount %q", a.Value)
+	}
+	switch strings.TrimSpace(creditDebit) {
+	case "CRDT":
+	case "DBIT":
+		q.Neg(q)
+	default:
+		return nil, errors.Errorf("invalid credit/debit indicator %q", creditDebit)
+	}
+	prec := 0
+	if i := strings.IndexByte(n, '.'); i >= 0 {
+		prec = len(n) - i - 1
+	}
+	currency := strings.TrimSpace(a.Currency)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	return &money{q: q, prec: prec, currency: currency}, nil
+}
+
+func (c *converter) format(m *money) string {
+	currency := m.currency
+	if s, ok := c.Currencies[currency]; ok {
+		currency = s
+	}
+	return importer.FormatAmount(m.q, m.prec, currency, false)
+}
+
+func dateText(e *entry) string {
+	for _, d := range []*date{&e.BookingDate, &e.ValueDate} {
+		if d.Date != "" {
+			return d.Date
+		}
+		if d.DateTime != "" {
+			return d.DateTime
+		}
+	}
+	return ""
+}
+
+func contains(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"testing"
+
+	"strings"
+)
+
+const camt053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">
+  <BkToCstmrStmt>
+    <GrpHdr><MsgId>M1</MsgId><CreDtTm>2024-01-31T18:00:00</CreDtTm></GrpHdr>
+    <Stmt>
+      <Id>S1</Id>
+      <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>
+      <Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">100.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-01-01</Dt></Dt></Bal>
+      <Ntry>
+        <Amt Ccy="EUR">45.10</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2024-01-05</Dt></BookgDt>
+        <ValDt><Dt>2024-01-04</Dt></ValDt>
+        <AcctSvcrRef>REF1</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <Amt Ccy="EUR">45.10</Amt>
+          <CdtDbtInd>DBIT</CdtDbtInd>
+          <RltdPties><Cdtr><Pty><Nm>Supermarkt GmbH</Nm></Pty></Cdtr></RltdPties>
+          <RmtInf><Ustrd>Einkauf</Ustrd><Ustrd>Filiale 12</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">3000.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><DtTm>2024-01-10T09:30:00+01:00</DtTm></BookgDt>
+        <AcctSvcrRef>REF2</AcctSvcrRef>
+        <AddtlNtryInf>SAMMLER</AddtlNtryInf>
+        <NtryDtls>
+          <Btch><NbOfTxs>2</NbOfTxs></Btch>
+          <TxDtls>
+            <Amt Ccy="EUR">1000.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+            <RltdPties><Cdtr><Pty><Nm>Alice</Nm></Pty></Cdtr></RltdPties>
+            <RmtInf><Ustrd>Salary January</Ustrd></RmtInf>
+          </TxDtls>
+          <TxDtls>
+            <Amt Ccy="EUR">2000.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+            <RltdPties><Cdtr><Pty><Nm>Bob</Nm></Pty></Cdtr></RltdPties>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">92.50</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts><Cd>BOOK</Cd></Sts>
+        <BookgDt><Dt>2024-01-12</Dt></BookgDt>
+        <ValDt><Dt>2024-01-12</Dt></ValDt>
+        <AcctSvcrRef>REF3</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <AmtDtls>
+            <InstdAmt><Amt Ccy="USD">100.00</Amt></InstdAmt>
+            <TxAmt><Amt Ccy="EUR">92.50</Amt><CcyXchg><SrcCcy>USD</SrcCcy><TrgtCcy>EUR</TrgtCcy><XchgRate>0.9000</XchgRate></CcyXchg></TxAmt>
+          </AmtDtls>
+          <Chrgs><Rcrd><Amt Ccy="EUR">2.50</Amt><CdtDbtInd>DBIT</CdtDbtInd><ChrgInclInd>true</ChrgInclInd></Rcrd></Chrgs>
+          <RltdPties><Cdtr><Pty><Nm>US Shop</Nm></Pty></Cdtr></RltdPties>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">10.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts><Cd>INFO</Cd></Sts>
+        <BookgDt><Dt>2024-01-20</Dt></BookgDt>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+const camt052 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.052.001.02">
+  <BkToCstmrAcctRpt>
+    <Rpt>
+      <Acct><Id><Othr><Id>12345</Id></Othr></Id></Acct>
+      <Ntry>
+        <Amt Ccy="CHF">50</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <RvslInd>true</RvslInd>
+        <Sts>PDNG</Sts>
+        <ValDt><Dt>2024-02-01</Dt></ValDt>
+        <NtryDtls>
+          <TxDtls>
+            <AmtDtls><TxAmt><Amt Ccy="CHF">20</Amt></TxAmt></AmtDtls>
+            <RltdPties><Dbtr><Nm>Carol</Nm></Dbtr></RltdPties>
+          </TxDtls>
+          <TxDtls>
+            <RltdPties><Dbtr><Nm>Dave</Nm></Dbtr></RltdPties>
+            <RmtInf><Ustrd>Refund</Ustrd></RmtInf>
+          </TxDtls>
+        </NtryDtls>
+      </Ntry>
+    </Rpt>
+  </BkToCstmrAcctRpt>
+</Document>
+`
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		im          Importer
+		in          string
+		want        string
+		wantSkipped []string
+	}{
+		{
+			Importer{
+				Accounts:       map[string]string{"DE89370400440532013000": "Assets:Giro"},
+				Currencies:     map[string]string{"EUR": "€"},
+				ExpenseAccount: DefaultExpenseAccount,
+				IncomeAccount:  DefaultIncomeAccount,
+				FeeAccount:     DefaultFeeAccount,
+				IDTag:          DefaultIDTag,
+			},
+			camt053,
+			"2024/01/05=2024/01/04 * Supermarkt GmbH\n    ; import-id: DE89370400440532013000.REF1\n    ; Einkauf Filiale 12\n    Assets:Giro  €-45.10\n    Expenses:Unknown\n\n" +
+				"2024/01/10 * Alice\n    ; import-id: DE89370400440532013000.REF2.1\n    ; Salary January\n    ; SAMMLER\n    Assets:Giro  €-1000.00\n    Expenses:Unknown\n\n" +
+				"2024/01/10 * Bob\n    ; import-id: DE89370400440532013000.REF2.2\n    ; SAMMLER\n    Assets:Giro  €-2000.00\n    Expenses:Unknown\n\n" +
+				"2024/01/12 * US Shop\n    ; import-id: DE89370400440532013000.REF3\n    ; exchange rate: 0.9000 USD/EUR\n    Assets:Giro  €-92.50\n    Expenses:Bank Fees  €2.50\n    Expenses:Unknown  USD 100.00 @@ €90.00\n",
+			[]string{"2024-01-20 CRDT 10.00: status INFO"},
+		},
+		{
+			Importer{ExpenseAccount: DefaultExpenseAccount, IncomeAccount: DefaultIncomeAccount, FeeAccount: DefaultFeeAccount, IDTag: DefaultIDTag},
+			camt052,
+			"2024/02/01 ! Batch of 2 transactions\n    ; import-id: 12345.dd9c4f11c942f2d9\n    ; Carol\n    ; Dave: Refund\n    ; reversal\n    Assets:Bank:12345  CHF 50\n    Income:Unknown\n",
+			nil,
+		},
+	}
+	for i, test := range tests {
+		imp, err := test.im.Convert(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("%d: Convert() = err(%v)", i, err)
+			continue
+		}
+		if imp.Transactions != test.want {
+			t.Errorf("%d: Convert() = %q, want %q", i, imp.Transactions, test.want)
+		}
+		if strings.Join(imp.Skipped, "|") != strings.Join(test.wantSkipped, "|") {
+			t.Errorf("%d: Convert().Skipped = %q, want %q", i, imp.Skipped, test.wantSkipped)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	entry := func(s string) string {
+		return `<Document><BkToCstmrStmt><Stmt><Acct><Id><IBAN>X</IBAN></Id></Acct><Ntry>` + s + `</Ntry></Stmt></BkToCstmrStmt></Document>`
+	}
+	tests := []string{
+		`<Document><GrpHdr/></Document>`,
+		`<Document><BkToCstmrStmt><Stmt>`,
+		entry(`<Amt Ccy="EUR">1</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts>`),
+		entry(`<Amt Ccy="EUR">1</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-13-01</Dt></BookgDt>`),
+		entry(`<Amt Ccy="EUR">1,00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-01</Dt></BookgDt>`),
+		entry(`<Amt Ccy="EUR">1</Amt><CdtDbtInd>X</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-01-01</Dt></BookgDt>`),
+	}
+	im := &Importer{ExpenseAccount: DefaultExpenseAccount, IncomeAccount: DefaultIncomeAccount, FeeAccount: DefaultFeeAccount}
+	for i, test := range tests {
+		if _, err := im.Convert(strings.NewReader(test)); err == nil {
+			t.Errorf("%d: Convert(%q) = nil error, want non-nil", i, test)
+		}
+	}
+}
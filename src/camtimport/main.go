@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/camtimport/lib"
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var (
+	journalPath    = flag.StringP("journal", "j", "", "Journal to add the imported transactions to, in sorted order. Defaults to printing them to stdout.")
+	backups        = flag.IntP("backups", "b", 0, "Number of backup copies of the original journal to keep (as <file>.bak, <file>.bak.1, etc).")
+	accounts       = flag.StringToString("account", nil, "Ledger account for an IBAN (or other account ID), as IBAN=ACCOUNT. Can be repeated. Unlisted accounts are named Assets:Bank:<IBAN>.")
+	currencies     = flag.StringToString("currency", nil, "Symbol to write for an ISO currency code, as CODE=SYMBOL (eg EUR=€). Can be repeated. Unlisted currencies are written as their codes.")
+	expenseAccount = flag.String("expense-account", lib.DefaultExpenseAccount, "Account that withdrawals are balanced against.")
+	incomeAccount  = flag.String("income-account", lib.DefaultIncomeAccount, "Account that deposits are balanced against.")
+	feeAccount     = flag.String("fee-account", lib.DefaultFeeAccount, "Account for bank charges that were taken out of a transaction's amount.")
+	idTag          = flag.String("id-tag", lib.DefaultIDTag, "Metadata tag to store each transaction's bank reference in. Empty to leave IDs out.")
+
+	dedupeMode sorter.DedupeMode
+)
+
+func main() {
+	flag.Var(enumflag.New(&dedupeMode, "dedupeMode", sorter.DedupeModeIDs, enumflag.EnumCaseInsensitive), "dedupe", fmt.Sprintf("What to do with likely duplicate transactions (eg from importing the same statement twice) when adding to a --journal. %q lists them on stderr; %q removes them; %q comments them out.", sorter.DedupeModeIDs[sorter.ReportDuplicates][0], sorter.DedupeModeIDs[sorter.DropDuplicates][0], sorter.DedupeModeIDs[sorter.CommentDuplicates][0]))
+
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	idTags := sorter.DefaultIDTags
+	if *idTag != "" && *idTag != lib.DefaultIDTag {
+		idTags = append([]string{*idTag}, idTags...)
+	}
+	im := &lib.Importer{
+		Accounts:       *accounts,
+		Currencies:     *currencies,
+		ExpenseAccount: *expenseAccount,
+		IncomeAccount:  *incomeAccount,
+		FeeAccount:     *feeAccount,
+		IDTag:          *idTag,
+		Appender: importer.Appender{
+			Sorter: sorter.Sorter{
+				Dedupe: sorter.Dedupe{
+					Mode:       dedupeMode,
+					Days:       sorter.DefaultDedupeDays,
+					Similarity: sorter.DefaultDedupeSimilarity,
+					IDTags:     idTags,
+				},
+			},
+		},
+	}
+
+	imp, err := im.ConvertFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, s := range imp.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped informational entry: %s\n", s)
+	}
+
+	if *journalPath == "" {
+		_, err = io.WriteString(os.Stdout, imp.Transactions)
+	} else {
+		var dups []sorter.Duplicate
+		dups, err = im.AppendFile(imp.Transactions, *journalPath, *backups)
+		for _, d := range dups {
+			fmt.Fprintf(os.Stderr, "%s %s: duplicate of %s %s (%s)\n", d.Transaction.DateText, d.Transaction.Payee, d.Of.DateText, d.Of.Payee, d.Reason)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+}
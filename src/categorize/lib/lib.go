@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+var (
+	// overridable for testing
+	outWriter io.Writer = os.Stdout
+)
+
+const DefaultMinConfidence = 0.6
+
+type Categorizer struct {
+	// UnknownAccounts are the placeholder accounts, like
+	// importer.DefaultUnknownAccounts, whose postings (and their
+	// subaccounts') get categorized.
+	UnknownAccounts []string
+	// Rules are checked before anything learned.
+	Rules []*Rule
+	// MinConfidence is the confidence (from 0 to 1) a learned account needs
+	// to be used. Rules are always used.
+	MinConfidence float64
+
+	// Report only lists the accounts that would be assigned, and Stdout
+	// prints the categorized journal; neither changes the file.
+	Report bool
+	Stdout bool
+
+	// Backups is how many copies of the uncategorized journal to keep when
+	// the file is rewritten.
+	Backups int
+
+	model *model
+}
+
+// Assignment is an account chosen for an uncategorized posting.
+type Assignment struct {
+	Transaction *journal.Transaction
+	Posting     *journal.Posting
+	// Account is the chosen account, or the best guess if it wasn't
+	// confident enough to be used. It's empty if there was no guess at all.
+	Account string
+	// Method is how the account was chosen: ByRule, ByExact or ByBayes.
+	Method     string
+	Confidence float64
+	// Applied is set if the posting was (or, in Report mode, would be)
+	// changed to Account.
+	Applied bool
+}
+
+// LearnFile learns from the categorized transactions in the journal at
+// path.
+func (c *Categorizer) LearnFile(path string) error {
+	j, err := journal.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "journal.ReadFile(%s)", path)
+	}
+	c.Learn(j)
+	return nil
+}
+
+// Learn learns from the categorized transactions in j: those with exactly
+// two real postings, to different accounts, neither of which is an unknown
+// account. Each one teaches both which account goes with the first posting,
+// and which goes with the second.
+func (c *Categorizer) Learn(j *journal.Journal) {
+	if c.model == nil {
+		c.model = newModel()
+	}
+	for _, t := range j.Transactions() {
+		real := realPostings(t)
+		if len(real) != 2 || real[0].Account == real[1].Account {
+			continue
+		}
+		if c.unknown(real[0].Account) || c.unknown(real[1].Account) {
+			continue
+		}
+		c.model.add(t.Payee, real[0].Account, real[1].Account)
+		c.model.add(t.Payee, real[1].Account, real[0].Account)
+	}
+}
+
+// CategorizeFile learns from the journal at path (on top of anything
+// already learned), and then assigns accounts to its uncategorized
+// postings. It returns an assignment for every uncategorized transaction,
+// including the ones that were left alone.
+func (c *Categorizer) CategorizeFile(path string) ([]*Assignment, error) {
+	j, err := journal.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "journal.ReadFile(%s)", path)
+	}
+	c.Learn(j)
+
+	as := c.categorize(j)
+	if c.Report {
+		for _, a := range as {
+			if _, err := fmt.Fprintln(outWriter, a); err != nil {
+				return nil, errors.Wrap(err, "fmt.Fprintln()")
+			}
+		}
+		return as, nil
+	}
+
+	if c.Stdout {
+		_, err := io.WriteString(outWriter, j.String())
+		return as, errors.Wrap(err, "io.WriteString()")
+	}
+	applied := false
+	for _, a := range as {
+		applied = applied || a.Applied
+	}
+	if !applied {
+		return as, nil
+	}
+	return as, errors.Wrapf(fs.WriteFileAtomic(path, []byte(j.String()), 0644, c.Backups), "fs.WriteFileAtomic(%s)", path)
+}
+
+// categorize picks accounts for the uncategorized transactions in j, and
+// rewrites their postings if they're confident enough. Uncategorized
+// transactions are the ones with exactly one posting to an unknown account,
+// and one other real posting.
+func (c *Categorizer) categorize(j *journal.Journal) []*Assignment {
+	if c.model == nil {
+		c.model = newModel()
+	}
+	var as []*Assignment
+	for _, t := range j.Transactions() {
+		var known, unknown []*journal.Posting
+		for _, p := range realPostings(t) {
+			if c.unknown(p.Account) {
+				unknown = append(unknown, p)
+			} else {
+				known = append(known, p)
+			}
+		}
+		if len(known) != 1 || len(unknown) != 1 {
+			continue
+		}
+
+		a := &Assignment{Transaction: t, Posting: unknown[0]}
+		as = append(as, a)
+		from := known[0].Account
+		for _, r := range c.Rules {
+			if r.Account != from && r.matches(t.Payee, from) {
+				a.Account, a.Method, a.Confidence = r.Account, ByRule, 1
+				break
+			}
+		}
+		if a.Account == "" {
+			a.Account, a.Method, a.Confidence = c.model.predict(t.Payee, from)
+		}
+		if a.Account == "" || (a.Method != ByRule && a.Confidence < c.MinConfidence) {
+			continue
+		}
+		a.Applied = true
+		i := a.Posting.Line - t.Line
+		t.Raw[i] = replaceAccount(t.Raw[i], a.Posting.Account, a.Account)
+	}
+	return as
+}
+
+func (c *Categorizer) unknown(account string) bool {
+	return importer.InAccounts(account, c.UnknownAccounts)
+}
+
+func realPostings(t *journal.Transaction) []*journal.Posting {
+	var ret []*journal.Posting
+	for _, p := range t.Postings {
+		if p.Type == journal.Real {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// replaceAccount replaces the account old in a posting line with new,
+// keeping the amount after it in the same column if there's room.
+func replaceAccount(line, old, new string) string {
+	i := strings.Index(line, old)
+	if i < 0 {
+		return line
+	}
+	rest := line[i+len(old):]
+	gap := len(rest) - len(strings.TrimLeft(rest, " "))
+	if gap >= 2 && gap < len(rest) {
+		// there's an amount (or a comment) after the account
+		gap = max(2, gap+len(old)-len(new))
+		rest = strings.Repeat(" ", gap) + strings.TrimLeft(rest, " ")
+	}
+	return line[:i] + new + rest
+}
+
+func (a *Assignment) String() string {
+	t := a.Transaction
+	prefix := fmt.Sprintf("%d: %s %s (%s)", a.Posting.Line, t.Date.Format(journal.DateFormat), t.Payee, a.Posting.Account)
+	switch {
+	case a.Account == "":
+		return prefix + ": no match"
+	case !a.Applied:
+		return fmt.Sprintf("%s: not confident enough in %s (%s, %.2f)", prefix, a.Account, a.Method, a.Confidence)
+	}
+	return fmt.Sprintf("%s -> %s (%s, %.2f)", prefix, a.Account, a.Method, a.Confidence)
+}
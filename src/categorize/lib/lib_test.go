@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"testing"
+
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/prashantv/gostub"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+)
+
+const training = `2024/01/01 LOBLAWS #123
+    Expenses:Groceries  $50.00
+    Assets:Chequing
+
+2024/01/08 LOBLAWS #456
+    Expenses:Groceries  $40.00
+    Liabilities:Visa
+
+2024/01/03 Shell Gas Station 77
+    Expenses:Fuel  $30.00
+    Liabilities:Visa
+
+2024/01/05 Esso Gas
+    Expenses:Fuel  $25.00
+    Liabilities:Visa
+
+2024/01/06 Payroll ACME
+    Assets:Chequing  $2000.00
+    Income:Salary
+`
+
+const categorizeTest = `2024/02/01 LOBLAWS #999
+    Liabilities:Visa  $-12.00
+    Expenses:Unknown
+
+2024/02/02 Petro Gas
+    Liabilities:Visa         $-20.00
+    Expenses:Unknown          $20.00  ; note
+
+2024/02/03 Mystery Store
+    Assets:Chequing  $-5
+    Expenses:Unknown
+
+2024/02/04 Netflix.com
+    ; import-id: abc
+    Liabilities:Visa  $-15
+    Expenses:Unknown
+
+2024/02/05 1234
+    Assets:Chequing  $1
+    Income:Unknown
+
+2024/02/06 Split
+    Assets:Chequing  $-1
+    Expenses:Unknown
+    Expenses:Food  $0.50
+`
+
+const categorizeTestWant = `2024/02/01 LOBLAWS #999
+    Liabilities:Visa  $-12.00
+    Expenses:Groceries
+
+2024/02/02 Petro Gas
+    Liabilities:Visa         $-20.00
+    Expenses:Fuel             $20.00  ; note
+
+2024/02/03 Mystery Store
+    Assets:Chequing  $-5
+    Expenses:Unknown
+
+2024/02/04 Netflix.com
+    ; import-id: abc
+    Liabilities:Visa  $-15
+    Expenses:Subscriptions
+
+2024/02/05 1234
+    Assets:Chequing  $1
+    Income:Unknown
+
+2024/02/06 Split
+    Assets:Chequing  $-1
+    Expenses:Unknown
+    Expenses:Food  $0.50
+`
+
+const categorizeTestReport = `3: 2024/02/01 LOBLAWS #999 (Expenses:Unknown) -> Expenses:Groceries (exact, 1.00)
+7: 2024/02/02 Petro Gas (Expenses:Unknown) -> Expenses:Fuel (bayes, 0.61)
+11: 2024/02/03 Mystery Store (Expenses:Unknown): not confident enough in Expenses:Groceries (bayes, 0.45)
+16: 2024/02/04 Netflix.com (Expenses:Unknown) -> Expenses:Subscriptions (rule, 1.00)
+20: 2024/02/05 1234 (Income:Unknown): no match
+`
+
+func TestCategorizeFile(t *testing.T) {
+	rules := []*Rule{{Payee: "(?i)netflix", Account: "Expenses:Subscriptions"}}
+	tests := []struct {
+		c        Categorizer
+		wantFile string
+		wantOut  string
+	}{
+		{Categorizer{UnknownAccounts: importer.DefaultUnknownAccounts, Rules: rules, MinConfidence: DefaultMinConfidence}, categorizeTestWant, ""},
+		{Categorizer{UnknownAccounts: importer.DefaultUnknownAccounts, Rules: rules, MinConfidence: DefaultMinConfidence, Report: true}, categorizeTest, categorizeTestReport},
+		{Categorizer{UnknownAccounts: importer.DefaultUnknownAccounts, Rules: rules, MinConfidence: DefaultMinConfidence, Stdout: true}, categorizeTest, categorizeTestWant},
+	}
+	for i, test := range tests {
+		stubs := gostub.New()
+		var b bytes.Buffer
+		stubs.Stub(&outWriter, &b)
+
+		dir := t.TempDir()
+		trainingPath := filepath.Join(dir, "training.ledger")
+		path := filepath.Join(dir, "test.ledger")
+		if err := ioutil.WriteFile(trainingPath, []byte(training), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(categorizeTest), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+
+		if err := test.c.LearnFile(trainingPath); err != nil {
+			t.Fatalf("%d: LearnFile() = err(%v)", i, err)
+		}
+		as, err := test.c.CategorizeFile(path)
+		if err != nil {
+			t.Errorf("%d: CategorizeFile() = err(%v)", i, err)
+		}
+		if len(as) != 5 {
+			t.Errorf("%d: CategorizeFile() = %d assignments, want 5", i, len(as))
+		}
+		if got, err := ioutil.ReadFile(path); err != nil || string(got) != test.wantFile {
+			t.Errorf("%d: CategorizeFile() left file as %q (err(%v)), want %q", i, got, err, test.wantFile)
+		}
+		if b.String() != test.wantOut {
+			t.Errorf("%d: CategorizeFile() printed %q, want %q", i, b.String(), test.wantOut)
+		}
+
+		stubs.Reset()
+	}
+}
+
+func TestPayeeWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"LOBLAWS #1234 TORONTO", "loblaws toronto"},
+		{"Amazon.ca*AB12CD", "amazon ca"},
+		{"2024-01-05", ""},
+		{"Café Crème", "café crème"},
+	}
+	for _, test := range tests {
+		if got := exactKey("", payeeWords(test.in)); got != "\x1f"+test.want {
+			t.Errorf("payeeWords(%q) = %q, want %q", test.in, got[1:], test.want)
+		}
+	}
+}
+
+func TestReplaceAccount(t *testing.T) {
+	tests := []struct {
+		line, old, new string
+		want           string
+	}{
+		{"    Expenses:Unknown", "Expenses:Unknown", "Expenses:Food", "    Expenses:Food"},
+		{"    Expenses:Unknown    $5", "Expenses:Unknown", "Expenses:Food", "    Expenses:Food       $5"},
+		{"    Expenses:Unknown    $5", "Expenses:Unknown", "Expenses:Entertainment", "    Expenses:Entertainment  $5"},
+		{"    * Expenses:Unknown\t$5", "Expenses:Unknown", "Expenses:Food", "    * Expenses:Food\t$5"},
+		{"    Expenses:Unknown ; note", "Expenses:Unknown", "Expenses:Food", "    Expenses:Food ; note"},
+	}
+	for _, test := range tests {
+		if got := replaceAccount(test.line, test.old, test.new); got != test.want {
+			t.Errorf("replaceAccount(%q, %q, %q) = %q, want %q", test.line, test.old, test.new, got, test.want)
+		}
+	}
+}
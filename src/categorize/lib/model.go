@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Methods an account can be chosen by, from most to least certain.
+const (
+	ByRule  = "rule"
+	ByExact = "exact"
+	ByBayes = "bayes"
+)
+
+// model learns which account the other side of a two-posting transaction
+// goes to, from its payee and the account of the side that's known.
+type model struct {
+	// exact counts the accounts seen for each payee key, both with and without
+	// the known account (see exactKey).
+	exact map[string]map[string]int
+	// classes are the naive Bayes classes, by account.
+	classes map[string]*class
+	vocab   map[string]bool
+	total   int
+}
+
+type class struct {
+	n       int
+	tokens  map[string]int
+	nTokens int
+}
+
+func newModel() *model {
+	return &model{
+		exact:   make(map[string]map[string]int),
+		classes: make(map[string]*class),
+		vocab:   make(map[string]bool),
+	}
+}
+
+// add learns that a transaction with payee, and a posting to from, had its
+// other posting to account.
+func (m *model) add(payee, from, account string) {
+	words := payeeWords(payee)
+	if len(words) == 0 {
+		return
+	}
+	for _, k := range []string{exactKey(from, words), exactKey("", words)} {
+		if m.exact[k] == nil {
+			m.exact[k] = make(map[string]int)
+		}
+		m.exact[k][account]++
+	}
+
+	c := m.classes[account]
+	if c == nil {
+		c = &class{tokens: make(map[string]int)}
+		m.classes[account] = c
+	}
+	c.n++
+	m.total++
+	for _, t := range features(from, words) {
+		c.tokens[t]++
+		c.nTokens++
+		m.vocab[t] = true
+	}
+}
+
+// predict returns the most likely account for the other side of a
+// transaction with payee and a posting to from, how it was chosen, and how
+// confident it is (from 0 to 1). It returns an empty account if nothing
+// similar has been seen.
+func (m *model) predict(payee, from string) (account, method string, confidence float64) {
+	words := payeeWords(payee)
+	if len(words) == 0 {
+		return "", "", 0
+	}
+	for _, k := range []string{exactKey(from, words), exactKey("", words)} {
+		if a, conf := best(m.exact[k], from); a != "" {
+			return a, ByExact, conf
+		}
+	}
+
+	// naive Bayes over the payee's words and the known account, with
+	// add-one smoothing
+	type score struct {
+		account string
+		logP    float64
+	}
+	var scores []score
+	fs := features(from, words)
+	known := false
+	for _, f := range fs {
+		known = known || m.vocab[f]
+	}
+	if !known {
+		return "", "", 0
+	}
+	for a, c := range m.classes {
+		if a == from {
+			continue
+		}
+		logP := math.Log(float64(c.n) / float64(m.total))
+		for _, f := range fs {
+			logP += math.Log(float64(c.tokens[f]+1) / float64(c.nTokens+len(m.vocab)))
+		}
+		scores = append(scores, score{a, logP})
+	}
+	if len(scores) == 0 {
+		return "", "", 0
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].logP != scores[j].logP {
+			return scores[i].logP > scores[j].logP
+		}
+		return scores[i].account < scores[j].account
+	})
+	sum := 0.0
+	for _, s := range scores {
+		sum += math.Exp(s.logP - scores[0].logP)
+	}
+	return scores[0].account, ByBayes, 1 / sum
+}
+
+// best returns the most common account in counts other than exclude, and
+// the fraction of all the counts it has.
+func best(counts map[string]int, exclude string) (string, float64) {
+	account, n, total := "", 0, 0
+	for a, c := range counts {
+		if a == exclude {
+			continue
+		}
+		total += c
+		if c > n || (c == n && a < account) {
+			account, n = a, c
+		}
+	}
+	if total == 0 {
+		return "", 0
+	}
+	return account, float64(n) / float64(total)
+}
+
+func exactKey(from string, words []string) string {
+	return from + "\x1f" + strings.Join(words, " ")
+}
+
+func features(from string, words []string) []string {
+	return append(append([]string(nil), words...), "account:"+from)
+}
+
+// payeeWords splits a payee into lower-case words, leaving out anything
+// with digits in it (like store numbers and dates), which would make the
+// same payee look different every time.
+func payeeWords(payee string) []string {
+	var words []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(payee), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			continue
+		}
+		words = append(words, w)
+	}
+	return words
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Rule assigns an account to transactions whose payee matches a regular
+// expression. Rules are read from a JSON file (see LoadRules), and are
+// checked in order before anything learned.
+type Rule struct {
+	// Payee is matched against the transaction's payee. Use `(?i)` to
+	// ignore case.
+	Payee string `json:"payee"`
+	// From, if set, is matched against the account of the known side of the
+	// transaction (eg `^Liabilities:Visa$`).
+	From    string `json:"from,omitempty"`
+	Account string `json:"account"`
+
+	payee *regexp.Regexp
+	from  *regexp.Regexp
+}
+
+// LoadRules reads a JSON list of rules from path.
+func LoadRules(path string) ([]*Rule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	var rules []*Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, errors.Wrapf(err, "json.Unmarshal(%s)", path)
+	}
+	for i, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, errors.Wrapf(err, "%s: rule %d", path, i+1)
+		}
+	}
+	return rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Account == "" {
+		return errors.New("missing account")
+	}
+	var err error
+	if r.payee, err = regexp.Compile(r.Payee); err != nil {
+		return errors.Wrapf(err, "regexp.Compile(%s)", r.Payee)
+	}
+	if r.From != "" {
+		if r.from, err = regexp.Compile(r.From); err != nil {
+			return errors.Wrapf(err, "regexp.Compile(%s)", r.From)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) matches(payee, from string) bool {
+	if r.payee == nil {
+		// not loaded with LoadRules
+		if err := r.compile(); err != nil {
+			return false
+		}
+	}
+	return r.payee.MatchString(payee) && (r.from == nil || r.from.MatchString(from))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/categorize/lib"
+	"github.com/glennhartmann/ledger-tools/src/importer"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	learn           = flag.StringSliceP("learn", "l", nil, "Journals to learn from, on top of the categorized transactions in <file> itself. Can be repeated.")
+	rulesPath       = flag.String("rules", "", "JSON file of payee rules, which are checked before anything learned.")
+	minConfidence   = flag.Float64("min-confidence", lib.DefaultMinConfidence, "Confidence (from 0 to 1) a learned account needs to be used.")
+	unknownAccounts = flag.StringSlice("unknown-accounts", importer.DefaultUnknownAccounts, "Placeholder accounts (and their subaccounts) that uncategorized transactions are balanced against.")
+	report          = flag.Bool("report", false, "Don't modify the file; list the accounts that would be assigned.")
+	stdout          = flag.Bool("stdout", false, "Don't modify the file; print the rewritten journal to stdout.")
+	backups         = flag.IntP("backups", "b", 0, "Number of backup copies of the original file to keep (as <file>.bak, <file>.bak.1, etc).")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+	if *report && *stdout {
+		fmt.Fprintf(os.Stderr, "--report and --stdout can't be used together\n")
+		os.Exit(1)
+	}
+
+	c := &lib.Categorizer{
+		UnknownAccounts: *unknownAccounts,
+		MinConfidence:   *minConfidence,
+		Report:          *report,
+		Stdout:          *stdout,
+		Backups:         *backups,
+	}
+	if *rulesPath != "" {
+		var err error
+		if c.Rules, err = lib.LoadRules(*rulesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+	}
+	for _, path := range *learn {
+		if err := c.LearnFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	as, err := c.CategorizeFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	if !*report {
+		n := 0
+		for _, a := range as {
+			fmt.Fprintln(os.Stderr, a)
+			if a.Applied {
+				n++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "categorized %d of %d transactions\n", n, len(as))
+	}
+}
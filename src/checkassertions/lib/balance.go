@@ -0,0 +1,261 @@
+package lib
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// Balance is a quantity of each of any number of commodities.
+type Balance map[string]*big.Rat
+
+// Add adds q of commodity to b.
+func (b Balance) Add(commodity string, q *big.Rat) {
+	if cur, ok := b[commodity]; ok {
+		cur.Add(cur, q)
+		return
+	}
+	b[commodity] = new(big.Rat).Set(q)
+}
+
+// AddBalance adds all of o to b.
+func (b Balance) AddBalance(o Balance) {
+	for c, q := range o {
+		b.Add(c, q)
+	}
+}
+
+// Get returns the quantity of commodity in b, which is 0 if there is none.
+func (b Balance) Get(commodity string) *big.Rat {
+	if q, ok := b[commodity]; ok {
+		return q
+	}
+	return new(big.Rat)
+}
+
+// IsZero returns whether b is zero in every commodity.
+func (b Balance) IsZero() bool {
+	for _, q := range b {
+		if q.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Commodities returns the commodities b has a non-zero quantity of, sorted.
+func (b Balance) Commodities() []string {
+	var cs []string
+	for c, q := range b {
+		if q.Sign() != 0 {
+			cs = append(cs, c)
+		}
+	}
+	sort.Strings(cs)
+	return cs
+}
+
+// Balances holds the balance of each account.
+type Balances map[string]Balance
+
+// Add adds o to account's balance.
+func (bs Balances) Add(account string, o Balance) {
+	b, ok := bs[account]
+	if !ok {
+		b = make(Balance)
+		bs[account] = b
+	}
+	b.AddBalance(o)
+}
+
+// Get returns account's balance, including its subaccounts' balances if
+// inclusive is set.
+func (bs Balances) Get(account string, inclusive bool) Balance {
+	b := make(Balance)
+	for a, ab := range bs {
+		if a == account || (inclusive && strings.HasPrefix(a, account+":")) {
+			b.AddBalance(ab)
+		}
+	}
+	return b
+}
+
+// Styles records how each commodity is written, so that computed amounts can
+// be written the same way.
+type Styles map[string]*journal.Amount
+
+// Learn records the style of a (and its lot price), unless its commodity has
+// already been seen, keeping the highest precision.
+func (s Styles) Learn(a *journal.Amount) {
+	if a == nil || a.Quantity == nil {
+		return
+	}
+	s.Learn(a.LotPrice)
+	if style, ok := s[a.Commodity]; ok {
+		style.Precision = max(style.Precision, a.Precision)
+		return
+	}
+	s[a.Commodity] = &journal.Amount{Commodity: a.Commodity, Precision: a.Precision, Prefix: a.Prefix, Spaced: a.Spaced}
+}
+
+// LearnPosting records the styles of all of p's amounts.
+func (s Styles) LearnPosting(p *journal.Posting) {
+	s.Learn(p.Amount)
+	if p.Cost != nil {
+		s.Learn(p.Cost.Amount)
+	}
+	s.Learn(p.Assertion)
+}
+
+// Format writes q of commodity in the commodity's style.
+func (s Styles) Format(commodity string, q *big.Rat) string {
+	precision, prefix, spaced := 0, false, true
+	if style, ok := s[commodity]; ok {
+		precision, prefix, spaced = style.Precision, style.Prefix, style.Spaced
+	}
+	n := q.FloatString(precision)
+	if commodity == "" {
+		return n
+	}
+	sep := ""
+	if spaced {
+		sep = " "
+	}
+	if prefix {
+		return commodity + sep + n
+	}
+	return n + sep + commodity
+}
+
+// FormatBalance writes each commodity in b, or 0 if it's zero.
+func (s Styles) FormatBalance(b Balance) string {
+	cs := b.Commodities()
+	if len(cs) == 0 {
+		return "0"
+	}
+	parts := make([]string, 0, len(cs))
+	for _, c := range cs {
+		parts = append(parts, s.Format(c, b[c]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PostingAmounts returns the amount of each of t's postings, where accounts
+// holds their accounts and bs the balances before t. Postings without amounts
+// are either balance assignments (with a balance assertion), which get
+// whatever brings the account to the asserted balance, or balance whatever
+// the rest of the (real or balanced virtual) postings add up to, in as many
+// commodities as it takes. Virtual postings without amounts are zero.
+func PostingAmounts(t *journal.Transaction, accounts []string, bs Balances) ([]Balance, error) {
+	amounts := make([]Balance, len(t.Postings))
+	sums := make(map[journal.PostingType]Balance)
+	elided := make(map[journal.PostingType]int)
+	pending := make(Balances)
+	for i, p := range t.Postings {
+		switch {
+		case p.Amount != nil:
+			if p.Amount.Quantity == nil {
+				return nil, errors.Errorf("line %d: can't evaluate amount %q", p.Line, p.Amount.Text)
+			}
+			amounts[i] = Balance{p.Amount.Commodity: p.Amount.Quantity}
+		case p.Assertion != nil:
+			if p.Assertion.Quantity == nil {
+				return nil, errors.Errorf("line %d: can't evaluate balance assignment %q", p.Line, p.Assertion.Text)
+			}
+			inclusive := strings.HasSuffix(p.AssertionOp, "*")
+			cur := bs.Get(accounts[i], inclusive)
+			cur.AddBalance(pending.Get(accounts[i], inclusive))
+			q := new(big.Rat).Sub(p.Assertion.Quantity, cur.Get(p.Assertion.Commodity))
+			amounts[i] = Balance{p.Assertion.Commodity: q}
+		case p.Type == journal.Virtual:
+			amounts[i] = make(Balance)
+		default:
+			if _, ok := elided[p.Type]; ok {
+				return nil, errors.Errorf("line %d: more than one posting without an amount", p.Line)
+			}
+			elided[p.Type] = i
+			continue
+		}
+		pending.Add(accounts[i], amounts[i])
+
+		if p.Type == journal.Virtual {
+			continue
+		}
+		if _, ok := sums[p.Type]; !ok {
+			sums[p.Type] = make(Balance)
+		}
+		w, err := weight(p, amounts[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", p.Line)
+		}
+		sums[p.Type].AddBalance(w)
+	}
+
+	for typ, i := range elided {
+		amounts[i] = make(Balance)
+		for c, q := range sums[typ] {
+			if q.Sign() != 0 {
+				amounts[i][c] = new(big.Rat).Neg(q)
+			}
+		}
+	}
+	return amounts, nil
+}
+
+// Residuals returns what t's real postings, and separately its balanced
+// virtual postings, add up to, given their amounts from PostingAmounts. Both
+// are zero if t balances.
+func Residuals(t *journal.Transaction, amounts []Balance) (real, virtual Balance, err error) {
+	real, virtual = make(Balance), make(Balance)
+	for i, p := range t.Postings {
+		sum := real
+		switch p.Type {
+		case journal.Virtual:
+			continue
+		case journal.BalancedVirtual:
+			sum = virtual
+		}
+		w, err := weight(p, amounts[i])
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "line %d", p.Line)
+		}
+		sum.AddBalance(w)
+	}
+	return real, virtual, nil
+}
+
+// weight returns what a posting of amount contributes to balancing its
+// transaction: its cost, if it has one, and its amount otherwise.
+func weight(p *journal.Posting, amount Balance) (Balance, error) {
+	var per *journal.Amount
+	total := false
+	switch {
+	case p.Cost != nil:
+		per, total = p.Cost.Amount, p.Cost.Total
+	case p.Amount != nil && p.Amount.LotPrice != nil:
+		per = p.Amount.LotPrice
+	default:
+		return amount, nil
+	}
+	if per.Quantity == nil {
+		return nil, errors.Errorf("can't evaluate price %q", per.Text)
+	}
+
+	w := make(Balance)
+	for _, q := range amount {
+		if total {
+			c := new(big.Rat).Abs(per.Quantity)
+			if q.Sign() < 0 {
+				c.Neg(c)
+			}
+			w.Add(per.Commodity, c)
+		} else {
+			w.Add(per.Commodity, new(big.Rat).Mul(per.Quantity, q))
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+type Checker struct {
+	// All makes CheckFile carry on after the first failing assertion and
+	// return every failure.
+	All bool
+}
+
+// Failure is a balance assertion (or `balance` directive) that doesn't hold.
+type Failure struct {
+	Path    string
+	Line    int
+	Date    time.Time
+	Account string
+	// Assertion is the assertion as written, eg `= $100.00`.
+	Assertion string
+	Expected  string
+	Actual    string
+	// Since is the location of the previous assertion on Account (or "" if
+	// there wasn't one), and Contributions are the postings to Account (or
+	// its subaccounts, for an assertion that includes them) after it.
+	Since         string
+	Contributions []*Contribution
+}
+
+func (f *Failure) String() string {
+	lines := []string{fmt.Sprintf("%s:%d: %s %s %s: expected %s, but the balance is %s", f.Path, f.Line, f.Date.Format(journal.DateFormat), f.Account, f.Assertion, f.Expected, f.Actual)}
+	since := "the start"
+	if f.Since != "" {
+		since = f.Since
+	}
+	if len(f.Contributions) == 0 {
+		lines = append(lines, fmt.Sprintf("    no transactions since %s", since))
+	} else {
+		lines = append(lines, fmt.Sprintf("    transactions since %s:", since))
+	}
+	for _, c := range f.Contributions {
+		lines = append(lines, "    "+c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Contribution is a posting that contributed to a failing assertion's
+// balance.
+type Contribution struct {
+	Path    string
+	Line    int
+	Date    time.Time
+	Payee   string
+	Account string
+	Amount  string
+}
+
+func (c *Contribution) String() string {
+	return fmt.Sprintf("%s:%d: %s %s  %s  %s", c.Path, c.Line, c.Date.Format(journal.DateFormat), c.Payee, c.Account, c.Amount)
+}
+
+// entry is a transaction or `balance` directive to apply, in order.
+type entry struct {
+	path     string
+	t        *journal.Transaction
+	accounts []string
+	balance  *balanceDirective
+}
+
+// balanceDirective is a `DATE balance ACCOUNT AMOUNT` directive, which is
+// written (and parsed) like a transaction without postings.
+type balanceDirective struct {
+	account string
+	amount  *journal.Amount
+}
+
+// posting is an applied posting, kept for reporting contributions.
+type posting struct {
+	e       *entry
+	line    int
+	account string
+	amount  Balance
+}
+
+// state is the running state of CheckFile.
+type state struct {
+	balances Balances
+	styles   Styles
+	// postings holds every posting applied so far, in order
+	postings []*posting
+	// last holds the index into postings and the location of each account's
+	// last assertion
+	last map[string]lastAssertion
+}
+
+type lastAssertion struct {
+	postings int
+	loc      string
+}
+
+// CheckFile loads the journal at path (and everything it includes), and
+// checks every balance assertion and `balance` directive in it, in date
+// order. It returns the number of assertions checked, and those that failed:
+// only the first one, unless All is set.
+//
+// Transactions are applied in order of their (primary) date. On any one
+// date, `balance` directives are checked first, as of the start of the day,
+// and then transactions are applied in the order they're loaded in, which is
+// the order they appear in their files, with included files in place of
+// their `include` directives.
+func (c *Checker) CheckFile(path string) (int, []*Failure, error) {
+	blocks, err := Load(path)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "Load(%s)", path)
+	}
+
+	s := &state{
+		balances: make(Balances),
+		styles:   make(Styles),
+		last:     make(map[string]lastAssertion),
+	}
+	var entries []*entry
+	for _, b := range blocks {
+		t, ok := b.Block.(*journal.Transaction)
+		if !ok {
+			continue
+		}
+		e := &entry{path: b.Path, t: t, accounts: b.Accounts}
+		if e.balance, err = parseBalanceDirective(t); err != nil {
+			return 0, nil, errors.Wrapf(err, "%s:%d", b.Path, t.StartLine())
+		}
+		if e.balance != nil {
+			s.styles.Learn(e.balance.amount)
+		}
+		for _, p := range t.Postings {
+			s.styles.LearnPosting(p)
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.t.Date.Equal(b.t.Date) {
+			return a.t.Date.Before(b.t.Date)
+		}
+		return a.balance != nil && b.balance == nil
+	})
+
+	checked := 0
+	var failures []*Failure
+	for _, e := range entries {
+		fs, n, err := s.apply(e)
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "%s:%d", e.path, e.t.StartLine())
+		}
+		checked += n
+		failures = append(failures, fs...)
+		if len(failures) > 0 && !c.All {
+			return checked, failures[:1], nil
+		}
+	}
+	return checked, failures, nil
+}
+
+// parseBalanceDirective returns the `balance` directive t is, or nil if it
+// isn't one. The account ends at two spaces or a tab, like in a posting, or
+// otherwise at the first space.
+func parseBalanceDirective(t *journal.Transaction) (*balanceDirective, error) {
+	rest, ok := strings.CutPrefix(t.Payee, "balance ")
+	if !ok || len(t.Postings) > 0 {
+		return nil, nil
+	}
+	rest = strings.TrimSpace(rest)
+	end := strings.Index(rest, "  ")
+	if i := strings.IndexByte(rest, '\t'); i >= 0 && (end < 0 || i < end) {
+		end = i
+	}
+	if end < 0 {
+		end = strings.IndexByte(rest, ' ')
+	}
+	if end < 0 {
+		return nil, errors.Errorf("balance directive %q without an amount", t.Payee)
+	}
+	a, err := journal.ParseAmount(rest[end:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "journal.ParseAmount(%s)", rest[end:])
+	}
+	if a.Quantity == nil {
+		return nil, errors.Errorf("can't evaluate amount %q", a.Text)
+	}
+	return &balanceDirective{account: rest[:end], amount: a}, nil
+}
+
+// apply applies e to the balances, returning any failed assertions and the
+// number checked.
+func (s *state) apply(e *entry) ([]*Failure, int, error) {
+	loc := fmt.Sprintf("%s:%d", e.path, e.t.StartLine())
+	if e.balance != nil {
+		f := s.check(e, e.t.StartLine(), e.balance.account, "balance "+e.balance.amount.Text, e.balance.amount, "=*", loc)
+		if f != nil {
+			return []*Failure{f}, 1, nil
+		}
+		return nil, 1, nil
+	}
+
+	amounts, err := PostingAmounts(e.t, e.accounts, s.balances)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "PostingAmounts()")
+	}
+	var failures []*Failure
+	n := 0
+	for i, p := range e.t.Postings {
+		account := e.accounts[i]
+		s.balances.Add(account, amounts[i])
+		if !amounts[i].IsZero() {
+			s.postings = append(s.postings, &posting{e: e, line: p.Line, account: account, amount: amounts[i]})
+		}
+		if p.Assertion == nil || p.Amount == nil {
+			// balance assignments hold by definition
+			continue
+		}
+		if p.Assertion.Quantity == nil {
+			return nil, 0, errors.Errorf("line %d: can't evaluate balance assertion %q", p.Line, p.Assertion.Text)
+		}
+		n++
+		assertion := p.AssertionOp + " " + p.Assertion.Text
+		if f := s.check(e, p.Line, account, assertion, p.Assertion, p.AssertionOp, fmt.Sprintf("%s:%d", e.path, p.Line)); f != nil {
+			failures = append(failures, f)
+		}
+	}
+	return failures, n, nil
+}
+
+// check checks that account's balance matches want, returning a Failure if it
+// doesn't. op is the assertion's operator: `=` checks only want's commodity,
+// or every commodity if want is a plain 0, `==` also checks that the account
+// has nothing else, and with a `*` subaccounts are included.
+func (s *state) check(e *entry, line int, account, assertion string, want *journal.Amount, op, loc string) *Failure {
+	inclusive := strings.HasSuffix(op, "*")
+	only := strings.HasPrefix(op, "==")
+	all := want.Commodity == "" && want.Quantity.Sign() == 0
+
+	b := s.balances.Get(account, inclusive)
+	got := b.Get(want.Commodity)
+	ok := got.Cmp(want.Quantity) == 0
+	if all || only {
+		rest := make(Balance)
+		for c, q := range b {
+			if c != want.Commodity {
+				rest[c] = q
+			}
+		}
+		ok = ok && rest.IsZero()
+	}
+
+	last := s.last[account]
+	s.last[account] = lastAssertion{postings: len(s.postings), loc: loc}
+	if ok {
+		return nil
+	}
+
+	f := &Failure{
+		Path:      e.path,
+		Line:      line,
+		Date:      e.t.Date,
+		Account:   account,
+		Assertion: assertion,
+		Expected:  s.styles.Format(want.Commodity, want.Quantity),
+		Actual:    s.styles.Format(want.Commodity, got),
+		Since:     last.loc,
+	}
+	if all || only {
+		f.Actual = s.styles.FormatBalance(b)
+	}
+	for _, p := range s.postings[last.postings:] {
+		if p.account != account && (!inclusive || !strings.HasPrefix(p.account, account+":")) {
+			continue
+		}
+		if !all && !only && p.amount.Get(want.Commodity).Sign() == 0 {
+			continue
+		}
+		f.Contributions = append(f.Contributions, &Contribution{
+			Path:    p.e.path,
+			Line:    p.line,
+			Date:    p.e.t.Date,
+			Payee:   p.e.t.Payee,
+			Account: p.account,
+			Amount:  s.styles.FormatBalance(p.amount),
+		})
+	}
+	return f
+}
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// main.ledger includes the per-account files, which are each in date order
+// but whose assertions only hold when they're interleaved.
+var checkTestFiles = map[string]string{
+	"main.ledger": `alias Chq=Assets:Chequing
+
+include accounts/*.ledger
+
+2024/01/31 balance Assets  $1,020.00
+2024/02/01 balance Liabilities:Visa 0
+`,
+	"accounts/chequing.ledger": `2024/01/01 Opening
+    Chq                $1,000.00
+    Equity:Opening
+
+2024/01/20 Pay Visa
+    Chq                  $-20.00 = $980.00
+    Liabilities:Visa
+
+2024/01/21 Interest
+    Chq
+    Income:Interest      $-0.05
+
+2024/01/22 Adjust
+    Chq                          = $980.00
+    Income:Misc
+`,
+	"accounts/visa.ledger": `2024/01/15 Groceries
+    Expenses:Food         $20.00
+    Liabilities:Visa     $-20.00 == $-20.00
+
+2024/01/20 Shares
+    Assets:Brokerage      5 AAPL @ $10.00
+    Liabilities:Visa     $-50.00 = $-70.00
+
+2024/01/25 Refund
+    Liabilities:Visa      $10.00
+    Income:Refunds
+`,
+	"apply.ledger":  "apply account Assets\n2024/01/01 x\n    Cash  $5\n    Bank\nend apply account\n\n2024/01/02 y\n    Assets:Cash  $1 = $6\n    Equity\n",
+	"cycle.ledger":  "include cycle.ledger\n",
+	"expr.ledger":   "2024/01/01 x\n    a  ($1 * 2)\n    b\n",
+	"two.ledger":    "2024/01/01 x\n    a  $1\n    b\n    c\n",
+	"nobal.ledger":  "2024/01/01 balance Assets\n",
+	"single.ledger": "2024/01/01 x\n    Assets:Cash  100 EUR\n    Equity\n\n2024/01/02 balance Assets 100 EUR\n2024/01/02 balance Assets 100 USD\n",
+}
+
+const checkTestWantFirst = `DIR/accounts/visa.ledger:7: 2024/01/20 Liabilities:Visa = $-70.00: expected $-70.00, but the balance is $-50.00
+    transactions since DIR/accounts/visa.ledger:3:
+    DIR/accounts/chequing.ledger:7: 2024/01/20 Pay Visa  Liabilities:Visa  $20.00
+    DIR/accounts/visa.ledger:7: 2024/01/20 Shares  Liabilities:Visa  $-50.00`
+
+const checkTestWantAll = checkTestWantFirst + `
+DIR/main.ledger:5: 2024/01/31 Assets balance $1,020.00: expected $1020.00, but the balance is $980.00
+    transactions since the start:
+    DIR/accounts/chequing.ledger:2: 2024/01/01 Opening  Assets:Chequing  $1000.00
+    DIR/accounts/chequing.ledger:6: 2024/01/20 Pay Visa  Assets:Chequing  $-20.00
+    DIR/accounts/chequing.ledger:10: 2024/01/21 Interest  Assets:Chequing  $0.05
+    DIR/accounts/chequing.ledger:14: 2024/01/22 Adjust  Assets:Chequing  $-0.05
+DIR/main.ledger:6: 2024/02/01 Liabilities:Visa balance 0: expected 0, but the balance is $-40.00
+    transactions since DIR/accounts/visa.ledger:7:
+    DIR/accounts/visa.ledger:10: 2024/01/25 Refund  Liabilities:Visa  $10.00`
+
+func TestCheckFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range checkTestFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() = err(%v)", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+	}
+
+	tests := []struct {
+		c           Checker
+		file        string
+		wantChecked int
+		want        string
+		wantErr     bool
+	}{
+		{Checker{}, "main.ledger", 3, checkTestWantFirst, false},
+		{Checker{All: true}, "main.ledger", 5, checkTestWantAll, false},
+		{Checker{All: true}, "single.ledger", 2, "DIR/single.ledger:6: 2024/01/02 Assets balance 100 USD: expected 100 USD, but the balance is 0 USD\n    no transactions since DIR/single.ledger:5", false},
+		{Checker{}, "accounts/chequing.ledger", 1, "", false},
+		{Checker{}, "apply.ledger", 1, "", false},
+		{Checker{}, "cycle.ledger", 0, "", true},
+		{Checker{}, "expr.ledger", 0, "", true},
+		{Checker{}, "two.ledger", 0, "", true},
+		{Checker{}, "nobal.ledger", 0, "", true},
+		{Checker{}, "missing.ledger", 0, "", true},
+	}
+	for i, test := range tests {
+		checked, failures, err := test.c.CheckFile(filepath.Join(dir, test.file))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%d: CheckFile() = err(%v), want non-nil error %v", i, err, test.wantErr)
+			continue
+		}
+		if checked != test.wantChecked {
+			t.Errorf("%d: CheckFile() checked %d assertions, want %d", i, checked, test.wantChecked)
+		}
+		var got []string
+		for _, f := range failures {
+			got = append(got, strings.ReplaceAll(f.String(), dir, "DIR"))
+		}
+		if strings.Join(got, "\n") != test.want {
+			t.Errorf("%d: CheckFile() = %q, want %q", i, strings.Join(got, "\n"), test.want)
+		}
+	}
+}
+
+func TestPostingAmounts(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"2024/01/01 x\n    a  $1\n    b", []string{"$1", "$-1"}},
+		{"2024/01/01 x\n    a  10 AAPL @ $2\n    b  1 EUR\n    c", []string{"10 AAPL", "1 EUR", "$-20, -1 EUR"}},
+		{"2024/01/01 x\n    a  -10 AAPL @@ $25\n    b", []string{"-10 AAPL", "$25"}},
+		{"2024/01/01 x\n    a  2 AAPL {$5}\n    b", []string{"2 AAPL", "$-10"}},
+		{"2024/01/01 x\n    a  $1\n    (c)\n    [d]  $3\n    [e]\n    b", []string{"$1", "0", "$3", "$-3", "$-1"}},
+		{"2024/01/01 x\n    a  = $5\n    b", []string{"$3", "$-3"}},
+		{"2024/01/01 x\n    a:b  =* $5\n    b", []string{"$1", "$-1"}},
+	}
+	for _, test := range tests {
+		j, err := journal.Parse(test.in)
+		if err != nil {
+			t.Fatalf("journal.Parse(%q) = err(%v)", test.in, err)
+		}
+		tr := j.Transactions()[0]
+		s := make(Styles)
+		var accounts []string
+		for _, p := range tr.Postings {
+			accounts = append(accounts, p.Account)
+			s.LearnPosting(p)
+		}
+		bs := Balances{"a": Balance{"$": big.NewRat(2, 1)}, "a:b:c": Balance{"$": big.NewRat(4, 1)}}
+		amounts, err := PostingAmounts(tr, accounts, bs)
+		if err != nil {
+			t.Errorf("PostingAmounts(%q) = err(%v)", test.in, err)
+			continue
+		}
+		var got []string
+		for _, a := range amounts {
+			got = append(got, s.FormatBalance(a))
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("PostingAmounts(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// Block is a block of a journal loaded by Load, along with the file it came
+// from.
+type Block struct {
+	Path  string
+	Block journal.Block
+	// Accounts holds the accounts of a transaction's postings, after any
+	// `alias` and `apply account` directives have been applied.
+	Accounts []string
+}
+
+// loader tracks the state of the directives that change account names, which
+// carries across included files.
+type loader struct {
+	blocks  []*Block
+	aliases map[string]string
+	applied []string
+}
+
+// Load parses the journal at path, replacing `include` directives with the
+// (recursively loaded) blocks of the files they name. As in ledger, relative
+// paths are relative to the including file, and globs are expanded.
+func Load(path string) ([]*Block, error) {
+	l := &loader{aliases: make(map[string]string)}
+	if err := l.load(path, nil); err != nil {
+		return nil, err
+	}
+	return l.blocks, nil
+}
+
+// load loads the journal at path. stack holds the absolute paths of the files
+// currently being loaded, to detect include cycles.
+func (l *loader) load(path string, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrapf(err, "filepath.Abs(%s)", path)
+	}
+	for _, s := range stack {
+		if s == abs {
+			return errors.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	j, err := journal.Parse(strings.TrimSuffix(string(b), "\n"))
+	if err != nil {
+		return errors.Wrapf(err, "journal.Parse(%s)", path)
+	}
+
+	for _, b := range j.Blocks {
+		block := &Block{Path: path, Block: b}
+		switch b := b.(type) {
+		case *journal.Transaction:
+			for _, p := range b.Postings {
+				block.Accounts = append(block.Accounts, l.account(p.Account))
+			}
+		case *journal.Directive:
+			if b.Name == "include" {
+				if err := l.include(path, b, stack); err != nil {
+					return errors.Wrapf(err, "%s:%d", path, b.StartLine())
+				}
+				continue
+			}
+			l.directive(b)
+		}
+		l.blocks = append(l.blocks, block)
+	}
+	return nil
+}
+
+// include loads the files named by the include directive d, which appears in
+// the file at path.
+func (l *loader) include(path string, d *journal.Directive, stack []string) error {
+	pattern := strings.TrimSpace(d.Arg)
+	if pattern == "" {
+		return errors.New("include without a file name")
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(path), pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return errors.Wrapf(err, "filepath.Glob(%s)", pattern)
+	}
+	if len(matches) == 0 {
+		return errors.Errorf("no files match include %q", d.Arg)
+	}
+
+	for _, match := range matches {
+		if err := l.load(match, stack); err != nil {
+			return errors.Wrapf(err, "load(%s)", match)
+		}
+	}
+	return nil
+}
+
+// directive updates the account aliases and prefixes.
+func (l *loader) directive(d *journal.Directive) {
+	switch d.Name {
+	case "alias":
+		if name, value, ok := strings.Cut(d.Arg, "="); ok {
+			l.aliases[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	case "end aliases":
+		l.aliases = make(map[string]string)
+	case "apply account":
+		l.applied = append(l.applied, strings.TrimSpace(d.Arg))
+	default:
+		// other `apply`s (eg `apply year`) are tracked too, so that a plain
+		// `end apply` ends the right one
+		if strings.HasPrefix(d.Name, "apply ") {
+			l.applied = append(l.applied, "")
+		} else if strings.HasPrefix(d.Name, "end apply") && len(l.applied) > 0 {
+			l.applied = l.applied[:len(l.applied)-1]
+		}
+	}
+}
+
+// account returns the full name of an account as written in a posting. An
+// alias applies to the account it names and its subaccounts.
+func (l *loader) account(name string) string {
+	for i := len(l.applied) - 1; i >= 0; i-- {
+		if l.applied[i] != "" {
+			name = l.applied[i] + ":" + name
+		}
+	}
+	for prefix := name; prefix != ""; {
+		if alias, ok := l.aliases[prefix]; ok {
+			return alias + name[len(prefix):]
+		}
+		i := strings.LastIndexByte(prefix, ':')
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return name
+}
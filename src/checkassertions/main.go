@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/checkassertions/lib"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	all = flag.BoolP("all", "a", false, "Report every failing assertion, rather than stopping at the first.")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	c := &lib.Checker{All: *all}
+	checked, failures, err := c.CheckFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, f := range failures {
+		fmt.Println(f)
+	}
+	fmt.Fprintf(os.Stderr, "checked %d assertions, %d failed\n", checked, len(failures))
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+}
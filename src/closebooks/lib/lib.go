@@ -0,0 +1,257 @@
+package lib
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	assertions "github.com/glennhartmann/ledger-tools/src/checkassertions/lib"
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	split "github.com/glennhartmann/ledger-tools/src/journalsplit/lib"
+)
+
+const (
+	DefaultRetainedEarnings = "Equity:RetainedEarnings"
+	DefaultOpeningAccount   = split.DefaultOpeningAccount
+)
+
+var (
+	// DefaultBalanceAccounts are the accounts (and their subaccounts) that are
+	// closed and opened again.
+	DefaultBalanceAccounts = split.DefaultBalanceAccounts
+	// DefaultIncomeAccounts are the accounts (and their subaccounts) that are
+	// rolled over into retained earnings.
+	DefaultIncomeAccounts = []string{"Income", "Expenses"}
+)
+
+type Closer struct {
+	// Date is the last day of the period being closed.
+	Date time.Time
+
+	BalanceAccounts []string
+	IncomeAccounts  []string
+	// OpeningAccount is what the closing and opening transactions are
+	// balanced against.
+	OpeningAccount string
+	// RetainedEarnings is what the IncomeAccounts are rolled over into.
+	RetainedEarnings string
+	// Rollover is whether to roll the IncomeAccounts over at all.
+	Rollover bool
+	// Lots keeps commodities held at different lot prices (and lot dates and
+	// notes) apart, instead of adding them together.
+	Lots bool
+}
+
+// Result is the transactions CloseFile generates, each as its lines. Any of
+// them can be nil, if there was nothing to put in it.
+type Result struct {
+	// Rollover (dated Date) moves the balances of the IncomeAccounts to
+	// RetainedEarnings.
+	Rollover []string
+	// Closing (dated Date) brings the BalanceAccounts to zero, and Opening
+	// (dated the day after) brings them back again.
+	Closing []string
+	Opening []string
+
+	closingDate, openingDate time.Time
+}
+
+func (r *Result) String() string {
+	var parts []string
+	for _, t := range [][]string{r.Rollover, r.Closing, r.Opening} {
+		if t != nil {
+			parts = append(parts, strings.Join(t, "\n")+"\n")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// lot is a commodity, and the lot annotations it was written with, if any.
+type lot struct {
+	commodity   string
+	annotations string
+}
+
+// CloseFile computes the balances in the journal at path (and everything it
+// includes) as of the end of Date, and generates the transactions to close
+// the books with. Transactions are applied in date order, like checkassertions
+// does. Closing and opening transactions written by CloseFile (or journalsplit)
+// are ignored, so that it can be run again for a period that's already closed.
+func (c *Closer) CloseFile(path string) (*Result, error) {
+	blocks, err := assertions.Load(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load(%s)", path)
+	}
+	var txns []*assertions.Block
+	styles := make(assertions.Styles)
+	for _, b := range blocks {
+		t, ok := b.Block.(*journal.Transaction)
+		if !ok || t.Tags.Has(split.BalancesTag) {
+			continue
+		}
+		for _, p := range t.Postings {
+			styles.Learn(p.Amount)
+			styles.Learn(p.Assertion)
+		}
+		if !t.Date.After(c.Date) {
+			txns = append(txns, b)
+		}
+	}
+	sort.SliceStable(txns, func(i, j int) bool {
+		return txns[i].Block.(*journal.Transaction).Date.Before(txns[j].Block.(*journal.Transaction).Date)
+	})
+
+	// bs is what PostingAmounts needs, by plain commodity; held is the same,
+	// but by lot if c.Lots is set
+	bs := make(assertions.Balances)
+	held := make(assertions.Balances)
+	lots := make(map[string]lot)
+	for _, b := range txns {
+		t := b.Block.(*journal.Transaction)
+		amounts, err := assertions.PostingAmounts(t, b.Accounts, bs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", b.Path, t.StartLine())
+		}
+		for i, a := range amounts {
+			bs.Add(b.Accounts[i], a)
+			held.Add(b.Accounts[i], c.byLot(t.Postings[i].Amount, a, lots))
+		}
+	}
+
+	r := &Result{closingDate: c.Date, openingDate: c.Date.AddDate(0, 0, 1)}
+	if c.Rollover {
+		rollover := make(assertions.Balances)
+		for a, b := range held {
+			if split.UnderAny(a, c.IncomeAccounts) {
+				rollover.Add(a, b)
+			}
+		}
+		r.Rollover = transaction(c.Date, "Income and expenses rollover", nil, rollover, c.RetainedEarnings, styles, lots, true)
+		for a, b := range rollover {
+			neg := make(assertions.Balance)
+			for k, q := range b {
+				neg[k] = new(big.Rat).Neg(q)
+			}
+			held.Add(a, neg)
+			held.Add(c.RetainedEarnings, b)
+		}
+	}
+
+	balances := make(assertions.Balances)
+	for a, b := range held {
+		if a != c.OpeningAccount && split.UnderAny(a, c.BalanceAccounts) {
+			balances.Add(a, b)
+		}
+	}
+	r.Closing = transaction(r.closingDate, "Closing balances", []string{split.BalancesTag + ": closing"}, balances, c.OpeningAccount, styles, lots, true)
+	r.Opening = transaction(r.openingDate, "Opening balances", []string{split.BalancesTag + ": opening"}, balances, c.OpeningAccount, styles, lots, false)
+	return r, nil
+}
+
+// byLot returns a (the amount of a posting written as amount), keyed by lot
+// if c.Lots is set, recording the lots it finds in lots.
+func (c *Closer) byLot(amount *journal.Amount, a assertions.Balance, lots map[string]lot) assertions.Balance {
+	if !c.Lots || amount == nil || amount.Commodity == "" {
+		for k := range a {
+			lots[k] = lot{commodity: k}
+		}
+		return a
+	}
+	var annotations string
+	if amount.LotPrice != nil {
+		annotations += " {" + amount.LotPrice.Text + "}"
+	}
+	if amount.LotDate != "" {
+		annotations += " [" + amount.LotDate + "]"
+	}
+	if amount.LotNote != "" {
+		annotations += " (" + amount.LotNote + ")"
+	}
+	key := amount.Commodity + annotations
+	lots[key] = lot{commodity: amount.Commodity, annotations: annotations}
+	return assertions.Balance{key: a.Get(amount.Commodity)}
+}
+
+// WriteSplit adds r's transactions to the year files in dir, like the ones
+// journalsplit writes: the rollover and closing transactions go at the end of
+// the file for the year being closed, and the opening transaction at the
+// start of the file for the year after. Files that don't exist are created,
+// and ones that do are replaced atomically, keeping backups copies of them.
+// The paths of the files written are returned.
+func (r *Result) WriteSplit(dir string, backups int) ([]string, error) {
+	closing := filepath.Join(dir, strconv.Itoa(r.closingDate.Year())+".ledger")
+	opening := filepath.Join(dir, strconv.Itoa(r.openingDate.Year())+".ledger")
+
+	contents := make(map[string][]string)
+	for _, path := range []string{closing, opening} {
+		if _, ok := contents[path]; ok {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+		}
+		contents[path] = splitLines(string(b))
+	}
+	contents[closing] = split.AppendHunk(split.AppendHunk(contents[closing], r.Rollover), r.Closing)
+	if closing == opening {
+		contents[opening] = split.AppendHunk(contents[opening], r.Opening)
+	} else {
+		contents[opening] = split.AppendHunk(r.Opening, contents[opening])
+	}
+
+	var written []string
+	for _, path := range []string{closing, opening} {
+		lines, ok := contents[path]
+		if !ok {
+			continue
+		}
+		delete(contents, path)
+		if err := fs.WriteFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), 0644, backups); err != nil {
+			return nil, errors.Wrapf(err, "fs.WriteFileAtomic(%s)", path)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// transaction returns the lines of a transaction posting the balances in bs
+// (or, if negate is set, their negations), balanced by an elided posting to
+// counter, or nil if they're all zero.
+func transaction(date time.Time, payee string, notes []string, bs assertions.Balances, counter string, styles assertions.Styles, lots map[string]lot, negate bool) []string {
+	var postings []split.Posting
+	accounts := make([]string, 0, len(bs))
+	for a := range bs {
+		accounts = append(accounts, a)
+	}
+	sort.Strings(accounts)
+	for _, a := range accounts {
+		for _, k := range bs[a].Commodities() {
+			q := bs[a][k]
+			if negate {
+				q = new(big.Rat).Neg(q)
+			}
+			l := lots[k]
+			postings = append(postings, split.Posting{Account: a, Amount: styles.Format(l.commodity, q) + l.annotations})
+		}
+	}
+	return split.BalancesTransaction(date, payee, notes, postings, counter)
+}
+
+// splitLines splits a file's contents into lines, without any trailing blank
+// ones.
+func splitLines(s string) []string {
+	lines := strings.Split(strings.TrimRight(s, " \t\r\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	return lines
+}
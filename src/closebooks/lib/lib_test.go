@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+const closeTest = `2023/06/01 Opening
+    Assets:Chequing          $1,000.00
+    Equity:Opening Balances
+
+2024/01/05 Employer
+    Assets:Chequing            $500.00
+    Income:Salary
+
+2024/02/01 Broker
+    Assets:Broker               10 AAPL {$20.00}
+    Assets:Chequing
+
+2024/03/01 Broker
+    Assets:Broker               5 AAPL {$30.00}
+    Assets:Chequing           $-150.00
+
+2024/04/01 Grocer
+    Expenses:Food               $50.00
+    Liabilities:Visa
+
+2024/12/31 Closing balances
+    ; split-balances: closing
+    Assets:Chequing        $-1,000.00
+    Equity:Opening Balances
+
+2025/01/02 Grocer
+    Expenses:Food               $10.00
+    Liabilities:Visa
+`
+
+func TestCloseFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.ledger")
+	if err := ioutil.WriteFile(path, []byte(closeTest), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+
+	base := Closer{
+		Date:             time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+		BalanceAccounts:  DefaultBalanceAccounts,
+		IncomeAccounts:   DefaultIncomeAccounts,
+		OpeningAccount:   DefaultOpeningAccount,
+		RetainedEarnings: DefaultRetainedEarnings,
+		Rollover:         true,
+	}
+	lots := base
+	lots.Lots = true
+	noRollover := base
+	noRollover.Rollover = false
+
+	tests := []struct {
+		c    Closer
+		want string
+	}{
+		{base, `2024/12/31 Income and expenses rollover
+    Expenses:Food  $-50.00
+    Income:Salary  $500.00
+    Equity:RetainedEarnings
+
+2024/12/31 Closing balances
+    ; split-balances: closing
+    Assets:Broker           -15 AAPL
+    Assets:Chequing        $-1150.00
+    Equity:RetainedEarnings  $450.00
+    Liabilities:Visa          $50.00
+    Equity:Opening Balances
+
+2025/01/01 Opening balances
+    ; split-balances: opening
+    Assets:Broker             15 AAPL
+    Assets:Chequing          $1150.00
+    Equity:RetainedEarnings  $-450.00
+    Liabilities:Visa          $-50.00
+    Equity:Opening Balances
+`},
+		{lots, `2024/12/31 Income and expenses rollover
+    Expenses:Food  $-50.00
+    Income:Salary  $500.00
+    Equity:RetainedEarnings
+
+2024/12/31 Closing balances
+    ; split-balances: closing
+    Assets:Broker  -10 AAPL {$20.00}
+    Assets:Broker   -5 AAPL {$30.00}
+    Assets:Chequing        $-1150.00
+    Equity:RetainedEarnings  $450.00
+    Liabilities:Visa          $50.00
+    Equity:Opening Balances
+
+2025/01/01 Opening balances
+    ; split-balances: opening
+    Assets:Broker    10 AAPL {$20.00}
+    Assets:Broker     5 AAPL {$30.00}
+    Assets:Chequing          $1150.00
+    Equity:RetainedEarnings  $-450.00
+    Liabilities:Visa          $-50.00
+    Equity:Opening Balances
+`},
+		{noRollover, `2024/12/31 Closing balances
+    ; split-balances: closing
+    Assets:Broker     -15 AAPL
+    Assets:Chequing  $-1150.00
+    Liabilities:Visa    $50.00
+    Equity:Opening Balances
+
+2025/01/01 Opening balances
+    ; split-balances: opening
+    Assets:Broker     15 AAPL
+    Assets:Chequing  $1150.00
+    Liabilities:Visa  $-50.00
+    Equity:Opening Balances
+`},
+	}
+	for i, test := range tests {
+		r, err := test.c.CloseFile(path)
+		if err != nil {
+			t.Errorf("%d: CloseFile() = err(%v)", i, err)
+			continue
+		}
+		if got := r.String(); got != test.want {
+			t.Errorf("%d: CloseFile() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestWriteSplit(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "2024.ledger"), []byte("2024/01/05 A\n    a  $1\n    b\n\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "2025.ledger"), []byte("2025/01/05 B\n    a  $1\n    b\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	r := &Result{
+		Rollover:    []string{"2024/12/31 R"},
+		Closing:     []string{"2024/12/31 C"},
+		Opening:     []string{"2025/01/01 O"},
+		closingDate: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+		openingDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if _, err := r.WriteSplit(dir, 0); err != nil {
+		t.Fatalf("WriteSplit() = err(%v)", err)
+	}
+
+	want := map[string]string{
+		"2024.ledger": "2024/01/05 A\n    a  $1\n    b\n\n2024/12/31 R\n\n2024/12/31 C\n",
+		"2025.ledger": "2025/01/01 O\n\n2025/01/05 B\n    a  $1\n    b\n",
+	}
+	for name, w := range want {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("ioutil.ReadFile(%s) = err(%v)", name, err)
+			continue
+		}
+		if string(b) != w {
+			t.Errorf("WriteSplit() wrote %s = %q, want %q", name, string(b), w)
+		}
+	}
+}
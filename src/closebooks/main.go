@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/closebooks/lib"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	date             = flag.StringP("date", "d", "", "Last day of the period to close, like 2024/12/31. Required.")
+	balanceAccounts  = flag.StringSlice("balance-accounts", lib.DefaultBalanceAccounts, "Comma-separated accounts (with their subaccounts) to close and open again.")
+	incomeAccounts   = flag.StringSlice("income-accounts", lib.DefaultIncomeAccounts, "Comma-separated accounts (with their subaccounts) to roll over into --retained-earnings.")
+	openingAccount   = flag.String("opening-account", lib.DefaultOpeningAccount, "Account to balance the closing and opening transactions against.")
+	retainedEarnings = flag.String("retained-earnings", lib.DefaultRetainedEarnings, "Account to roll income and expenses over into.")
+	rollover         = flag.Bool("rollover", true, "Roll income and expenses over into --retained-earnings before closing.")
+	lots             = flag.Bool("lots", false, "Keep commodities held at different lot prices apart, with their lot annotations.")
+	splitDir         = flag.String("split-dir", "", "Instead of printing the transactions, add them to the year files (as written by journalsplit) in this directory.")
+	backups          = flag.IntP("backups", "b", 0, "Number of backup copies of changed year files to keep (as <file>.bak, <file>.bak.1, etc).")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 || *date == "" {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+	d, err := journal.ParseDate(*date, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+
+	c := &lib.Closer{
+		Date:             d,
+		BalanceAccounts:  *balanceAccounts,
+		IncomeAccounts:   *incomeAccounts,
+		OpeningAccount:   *openingAccount,
+		RetainedEarnings: *retainedEarnings,
+		Rollover:         *rollover,
+		Lots:             *lots,
+	}
+	r, err := c.CloseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+
+	if *splitDir == "" {
+		if _, err := io.WriteString(os.Stdout, r.String()); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	written, err := r.WriteSplit(*splitDir, *backups)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range written {
+		fmt.Fprintf(os.Stderr, "wrote %s\n", path)
+	}
+}
@@ -57,8 +57,8 @@ func (c *Conn) Fetch() ([]*priceutils.TimeSeriesItemWithSymbol, error) {
 		if err := json.Unmarshal(responseBody, &parsedResponse); err != nil {
 			return nil, errors.Wrapf(err, "json.Unmarshal(%s response)", currency)
 		}
-		ret = append(ret, &priceutils.TimeSeriesItemWithSymbol{c.Now, currency, &parsedResponse.Data.Rates})
+		ret = append(ret, &priceutils.TimeSeriesItemWithSymbol{Date: c.Now, Symbol: currency, Data: &parsedResponse.Data.Rates})
 	}
-	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{ret})
+	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{TSIWS: ret})
 	return ret, nil
 }
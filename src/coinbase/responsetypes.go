@@ -18,10 +18,10 @@ type Data struct {
 }
 
 type Rates struct {
-	CAD string `json:"CAD"`
-	USD string `json:"USD"`
+	CAD priceutils.Decimal `json:"CAD"`
+	USD priceutils.Decimal `json:"USD"`
 }
 
-func (r *Rates) GetLastPrice() string {
+func (r *Rates) GetLastPrice() priceutils.Decimal {
 	return r.CAD
 }
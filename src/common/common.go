@@ -26,12 +26,12 @@ func init() {
 	DefaultConfigDir, err = xdg.ConfigFile(ledgerToolsName)
 	if err != nil {
 		DefaultConfigDir = defaultDefaultConfigDir
-		log.Printf("xdg.ConfigFile() = {%+v}; using DefaultConfigDir = %q", DefaultConfigDir)
+		log.Printf("xdg.ConfigFile() = {%+v}; using DefaultConfigDir = %q", err, DefaultConfigDir)
 	}
 
 	DefaultDataDir, err = xdg.DataFile(ledgerToolsName)
 	if err != nil {
 		DefaultDataDir = defaultDefaultDataDir
-		log.Printf("xdg.DataFile() = {%+v}; using DefaultDataDir = %q", DefaultDataDir)
+		log.Printf("xdg.DataFile() = {%+v}; using DefaultDataDir = %q", err, DefaultDataDir)
 	}
 }
@@ -0,0 +1,640 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+var (
+	// hledgerFieldRx matches the names of the fields hledger CSV rules can
+	// assign.
+	hledgerFieldRx = regexp.MustCompile(`^(date2?|status|code|description|comment\d*|account\d+|amount\d*(-in|-out)?|currency\d*|balance\d*)$`)
+	// fieldRefRx matches references to CSV fields, like `%1` or `%name`.
+	fieldRefRx = regexp.MustCompile(`%(\d+|[a-zA-Z_][-\w]*)`)
+
+	strftimeLayouts = map[byte]string{
+		'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'b': "Jan", 'h': "Jan", 'B': "January",
+		'a': "Mon", 'A': "Monday", 'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM", 'z': "-0700", 'Z': "MST",
+	}
+	strftimeUnpaddedLayouts = map[byte]string{'m': "1", 'd': "2", 'I': "3"}
+)
+
+// maxPostings is the highest posting number checked for when converting
+// records.
+const maxPostings = 9
+
+// HledgerRules are hledger CSV rules (https://hledger.org/csv.html), read from
+// a `.csv.rules` file (see LoadHledgerRules). They support the `skip`,
+// `fields`, `separator`, `date-format`, `decimal-mark`, `newest-first` and
+// `include` directives, field assignments and if blocks, but not if tables.
+type HledgerRules struct {
+	skip         int
+	separator    rune
+	dateFormat   string
+	decimalComma bool
+	newestFirst  bool
+	// fields maps field names to 0-based column numbers.
+	fields map[string]int
+	// rules are applied in order, so later assignments win.
+	rules []*hledgerRule
+}
+
+// hledgerRule is a set of field assignments, applied to every record, or only
+// those matching an if block.
+type hledgerRule struct {
+	// matchers are ORed groups of ANDed matchers. They're nil outside of if
+	// blocks.
+	matchers    [][]*hledgerMatcher
+	assignments []hledgerAssignment
+	// skip is the number of records to skip, starting with the matching one,
+	// and end skips the rest of the file.
+	skip int
+	end  bool
+}
+
+type hledgerMatcher struct {
+	// field is the 0-based column to match, or -1 to match the whole record.
+	field  int
+	rx     *regexp.Regexp
+	negate bool
+}
+
+type hledgerAssignment struct {
+	field, value string
+}
+
+// hledgerLine is a line of a rules file, with its position for errors.
+type hledgerLine struct {
+	text string
+	pos  string
+}
+
+// LoadHledgerRules reads the hledger CSV rules file at path.
+func LoadHledgerRules(path string) (*HledgerRules, error) {
+	lines, err := readHledgerLines(path, make(map[string]bool))
+	if err != nil {
+		return nil, errors.Wrapf(err, "readHledgerLines(%s)", path)
+	}
+	r, err := parseHledgerRules(lines)
+	return r, errors.Wrapf(err, "parseHledgerRules(%s)", path)
+}
+
+// readHledgerLines reads the lines of the rules file at path, replacing
+// `include` directives with the lines of the included files.
+func readHledgerLines(path string, including map[string]bool) ([]hledgerLine, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "filepath.Abs(%s)", path)
+	}
+	if including[abs] {
+		return nil, errors.Errorf("%s includes itself", path)
+	}
+	including[abs] = true
+	defer delete(including, abs)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.Open(%s)", path)
+	}
+	defer f.Close()
+
+	var lines []hledgerLine
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimRight(s.Text(), " \t\r")
+		if inc, ok := strings.CutPrefix(text, "include "); ok {
+			inc = strings.TrimSpace(inc)
+			if !filepath.IsAbs(inc) {
+				inc = filepath.Join(filepath.Dir(path), inc)
+			}
+			included, err := readHledgerLines(inc, including)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s:%d", path, n)
+			}
+			lines = append(lines, included...)
+			continue
+		}
+		lines = append(lines, hledgerLine{text, fmt.Sprintf("%s:%d", path, n)})
+	}
+	return lines, errors.Wrapf(s.Err(), "s.Scan(%s)", path)
+}
+
+func parseHledgerRules(lines []hledgerLine) (*HledgerRules, error) {
+	r := &HledgerRules{separator: ',', fields: make(map[string]int)}
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		if isHledgerComment(l.text) {
+			continue
+		}
+		if indentation(l.text) != "" {
+			return nil, errors.Errorf("%s: unexpected indented line", l.pos)
+		}
+		name, arg := cutSpace(l.text)
+
+		var err error
+		switch name {
+		case "skip":
+			r.skip, err = parseSkip(arg)
+		case "fields":
+			err = r.parseFields(arg)
+		case "separator":
+			err = r.parseSeparator(arg)
+		case "date-format":
+			r.dateFormat, err = strftimeLayout(arg)
+		case "decimal-mark":
+			if arg != "." && arg != "," {
+				err = errors.Errorf("invalid decimal mark %q", arg)
+			}
+			r.decimalComma = arg == ","
+		case "newest-first":
+			r.newestFirst = true
+		case "if":
+			var rule *hledgerRule
+			rule, i, err = r.parseIf(lines, i)
+			r.rules = append(r.rules, rule)
+		default:
+			if !hledgerFieldRx.MatchString(name) {
+				err = errors.Errorf("unknown or unsupported directive %q", name)
+				break
+			}
+			r.rules = append(r.rules, &hledgerRule{assignments: []hledgerAssignment{{name, arg}}})
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, l.pos)
+		}
+	}
+	return r, nil
+}
+
+func isHledgerComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.ContainsAny(s[:1], "#;*")
+}
+
+func indentation(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// cutSpace splits s at its first run of whitespace.
+func cutSpace(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+func parseSkip(s string) (int, error) {
+	if s == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid skip count %q", s)
+	}
+	return n, nil
+}
+
+// parseFields parses a `fields` list. Fields named after hledger fields are
+// assigned from their columns.
+func (r *HledgerRules) parseFields(s string) error {
+	rule := &hledgerRule{}
+	for i, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.Trim(strings.TrimSpace(name), `"`))
+		if name == "" {
+			continue
+		}
+		if strings.ContainsFunc(name, unicode.IsSpace) {
+			return errors.Errorf("invalid field name %q", name)
+		}
+		r.fields[name] = i
+		if hledgerFieldRx.MatchString(name) {
+			rule.assignments = append(rule.assignments, hledgerAssignment{name, fmt.Sprintf("%%%d", i+1)})
+		}
+	}
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+func (r *HledgerRules) parseSeparator(s string) error {
+	switch strings.ToUpper(s) {
+	case "TAB", `\T`:
+		r.separator = '\t'
+	case "SPACE":
+		r.separator = ' '
+	default:
+		if len([]rune(s)) != 1 {
+			return errors.Errorf("separator must be a single character, TAB or SPACE, not %q", s)
+		}
+		r.separator = []rune(s)[0]
+	}
+	return nil
+}
+
+// parseIf parses the if block starting at lines[i], returning it and the
+// index of its last line. Either the matcher is on the `if` line, or each
+// following unindented line is a matcher. The indented lines after that are
+// assignments, `skip` or `end`.
+func (r *HledgerRules) parseIf(lines []hledgerLine, i int) (*hledgerRule, int, error) {
+	rule := &hledgerRule{}
+	_, first := cutSpace(lines[i].text)
+	if strings.HasPrefix(first, ",") {
+		return nil, i, errors.New("if tables aren't supported")
+	}
+
+	var matchLines []hledgerLine
+	if first != "" {
+		matchLines = append(matchLines, hledgerLine{first, lines[i].pos})
+	}
+	for i+1 < len(lines) && strings.TrimSpace(lines[i+1].text) != "" && indentation(lines[i+1].text) == "" {
+		i++
+		matchLines = append(matchLines, lines[i])
+	}
+	for _, l := range matchLines {
+		text := l.text
+		and := strings.HasPrefix(text, "&")
+		if and {
+			text = strings.TrimSpace(text[1:])
+		}
+		m, err := r.parseMatcher(text)
+		if err != nil {
+			return nil, i, errors.Wrap(err, l.pos)
+		}
+		if and && len(rule.matchers) > 0 {
+			last := len(rule.matchers) - 1
+			rule.matchers[last] = append(rule.matchers[last], m)
+		} else {
+			rule.matchers = append(rule.matchers, []*hledgerMatcher{m})
+		}
+	}
+	if len(rule.matchers) == 0 {
+		return nil, i, errors.New("if block without matchers")
+	}
+
+	for i+1 < len(lines) && (isHledgerComment(lines[i+1].text) || indentation(lines[i+1].text) != "") {
+		i++
+		l := lines[i]
+		if strings.TrimSpace(l.text) == "" {
+			break
+		}
+		if isHledgerComment(l.text) {
+			continue
+		}
+		name, arg := cutSpace(l.text)
+		switch {
+		case name == "skip":
+			n, err := parseSkip(arg)
+			if err != nil {
+				return nil, i, errors.Wrap(err, l.pos)
+			}
+			rule.skip = n
+		case name == "end":
+			rule.end = true
+		case hledgerFieldRx.MatchString(name):
+			rule.assignments = append(rule.assignments, hledgerAssignment{name, arg})
+		default:
+			return nil, i, errors.Errorf("%s: unknown field %q", l.pos, name)
+		}
+	}
+	return rule, i, nil
+}
+
+// parseMatcher parses `[%FIELD] [!]REGEX` or `![%FIELD] REGEX`.
+func (r *HledgerRules) parseMatcher(s string) (*hledgerMatcher, error) {
+	m := &hledgerMatcher{field: -1}
+	if strings.HasPrefix(s, "!") {
+		m.negate = true
+		s = strings.TrimSpace(s[1:])
+	}
+	if strings.HasPrefix(s, "%") {
+		var ref string
+		ref, s = cutSpace(s)
+		col, ok := r.column(ref[1:])
+		if !ok {
+			return nil, errors.Errorf("unknown field %q", ref)
+		}
+		m.field = col
+		if strings.HasPrefix(s, "!") {
+			m.negate = !m.negate
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+	var err error
+	m.rx, err = compile(s)
+	return m, err
+}
+
+// column returns the 0-based column for a field name or 1-based number.
+func (r *HledgerRules) column(ref string) (int, bool) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		return n - 1, n > 0
+	}
+	col, ok := r.fields[strings.ToLower(ref)]
+	return col, ok
+}
+
+// strftimeLayout converts a strftime-style date format to a Go time layout.
+func strftimeLayout(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", errors.Errorf("invalid date format %q", s)
+		}
+		i++
+		layouts := strftimeLayouts
+		if s[i] == '-' && i+1 < len(s) {
+			i++
+			layouts = strftimeUnpaddedLayouts
+		}
+		switch l, ok := layouts[s[i]]; {
+		case s[i] == '%':
+			b.WriteByte('%')
+		case ok:
+			b.WriteString(l)
+		default:
+			return "", errors.Errorf("unsupported date format %q", s)
+		}
+	}
+	return b.String(), nil
+}
+
+// entries implements Parser.
+func (r *HledgerRules) entries(in io.Reader) ([]*importer.Transaction, error) {
+	cr := csv.NewReader(in)
+	cr.Comma = r.separator
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var entries []*importer.Transaction
+	skip := r.skip
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cr.Read()")
+		}
+		if row == 1 && len(rec) > 0 {
+			rec[0] = strings.TrimPrefix(rec[0], "\ufeff")
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+
+		values, n, end := r.apply(rec)
+		if end {
+			break
+		}
+		if n > 0 {
+			skip = n - 1
+			continue
+		}
+		e, err := r.entry(rec, values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "row %d", row)
+		}
+		entries = append(entries, e)
+	}
+	if r.newestFirst {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	return entries, nil
+}
+
+// apply applies the rules to rec, returning the field values and whether to
+// skip some records or stop.
+func (r *HledgerRules) apply(rec []string) (values map[string]string, skip int, end bool) {
+	values = make(map[string]string)
+	for _, rule := range r.rules {
+		if !rule.matches(rec) {
+			continue
+		}
+		for _, a := range rule.assignments {
+			values[a.field] = r.interpolate(a.value, rec)
+		}
+		if rule.skip > 0 {
+			skip = rule.skip
+		}
+		end = end || rule.end
+	}
+	return values, skip, end
+}
+
+func (rule *hledgerRule) matches(rec []string) bool {
+	if rule.matchers == nil {
+		return true
+	}
+	for _, group := range rule.matchers {
+		all := true
+		for _, m := range group {
+			s := strings.Join(rec, ",")
+			if m.field >= 0 {
+				s = ""
+				if m.field < len(rec) {
+					s = rec[m.field]
+				}
+			}
+			if m.rx.MatchString(s) == m.negate {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// interpolate replaces references to CSV fields in s. References to unknown
+// fields are left alone.
+func (r *HledgerRules) interpolate(s string, rec []string) string {
+	s = fieldRefRx.ReplaceAllStringFunc(s, func(ref string) string {
+		col, ok := r.column(ref[1:])
+		if !ok {
+			return ref
+		}
+		if col >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[col])
+	})
+	return strings.TrimSpace(s)
+}
+
+// entry builds a transaction from the values assigned to hledger fields.
+func (r *HledgerRules) entry(rec []string, values map[string]string) (*importer.Transaction, error) {
+	e := &importer.Transaction{Code: values["code"], Payee: spacesRx.ReplaceAllString(values["description"], " ")}
+	var err error
+	if e.Date, err = r.parseDate(values["date"]); err != nil {
+		return nil, errors.Wrapf(err, "parseDate(%s)", values["date"])
+	}
+	if d := values["date2"]; d != "" {
+		if e.AuxDate, err = r.parseDate(d); err != nil {
+			return nil, errors.Wrapf(err, "parseDate(%s)", d)
+		}
+	}
+	switch values["status"] {
+	case "*":
+		e.State = journal.Cleared
+	case "!":
+		e.State = journal.Pending
+	case "":
+	default:
+		return nil, errors.Errorf("invalid status %q", values["status"])
+	}
+	if c := values["comment"]; c != "" {
+		e.Notes = append(e.Notes, strings.Split(strings.ReplaceAll(c, `\n`, "\n"), "\n")...)
+	}
+
+	// the sign of the first posting's amount, for picking an unknown account
+	var sign int
+	for n := 1; n <= maxPostings; n++ {
+		suffix := strconv.Itoa(n)
+		get := func(field string) string {
+			v, ok := values[field+suffix]
+			if !ok && n == 1 {
+				v = values[field]
+			}
+			return v
+		}
+		currency, ok := values["currency"+suffix]
+		if !ok {
+			// an unnumbered currency applies to every posting
+			currency = values["currency"]
+		}
+		q, prec, amountCurrency, err := r.amount(get("amount"), get("amount-in"), get("amount-out"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "amount%d", n)
+		}
+		if currency == "" {
+			currency = amountCurrency
+		}
+		account := values["account"+suffix]
+		p := &importer.Posting{Account: account}
+		if q != nil {
+			p.Amount = importer.FormatAmount(q, prec, currency, false)
+			if sign == 0 {
+				sign = q.Sign()
+			}
+		}
+		if bal := get("balance"); bal != "" {
+			bq, bprec, balanceCurrency, err := r.amount(bal, "", "")
+			if err != nil {
+				return nil, errors.Wrapf(err, "balance%d", n)
+			}
+			if currency == "" {
+				currency = balanceCurrency
+			}
+			p.Assertion = importer.FormatAmount(bq, bprec, currency, false)
+		}
+		if c := values["comment"+suffix]; c != "" {
+			p.Notes = strings.Split(strings.ReplaceAll(c, `\n`, "\n"), "\n")
+		}
+		if account == "" && (p.Amount != "" || p.Assertion != "") {
+			if n != 1 {
+				return nil, errors.Errorf("amount%d or balance%d without account%d", n, n, n)
+			}
+			return nil, errors.New("no account1")
+		}
+		if account != "" {
+			e.Postings = append(e.Postings, p)
+		}
+	}
+
+	if len(e.Postings) == 1 {
+		account := "expenses:unknown"
+		if sign > 0 {
+			account = "income:unknown"
+		}
+		e.Postings = append(e.Postings, &importer.Posting{Account: account})
+	}
+	if len(e.Postings) == 0 {
+		return nil, errors.New("no postings")
+	}
+	return e, nil
+}
+
+func (r *HledgerRules) parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("no date")
+	}
+	if r.dateFormat != "" {
+		d, err := time.Parse(r.dateFormat, s)
+		return d, errors.Wrapf(err, "time.Parse(%s)", s)
+	}
+	d, err := journal.ParseDate(s, 0)
+	if err == nil && d.Year() == 0 {
+		err = errors.Errorf("no year in date %q", s)
+	}
+	return d, errors.Wrapf(err, "journal.ParseDate(%s)", s)
+}
+
+// amount parses an amount from a signed amount, or from separate incoming
+// and outgoing amounts, only one of which may be non-zero. It returns a nil
+// quantity if there's no amount, along with any currency symbol found.
+func (r *HledgerRules) amount(amount, in, out string) (*big.Rat, int, string, error) {
+	type part struct {
+		s   string
+		neg bool
+	}
+	var q *big.Rat
+	var prec int
+	var currency string
+	for _, p := range []part{{amount, false}, {in, false}, {out, true}} {
+		if p.s == "" {
+			continue
+		}
+		pq, pprec, err := parseQuantity(p.s, r.decimalComma)
+		if err != nil {
+			return nil, 0, "", errors.Wrapf(err, "parseQuantity(%s)", p.s)
+		}
+		if p.neg {
+			pq.Neg(pq)
+		}
+		if q != nil && q.Sign() != 0 && pq.Sign() != 0 {
+			return nil, 0, "", errors.Errorf("more than one non-zero amount in %q, %q, %q", amount, in, out)
+		}
+		if q == nil || q.Sign() == 0 {
+			q, prec, currency = pq, pprec, commodity(p.s)
+		}
+	}
+	return q, prec, currency, nil
+}
+
+// commodity returns the currency symbol or name in a CSV amount, if any.
+func commodity(s string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsSymbol(r) && r != '+' {
+			return r
+		}
+		return -1
+	}, s))
+}
@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+	}
+	return dir
+}
+
+func TestHledgerConvert(t *testing.T) {
+	tests := []struct {
+		rules string
+		in    string
+		want  string
+	}{
+		{
+			`# a typical bank
+skip 1
+fields date, description, , amount, balance
+date-format %m/%d/%Y
+currency $
+account1 assets:bank:checking
+status *
+
+if LOBLAWS|METRO
+  account2 expenses:groceries
+
+if
+%description payroll
+& %amount ^[0-9]
+  account2 income:salary
+  description Employer Inc
+
+if ^pending
+  skip
+`,
+			"Date,Description,Ref,Amount,Balance\n01/05/2024,POS LOBLAWS #12,x,-12.50,987.50\n01/02/2024,PAYROLL,,1000,1000\npending,,,,\n01/07/2024,Coffee,,-3.50,984\n01/08/2024,Refund,,2,986\n",
+			"2024/01/02 * Employer Inc\n    assets:bank:checking  $1000 = $1000\n    income:salary\n\n" +
+				"2024/01/05 * POS LOBLAWS #12\n    assets:bank:checking  $-12.50 = $987.50\n    expenses:groceries\n\n" +
+				"2024/01/07 * Coffee\n    assets:bank:checking  $-3.50 = $984\n    expenses:unknown\n\n" +
+				"2024/01/08 * Refund\n    assets:bank:checking  $2 = $986\n    income:unknown\n",
+		},
+		{
+			`separator ;
+decimal-mark ,
+newest-first
+fields date, date2, code, desc, amount-in, amount-out, memo
+description %desc (%code)
+comment %memo
+account1 liabilities:visa
+currency EUR
+if !%memo ^$
+  comment1 memo: %memo
+if %desc ^stop$
+  end
+`,
+			"2024-03-02;2024-03-03;17;Shop;;1.234,5;books\n2024-03-02;;18;Shop;0;2,00;\n2024-02-01;;19;Refund;10,00;0;\n2024-01-01;;20;stop;;;\n2024-01-01;;21;Later;1;;\n",
+			"2024/02/01 (19) Refund (19)\n    liabilities:visa  EUR 10.00\n    income:unknown\n\n" +
+				"2024/03/02 (18) Shop (18)\n    liabilities:visa  EUR -2.00\n    expenses:unknown\n\n" +
+				"2024/03/02=2024/03/03 (17) Shop (17)\n    ; books\n    liabilities:visa  EUR -1234.5\n    ; memo: books\n    expenses:unknown\n",
+		},
+		{
+			`fields date, description, amount
+account1 assets:cash
+amount2 %amount
+account2 expenses:food
+account3 equity:rounding
+include extra.rules
+`,
+			"2024/01/01,lunch,$-10.00\n\n2024.01.02,dinner,$-20.00\n",
+			"2024/01/01 lunch\n    assets:cash  $-10.00\n    expenses:food  $-10.00\n    equity:rounding\n    ; extra\n\n" +
+				"2024/01/02 dinner\n    assets:cash  $-20.00\n    expenses:food  $-20.00\n    equity:rounding\n    ; extra\n",
+		},
+	}
+	for i, test := range tests {
+		dir := writeFiles(t, map[string]string{"test.rules": test.rules, "extra.rules": "comment3 extra\n"})
+		rules, err := LoadHledgerRules(filepath.Join(dir, "test.rules"))
+		if err != nil {
+			t.Errorf("%d: LoadHledgerRules() = err(%v)", i, err)
+			continue
+		}
+		im := &Importer{Rules: rules}
+		got, err := im.Convert(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("%d: Convert() = err(%v)", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%d: Convert() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestLoadHledgerRulesErrors(t *testing.T) {
+	tests := []string{
+		"unknown-directive x\n",
+		"  account1 a\n",
+		"separator ab\n",
+		"date-format %Q\n",
+		"decimal-mark x\n",
+		"skip -1\n",
+		"if\n  account2 a\n",
+		"if %nosuchfield x\n  account2 a\n",
+		"if (\n  account2 a\n",
+		"if,account2\nx,y\n",
+		"if x\n  nosuchfield a\n",
+		"include test.rules\n",
+		"include missing.rules\n",
+	}
+	for i, test := range tests {
+		dir := writeFiles(t, map[string]string{"test.rules": test})
+		if _, err := LoadHledgerRules(filepath.Join(dir, "test.rules")); err == nil {
+			t.Errorf("%d: LoadHledgerRules(%q) = nil error, want non-nil", i, test)
+		}
+	}
+}
+
+func TestHledgerConvertErrors(t *testing.T) {
+	tests := []struct {
+		rules string
+		in    string
+	}{
+		{"fields date, amount\naccount1 a\n", "01/02/2024,1\n"},
+		{"fields date, amount\naccount1 a\ndate-format %d/%m/%Y\n", "2024-01-02,1\n"},
+		{"fields date, amount\n", "2024-01-02,1\n"},
+		{"fields date, amount-in, amount-out\naccount1 a\n", "2024-01-02,1,2\n"},
+		{"fields date, amount, status\naccount1 a\n", "2024-01-02,1,x\n"},
+		{"fields date, amount2\naccount1 a\n", "2024-01-02,1\n"},
+		{"fields date, amount\naccount1 a\n", "2024-01-02,1.2.3\n"},
+	}
+	for i, test := range tests {
+		dir := writeFiles(t, map[string]string{"test.rules": test.rules})
+		rules, err := LoadHledgerRules(filepath.Join(dir, "test.rules"))
+		if err != nil {
+			t.Errorf("%d: LoadHledgerRules() = err(%v)", i, err)
+			continue
+		}
+		im := &Importer{Rules: rules}
+		if _, err := im.Convert(strings.NewReader(test.in)); err == nil {
+			t.Errorf("%d: Convert(%q) = nil error, want non-nil", i, test.in)
+		}
+	}
+}
+
+func TestStrftimeLayout(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"%Y-%m-%d", "2006-01-02"},
+		{"%-m/%-d/%y", "1/2/06"},
+		{"%d %b %Y %H:%M:%S", "02 Jan 2006 15:04:05"},
+		{"%%%Y", "%2006"},
+	}
+	for _, test := range tests {
+		got, err := strftimeLayout(test.in)
+		if err != nil || got != test.want {
+			t.Errorf("strftimeLayout(%q) = %q, err(%v), want %q", test.in, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+var spacesRx = regexp.MustCompile(`\s+`)
+
+// Parser turns the rows of a CSV file into transactions. It's implemented by
+// *Rules and *HledgerRules.
+type Parser interface {
+	entries(r io.Reader) ([]*importer.Transaction, error)
+}
+
+type Importer struct {
+	Rules Parser
+	importer.Appender
+}
+
+// Convert reads a CSV file from r and returns it as sorted ledger
+// transactions.
+func (im *Importer) Convert(r io.Reader) (string, error) {
+	entries, err := im.Rules.entries(r)
+	if err != nil {
+		return "", errors.Wrap(err, "entries()")
+	}
+	out, err := im.Sort(entries)
+	return out, errors.Wrap(err, "Sort()")
+}
+
+// ConvertFile is like Convert, reading the CSV file at path.
+func (im *Importer) ConvertFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "os.Open(%s)", path)
+	}
+	defer f.Close()
+	out, err := im.Convert(f)
+	return out, errors.Wrapf(err, "Convert(%s)", path)
+}
+
+// AppendFile imports the CSV file at csvPath into the journal at
+// journalPath, which is then sorted and replaced atomically, keeping backups
+// copies of the original. It returns any duplicates found by the Sorter.
+func (im *Importer) AppendFile(csvPath, journalPath string, backups int) ([]sorter.Duplicate, error) {
+	imported, err := im.ConvertFile(csvPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ConvertFile(%s)", csvPath)
+	}
+	return im.Appender.AppendFile(imported, journalPath, backups)
+}
+
+// rowID returns a stable ID for the nth occurrence of a row in an account's
+// CSV file.
+func rowID(account, row string, n int) string {
+	return importer.RowID(account+"\x1f"+row, n)
+}
+
+// parseQuantity parses a CSV amount, ignoring currency symbols and codes
+// (before or after the number) and thousands separators. Negative amounts can
+// be written with a leading or trailing `-`, in parentheses, or with a `DR`
+// (debit) suffix; a `CR` (credit) suffix is positive. An empty amount is
+// zero. It also returns the number of digits after the decimal mark.
+func parseQuantity(s string, decimalComma bool) (*big.Rat, int, error) {
+	neg := false
+	var digits, word strings.Builder
+	// after is set once something that isn't part of the number follows its
+	// digits, like the `e` in `1e5`, so that any more digits are an error
+	after := false
+	var suffixes []string
+	endWord := func() {
+		if word.Len() > 0 && after {
+			suffixes = append(suffixes, word.String())
+		}
+		word.Reset()
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			endWord()
+		}
+		switch {
+		case r == '-', r == '(':
+			neg = true
+		case unicode.IsDigit(r), r == '.', r == ',', r == '\'':
+			if after {
+				return nil, 0, errors.Errorf("invalid amount %q", s)
+			}
+			switch {
+			case unicode.IsDigit(r):
+				digits.WriteRune(r)
+			case r == '.' && !decimalComma, r == ',' && decimalComma:
+				digits.WriteByte('.')
+			}
+			// otherwise, it's a thousands separator
+		case unicode.IsLetter(r), unicode.IsSymbol(r):
+			// currencies
+			after = after || digits.Len() > 0
+			if unicode.IsLetter(r) {
+				word.WriteRune(r)
+			}
+		case r == ')', r == '+', unicode.IsSpace(r):
+		default:
+			return nil, 0, errors.Errorf("invalid amount %q", s)
+		}
+	}
+	endWord()
+	for _, w := range suffixes {
+		if strings.EqualFold(w, "DR") {
+			neg = true
+		}
+	}
+	d := digits.String()
+	if d == "" {
+		return new(big.Rat), 0, nil
+	}
+	q, ok := new(big.Rat).SetString(d)
+	if !ok {
+		return nil, 0, errors.Errorf("invalid amount %q", s)
+	}
+	if neg {
+		q.Neg(q)
+	}
+	prec := 0
+	if i := strings.IndexByte(d, '.'); i >= 0 {
+		prec = len(d) - i - 1
+	}
+	return q, prec, nil
+}
@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+func testRules(t *testing.T, r Rules) *Rules {
+	t.Helper()
+	if err := r.compile(); err != nil {
+		t.Fatalf("compile() = err(%v)", err)
+	}
+	return &r
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		in    string
+		want  string
+	}{
+		{
+			Rules{
+				Skip:           1,
+				DateFormat:     "01/02/2006",
+				Columns:        Columns{Date: 1, Payee: 2, Debit: 3, Credit: 4},
+				Account:        "Assets:Chequing",
+				DefaultAccount: "Expenses:Unknown",
+				Currency:       "$",
+				Payees:         []PayeeRewrite{{Match: "^POS PURCHASE "}, {Match: `#\d+$`}},
+				Accounts: []AccountRule{
+					{Payee: "loblaws|metro", Account: "Expenses:Groceries"},
+					{Payee: "payroll", Account: "Income:Salary", SetPayee: "Employer Inc"},
+				},
+			},
+			"\ufeffDate,Description,Withdrawal,Deposit\n01/05/2024,POS PURCHASE LOBLAWS #123,\"1,234.50\",\n01/02/2024,PAYROLL   DEP,,2000.00\n\n01/07/2024,Coffee,(3.5),\n",
+			"2024/01/02 Employer Inc\n    Assets:Chequing  $2000.00\n    Income:Salary\n\n" +
+				"2024/01/05 LOBLAWS\n    Assets:Chequing  $-1234.50\n    Expenses:Groceries\n\n" +
+				"2024/01/07 Coffee\n    Assets:Chequing  $-3.5\n    Expenses:Unknown\n",
+		},
+		{
+			Rules{
+				Separator:      ";",
+				SkipMatching:   []string{"^pending$"},
+				Columns:        Columns{Date: 1, AuxDate: 2, Code: 3, Payee: 4, Note: 5, Amount: 6, Debit: 0},
+				Account:        "Liabilities:Visa",
+				DefaultAccount: "Expenses:Unknown",
+				Currency:       "EUR",
+				CurrencySuffix: true,
+				DecimalComma:   true,
+				Negate:         true,
+				Cleared:        true,
+				Accounts:       []AccountRule{{Column: 5, Match: "books", Account: "Expenses:Books"}},
+			},
+			"2024-03-01;2024-03-02;17;Shop;Books;1.234,5\n2024-03-01;;;Shop;pending;1,00\n2024-02-01;2024-02-01;;Refund;;-10,00\n",
+			"2024/02/01 * Refund\n    Liabilities:Visa  10.00 EUR\n    Expenses:Unknown\n\n" +
+				"2024/03/01=2024/03/02 * (17) Shop\n    ; Books\n    Liabilities:Visa  -1234.5 EUR\n    Expenses:Books\n",
+		},
+	}
+	for i, test := range tests {
+		im := &Importer{Rules: testRules(t, test.rules)}
+		got, err := im.Convert(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("%d: Convert() = err(%v)", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%d: Convert() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	r := Rules{Columns: Columns{Date: 1, Amount: 3}, Account: "a", DefaultAccount: "b"}
+	tests := []string{
+		"2024-01-01,x\n",
+		"01/01/2024,x,1\n",
+		"2024-01-01,x,1.2.3abc!\n",
+	}
+	for i, test := range tests {
+		im := &Importer{Rules: testRules(t, r)}
+		if _, err := im.Convert(strings.NewReader(test)); err == nil {
+			t.Errorf("%d: Convert(%q) = nil error, want non-nil", i, test)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []Rules{
+		{Columns: Columns{Amount: 2}, Account: "a", DefaultAccount: "b"},
+		{Columns: Columns{Date: 1}, Account: "a", DefaultAccount: "b"},
+		{Columns: Columns{Date: 1, Amount: 2}, DefaultAccount: "b"},
+		{Columns: Columns{Date: 1, Amount: 2}, Account: "a", DefaultAccount: "b", Separator: "ab"},
+		{Columns: Columns{Date: 1, Amount: 2}, Account: "a", DefaultAccount: "b", Payees: []PayeeRewrite{{Match: "("}}},
+		{Columns: Columns{Date: 1, Amount: 2}, Account: "a", DefaultAccount: "b", Accounts: []AccountRule{{Payee: "x"}}},
+		{Columns: Columns{Date: 1, Amount: 2}, Account: "a", DefaultAccount: "b", Accounts: []AccountRule{{Column: 1, Account: "c"}}},
+	}
+	for i, test := range tests {
+		if err := test.compile(); err == nil {
+			t.Errorf("%d: compile() = nil error, want non-nil", i)
+		}
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, journalPath := filepath.Join(dir, "in.csv"), filepath.Join(dir, "main.ledger")
+	if err := ioutil.WriteFile(csvPath, []byte("2024-01-02,b,1\n2024-01-02,b,1\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	if err := ioutil.WriteFile(journalPath, []byte("account Assets:A\n\n2024/01/01 a\n    Assets:A  1\n    x\n\n2024/01/03 c\n    Assets:A  1\n    x\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+
+	r := Rules{Columns: Columns{Date: 1, Payee: 2, Amount: 3}, Account: "Assets:A", DefaultAccount: "x", IDTag: "import-id"}
+	im := &Importer{
+		Rules:    testRules(t, r),
+		Appender: importer.Appender{Sorter: sorter.Sorter{Dedupe: sorter.Dedupe{Mode: sorter.DropDuplicates, IDTags: []string{"import-id"}}}},
+	}
+	for i := 0; i < 2; i++ {
+		dups, err := im.AppendFile(csvPath, journalPath, 0)
+		if err != nil {
+			t.Fatalf("%d: AppendFile() = err(%v)", i, err)
+		}
+		if len(dups) != 2*i {
+			t.Errorf("%d: AppendFile() found %d duplicates, want %d", i, len(dups), 2*i)
+		}
+	}
+
+	want := "account Assets:A\n\n2024/01/01 a\n    Assets:A  1\n    x\n\n" +
+		"2024/01/02 b\n    ; import-id: ed4cb37831d97b2f\n    Assets:A  1\n    x\n\n" +
+		"2024/01/02 b\n    ; import-id: 81241f104d97c557\n    Assets:A  1\n    x\n\n" +
+		"2024/01/03 c\n    Assets:A  1\n    x\n"
+	got, err := ioutil.ReadFile(journalPath)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile() = err(%v)", err)
+	}
+	if string(got) != want {
+		t.Errorf("AppendFile() left journal as %q, want %q", got, want)
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in           string
+		decimalComma bool
+		want         string
+		wantPrec     int
+		wantErr      bool
+	}{
+		{"", false, "0", 0, false},
+		{"12", false, "12", 0, false},
+		{"$1,234.56", false, "30864/25", 2, false},
+		{"-1.5", false, "-3/2", 1, false},
+		{"(1.50)", false, "-3/2", 2, false},
+		{"1.50-", false, "-3/2", 2, false},
+		{"1.234,5 €", true, "2469/2", 1, false},
+		{"1'000", false, "1000", 0, false},
+		{"1.2.3", false, "", 0, true},
+		{"12#", false, "", 0, true},
+		{"USD 12.50", false, "25/2", 2, false},
+		{"12.50 CAD", false, "25/2", 2, false},
+		{"12.50 DR", false, "-25/2", 2, false},
+		{"12.50CR", false, "25/2", 2, false},
+		{"1,234.56 dr", false, "-30864/25", 2, false},
+		{"1e5", false, "", 0, true},
+		{"12 USD 5", false, "", 0, true},
+	}
+	for _, test := range tests {
+		q, prec, err := parseQuantity(test.in, test.decimalComma)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseQuantity(%q) = err(%v), want non-nil error %v", test.in, err, test.wantErr)
+			continue
+		}
+		if err == nil && (q.RatString() != test.want || prec != test.wantPrec) {
+			t.Errorf("parseQuantity(%q) = %s, %d, want %s, %d", test.in, q.RatString(), prec, test.want, test.wantPrec)
+		}
+	}
+}
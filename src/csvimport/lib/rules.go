@@ -0,0 +1,331 @@
+package lib
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// Rules describe how to turn the rows of a particular bank's CSV export into
+// ledger transactions. They're read from a JSON file (see LoadRules).
+type Rules struct {
+	// Skip is the number of rows (eg headers) to skip at the start of the
+	// file, and SkipMatching are regexps for other rows to skip. A row matches
+	// if any of its fields do.
+	Skip         int      `json:"skip"`
+	SkipMatching []string `json:"skipMatching"`
+	// Separator is the field separator. Defaults to ",".
+	Separator string `json:"separator"`
+
+	// DateFormat is a Go time layout, eg "01/02/2006". Defaults to
+	// "2006-01-02".
+	DateFormat string  `json:"dateFormat"`
+	Columns    Columns `json:"columns"`
+
+	// Account is the account the CSV file belongs to, and DefaultAccount the
+	// one transactions are balanced against if no AccountRule matches.
+	Account        string `json:"account"`
+	DefaultAccount string `json:"defaultAccount"`
+
+	// Currency is the commodity amounts are in, eg "$" or "CAD". It's written
+	// before the amount unless CurrencySuffix is set.
+	Currency       string `json:"currency"`
+	CurrencySuffix bool   `json:"currencySuffix"`
+	// DecimalComma means amounts are written like "1.234,56".
+	DecimalComma bool `json:"decimalComma"`
+	// Negate flips the sign of every amount, eg for credit card exports where
+	// purchases are positive.
+	Negate bool `json:"negate"`
+
+	// Cleared marks every transaction as cleared (`*`).
+	Cleared bool `json:"cleared"`
+	// IDTag, if set, is a metadata tag given a unique ID for each row, so
+	// re-importing the same rows can be detected with `--dedupe`.
+	IDTag string `json:"idTag"`
+
+	// Payees are applied, in order, to clean up payees.
+	Payees []PayeeRewrite `json:"payees"`
+	// Accounts pick the account to balance each transaction against. The
+	// first one that matches wins.
+	Accounts []AccountRule `json:"accounts"`
+
+	skip []*regexp.Regexp
+	// columns is the highest column number used
+	columns int
+}
+
+// Columns holds the 1-based column numbers of each field. Unused fields are
+// 0. Either Amount or at least one of Debit and Credit is required.
+type Columns struct {
+	Date    int `json:"date"`
+	AuxDate int `json:"auxDate"`
+	Code    int `json:"code"`
+	Payee   int `json:"payee"`
+	Note    int `json:"note"`
+	// Amount is a signed amount, where positive amounts increase Account.
+	Amount int `json:"amount"`
+	// Debit and Credit are unsigned amounts that decrease and increase
+	// Account, respectively.
+	Debit  int `json:"debit"`
+	Credit int `json:"credit"`
+}
+
+// PayeeRewrite replaces matches of a regexp in payees. Replace can refer to
+// submatches as $1, etc. Matching is case-insensitive.
+type PayeeRewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+
+	rx *regexp.Regexp
+}
+
+// AccountRule assigns Account (and optionally a new payee) to transactions
+// matching all of its (case-insensitive) regexps. Payee is matched against
+// the rewritten payee, and Match against the field in Column.
+type AccountRule struct {
+	Payee  string `json:"payee"`
+	Note   string `json:"note"`
+	Column int    `json:"column"`
+	Match  string `json:"match"`
+
+	Account  string `json:"account"`
+	SetPayee string `json:"setPayee"`
+
+	payee, note, match *regexp.Regexp
+}
+
+// LoadRules reads and validates the JSON rules file at path.
+func LoadRules(path string) (*Rules, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	r := &Rules{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrapf(err, "json.Unmarshal(%s)", path)
+	}
+	if err := r.compile(); err != nil {
+		return nil, errors.Wrapf(err, "compile(%s)", path)
+	}
+	return r, nil
+}
+
+// compile fills in defaults, checks r for errors and compiles its regexps.
+func (r *Rules) compile() error {
+	if r.Separator == "" {
+		r.Separator = ","
+	}
+	if len([]rune(r.Separator)) != 1 {
+		return errors.Errorf("separator must be a single character, not %q", r.Separator)
+	}
+	if r.DateFormat == "" {
+		r.DateFormat = "2006-01-02"
+	}
+	if r.Columns.Date == 0 {
+		return errors.New("no date column")
+	}
+	if r.Columns.Amount == 0 && r.Columns.Debit == 0 && r.Columns.Credit == 0 {
+		return errors.New("no amount, debit or credit column")
+	}
+	if r.Account == "" || r.DefaultAccount == "" {
+		return errors.New("account and defaultAccount are required")
+	}
+	c := r.Columns
+	r.columns = max(c.Date, c.AuxDate, c.Code, c.Payee, c.Note, c.Amount, c.Debit, c.Credit)
+
+	var err error
+	r.skip = nil
+	for _, s := range r.SkipMatching {
+		rx, err := compile(s)
+		if err != nil {
+			return errors.Wrap(err, "skipMatching")
+		}
+		r.skip = append(r.skip, rx)
+	}
+	for i := range r.Payees {
+		if r.Payees[i].rx, err = compile(r.Payees[i].Match); err != nil {
+			return errors.Wrapf(err, "payees[%d]", i)
+		}
+	}
+	for i := range r.Accounts {
+		a := &r.Accounts[i]
+		if a.Account == "" {
+			return errors.Errorf("accounts[%d]: no account", i)
+		}
+		if (a.Column == 0) != (a.Match == "") {
+			return errors.Errorf("accounts[%d]: column and match must be used together", i)
+		}
+		for _, f := range []struct {
+			s  string
+			rx **regexp.Regexp
+		}{{a.Payee, &a.payee}, {a.Note, &a.note}, {a.Match, &a.match}} {
+			if f.s == "" {
+				continue
+			}
+			if *f.rx, err = compile(f.s); err != nil {
+				return errors.Wrapf(err, "accounts[%d]", i)
+			}
+		}
+	}
+	return nil
+}
+
+// entries implements Parser.
+func (r *Rules) entries(in io.Reader) ([]*importer.Transaction, error) {
+	cr := csv.NewReader(in)
+	cr.Comma = []rune(r.Separator)[0]
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var entries []*importer.Transaction
+	// seen counts identical rows, so that they get different IDs
+	seen := make(map[string]int)
+	for row := 1; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "cr.Read()")
+		}
+		if row == 1 && len(rec) > 0 {
+			rec[0] = strings.TrimPrefix(rec[0], "\ufeff")
+		}
+		if row <= r.Skip || r.skipRow(rec) {
+			continue
+		}
+
+		e, err := r.parse(rec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "row %d", row)
+		}
+		if r.IDTag != "" {
+			key := strings.Join(rec, "\x1f")
+			e.Notes = append(e.Notes, fmt.Sprintf("%s: %s", r.IDTag, rowID(r.Account, key, seen[key])))
+			seen[key]++
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (r *Rules) skipRow(rec []string) bool {
+	if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+		return true
+	}
+	for _, rx := range r.skip {
+		for _, f := range rec {
+			if rx.MatchString(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Rules) parse(rec []string) (*importer.Transaction, error) {
+	if len(rec) < r.columns {
+		return nil, errors.Errorf("row has %d columns, want at least %d", len(rec), r.columns)
+	}
+	field := func(col int) string {
+		if col == 0 {
+			return ""
+		}
+		return strings.TrimSpace(rec[col-1])
+	}
+	date, auxDate, amount, debit, credit := field(r.Columns.Date), field(r.Columns.AuxDate), field(r.Columns.Amount), field(r.Columns.Debit), field(r.Columns.Credit)
+
+	e := &importer.Transaction{Code: field(r.Columns.Code)}
+	if r.Cleared {
+		e.State = journal.Cleared
+	}
+	note := field(r.Columns.Note)
+	if note != "" {
+		e.Notes = append(e.Notes, note)
+	}
+	var err error
+	if e.Date, err = time.Parse(r.DateFormat, date); err != nil {
+		return nil, errors.Wrapf(err, "time.Parse(%s)", date)
+	}
+	if auxDate != "" {
+		if e.AuxDate, err = time.Parse(r.DateFormat, auxDate); err != nil {
+			return nil, errors.Wrapf(err, "time.Parse(%s)", auxDate)
+		}
+	}
+
+	var quantity *big.Rat
+	var prec int
+	if r.Columns.Amount != 0 {
+		if quantity, prec, err = parseQuantity(amount, r.DecimalComma); err != nil {
+			return nil, errors.Wrapf(err, "parseQuantity(%s)", amount)
+		}
+	} else {
+		d, dp, err := parseQuantity(debit, r.DecimalComma)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parseQuantity(%s)", debit)
+		}
+		c, cp, err := parseQuantity(credit, r.DecimalComma)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parseQuantity(%s)", credit)
+		}
+		// some banks write debits as negative numbers
+		quantity = new(big.Rat).Sub(c, new(big.Rat).Abs(d))
+		prec = max(dp, cp)
+	}
+	if r.Negate {
+		quantity.Neg(quantity)
+	}
+
+	e.Payee = r.rewritePayee(field(r.Columns.Payee))
+	account := r.DefaultAccount
+	for _, a := range r.Accounts {
+		if a.matches(e.Payee, note, rec) {
+			account = a.Account
+			if a.SetPayee != "" {
+				e.Payee = a.SetPayee
+			}
+			break
+		}
+	}
+	e.Postings = []*importer.Posting{
+		{Account: r.Account, Amount: importer.FormatAmount(quantity, prec, r.Currency, r.CurrencySuffix)},
+		{Account: account},
+	}
+	return e, nil
+}
+
+func (r *Rules) rewritePayee(payee string) string {
+	for _, p := range r.Payees {
+		payee = p.rx.ReplaceAllString(payee, p.Replace)
+	}
+	return strings.TrimSpace(spacesRx.ReplaceAllString(payee, " "))
+}
+
+func (a *AccountRule) matches(payee, note string, rec []string) bool {
+	if a.payee != nil && !a.payee.MatchString(payee) {
+		return false
+	}
+	if a.note != nil && !a.note.MatchString(note) {
+		return false
+	}
+	if a.match != nil && (a.Column > len(rec) || !a.match.MatchString(rec[a.Column-1])) {
+		return false
+	}
+	return true
+}
+
+func compile(s string) (*regexp.Regexp, error) {
+	rx, err := regexp.Compile("(?i)" + s)
+	return rx, errors.Wrapf(err, "regexp.Compile(%s)", s)
+}
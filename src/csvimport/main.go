@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/glennhartmann/ledger-tools/src/csvimport/lib"
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var (
+	rulesPath   = flag.StringP("rules", "r", "", "Rules file describing the CSV format: either a JSON file (ending in .json), or hledger CSV rules. Required.")
+	journalPath = flag.StringP("journal", "j", "", "Journal to add the imported transactions to, in sorted order. Defaults to printing them to stdout.")
+	backups     = flag.IntP("backups", "b", 0, "Number of backup copies of the original journal to keep (as <file>.bak, <file>.bak.1, etc).")
+
+	dedupeMode sorter.DedupeMode
+)
+
+func main() {
+	flag.Var(enumflag.New(&dedupeMode, "dedupeMode", sorter.DedupeModeIDs, enumflag.EnumCaseInsensitive), "dedupe", fmt.Sprintf("What to do with likely duplicate transactions (eg from importing the same rows twice) when adding to a --journal. %q lists them on stderr; %q removes them; %q comments them out.", sorter.DedupeModeIDs[sorter.ReportDuplicates][0], sorter.DedupeModeIDs[sorter.DropDuplicates][0], sorter.DedupeModeIDs[sorter.CommentDuplicates][0]))
+
+	flag.Parse()
+	if flag.NArg() != 1 || *rulesPath == "" {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	var rules lib.Parser
+	idTags := sorter.DefaultIDTags
+	if strings.HasSuffix(strings.ToLower(*rulesPath), ".json") {
+		r, err := lib.LoadRules(*rulesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+		if r.IDTag != "" {
+			idTags = append([]string{r.IDTag}, idTags...)
+		}
+		rules = r
+	} else {
+		r, err := lib.LoadHledgerRules(*rulesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+		rules = r
+	}
+	im := &lib.Importer{
+		Rules: rules,
+		Appender: importer.Appender{
+			Sorter: sorter.Sorter{
+				Dedupe: sorter.Dedupe{
+					Mode:       dedupeMode,
+					Days:       sorter.DefaultDedupeDays,
+					Similarity: sorter.DefaultDedupeSimilarity,
+					IDTags:     idTags,
+				},
+			},
+		},
+	}
+
+	if *journalPath == "" {
+		out, err := im.ConvertFile(flag.Arg(0))
+		if err == nil {
+			_, err = io.WriteString(os.Stdout, out)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	dups, err := im.AppendFile(flag.Arg(0), *journalPath, *backups)
+	for _, d := range dups {
+		fmt.Fprintf(os.Stderr, "%s %s: duplicate of %s %s (%s)\n", d.Transaction.DateText, d.Transaction.Payee, d.Of.DateText, d.Of.Payee, d.Reason)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+}
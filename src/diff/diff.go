@@ -0,0 +1,217 @@
+// Package diff produces unified diffs of text files.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const DefaultContext = 3
+
+type opKind int
+
+const (
+	equal opKind = iota
+	del
+	ins
+)
+
+type op struct {
+	kind opKind
+	// index into a (for equal and del) or b (for ins)
+	i, j int
+}
+
+// Unified returns a unified diff (like `diff -u`) turning a into b, labelled
+// with aName and bName, using DefaultContext lines of context. It returns ""
+// if a and b are identical.
+func Unified(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	al, aNoEOL := splitLines(a)
+	bl, bNoEOL := splitLines(b)
+	// the last lines differ if only one of them is missing its newline
+	if aNoEOL != bNoEOL && len(al) > 0 && len(bl) > 0 {
+		al[len(al)-1] += "\x00"
+	}
+
+	ops := myers(al, bl)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+	for _, h := range hunks(ops, DefaultContext) {
+		writeHunk(&buf, h, al, bl, aNoEOL, bNoEOL)
+	}
+	return buf.String()
+}
+
+// splitLines splits s into lines, reporting whether the last one is missing
+// its trailing newline.
+func splitLines(s string) ([]string, bool) {
+	if s == "" {
+		return nil, false
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1], false
+	}
+	return lines, true
+}
+
+// myers computes a shortest edit script from a to b, using the algorithm from
+// "An O(ND) Difference Algorithm and Its Variations" (Myers, 1986).
+func myers(a, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] is v[-d..d] before step d, which is all that backtrack needs,
+	// so the trace is O(D²) rather than O((N+M)·D)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, d, k, x, y)
+			}
+		}
+	}
+	return nil // unreachable
+}
+
+func backtrack(trace [][]int, a, b []string, d, k, x, y int) []op {
+	var ops []op
+	for ; d > 0; d-- {
+		// v[k+d] is the furthest x on diagonal k
+		v := trace[d]
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{equal, x, y})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{ins, x, y})
+		} else {
+			x--
+			ops = append(ops, op{del, x, y})
+		}
+		k = prevK
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, op{equal, x, y})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunks groups ops into runs of changes with up to context lines of
+// surrounding unchanged lines, merging runs that are close together.
+func hunks(ops []op, context int) [][]op {
+	var ret [][]op
+	start, end := -1, -1
+	for i, o := range ops {
+		if o.kind == equal {
+			continue
+		}
+		lo := i - context
+		if lo < 0 {
+			lo = 0
+		}
+		if start >= 0 && lo > end {
+			ret = append(ret, ops[start:end])
+			start = -1
+		}
+		if start < 0 {
+			start = lo
+		}
+		end = i + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+	}
+	if start >= 0 {
+		ret = append(ret, ops[start:end])
+	}
+	return ret
+}
+
+func writeHunk(buf *bytes.Buffer, h []op, a, b []string, aNoEOL, bNoEOL bool) {
+	aStart, bStart := -1, -1
+	aCount, bCount := 0, 0
+	for _, o := range h {
+		switch o.kind {
+		case equal:
+			aCount++
+			bCount++
+		case del:
+			aCount++
+		case ins:
+			bCount++
+		}
+		if aStart < 0 {
+			aStart, bStart = o.i, o.j
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+
+	for _, o := range h {
+		switch o.kind {
+		case equal:
+			writeLine(buf, ' ', a[o.i], o.i == len(a)-1 && aNoEOL)
+		case del:
+			writeLine(buf, '-', a[o.i], o.i == len(a)-1 && aNoEOL)
+		case ins:
+			writeLine(buf, '+', b[o.j], o.j == len(b)-1 && bNoEOL)
+		}
+	}
+}
+
+func writeLine(buf *bytes.Buffer, prefix byte, line string, noEOL bool) {
+	buf.WriteByte(prefix)
+	buf.WriteString(strings.TrimSuffix(line, "\x00"))
+	buf.WriteByte('\n')
+	if noEOL {
+		buf.WriteString("\\ No newline at end of file\n")
+	}
+}
+
+func hunkRange(start, count int) string {
+	// unified diffs number lines from 1, and an empty range refers to the line
+	// before it
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
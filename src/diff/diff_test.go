@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"a\nb\nc\n", "a\nc\n",
+			"--- a\n+++ b\n@@ -1,3 +1,2 @@\n a\n-b\n c\n",
+		},
+		{
+			"", "x\n",
+			"--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n",
+		},
+		{
+			"a\nb", "a\nb\n",
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n",
+			"0\n1\n2\n3\nX\n5\n6\n7\n8\n9\n10\n11\n12\nY\n14\n15\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,7 +1,8 @@\n+0\n 1\n 2\n 3\n-4\n+X\n 5\n 6\n 7\n" +
+				"@@ -10,5 +11,6 @@\n 10\n 11\n 12\n-13\n+Y\n 14\n+15\n",
+		},
+	}
+	for i, test := range tests {
+		if got := Unified("a", "b", test.a, test.b); got != test.want {
+			t.Errorf("%d: Unified() =\n%s\nwant\n%s", i, got, test.want)
+		}
+	}
+}
+
+func TestMyersReordered(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 500; i++ {
+		a = append(a, fmt.Sprintf("line %d", i))
+		b = append(b, fmt.Sprintf("line %d", (i*7)%500))
+	}
+	ops := myers(a, b)
+	var gotA, gotB []string
+	for _, o := range ops {
+		switch o.kind {
+		case equal:
+			gotA = append(gotA, a[o.i])
+			gotB = append(gotB, b[o.j])
+		case del:
+			gotA = append(gotA, a[o.i])
+		case ins:
+			gotB = append(gotB, b[o.j])
+		}
+	}
+	if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+		t.Errorf("myers() = ops that don't turn a into b")
+	}
+}
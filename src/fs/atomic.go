@@ -0,0 +1,193 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// AtomicFile is an io.WriteCloser that replaces a file atomically: data is
+// written to a temporary file in the same directory, which is synced and then
+// renamed over the destination on Close. A crash or full disk part-way
+// through leaves the original file untouched.
+//
+// If the destination already exists, its permissions are preserved. If
+// backups is positive, the previous contents are kept as `<path>.bak`, with
+// older copies rotated to `<path>.bak.1`, `<path>.bak.2`, etc, keeping at
+// most backups copies in total.
+type AtomicFile struct {
+	path    string
+	perm    os.FileMode
+	backups int
+	tmp     afero.File
+	err     error
+	done    bool
+}
+
+// CreateAtomic starts writing a replacement for path. perm is only used if
+// path doesn't exist yet. If path is a symlink, the file it points to is
+// replaced (and backed up), rather than the link itself. Call Close to commit
+// the new contents, or Abort to discard them.
+func CreateAtomic(path string, perm os.FileMode, backups int) (*AtomicFile, error) {
+	resolved, err := resolveSymlinks(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolveSymlinks(%s)", path)
+	}
+	path = resolved
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := afero.TempFile(fs, dir, "."+base+".tmp*")
+	if err != nil {
+		return nil, errors.Wrapf(err, "afero.TempFile(%s)", dir)
+	}
+	return &AtomicFile{path: path, perm: perm, backups: backups, tmp: tmp}, nil
+}
+
+// WriteFileAtomic is like os.WriteFile, but uses an AtomicFile.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode, backups int) error {
+	f, err := CreateAtomic(path, perm, backups)
+	if err != nil {
+		return errors.Wrapf(err, "CreateAtomic(%s)", path)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return errors.Wrap(err, "f.Write()")
+	}
+	return errors.Wrap(f.Close(), "f.Close()")
+}
+
+// Write writes to the temporary file. After the first error, all further
+// writes fail, and Close will discard the file instead of committing it.
+func (f *AtomicFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	n, err := f.tmp.Write(p)
+	if err != nil {
+		f.err = errors.Wrapf(err, "write to %s", f.tmp.Name())
+	}
+	return n, f.err
+}
+
+// Abort discards everything written so far, leaving the destination file
+// untouched.
+func (f *AtomicFile) Abort() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	f.tmp.Close()
+	return errors.Wrapf(fs.Remove(f.tmp.Name()), "Remove(%s)", f.tmp.Name())
+}
+
+// Close commits the new contents. If any Write failed, the file is discarded
+// and the write error is returned.
+func (f *AtomicFile) Close() error {
+	if f.done {
+		return nil
+	}
+	if f.err != nil {
+		f.Abort()
+		return f.err
+	}
+	if err := f.commit(); err != nil {
+		f.Abort()
+		return err
+	}
+	f.done = true
+	return nil
+}
+
+func (f *AtomicFile) commit() error {
+	tmpName := f.tmp.Name()
+	if err := f.tmp.Sync(); err != nil {
+		return errors.Wrapf(err, "Sync(%s)", tmpName)
+	}
+	if err := f.tmp.Close(); err != nil {
+		return errors.Wrapf(err, "Close(%s)", tmpName)
+	}
+
+	perm := f.perm
+	st, err := fs.Stat(f.path)
+	exists := err == nil
+	if exists {
+		perm = st.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Stat(%s)", f.path)
+	}
+	if err := fs.Chmod(tmpName, perm); err != nil {
+		return errors.Wrapf(err, "Chmod(%s)", tmpName)
+	}
+
+	if exists && f.backups > 0 {
+		if err := backUp(f.path, perm, f.backups); err != nil {
+			return errors.Wrapf(err, "backUp(%s)", f.path)
+		}
+	}
+
+	if err := fs.Rename(tmpName, f.path); err != nil {
+		return errors.Wrapf(err, "Rename(%s, %s)", tmpName, f.path)
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// resolveSymlinks returns path with any symlinks resolved. Paths that don't
+// exist yet (including dangling links) are returned as they are.
+func resolveSymlinks(path string) (string, error) {
+	// only the real file system has symlinks
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return path, nil
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	}
+	return resolved, err
+}
+
+// BackupName returns the name of the nth most recent backup of path (with 0
+// being the most recent).
+func BackupName(path string, n int) string {
+	if n == 0 {
+		return path + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// backUp rotates the existing backups of path and copies path to the most
+// recent one.
+func backUp(path string, perm os.FileMode, backups int) error {
+	oldest := BackupName(path, backups-1)
+	if err := fs.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Remove(%s)", oldest)
+	}
+	for i := backups - 2; i >= 0; i-- {
+		from, to := BackupName(path, i), BackupName(path, i+1)
+		if err := fs.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Rename(%s, %s)", from, to)
+		}
+	}
+
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return errors.Wrapf(err, "afero.ReadFile(%s)", path)
+	}
+	return errors.Wrap(WriteFileAtomic(BackupName(path, 0), b, perm, 0), "WriteFileAtomic(backup)")
+}
+
+// syncDir makes a rename durable. It's best-effort, since not every
+// platform (or afero.Fs) supports syncing directories.
+func syncDir(dir string) {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
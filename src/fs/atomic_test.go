@@ -0,0 +1,149 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	memFS := SetUpMemFSOverlayForTesting()
+	defer ResetForTesting()
+
+	path := "dir/file"
+	if err := memFS.MkdirAll("dir", 0755); err != nil {
+		t.Fatalf("MkdirAll() = err(%+v)", err)
+	}
+
+	// new files get the given permissions
+	if err := WriteFileAtomic(path, []byte("v1"), 0640, 2); err != nil {
+		t.Fatalf("WriteFileAtomic(v1) = err(%+v)", err)
+	}
+	checkFile(t, memFS, path, "v1", 0640)
+	checkNotExist(t, memFS, BackupName(path, 0))
+
+	// existing permissions are preserved, and backups are rotated
+	if err := memFS.Chmod(path, 0600); err != nil {
+		t.Fatalf("Chmod() = err(%+v)", err)
+	}
+	for _, v := range []string{"v2", "v3", "v4"} {
+		if err := WriteFileAtomic(path, []byte(v), 0644, 2); err != nil {
+			t.Fatalf("WriteFileAtomic(%s) = err(%+v)", v, err)
+		}
+	}
+	checkFile(t, memFS, path, "v4", 0600)
+	checkFile(t, memFS, BackupName(path, 0), "v3", 0600)
+	checkFile(t, memFS, BackupName(path, 1), "v2", 0600)
+	checkNotExist(t, memFS, BackupName(path, 2))
+
+	// no temp files are left behind
+	infos, err := afero.ReadDir(memFS, "dir")
+	if err != nil {
+		t.Fatalf("afero.ReadDir() = err(%+v)", err)
+	}
+	if len(infos) != 3 {
+		var names []string
+		for _, i := range infos {
+			names = append(names, i.Name())
+		}
+		t.Errorf("dir contains %q, want only the file and 2 backups", names)
+	}
+}
+
+func TestAtomicFileAbort(t *testing.T) {
+	memFS := SetUpMemFSOverlayForTesting()
+	defer ResetForTesting()
+
+	path := "file"
+	if err := afero.WriteFile(memFS, path, []byte("original"), 0644); err != nil {
+		t.Fatalf("afero.WriteFile() = err(%+v)", err)
+	}
+
+	f, err := CreateAtomic(path, 0644, 1)
+	if err != nil {
+		t.Fatalf("CreateAtomic() = err(%+v)", err)
+	}
+	if _, err := f.Write([]byte("partial")); err != nil {
+		t.Fatalf("Write() = err(%+v)", err)
+	}
+	if err := f.Abort(); err != nil {
+		t.Errorf("Abort() = err(%+v)", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close() after Abort() = err(%+v)", err)
+	}
+	checkFile(t, memFS, path, "original", 0644)
+	checkNotExist(t, memFS, BackupName(path, 0))
+
+	// a failed write means Close discards the file too
+	f, err = CreateAtomic(path, 0644, 1)
+	if err != nil {
+		t.Fatalf("CreateAtomic() = err(%+v)", err)
+	}
+	f.err = errors.New("disk full")
+	if err := f.Close(); err == nil {
+		t.Errorf("Close() after failed write = err(nil), want an error")
+	}
+	checkFile(t, memFS, path, "original", 0644)
+	if infos, _ := afero.ReadDir(memFS, "."); len(infos) != 1 {
+		t.Errorf("temp file left behind: %d files", len(infos))
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	// symlinks need the real file system
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.ledger")
+	link := filepath.Join(dir, "link.ledger")
+	if err := os.WriteFile(target, []byte("v1"), 0600); err != nil {
+		t.Fatalf("os.WriteFile() = err(%+v)", err)
+	}
+	if err := os.Symlink("real.ledger", link); err != nil {
+		t.Skipf("os.Symlink() = err(%+v)", err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("v2"), 0644, 1); err != nil {
+		t.Fatalf("WriteFileAtomic() = err(%+v)", err)
+	}
+	osFS := afero.NewOsFs()
+	checkFile(t, osFS, target, "v2", 0600)
+	checkFile(t, osFS, BackupName(target, 0), "v1", 0600)
+	if st, err := os.Lstat(link); err != nil || st.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("os.Lstat(%s) = %v, err(%+v), want a symlink", link, st, err)
+	}
+}
+
+func TestBackupName(t *testing.T) {
+	if got := BackupName("a/b", 0); got != "a/b.bak" {
+		t.Errorf("BackupName(0) = %q", got)
+	}
+	if got := BackupName("a/b", 3); got != "a/b.bak.3" {
+		t.Errorf("BackupName(3) = %q", got)
+	}
+}
+
+func checkFile(t *testing.T, fs afero.Fs, path, want string, wantPerm os.FileMode) {
+	t.Helper()
+	if b, err := afero.ReadFile(fs, path); err != nil {
+		t.Errorf("afero.ReadFile(%s): %+v", path, err)
+	} else if string(b) != want {
+		t.Errorf("%s contains %q, expected %q", path, string(b), want)
+	}
+	if st, err := fs.Stat(path); err != nil {
+		t.Errorf("Stat(%s): %+v", path, err)
+	} else if st.Mode().Perm() != wantPerm {
+		t.Errorf("%s has mode %v, expected %v", path, st.Mode().Perm(), wantPerm)
+	}
+}
+
+func checkNotExist(t *testing.T, fs afero.Fs, path string) {
+	t.Helper()
+	if exists, err := afero.Exists(fs, path); err != nil {
+		t.Errorf("afero.Exists(): %+v", err)
+	} else if exists {
+		t.Errorf("%q exists, but it shouldn't", path)
+	}
+}
@@ -0,0 +1,161 @@
+// Package importer holds what the importers (csvimport, ofximport, qifimport
+// and camtimport) have in common: the transactions they build, how those are
+// written and sorted, and how they're added to a journal.
+package importer
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+// DefaultUnknownAccounts are the placeholder accounts importers balance
+// single-sided transactions against by default, for transfermatch and
+// categorize to fix up.
+var DefaultUnknownAccounts = []string{"Expenses:Unknown", "Income:Unknown"}
+
+// Transaction is an imported transaction, before it's written.
+type Transaction struct {
+	Date     time.Time
+	AuxDate  time.Time
+	State    journal.State
+	Code     string
+	Payee    string
+	Notes    []string
+	Postings []*Posting
+}
+
+type Posting struct {
+	Account string
+	// Amount and Assertion are already formatted (see FormatAmount). Amount
+	// is empty if it should be elided.
+	Amount    string
+	Assertion string
+	Notes     []string
+}
+
+// Appender sorts imported transactions, and adds them to journals.
+type Appender struct {
+	// Sorter sorts the imported transactions, and the journal they're
+	// appended to. Its Check, Diff, Stdout and Backups fields are ignored.
+	Sorter sorter.Sorter
+}
+
+// Sort writes transactions as a journal, sorted by a.Sorter.
+func (a *Appender) Sort(transactions []*Transaction) (string, error) {
+	var b strings.Builder
+	for _, t := range transactions {
+		// every transaction ends with a blank line, so they stay separated
+		// however they're sorted
+		t.Write(&b)
+		b.WriteString("\n")
+	}
+	out, _, err := a.Sorter.SortString(strings.TrimSuffix(b.String(), "\n"))
+	if err != nil {
+		return "", errors.Wrap(err, "SortString()")
+	}
+	if out == "" {
+		return "", nil
+	}
+	return strings.TrimRight(out, "\n") + "\n", nil
+}
+
+// AppendFile adds transactions (as returned by Sort) to the journal at
+// journalPath, which is then sorted and replaced atomically, keeping backups
+// copies of the original. It returns any duplicates found by the Sorter.
+func (a *Appender) AppendFile(transactions, journalPath string, backups int) ([]sorter.Duplicate, error) {
+	s := a.Sorter
+	s.Backups = backups
+	dups, err := s.AddToFile(journalPath, transactions)
+	return dups, errors.Wrapf(err, "AddToFile(%s)", journalPath)
+}
+
+// Write writes t to b. Multi-line notes become several comment lines.
+func (t *Transaction) Write(b *strings.Builder) {
+	b.WriteString(t.Date.Format(journal.DateFormat))
+	if !t.AuxDate.IsZero() && !t.AuxDate.Equal(t.Date) {
+		b.WriteString("=" + t.AuxDate.Format(journal.DateFormat))
+	}
+	if t.State != journal.Uncleared {
+		b.WriteString(" " + t.State.String())
+	}
+	if t.Code != "" {
+		fmt.Fprintf(b, " (%s)", t.Code)
+	}
+	if t.Payee != "" {
+		b.WriteString(" " + t.Payee)
+	}
+	b.WriteString("\n")
+	writeNotes(b, t.Notes)
+	for _, p := range t.Postings {
+		b.WriteString("    " + p.Account)
+		if p.Amount != "" {
+			b.WriteString("  " + p.Amount)
+		}
+		if p.Assertion != "" {
+			if p.Amount == "" {
+				b.WriteString(" ")
+			}
+			b.WriteString(" = " + p.Assertion)
+		}
+		b.WriteString("\n")
+		writeNotes(b, p.Notes)
+	}
+}
+
+func writeNotes(b *strings.Builder, notes []string) {
+	for _, n := range notes {
+		for _, l := range strings.Split(n, "\n") {
+			fmt.Fprintf(b, "    ; %s\n", l)
+		}
+	}
+}
+
+// FormatAmount formats q with prec digits after the decimal point, like
+// `$-1.50` or `CAD -1.50`, or `-1.50 CAD` if suffix is set.
+func FormatAmount(q *big.Rat, prec int, commodity string, suffix bool) string {
+	n := q.FloatString(prec)
+	switch {
+	case commodity == "":
+		return n
+	case suffix:
+		return n + " " + commodity
+	case HasLetters(commodity):
+		return commodity + " " + n
+	}
+	return commodity + n
+}
+
+// HasLetters reports whether commodity has any letters in it (like `CAD`,
+// as opposed to `$`), so it has to be separated from its amount by a space.
+func HasLetters(commodity string) bool {
+	return strings.IndexFunc(commodity, unicode.IsLetter) >= 0
+}
+
+// RowID returns a stable ID for the nth occurrence of key (eg the text of a
+// row in an export) in an import, for transactions that don't come with an
+// ID of their own.
+func RowID(key string, n int) string {
+	h := sha1.Sum([]byte(fmt.Sprintf("%s\x1f%d", key, n)))
+	return hex.EncodeToString(h[:8])
+}
+
+// InAccounts reports whether account is one of accounts, or a subaccount of
+// one of them.
+func InAccounts(account string, accounts []string) bool {
+	for _, a := range accounts {
+		if account == a || strings.HasPrefix(account, a+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+func TestWrite(t *testing.T) {
+	tr := &Transaction{
+		Date:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		AuxDate: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		State:   journal.Cleared,
+		Code:    "101",
+		Payee:   "Coffee",
+		Notes:   []string{"import-id: abc", "two\nlines"},
+		Postings: []*Posting{
+			{Account: "Expenses:Coffee", Amount: "$3.50", Notes: []string{"large"}},
+			{Account: "Assets:Checking", Assertion: "$96.50"},
+		},
+	}
+	want := "2024/01/02=2024/01/03 * (101) Coffee\n" +
+		"    ; import-id: abc\n" +
+		"    ; two\n" +
+		"    ; lines\n" +
+		"    Expenses:Coffee  $3.50\n" +
+		"    ; large\n" +
+		"    Assets:Checking  = $96.50\n"
+	var b strings.Builder
+	tr.Write(&b)
+	if got := b.String(); got != want {
+		t.Errorf("Write() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	q := big.NewRat(-3, 2)
+	tests := []struct {
+		prec      int
+		commodity string
+		suffix    bool
+		want      string
+	}{
+		{2, "$", false, "$-1.50"},
+		{2, "CAD", false, "CAD -1.50"},
+		{2, "CAD", true, "-1.50 CAD"},
+		{1, "", false, "-1.5"},
+	}
+	for i, test := range tests {
+		if got := FormatAmount(q, test.prec, test.commodity, test.suffix); got != test.want {
+			t.Errorf("%d: FormatAmount() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestAppenderSort(t *testing.T) {
+	a := &Appender{}
+	ts := []*Transaction{
+		{Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Payee: "b", Postings: []*Posting{{Account: "x", Amount: "1"}, {Account: "y"}}},
+		{Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Payee: "a", Postings: []*Posting{{Account: "x", Amount: "1"}, {Account: "y"}}},
+	}
+	got, err := a.Sort(ts)
+	if err != nil {
+		t.Fatalf("Sort() = err(%v)", err)
+	}
+	if want := "2024/01/01 a\n    x  1\n    y\n\n2024/01/02 b\n    x  1\n    y\n"; got != want {
+		t.Errorf("Sort() = %q, want %q", got, want)
+	}
+	if got, err := a.Sort(nil); err != nil || got != "" {
+		t.Errorf("Sort(nil) = %q, err(%v), want \"\"", got, err)
+	}
+}
+
+func TestInAccounts(t *testing.T) {
+	tests := []struct {
+		account string
+		want    bool
+	}{
+		{"Expenses:Unknown", true},
+		{"Expenses:Unknown:Foo", true},
+		{"Expenses:UnknownFoo", false},
+		{"Expenses", false},
+	}
+	for _, test := range tests {
+		if got := InAccounts(test.account, []string{"Expenses:Unknown"}); got != test.want {
+			t.Errorf("InAccounts(%s) = %v, want %v", test.account, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package journal
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CommodityStopChars are the characters that can't appear in an unquoted
+// commodity symbol.
+const CommodityStopChars = " \t0123456789.,;:?!-+*/^&|=<>{}[]()@\""
+
+// Amount is a quantity of some commodity, like `$-2362.25`, `10 AAPL` or
+// `"XBAL.TO" 5`, optionally followed by lot annotations.
+//
+// Amounts written as value expressions (`($10 * 2)`) are kept as text only:
+// Expr is set and Quantity is nil.
+type Amount struct {
+	// Text is the amount as written, including any lot annotations.
+	Text      string
+	Commodity string
+	Quantity  *big.Rat
+	// Precision is the number of digits written after the decimal mark.
+	Precision int
+	// Prefix is set if the commodity is written before the quantity, and
+	// Spaced if there is whitespace between them.
+	Prefix bool
+	Spaced bool
+	Expr   bool
+
+	LotPrice *Amount
+	LotDate  string
+	LotNote  string
+}
+
+func (a *Amount) String() string {
+	return a.Text
+}
+
+// ParseAmount parses an amount written on its own, like `$-2362.25` or
+// `10 AAPL {$20.00}`.
+func ParseAmount(s string) (*Amount, error) {
+	a, err := parseAmount(s)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, errors.New("empty amount")
+	}
+	return a, nil
+}
+
+// parseAmount parses s (which must already have any cost, assertion and note
+// split off). An empty s results in a nil Amount.
+func parseAmount(s string) (*Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	a := &Amount{Text: s}
+	if s[0] == '(' {
+		a.Expr = true
+		return a, nil
+	}
+
+	rest := s
+	neg := false
+	if rest[0] == '-' || rest[0] == '+' {
+		neg = rest[0] == '-'
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	commodity, rest, err := readCommodity(rest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "readCommodity(%s)", rest)
+	}
+	if commodity != "" {
+		a.Commodity = commodity
+		a.Prefix = true
+		trimmed := strings.TrimLeft(rest, " \t")
+		a.Spaced = len(trimmed) != len(rest)
+		rest = trimmed
+		if rest != "" && (rest[0] == '-' || rest[0] == '+') {
+			neg = neg != (rest[0] == '-')
+			rest = rest[1:]
+		}
+	}
+
+	i := 0
+	for i < len(rest) && strings.IndexByte("0123456789.,", rest[i]) >= 0 {
+		i++
+	}
+	if i == 0 {
+		return nil, errors.Errorf("no quantity found in amount %q", s)
+	}
+	a.Quantity, a.Precision, err = parseQuantity(rest[:i])
+	if err != nil {
+		return nil, errors.Wrapf(err, "parseQuantity(%s)", rest[:i])
+	}
+	if neg {
+		a.Quantity.Neg(a.Quantity)
+	}
+	rest = rest[i:]
+
+	if !a.Prefix {
+		trimmed := strings.TrimLeft(rest, " \t")
+		spaced := len(trimmed) != len(rest)
+		commodity, rest, err = readCommodity(trimmed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "readCommodity(%s)", trimmed)
+		}
+		if commodity != "" {
+			a.Commodity = commodity
+			a.Spaced = spaced
+		} else {
+			rest = trimmed
+		}
+	}
+
+	if err := a.parseAnnotations(rest); err != nil {
+		return nil, errors.Wrapf(err, "amount %q", s)
+	}
+	return a, nil
+}
+
+// readCommodity reads a quoted or unquoted commodity symbol from the start of
+// s, returning "" if there isn't one.
+func readCommodity(s string) (commodity, rest string, err error) {
+	if s == "" {
+		return "", s, nil
+	}
+	if s[0] == '"' {
+		end := strings.IndexByte(s[1:], '"')
+		if end < 0 {
+			return "", s, errors.New("unterminated quoted commodity")
+		}
+		return s[:end+2], s[end+2:], nil
+	}
+	i := strings.IndexAny(s, CommodityStopChars)
+	if i < 0 {
+		i = len(s)
+	}
+	return s[:i], s[i:], nil
+}
+
+// QuoteCommodity returns symbol as it has to be written in an amount: in
+// double quotes if it contains any characters that would end an unquoted
+// commodity, eg `"VFV.TO"`.
+func QuoteCommodity(symbol string) string {
+	if strings.ContainsAny(symbol, CommodityStopChars) {
+		return `"` + symbol + `"`
+	}
+	return symbol
+}
+
+// UnquoteCommodity returns symbol without the double quotes QuoteCommodity
+// might have added, so that `"VFV.TO"` and `VFV.TO` compare equal.
+func UnquoteCommodity(symbol string) string {
+	return strings.Trim(symbol, `"`)
+}
+
+// parseQuantity parses a number written with optional thousands separators.
+// If both '.' and ',' appear, whichever comes last is the decimal mark;
+// otherwise ',' is a thousands separator and '.' is the decimal mark.
+func parseQuantity(s string) (*big.Rat, int, error) {
+	decimalMark := byte('.')
+	if strings.LastIndexByte(s, ',') > strings.LastIndexByte(s, '.') && strings.IndexByte(s, '.') >= 0 {
+		decimalMark = ','
+	}
+
+	var b strings.Builder
+	precision := 0
+	seenMark := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == decimalMark:
+			if seenMark {
+				return nil, 0, errors.Errorf("multiple decimal marks in %q", s)
+			}
+			seenMark = true
+			b.WriteByte('.')
+		case c == '.' || c == ',':
+			if seenMark {
+				return nil, 0, errors.Errorf("thousands separator after decimal mark in %q", s)
+			}
+		default:
+			if seenMark {
+				precision++
+			}
+			b.WriteByte(c)
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(b.String())
+	if !ok {
+		return nil, 0, errors.Errorf("invalid quantity %q", s)
+	}
+	return r, precision, nil
+}
+
+// parseAnnotations parses lot annotations: `{PRICE}`, `{{TOTAL}}`, `[DATE]`
+// and `(NOTE)`, in any order.
+func (a *Amount) parseAnnotations(s string) error {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil
+		}
+		var closer string
+		switch {
+		case strings.HasPrefix(s, "{{"):
+			closer = "}}"
+		case s[0] == '{':
+			closer = "}"
+		case s[0] == '[':
+			closer = "]"
+		case s[0] == '(':
+			closer = ")"
+		default:
+			return errors.Errorf("unexpected text %q", s)
+		}
+		open := len(closer)
+		end := strings.Index(s[open:], closer)
+		if end < 0 {
+			return errors.Errorf("unterminated annotation %q", s)
+		}
+		inner := strings.TrimSpace(s[open : open+end])
+		s = s[open+end+len(closer):]
+
+		switch closer[0] {
+		case '}':
+			lp, err := parseAmount(strings.TrimLeft(inner, "="))
+			if err != nil {
+				return errors.Wrap(err, "lot price")
+			}
+			a.LotPrice = lp
+		case ']':
+			a.LotDate = inner
+		case ')':
+			a.LotNote = inner
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package journal
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const DateFormat = "2006/01/02"
+
+var (
+	// overridable for testing
+	Now = time.Now
+)
+
+// ParseDate parses any date form ledger accepts: `2006/01/02`, `2006-01-02`
+// or `2006.01.02` (with or without leading zeroes), or a short `01/02` form
+// which takes its year from defaultYear.
+func ParseDate(s string, defaultYear int) (time.Time, error) {
+	sep := strings.IndexAny(s, "/-.")
+	if sep < 0 {
+		return time.Time{}, errors.Errorf("invalid date %q", s)
+	}
+	parts := strings.Split(s, s[sep:sep+1])
+
+	var year int
+	switch len(parts) {
+	case 2:
+		year = defaultYear
+	case 3:
+		y, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts[0]) != 4 {
+			return time.Time{}, errors.Errorf("invalid year in date %q", s)
+		}
+		year = y
+		parts = parts[1:]
+	default:
+		return time.Time{}, errors.Errorf("invalid date %q", s)
+	}
+
+	month, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts[0]) > 2 || month < 1 || month > 12 {
+		return time.Time{}, errors.Errorf("invalid month in date %q", s)
+	}
+	day, err := strconv.Atoi(parts[1])
+	if err != nil || len(parts[1]) > 2 || day < 1 {
+		return time.Time{}, errors.Errorf("invalid day in date %q", s)
+	}
+
+	d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if d.Day() != day {
+		return time.Time{}, errors.Errorf("day out of range in date %q", s)
+	}
+	return d, nil
+}
+
+// parseDates parses a `DATE[=AUXDATE]` transaction date. An auxiliary date
+// without a year takes its year from the primary date.
+func parseDates(s string, defaultYear int) (date, auxDate time.Time, err error) {
+	primary, aux := s, ""
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		primary, aux = s[:i], s[i+1:]
+	}
+
+	date, err = ParseDate(primary, defaultYear)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrapf(err, "ParseDate(%s)", primary)
+	}
+	if aux != "" {
+		auxDate, err = ParseDate(aux, date.Year())
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.Wrapf(err, "ParseDate(%s)", aux)
+		}
+	}
+	return date, auxDate, nil
+}
@@ -0,0 +1,95 @@
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prashantv/gostub"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2020/02/07", time.Date(2020, time.February, 7, 0, 0, 0, 0, time.UTC), false},
+		{"2020-02-07", time.Date(2020, time.February, 7, 0, 0, 0, 0, time.UTC), false},
+		{"2020.02.07", time.Date(2020, time.February, 7, 0, 0, 0, 0, time.UTC), false},
+		{"2020/2/7", time.Date(2020, time.February, 7, 0, 0, 0, 0, time.UTC), false},
+		{"02/07", time.Date(1999, time.February, 7, 0, 0, 0, 0, time.UTC), false},
+		{"2-7", time.Date(1999, time.February, 7, 0, 0, 0, 0, time.UTC), false},
+		{"2020/02/30", time.Time{}, true},
+		{"2020/13/01", time.Time{}, true},
+		{"2020/00/01", time.Time{}, true},
+		{"2020/01/00", time.Time{}, true},
+		{"20/01/01", time.Time{}, true},
+		{"2020/01/01/01", time.Time{}, true},
+		{"2020/001/01", time.Time{}, true},
+		{"20200101", time.Time{}, true},
+		{"", time.Time{}, true},
+		{"f", time.Time{}, true},
+	}
+	for _, test := range tests {
+		d, err := ParseDate(test.s, 1999)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseDate(%s) = err(%v), want non-nil error: %v", test.s, err, test.wantErr)
+		}
+		if err == nil && !d.Equal(test.want) {
+			t.Errorf("ParseDate(%s) = %v, want %v", test.s, d, test.want)
+		}
+	}
+}
+
+func TestParseDatesAndYears(t *testing.T) {
+	stubs := gostub.Stub(&Now, func() time.Time { return time.Date(2030, time.June, 1, 0, 0, 0, 0, time.UTC) })
+	defer stubs.Reset()
+
+	j, err := Parse(yearsJournal)
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+	xacts := j.Transactions()
+	want := []struct {
+		date, auxDate time.Time
+		dateText      string
+		auxDateText   string
+	}{
+		{time.Date(2030, time.January, 2, 0, 0, 0, 0, time.UTC), time.Time{}, "01/02", ""},
+		{time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC), time.Date(2021, time.March, 6, 0, 0, 0, 0, time.UTC), "03/04", "03/06"},
+		{time.Date(2019, time.May, 6, 0, 0, 0, 0, time.UTC), time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), "5-6", "2020-01-01"},
+		{time.Date(2021, time.July, 8, 0, 0, 0, 0, time.UTC), time.Time{}, "07.08", ""},
+	}
+	if len(xacts) != len(want) {
+		t.Fatalf("len(Transactions()) = %d, want %d", len(xacts), len(want))
+	}
+	for i, w := range want {
+		x := xacts[i]
+		if !x.Date.Equal(w.date) || !x.AuxDate.Equal(w.auxDate) || x.DateText != w.dateText || x.AuxDateText != w.auxDateText {
+			t.Errorf("%d: dates = %v %v %q %q, want %v %v %q %q", i, x.Date, x.AuxDate, x.DateText, x.AuxDateText, w.date, w.auxDate, w.dateText, w.auxDateText)
+		}
+	}
+	if !xacts[0].AuxDateOrDate().Equal(xacts[0].Date) || !xacts[1].AuxDateOrDate().Equal(xacts[1].AuxDate) {
+		t.Errorf("AuxDateOrDate() failed")
+	}
+
+	if _, err := Parse("year twenty\n"); err == nil {
+		t.Errorf("Parse(bad year) = err(nil), want an error")
+	}
+}
+
+const yearsJournal = `01/02 no year directive yet
+    a
+
+year 2021
+03/04=03/06 aux date
+    a
+
+apply year 2019
+5-6=2020-01-01 applied year
+    a
+end apply year
+
+07.08 back to 2021
+    a
+`
@@ -0,0 +1,305 @@
+// Package journal parses ledger-cli journal files into a typed syntax tree.
+//
+// Every Block keeps the raw source lines it was parsed from, so a Journal can
+// always be written back out byte-for-byte, while the typed fields give tools
+// access to dates, payees, postings, amounts, metadata and directives without
+// having to re-implement ledger's line heuristics.
+package journal
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Block is a top-level element of a journal: a transaction, a directive, a
+// run of comments or blank lines, etc.
+type Block interface {
+	// Lines returns the raw source lines making up the block.
+	Lines() []string
+	// StartLine returns the 1-based line number of the block's first line.
+	StartLine() int
+}
+
+// Source records where a Block came from, and its exact text.
+type Source struct {
+	Line int
+	Raw  []string
+}
+
+func (s *Source) Lines() []string {
+	return s.Raw
+}
+
+func (s *Source) StartLine() int {
+	return s.Line
+}
+
+// EndLine returns the 1-based line number of the block's last line.
+func (s *Source) EndLine() int {
+	return s.Line + len(s.Raw) - 1
+}
+
+// Blank is a run of one or more empty (or whitespace-only) lines.
+type Blank struct {
+	Source
+}
+
+// Comment is a run of top-level comment lines, or a `comment`/`test` ...
+// `end comment`/`end test` block.
+type Comment struct {
+	Source
+}
+
+// Unknown is a top-level line (plus any indented lines following it) that
+// isn't recognized as any ledger construct.
+type Unknown struct {
+	Source
+}
+
+// Directive is any non-transaction ledger command, such as `account`,
+// `commodity`, `include`, `apply account`, `P` or `year`. Name is normalized
+// (so `!include` and `@include` both become "include", and multi-word
+// commands like "apply account" or "end apply tag" are kept together), and
+// Arg is the rest of the line. Body holds any indented sub-directive lines.
+type Directive struct {
+	Source
+	Name string
+	Arg  string
+	Body []string
+}
+
+// State is the clearing state of a transaction or posting.
+type State int
+
+const (
+	Uncleared State = iota
+	Pending
+	Cleared
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "!"
+	case Cleared:
+		return "*"
+	}
+	return ""
+}
+
+// Transaction is a regular, dated ledger transaction.
+type Transaction struct {
+	Source
+	Date     time.Time
+	DateText string
+	// AuxDate is the auxiliary (aka effective) date, if any. It's zero if
+	// there isn't one.
+	AuxDate     time.Time
+	AuxDateText string
+	State       State
+	Code        string
+	Payee       string
+	// Notes holds the header comment (if any) followed by any comment lines
+	// appearing before the first posting, without the leading ';'.
+	Notes    []string
+	Tags     Tags
+	Postings []*Posting
+}
+
+// AuxDateOrDate returns the auxiliary date if there is one, and the primary
+// date otherwise.
+func (t *Transaction) AuxDateOrDate() time.Time {
+	if t.AuxDate.IsZero() {
+		return t.Date
+	}
+	return t.AuxDate
+}
+
+// AddNote adds a transaction-level comment line after the header and any
+// existing transaction-level comments, indented like the first posting. note
+// shouldn't include the leading ';'.
+func (t *Transaction) AddNote(note string) {
+	i := 1
+	for i < len(t.Raw) && isIndentedComment(trimCR(t.Raw[i])) {
+		i++
+	}
+	indent := "    "
+	if len(t.Postings) > 0 {
+		indent = indentation(t.Postings[0].Raw)
+	}
+
+	raw := make([]string, 0, len(t.Raw)+1)
+	raw = append(append(append(raw, t.Raw[:i]...), indent+";"+note), t.Raw[i:]...)
+	t.Raw = raw
+	t.Notes = append(t.Notes, note)
+	t.Tags = append(t.Tags, parseTags(note)...)
+}
+
+// PostingAmount returns the commodity and quantity of p, which must be one of
+// t's postings. If p has no amount, it's inferred as whatever balances the
+// transaction, as long as p is the only real posting without an amount, no
+// posting has a cost, and all the others are in the same commodity. ok is
+// false if there's no amount and it can't be inferred.
+func (t *Transaction) PostingAmount(p *Posting) (commodity string, quantity *big.Rat, ok bool) {
+	if p.Amount != nil && p.Amount.Quantity != nil {
+		return p.Amount.Commodity, p.Amount.Quantity, true
+	}
+	if p.Type == Virtual {
+		return "", nil, false
+	}
+
+	sum := new(big.Rat)
+	first := true
+	for _, o := range t.Postings {
+		if o == p || o.Type == Virtual {
+			continue
+		}
+		if o.Amount == nil || o.Amount.Quantity == nil || o.Cost != nil {
+			return "", nil, false
+		}
+		if !first && o.Amount.Commodity != commodity {
+			return "", nil, false
+		}
+		commodity, first = o.Amount.Commodity, false
+		sum.Add(sum, o.Amount.Quantity)
+	}
+	if first {
+		return "", nil, false
+	}
+	return commodity, sum.Neg(sum), true
+}
+
+// PostingLines returns the range of t.Raw, [start, end), holding p (which
+// must be one of t's postings) and any comment lines after it.
+func (t *Transaction) PostingLines(p *Posting) (start, end int) {
+	start = p.Line - t.Line
+	end = start + 1
+	for end < len(t.Raw) && isIndentedComment(trimCR(t.Raw[end])) {
+		end++
+	}
+	return start, end
+}
+
+// AutomatedTransaction is an `= PREDICATE` transaction.
+type AutomatedTransaction struct {
+	Source
+	Predicate string
+	Notes     []string
+	Tags      Tags
+	Postings  []*Posting
+}
+
+// PeriodicTransaction is a `~ PERIOD` transaction.
+type PeriodicTransaction struct {
+	Source
+	Period   string
+	Notes    []string
+	Tags     Tags
+	Postings []*Posting
+}
+
+// PostingType distinguishes real postings from virtual ones.
+type PostingType int
+
+const (
+	Real PostingType = iota
+	// Virtual postings are written as (Account) and need not balance.
+	Virtual
+	// BalancedVirtual postings are written as [Account] and must balance.
+	BalancedVirtual
+)
+
+// Posting is a single account line within a transaction.
+type Posting struct {
+	// Line is the 1-based line number of the posting itself (not of any
+	// comment lines following it).
+	Line    int
+	Raw     string
+	State   State
+	Account string
+	Type    PostingType
+	Amount  *Amount
+	Cost    *Cost
+	// Assertion is the amount after `=`, if any. AssertionOp holds the
+	// operator as written ("=", "==", "=*" or "==*").
+	Assertion   *Amount
+	AssertionOp string
+	// Notes holds the inline comment (if any) followed by any comment lines
+	// directly below the posting, without the leading ';'.
+	Notes []string
+	Tags  Tags
+}
+
+// Cost is a posting's `@ PRICE` (per-unit) or `@@ PRICE` (Total) cost.
+type Cost struct {
+	Amount *Amount
+	Total  bool
+}
+
+// Journal is a parsed journal file.
+type Journal struct {
+	Blocks []Block
+}
+
+// Lines returns the raw lines of every block, in order.
+func (j *Journal) Lines() []string {
+	n := 0
+	for _, b := range j.Blocks {
+		n += len(b.Lines())
+	}
+	lines := make([]string, 0, n)
+	for _, b := range j.Blocks {
+		lines = append(lines, b.Lines()...)
+	}
+	return lines
+}
+
+// String returns the journal as text. For an unmodified Journal, this is
+// identical to the text it was parsed from.
+func (j *Journal) String() string {
+	return strings.Join(j.Lines(), "\n")
+}
+
+// Transactions returns all regular transactions, in file order.
+func (j *Journal) Transactions() []*Transaction {
+	var ret []*Transaction
+	for _, b := range j.Blocks {
+		if t, ok := b.(*Transaction); ok {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// Directives returns all directives, in file order.
+func (j *Journal) Directives() []*Directive {
+	var ret []*Directive
+	for _, b := range j.Blocks {
+		if d, ok := b.(*Directive); ok {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// ParseError describes a line that looked like a known construct but
+// couldn't be parsed.
+type ParseError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v (line: %q)", e.Line, e.Err, e.Text)
+}
+
+func (e *ParseError) Cause() error {
+	return e.Err
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,437 @@
+package journal
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"\n",
+		fullJournal,
+		strings.ReplaceAll(fullJournal, "\n", "\r\n"),
+		"2020/01/01 no trailing newline\n    a  $1\n    b",
+	}
+	for i, test := range tests {
+		j, err := Parse(test)
+		if err != nil {
+			t.Errorf("%d: Parse() = err(%v)", i, err)
+			continue
+		}
+		if got := j.String(); got != test {
+			t.Errorf("%d: Parse().String() = %q, want %q", i, got, test)
+		}
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	j, err := Parse(fullJournal)
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+
+	type blockSummary struct {
+		kind string
+		line int
+		n    int
+	}
+	var got []blockSummary
+	for _, b := range j.Blocks {
+		kind := reflect.TypeOf(b).Elem().Name()
+		if d, ok := b.(*Directive); ok {
+			kind += ":" + d.Name
+		}
+		got = append(got, blockSummary{kind, b.StartLine(), len(b.Lines())})
+	}
+	want := []blockSummary{
+		{"Comment", 1, 2},
+		{"Blank", 3, 1},
+		{"Directive:account", 4, 3},
+		{"Directive:commodity", 7, 2},
+		{"Directive:include", 9, 1},
+		{"Directive:alias", 10, 1},
+		{"Directive:year", 11, 1},
+		{"Directive:P", 12, 1},
+		{"Blank", 13, 1},
+		{"Directive:apply account", 14, 1},
+		{"Transaction", 15, 13},
+		{"Blank", 28, 1},
+		{"Directive:end apply account", 29, 1},
+		{"Blank", 30, 1},
+		{"AutomatedTransaction", 31, 2},
+		{"Blank", 33, 1},
+		{"PeriodicTransaction", 34, 3},
+		{"Blank", 37, 1},
+		{"Comment", 38, 3},
+		{"Blank", 41, 1},
+		{"Transaction", 42, 3},
+		{"Unknown", 45, 1},
+		{"Blank", 46, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() blocks = %v, want %v", got, want)
+	}
+
+	ds := j.Directives()
+	if ds[0].Arg != "Assets:Checking" || !reflect.DeepEqual(ds[0].Body, []string{"    note main account", "    alias chq"}) {
+		t.Errorf("account directive = %+v", ds[0])
+	}
+	if ds[2].Name != "include" || ds[2].Arg != "other.ledger" {
+		t.Errorf("include directive = %+v", ds[2])
+	}
+}
+
+func TestParseTransaction(t *testing.T) {
+	j, err := Parse(fullJournal)
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+	xacts := j.Transactions()
+	if len(xacts) != 2 {
+		t.Fatalf("len(Transactions()) = %d, want 2", len(xacts))
+	}
+
+	x := xacts[0]
+	if !x.Date.Equal(time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC)) || x.DateText != "2021/03/04" {
+		t.Errorf("Date = %v (%q)", x.Date, x.DateText)
+	}
+	if x.State != Cleared || x.Code != "1234" || x.Payee != "Grocery Store" {
+		t.Errorf("header = %v %q %q", x.State, x.Code, x.Payee)
+	}
+	if !reflect.DeepEqual(x.Notes, []string{" header note", " :food:weekly:", " import-id: abc123"}) {
+		t.Errorf("Notes = %q", x.Notes)
+	}
+	wantTags := Tags{{Name: "food"}, {Name: "weekly"}, {Name: "import-id", Value: "abc123"}}
+	if !reflect.DeepEqual(x.Tags, wantTags) {
+		t.Errorf("Tags = %+v, want %+v", x.Tags, wantTags)
+	}
+
+	if len(x.Postings) != 6 {
+		t.Fatalf("len(Postings) = %d, want 6", len(x.Postings))
+	}
+	p := x.Postings[0]
+	if p.Line != 18 || p.Account != "Expenses:Food" || p.Type != Real || p.State != Uncleared {
+		t.Errorf("posting 0 = %+v", p)
+	}
+	checkAmount(t, "posting 0", p.Amount, "$", "45.10", 2, true)
+	if !reflect.DeepEqual(p.Notes, []string{" groceries", " typed:: 5"}) || !reflect.DeepEqual(p.Tags, Tags{{Name: "typed", Value: "5", Typed: true}}) {
+		t.Errorf("posting 0 notes = %q, tags = %+v", p.Notes, p.Tags)
+	}
+
+	p = x.Postings[1]
+	if p.Account != "Assets:Brokerage" || p.State != Pending || p.Cost == nil || p.Cost.Total {
+		t.Errorf("posting 1 = %+v", p)
+	}
+	checkAmount(t, "posting 1", p.Amount, `"XBAL.TO"`, "10", 0, false)
+	checkAmount(t, "posting 1 lot", p.Amount.LotPrice, "CAD", "25.5", 1, true)
+	if p.Amount.LotDate != "2020/01/01" || p.Amount.LotNote != "note" {
+		t.Errorf("posting 1 lot = %q %q", p.Amount.LotDate, p.Amount.LotNote)
+	}
+	checkAmount(t, "posting 1 cost", p.Cost.Amount, "CAD", "26", 0, true)
+
+	p = x.Postings[2]
+	if p.Type != Virtual || p.Account != "Budget:Food" {
+		t.Errorf("posting 2 = %+v", p)
+	}
+	checkAmount(t, "posting 2", p.Amount, "EUR", "-1234.5", 1, false)
+	if p.Cost == nil || !p.Cost.Total {
+		t.Errorf("posting 2 cost = %+v", p.Cost)
+	}
+
+	p = x.Postings[3]
+	if p.Type != BalancedVirtual || p.Account != "Savings" || p.Amount == nil || !p.Amount.Expr {
+		t.Errorf("posting 3 = %+v", p)
+	}
+
+	p = x.Postings[4]
+	if p.Amount != nil || p.AssertionOp != "=" {
+		t.Errorf("posting 4 = %+v", p)
+	}
+	checkAmount(t, "posting 4 assertion", p.Assertion, "$", "-100", 0, true)
+
+	p = x.Postings[5]
+	if p.Account != "Assets:Checking" || p.Amount != nil || p.Assertion != nil || p.State != Cleared {
+		t.Errorf("posting 5 = %+v", p)
+	}
+
+	if xacts[1].Payee != "" || xacts[1].State != Uncleared || len(xacts[1].Postings) != 2 {
+		t.Errorf("transaction 1 = %+v", xacts[1])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantLine int
+	}{
+		{"2020/13/01 bad month\n    a  $1\n", 1},
+		{"\n2020/01/01 x\n    a  $\n", 3},
+		{"2020/01/01 x\n    a  $1 @\n", 2},
+		{"2020/01/01 x\n    a  $1 garbage\n", 2},
+		{"2020/01/01 x\n    a  $1 {$2\n", 2},
+	}
+	for i, test := range tests {
+		_, err := Parse(test.in)
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%d: Parse() = err(%v), want *ParseError", i, err)
+			continue
+		}
+		if pe.Line != test.wantLine {
+			t.Errorf("%d: Parse() error line = %d, want %d", i, pe.Line, test.wantLine)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in            string
+		wantCommodity string
+		wantQuantity  string
+		wantPrecision int
+		wantPrefix    bool
+		wantSpaced    bool
+		wantErr       bool
+	}{
+		{"$5", "$", "5", 0, true, false, false},
+		{"-$5.00", "$", "-5", 2, true, false, false},
+		{"$-2362.25", "$", "-2362.25", 2, true, false, false},
+		{"$ 1,000.5", "$", "1000.5", 1, true, true, false},
+		{"10 AAPL", "AAPL", "10", 0, false, true, false},
+		{"10AAPL", "AAPL", "10", 0, false, false, false},
+		{"-3.5 \"XBAL.TO\"", "\"XBAL.TO\"", "-3.5", 1, false, true, false},
+		{"1.000,25 EUR", "EUR", "1000.25", 2, false, true, false},
+		{"USD$4382.385283", "USD$", "4382.385283", 6, true, false, false},
+		{"42", "", "42", 0, false, false, false},
+		{"$", "", "", 0, false, false, true},
+		{"\"unterminated 5", "", "", 0, false, false, true},
+		{"5 USD extra", "", "", 0, false, false, true},
+	}
+	for _, test := range tests {
+		a, err := parseAmount(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseAmount(%s) = err(%v), want non-nil error %v", test.in, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		checkAmount(t, test.in, a, test.wantCommodity, test.wantQuantity, test.wantPrecision, test.wantPrefix)
+		if a.Spaced != test.wantSpaced {
+			t.Errorf("parseAmount(%s).Spaced = %v, want %v", test.in, a.Spaced, test.wantSpaced)
+		}
+	}
+}
+
+func TestQuoteCommodity(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"AAPL", "AAPL"},
+		{"$", "$"},
+		{"VFV.TO", `"VFV.TO"`},
+		{"S&P 500", `"S&P 500"`},
+	}
+	for _, test := range tests {
+		if got := QuoteCommodity(test.in); got != test.want {
+			t.Errorf("QuoteCommodity(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Tags
+	}{
+		{"", nil},
+		{" just a comment", nil},
+		{" :a:b:", Tags{{Name: "a"}, {Name: "b"}}},
+		{" lift tickets :fun:", Tags{{Name: "fun"}}},
+		{" Payee: Someone Else", Tags{{Name: "Payee", Value: "Someone Else"}}},
+		{" amount:: $-236", Tags{{Name: "amount", Value: "$-236", Typed: true}}},
+		{" empty:", Tags{{Name: "empty"}}},
+		{" see http://example.com", nil},
+	}
+	for _, test := range tests {
+		if got := parseTags(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseTags(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+
+	ts := Tags{{Name: "a", Value: "1"}, {Name: "b"}}
+	if v, ok := ts.Get("a"); !ok || v != "1" {
+		t.Errorf("Get(a) = %q, %v", v, ok)
+	}
+	if !ts.Has("b") || ts.Has("c") {
+		t.Errorf("Has() failed")
+	}
+}
+
+func TestAddNote(t *testing.T) {
+	tests := []struct {
+		in   string
+		note string
+		want string
+	}{
+		{"2020/01/01 x\n  a  $1\n  b", " source: f", "2020/01/01 x\n  ; source: f\n  a  $1\n  b"},
+		{"2020/01/01 x\n    ; one\n    a  $1\n    b", " two", "2020/01/01 x\n    ; one\n    ; two\n    a  $1\n    b"},
+		{"2020/01/01 x", " n", "2020/01/01 x\n    ; n"},
+	}
+	for i, test := range tests {
+		j, err := Parse(test.in)
+		if err != nil {
+			t.Fatalf("%d: Parse() = err(%v)", i, err)
+		}
+		tr := j.Transactions()[0]
+		tr.AddNote(test.note)
+		if got := j.String(); got != test.want {
+			t.Errorf("%d: AddNote() = %q, want %q", i, got, test.want)
+		}
+		if n := tr.Notes[len(tr.Notes)-1]; n != test.note {
+			t.Errorf("%d: AddNote() note = %q, want %q", i, n, test.note)
+		}
+	}
+
+	j, _ := Parse("2020/01/01 x\n    a  $1\n    b")
+	tr := j.Transactions()[0]
+	tr.AddNote(" source: f")
+	if v, _ := tr.Tags.Get("source"); v != "f" {
+		t.Errorf("AddNote() tag = %q, want %q", v, "f")
+	}
+}
+
+func TestPostingAmount(t *testing.T) {
+	tests := []struct {
+		in            string
+		posting       int
+		wantCommodity string
+		wantQuantity  string
+		wantOK        bool
+	}{
+		{"2020/01/01 x\n    a  $1.50\n    b", 0, "$", "3/2", true},
+		{"2020/01/01 x\n    a  $1.50\n    b", 1, "$", "-3/2", true},
+		{"2020/01/01 x\n    a  $1.50\n    c  $2\n    (v)  $7\n    b", 3, "$", "-7/2", true},
+		{"2020/01/01 x\n    a  $1.50\n    c  1 EUR\n    b", 2, "", "", false},
+		{"2020/01/01 x\n    a  10 AAPL @ $5\n    b", 1, "", "", false},
+		{"2020/01/01 x\n    a\n    b", 1, "", "", false},
+		{"2020/01/01 x\n    (a)", 0, "", "", false},
+	}
+	for i, test := range tests {
+		j, err := Parse(test.in)
+		if err != nil {
+			t.Fatalf("%d: Parse() = err(%v)", i, err)
+		}
+		tr := j.Transactions()[0]
+		c, q, ok := tr.PostingAmount(tr.Postings[test.posting])
+		if ok != test.wantOK || c != test.wantCommodity || (ok && q.RatString() != test.wantQuantity) {
+			t.Errorf("%d: PostingAmount() = %q, %v, %v, want %q, %s, %v", i, c, q, ok, test.wantCommodity, test.wantQuantity, test.wantOK)
+		}
+	}
+}
+
+func TestPostingLines(t *testing.T) {
+	j, err := Parse("\n2020/01/01 x\n    ; note\n    a  $1\n    ; a note\n    ; another\n    b\n")
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+	tr := j.Transactions()[0]
+	if start, end := tr.PostingLines(tr.Postings[0]); start != 2 || end != 5 {
+		t.Errorf("PostingLines(a) = %d, %d, want 2, 5", start, end)
+	}
+	if start, end := tr.PostingLines(tr.Postings[1]); start != 5 || end != 6 {
+		t.Errorf("PostingLines(b) = %d, %d, want 5, 6", start, end)
+	}
+}
+
+func TestSplitDirective(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantName string
+		wantArg  string
+		wantOK   bool
+	}{
+		{"account Assets:Cash", "account", "Assets:Cash", true},
+		{"!include foo.ledger", "include", "foo.ledger", true},
+		{"@include  foo.ledger", "include", "foo.ledger", true},
+		{"apply account Assets:Bank", "apply account", "Assets:Bank", true},
+		{"apply tag  hashtag: foo", "apply tag", "hashtag: foo", true},
+		{"end apply account", "end apply account", "", true},
+		{"end tag", "end tag", "", true},
+		{"end", "end", "", true},
+		{"P 2021/01/01 GOOG $5", "P", "2021/01/01 GOOG $5", true},
+		{"Y 2021", "Y", "2021", true},
+		{"--decimal-comma", "option", "decimal-comma", true},
+		{"Payee", "", "", false},
+		{"asdf", "", "", false},
+	}
+	for _, test := range tests {
+		name, arg, ok := splitDirective(test.line)
+		if name != test.wantName || arg != test.wantArg || ok != test.wantOK {
+			t.Errorf("splitDirective(%s) = %q, %q, %v, want %q, %q, %v", test.line, name, arg, ok, test.wantName, test.wantArg, test.wantOK)
+		}
+	}
+}
+
+func checkAmount(t *testing.T, desc string, a *Amount, commodity, quantity string, precision int, prefix bool) {
+	t.Helper()
+	if a == nil {
+		t.Errorf("%s: amount is nil", desc)
+		return
+	}
+	want, _ := new(big.Rat).SetString(quantity)
+	if a.Commodity != commodity || a.Quantity == nil || a.Quantity.Cmp(want) != 0 || a.Precision != precision || a.Prefix != prefix {
+		t.Errorf("%s: amount = {%q %v %d %v}, want {%q %s %d %v}", desc, a.Commodity, a.Quantity, a.Precision, a.Prefix, commodity, quantity, precision, prefix)
+	}
+}
+
+const fullJournal = `; vim:filetype=ledger
+# another comment style
+
+account Assets:Checking
+    note main account
+    alias chq
+commodity $
+    format $1,000.00
+include other.ledger
+alias chq=Assets:Checking
+year 2021
+P 2021/03/01 00:00:00 GOOG $2000
+
+apply account Personal
+2021/03/04 * (1234) Grocery Store  ; header note
+    ; :food:weekly:
+    ; import-id: abc123
+    Expenses:Food                    $45.10  ; groceries
+    ; typed:: 5
+    ! Assets:Brokerage    10 "XBAL.TO" {CAD 25.5} [2020/01/01] (note) @ CAD 26
+    (Budget:Food)         -1234.5 EUR @@ $1,300.00
+    [Savings]             ($10 * 2)
+    Liabilities:Visa      = $-100
+    * Assets:Checking
+    ; trailing posting comment
+    ; another
+    ; and another
+
+end apply account
+
+= expr account =~ /Food/
+    (Budget:Food)  -1
+
+~ monthly
+    Expenses:Rent  $1000
+    Assets:Checking
+
+comment
+this is all ignored
+end comment
+
+2021/03/05
+    a  $1
+    b
+asdf
+`
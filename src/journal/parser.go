@@ -0,0 +1,493 @@
+package journal
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// single-character directives, which must be followed by whitespace
+	charDirectives = map[string]struct{}{
+		"A": {}, "C": {}, "D": {}, "N": {}, "P": {}, "Y": {},
+		"b": {}, "h": {}, "i": {}, "I": {}, "o": {}, "O": {},
+	}
+
+	wordDirectives = map[string]struct{}{
+		"account": {}, "alias": {}, "apply": {}, "assert": {}, "bucket": {},
+		"capture": {}, "check": {}, "comment": {}, "commodity": {}, "def": {}, "define": {},
+		"end": {}, "eval": {}, "expr": {}, "import": {}, "include": {},
+		"payee": {}, "python": {}, "tag": {}, "test": {}, "value": {},
+		"year": {},
+	}
+)
+
+// ReadFile parses the journal at path.
+func ReadFile(path string) (*Journal, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	j, err := Parse(string(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parse(%s)", path)
+	}
+	return j, nil
+}
+
+// Parse parses the text of a journal.
+func Parse(s string) (*Journal, error) {
+	return ParseLines(strings.Split(s, "\n"))
+}
+
+// ParseLines parses a journal that has already been split on "\n".
+func ParseLines(lines []string) (*Journal, error) {
+	p := &parser{lines: lines, years: []int{Now().Year()}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return &Journal{Blocks: p.blocks}, nil
+}
+
+type parser struct {
+	lines  []string
+	i      int
+	blocks []Block
+	// years holds the default year for dates without one, as set by `year`,
+	// `Y` and `apply year` directives. The last element is current.
+	years []int
+}
+
+func (p *parser) parse() error {
+	for p.i < len(p.lines) {
+		line := trimCR(p.lines[p.i])
+		var b Block
+		var err error
+		switch {
+		case isBlank(line):
+			b = &Blank{p.takeWhile(isBlank)}
+		case isIndented(line):
+			b = p.parseStrayIndented()
+		case isCommentLine(line):
+			b = &Comment{p.takeWhile(isCommentLine)}
+		case isDigit(line[0]):
+			b, err = p.parseTransaction()
+		case line[0] == '=':
+			b, err = p.parseAutomatedTransaction()
+		case line[0] == '~':
+			b, err = p.parsePeriodicTransaction()
+		default:
+			b, err = p.parseDirective()
+		}
+		if err != nil {
+			return err
+		}
+		p.blocks = append(p.blocks, b)
+	}
+	return nil
+}
+
+// takeWhile consumes lines starting at the current one for as long as f
+// returns true (always taking at least one line).
+func (p *parser) takeWhile(f func(string) bool) Source {
+	start := p.i
+	p.i++
+	for p.i < len(p.lines) && f(trimCR(p.lines[p.i])) {
+		p.i++
+	}
+	return p.source(start)
+}
+
+// takeBody consumes indented, non-blank lines following the current line.
+func (p *parser) takeBody() {
+	p.i++
+	for p.i < len(p.lines) {
+		l := trimCR(p.lines[p.i])
+		if isBlank(l) || !isIndented(l) {
+			break
+		}
+		p.i++
+	}
+}
+
+func (p *parser) source(start int) Source {
+	return Source{Line: start + 1, Raw: p.lines[start:p.i:p.i]}
+}
+
+// parseStrayIndented handles an indented line that isn't part of a
+// transaction or directive.
+func (p *parser) parseStrayIndented() Block {
+	if isIndentedComment(trimCR(p.lines[p.i])) {
+		return &Comment{p.takeWhile(isIndentedComment)}
+	}
+	start := p.i
+	p.takeBody()
+	return &Unknown{p.source(start)}
+}
+
+func (p *parser) parseDirective() (Block, error) {
+	start := p.i
+	line := trimCR(p.lines[p.i])
+	name, arg, ok := splitDirective(line)
+	if !ok {
+		p.takeBody()
+		return &Unknown{p.source(start)}, nil
+	}
+
+	if name == "comment" || name == "test" {
+		end := "end " + name
+		p.i++
+		for p.i < len(p.lines) {
+			l := strings.TrimSpace(p.lines[p.i])
+			p.i++
+			if l == end {
+				break
+			}
+		}
+		return &Comment{p.source(start)}, nil
+	}
+
+	if err := p.updateYear(name, arg); err != nil {
+		return nil, &ParseError{Line: start + 1, Text: line, Err: err}
+	}
+
+	p.takeBody()
+	src := p.source(start)
+	return &Directive{Source: src, Name: name, Arg: arg, Body: src.Raw[1:]}, nil
+}
+
+// updateYear tracks the default year for dates that don't specify one.
+func (p *parser) updateYear(name, arg string) error {
+	switch name {
+	case "year", "Y", "apply year":
+		y, err := strconv.Atoi(arg)
+		if err != nil {
+			return errors.Wrapf(err, "strconv.Atoi(%s)", arg)
+		}
+		if name == "apply year" {
+			p.years = append(p.years, y)
+		} else {
+			p.years[len(p.years)-1] = y
+		}
+	case "end apply year":
+		if len(p.years) > 1 {
+			p.years = p.years[:len(p.years)-1]
+		}
+	}
+	return nil
+}
+
+// splitDirective splits a directive line into its normalized name and
+// argument.
+func splitDirective(line string) (name, arg string, ok bool) {
+	if line[0] == '!' || line[0] == '@' {
+		line = line[1:]
+	}
+	if strings.HasPrefix(line, "--") {
+		return "option", strings.TrimSpace(line[2:]), true
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	name = fields[0]
+	_, isChar := charDirectives[name]
+	_, isWord := wordDirectives[name]
+	if !isChar && !isWord {
+		return "", "", false
+	}
+
+	n := 1
+	switch name {
+	case "apply":
+		n = 2
+	case "end":
+		n = len(fields)
+		if len(fields) > 1 && fields[1] == "apply" {
+			n = 3
+		}
+	}
+	if n > len(fields) {
+		n = len(fields)
+	}
+	name = strings.Join(fields[:n], " ")
+	rest := line
+	for k := 0; k < n; k++ {
+		rest = strings.TrimLeft(rest, " \t")
+		rest = rest[len(fields[k]):]
+	}
+	return name, strings.TrimSpace(rest), true
+}
+
+func (p *parser) parseTransaction() (Block, error) {
+	start := p.i
+	header := trimCR(p.lines[p.i])
+	t := &Transaction{}
+	if err := t.parseHeader(header, p.years[len(p.years)-1]); err != nil {
+		return nil, &ParseError{Line: start + 1, Text: header, Err: err}
+	}
+	postings, notes, err := p.parsePostings()
+	if err != nil {
+		return nil, err
+	}
+	t.Source = p.source(start)
+	t.Postings = postings
+	t.Notes = append(t.Notes, notes...)
+	t.Tags = parseAllTags(t.Notes)
+	return t, nil
+}
+
+func (p *parser) parseAutomatedTransaction() (Block, error) {
+	start := p.i
+	t := &AutomatedTransaction{Predicate: strings.TrimSpace(trimCR(p.lines[p.i])[1:])}
+	postings, notes, err := p.parsePostings()
+	if err != nil {
+		return nil, err
+	}
+	t.Source = p.source(start)
+	t.Postings = postings
+	t.Notes = notes
+	t.Tags = parseAllTags(t.Notes)
+	return t, nil
+}
+
+func (p *parser) parsePeriodicTransaction() (Block, error) {
+	start := p.i
+	t := &PeriodicTransaction{Period: strings.TrimSpace(trimCR(p.lines[p.i])[1:])}
+	postings, notes, err := p.parsePostings()
+	if err != nil {
+		return nil, err
+	}
+	t.Source = p.source(start)
+	t.Postings = postings
+	t.Notes = notes
+	t.Tags = parseAllTags(t.Notes)
+	return t, nil
+}
+
+// parsePostings consumes the indented lines following a transaction header.
+// Comment lines before the first posting are returned as transaction-level
+// notes; later ones are attached to the posting above them.
+func (p *parser) parsePostings() ([]*Posting, []string, error) {
+	var postings []*Posting
+	var notes []string
+	p.i++
+	for p.i < len(p.lines) {
+		line := trimCR(p.lines[p.i])
+		if isBlank(line) || !isIndented(line) {
+			break
+		}
+		content := strings.TrimSpace(line)
+		if content[0] == ';' {
+			if len(postings) == 0 {
+				notes = append(notes, content[1:])
+			} else {
+				last := postings[len(postings)-1]
+				last.Notes = append(last.Notes, content[1:])
+				last.Tags = append(last.Tags, parseTags(content[1:])...)
+			}
+		} else {
+			posting, err := parsePosting(content)
+			if err != nil {
+				return nil, nil, &ParseError{Line: p.i + 1, Text: line, Err: err}
+			}
+			posting.Line = p.i + 1
+			posting.Raw = p.lines[p.i]
+			postings = append(postings, posting)
+		}
+		p.i++
+	}
+	return postings, notes, nil
+}
+
+// parseHeader parses `DATE[=AUXDATE] [STATE] [(CODE)] PAYEE [; NOTE]`.
+func (t *Transaction) parseHeader(line string, defaultYear int) error {
+	end := strings.IndexAny(line, " \t")
+	if end < 0 {
+		end = len(line)
+	}
+	dates := line[:end]
+	rest := strings.TrimSpace(line[end:])
+
+	var err error
+	t.Date, t.AuxDate, err = parseDates(dates, defaultYear)
+	if err != nil {
+		return errors.Wrapf(err, "parseDates(%s)", dates)
+	}
+	t.DateText = dates
+	if i := strings.IndexByte(dates, '='); i >= 0 {
+		t.DateText, t.AuxDateText = dates[:i], dates[i+1:]
+	}
+
+	t.State, rest = parseState(rest)
+
+	if strings.HasPrefix(rest, "(") {
+		if end := strings.IndexByte(rest, ')'); end >= 0 {
+			t.Code = rest[1:end]
+			rest = strings.TrimSpace(rest[end+1:])
+		}
+	}
+
+	if i := strings.IndexByte(rest, ';'); i >= 0 {
+		t.Notes = append(t.Notes, rest[i+1:])
+		rest = rest[:i]
+	}
+	t.Payee = strings.TrimSpace(rest)
+	return nil
+}
+
+// parsePosting parses
+// `[STATE] ACCOUNT  [AMOUNT] [@ COST | @@ COST] [= ASSERTION] [; NOTE]`,
+// with leading indentation already removed.
+func parsePosting(s string) (*Posting, error) {
+	p := &Posting{}
+	p.State, s = parseState(s)
+
+	end := len(s)
+	if i := strings.Index(s, "  "); i >= 0 {
+		end = i
+	}
+	if i := strings.IndexByte(s, '\t'); i >= 0 && i < end {
+		end = i
+	}
+	account := strings.TrimSpace(s[:end])
+	rest := s[end:]
+	if strings.HasSuffix(account, ";") || strings.Contains(account, " ;") {
+		// e.g. "Assets:Cash ; note" with only a single space before the note
+		i := strings.IndexByte(account, ';')
+		rest = account[i:] + rest
+		account = strings.TrimSpace(account[:i])
+	}
+	p.Account, p.Type = parseAccount(account)
+	if p.Account == "" {
+		return nil, errors.New("missing account name")
+	}
+
+	if i := indexOutside(rest, ";"); i >= 0 {
+		p.Notes = append(p.Notes, rest[i+1:])
+		p.Tags = parseTags(rest[i+1:])
+		rest = rest[:i]
+	}
+
+	if i := indexOutside(rest, "="); i >= 0 {
+		assertion := rest[i:]
+		op := "="
+		for _, o := range []string{"==*", "=*", "=="} {
+			if strings.HasPrefix(assertion, o) {
+				op = o
+				break
+			}
+		}
+		a, err := parseAmount(assertion[len(op):])
+		if err != nil {
+			return nil, errors.Wrap(err, "balance assertion")
+		}
+		p.Assertion = a
+		p.AssertionOp = op
+		rest = rest[:i]
+	}
+
+	if i := indexOutside(rest, "@"); i >= 0 {
+		cost := rest[i+1:]
+		total := strings.HasPrefix(cost, "@")
+		if total {
+			cost = cost[1:]
+		}
+		a, err := parseAmount(cost)
+		if err != nil {
+			return nil, errors.Wrap(err, "cost")
+		}
+		if a == nil {
+			return nil, errors.New("missing cost amount")
+		}
+		p.Cost = &Cost{Amount: a, Total: total}
+		rest = rest[:i]
+	}
+
+	a, err := parseAmount(rest)
+	if err != nil {
+		return nil, errors.Wrap(err, "amount")
+	}
+	p.Amount = a
+	return p, nil
+}
+
+func parseAccount(s string) (string, PostingType) {
+	if len(s) >= 2 {
+		switch {
+		case s[0] == '(' && s[len(s)-1] == ')':
+			return s[1 : len(s)-1], Virtual
+		case s[0] == '[' && s[len(s)-1] == ']':
+			return s[1 : len(s)-1], BalancedVirtual
+		}
+	}
+	return s, Real
+}
+
+func parseState(s string) (State, string) {
+	if len(s) > 0 {
+		switch s[0] {
+		case '*':
+			return Cleared, strings.TrimSpace(s[1:])
+		case '!':
+			return Pending, strings.TrimSpace(s[1:])
+		}
+	}
+	return Uncleared, s
+}
+
+// indexOutside returns the index of the first occurrence of sep in s that
+// isn't inside quotes, parentheses, braces or brackets.
+func indexOutside(s, sep string) int {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' || c == '}' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			return i
+		}
+	}
+	return -1
+}
+
+func trimCR(s string) string {
+	return strings.TrimSuffix(s, "\r")
+}
+
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+func isIndented(s string) bool {
+	return s != "" && (s[0] == ' ' || s[0] == '\t')
+}
+
+func indentation(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+func isIndentedComment(s string) bool {
+	t := strings.TrimSpace(s)
+	return isIndented(s) && strings.HasPrefix(t, ";")
+}
+
+// isCommentLine reports whether s is a top-level comment line.
+func isCommentLine(s string) bool {
+	return s != "" && strings.IndexByte(";#%|*", s[0]) >= 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
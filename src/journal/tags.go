@@ -0,0 +1,79 @@
+package journal
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// "; Key: value" or "; Key:: value" (typed)
+	tagValueRx = regexp.MustCompile(`^([^\s:]+)(::?)(?:\s+(.*))?$`)
+	// ":tag1:tag2:"
+	tagListRx = regexp.MustCompile(`^:(?:[^\s:]+:)+$`)
+)
+
+// Tag is a piece of metadata attached to a transaction or posting, either a
+// bare tag (`:tag:`), a `Name: value` pair, or a typed `Name:: value` pair.
+type Tag struct {
+	Name  string
+	Value string
+	Typed bool
+}
+
+// Tags is an ordered list of metadata.
+type Tags []Tag
+
+// Get returns the value of the first tag called name.
+func (ts Tags) Get(name string) (string, bool) {
+	for _, t := range ts {
+		if t.Name == name {
+			return t.Value, true
+		}
+	}
+	return "", false
+}
+
+// Has reports whether a tag called name is present.
+func (ts Tags) Has(name string) bool {
+	_, ok := ts.Get(name)
+	return ok
+}
+
+// parseTags extracts metadata from a single comment (with the ';' already
+// removed).
+func parseTags(note string) Tags {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil
+	}
+
+	var ts Tags
+	if m := tagValueRx.FindStringSubmatch(note); m != nil {
+		ts = append(ts, Tag{Name: m[1], Value: strings.TrimSpace(m[3]), Typed: m[2] == "::"})
+		return ts
+	}
+
+	for _, field := range strings.Fields(note) {
+		if !tagListRx.MatchString(field) {
+			continue
+		}
+		for _, name := range strings.Split(strings.Trim(field, ":"), ":") {
+			ts = append(ts, Tag{Name: name})
+		}
+	}
+	return ts
+}
+
+// ParseTags extracts metadata from comments (with their ';' already
+// removed), such as the ones in a directive's body.
+func ParseTags(notes []string) Tags {
+	return parseAllTags(notes)
+}
+
+func parseAllTags(notes []string) Tags {
+	var ts Tags
+	for _, n := range notes {
+		ts = append(ts, parseTags(n)...)
+	}
+	return ts
+}
@@ -0,0 +1,291 @@
+package lib
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/diff"
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+var (
+	// overridable for testing
+	outWriter io.Writer = os.Stdout
+
+	// ErrNotFormatted is returned by FormatFile in Check mode if the file
+	// isn't already formatted.
+	ErrNotFormatted = errors.New("file is not formatted")
+)
+
+const (
+	DefaultIndent = 4
+	// DefaultAmountColumn is the column amounts end at, the same as
+	// ledger-mode's default.
+	DefaultAmountColumn = 52
+)
+
+type Formatter struct {
+	// Indent is the number of spaces postings (and comments within
+	// transactions) are indented by.
+	Indent int
+	// AmountColumn is the column that posting amounts are right-aligned to
+	// end at. If it's 0, amounts are aligned within each transaction, 2
+	// spaces after its longest account. Amounts that don't fit are written 2
+	// spaces after their account.
+	AmountColumn int
+	// DateSeparator, if set, is the separator written in transaction dates
+	// (one of `/`, `-` or `.`), which are also zero-padded.
+	DateSeparator string
+
+	// If any of Check, Diff or Stdout are set, the file is left untouched.
+	// Check makes FormatFile return ErrNotFormatted if formatting would change
+	// the file. Diff prints a unified diff of what formatting would change,
+	// and Stdout prints the formatted file.
+	Check  bool
+	Diff   bool
+	Stdout bool
+
+	// Backups is the number of backup copies of the original file to keep
+	// when formatting in-place.
+	Backups int
+}
+
+// FormatFile formats the journal at path.
+func (f *Formatter) FormatFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	formatted, err := f.Format(string(b))
+	if err != nil {
+		return errors.Wrapf(err, "Format(%s)", path)
+	}
+
+	if !f.Check && !f.Diff && !f.Stdout {
+		if formatted == string(b) {
+			return nil
+		}
+		return errors.Wrapf(fs.WriteFileAtomic(path, []byte(formatted), 0644, f.Backups), "fs.WriteFileAtomic(%s)", path)
+	}
+
+	if f.Diff {
+		if _, err := io.WriteString(outWriter, diff.Unified(path, path+" (formatted)", string(b), formatted)); err != nil {
+			return errors.Wrap(err, "io.WriteString(diff)")
+		}
+	}
+	if f.Stdout {
+		if _, err := io.WriteString(outWriter, formatted); err != nil {
+			return errors.Wrap(err, "io.WriteString(formatted)")
+		}
+	}
+	if f.Check && formatted != string(b) {
+		return ErrNotFormatted
+	}
+	return nil
+}
+
+// Format returns the formatted text of a journal. Transactions (including
+// automated and periodic ones) are re-indented, with their amounts aligned
+// and their dates normalized, and runs of blank lines are collapsed into
+// one. Comments, metadata, directives and anything unrecognized are kept
+// exactly as they are, apart from the indentation of comments within
+// transactions.
+func (f *Formatter) Format(s string) (string, error) {
+	switch f.DateSeparator {
+	case "", "/", "-", ".":
+	default:
+		return "", errors.Errorf("invalid date separator %q", f.DateSeparator)
+	}
+
+	j, err := journal.Parse(s)
+	if err != nil {
+		return "", errors.Wrap(err, "journal.Parse()")
+	}
+	eol := ""
+	if strings.HasSuffix(strings.SplitN(s, "\n", 2)[0], "\r") {
+		eol = "\r"
+	}
+
+	var out []string
+	blank, lastWasTransaction := false, false
+	for _, b := range j.Blocks {
+		if _, ok := b.(*journal.Blank); ok {
+			blank = len(out) > 0
+			continue
+		}
+		lines, isTransaction := f.formatBlock(b, eol)
+		if blank || (isTransaction && lastWasTransaction) {
+			out = append(out, eol)
+		}
+		out = append(out, lines...)
+		blank, lastWasTransaction = false, isTransaction
+	}
+	if len(out) == 0 {
+		return "", nil
+	}
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// formatBlock returns the formatted lines of b, and whether it's a (regular,
+// automated or periodic) transaction.
+func (f *Formatter) formatBlock(b journal.Block, eol string) ([]string, bool) {
+	var header string
+	var source *journal.Source
+	var postings []*journal.Posting
+	switch t := b.(type) {
+	case *journal.Transaction:
+		header, source, postings = f.formatHeader(t), &t.Source, t.Postings
+	case *journal.AutomatedTransaction:
+		header, source, postings = trimHeader(t.Raw[0]), &t.Source, t.Postings
+	case *journal.PeriodicTransaction:
+		header, source, postings = trimHeader(t.Raw[0]), &t.Source, t.Postings
+	default:
+		return b.Lines(), false
+	}
+
+	indent := strings.Repeat(" ", f.Indent)
+	column := f.AmountColumn
+	if column == 0 {
+		for _, p := range postings {
+			if amount, _ := amountText(p); amount != "" {
+				column = max(column, f.Indent+utf8.RuneCountInString(accountText(p))+2+utf8.RuneCountInString(amount))
+			}
+		}
+	}
+
+	lines := []string{header + eol}
+	byLine := make(map[int]*journal.Posting, len(postings))
+	for _, p := range postings {
+		byLine[p.Line] = p
+	}
+	for i, raw := range source.Raw[1:] {
+		raw = strings.TrimSuffix(raw, "\r")
+		if p, ok := byLine[source.Line+1+i]; ok {
+			lines = append(lines, f.formatPosting(p, source.Raw[i+2:], indent, column)+eol)
+		} else {
+			// a comment line
+			lines = append(lines, indent+strings.TrimLeft(raw, " \t")+eol)
+		}
+	}
+	return lines, true
+}
+
+// formatHeader returns t's header line, with its dates normalized.
+func (f *Formatter) formatHeader(t *journal.Transaction) string {
+	line := strings.TrimSuffix(t.Raw[0], "\r")
+	end := strings.IndexAny(line, " \t")
+	if end < 0 {
+		end = len(line)
+	}
+	dates, rest := line[:end], trimHeader(line[end:])
+	if f.DateSeparator != "" {
+		dates = f.formatDate(t.Date, t.DateText)
+		if t.AuxDateText != "" {
+			dates += "=" + f.formatDate(t.AuxDate, t.AuxDateText)
+		}
+	}
+	if rest == "" {
+		return dates
+	}
+	return dates + " " + strings.TrimLeft(rest, " \t")
+}
+
+// formatDate writes d with the DateSeparator, leaving out the year if the
+// original text did.
+func (f *Formatter) formatDate(d time.Time, text string) string {
+	sep := f.DateSeparator
+	if len(strings.FieldsFunc(text, isDateSeparator)) == 2 {
+		return d.Format("01" + sep + "02")
+	}
+	return d.Format("2006" + sep + "01" + sep + "02")
+}
+
+// formatPosting returns p's line, with following holding the raw lines after
+// it in its transaction.
+func (f *Formatter) formatPosting(p *journal.Posting, following []string, indent string, column int) string {
+	line := indent + accountText(p)
+	amount, tail := amountText(p)
+	if amount != "" {
+		n := max(2, column-utf8.RuneCountInString(line)-utf8.RuneCountInString(amount))
+		line += strings.Repeat(" ", n) + amount
+	}
+	if tail != "" {
+		line += " " + tail
+	}
+
+	// the first note is the inline comment, unless they're all on the
+	// following lines
+	noteLines := 0
+	for _, l := range following {
+		if t := strings.TrimSpace(l); l == "" || (l[0] != ' ' && l[0] != '\t') || !strings.HasPrefix(t, ";") {
+			break
+		}
+		noteLines++
+	}
+	if len(p.Notes) > noteLines {
+		line += "  ;" + p.Notes[0]
+	}
+	return line
+}
+
+// accountText returns p's state and account, as they're written.
+func accountText(p *journal.Posting) string {
+	var s string
+	if p.State != journal.Uncleared {
+		s = p.State.String() + " "
+	}
+	switch p.Type {
+	case journal.Virtual:
+		return s + "(" + p.Account + ")"
+	case journal.BalancedVirtual:
+		return s + "[" + p.Account + "]"
+	}
+	return s + p.Account
+}
+
+// amountText returns p's amount, which is what's aligned, and its cost and
+// balance assertion, which come after it. If p has no amount, the cost and
+// assertion are returned as the amount.
+func amountText(p *journal.Posting) (amount, tail string) {
+	var parts []string
+	if p.Cost != nil {
+		op := "@"
+		if p.Cost.Total {
+			op = "@@"
+		}
+		parts = append(parts, op+" "+p.Cost.Amount.Text)
+	}
+	if p.AssertionOp != "" {
+		a := p.AssertionOp
+		if p.Assertion != nil {
+			a += " " + p.Assertion.Text
+		}
+		parts = append(parts, a)
+	}
+	tail = strings.Join(parts, " ")
+	if p.Amount == nil {
+		return tail, ""
+	}
+	return p.Amount.Text, tail
+}
+
+// trimHeader trims trailing whitespace from a header line, unless it ends in
+// a comment.
+func trimHeader(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.Contains(line, ";") {
+		return line
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+func isDateSeparator(r rune) bool {
+	return r == '/' || r == '-' || r == '.'
+}
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"testing"
+
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashantv/gostub"
+)
+
+const formatTest = `
+
+; leading comment
+account Assets:Chequing
+  note  keep   this   as is
+
+2024-1-5=1-6 * (101) Grocery Store   ; header  note
+	; :food:
+  Expenses:Food      $45.10 ; inline
+      ; posting note
+  Assets:Chequing
+2024/01/06 ! Broker
+ Assets:Brokerage   10 "XBAL.TO" {$20.00} [2024/01/02] @ $21.00
+ * [Assets:Budget]     $-5 = $100
+ (Assets:Tracking)  = $0
+ Assets:Cash
+
+
+
+1/7 Short date
+    Expenses:Misc  5 EUR
+    Assets:Cash
+
+~ Monthly
+    Expenses:Rent  $1000
+    Assets:Chequing
+
+= expr account =~ /Food/
+    (Budget:Food)  -1
+
+
+
+`
+
+const formatTestWant52 = `; leading comment
+account Assets:Chequing
+  note  keep   this   as is
+
+2024/01/05=01/06 * (101) Grocery Store   ; header  note
+    ; :food:
+    Expenses:Food                             $45.10  ; inline
+    ; posting note
+    Assets:Chequing
+
+2024/01/06 ! Broker
+    Assets:Brokerage  10 "XBAL.TO" {$20.00} [2024/01/02] @ $21.00
+    * [Assets:Budget]                            $-5 = $100
+    (Assets:Tracking)                           = $0
+    Assets:Cash
+
+01/07 Short date
+    Expenses:Misc                              5 EUR
+    Assets:Cash
+
+~ Monthly
+    Expenses:Rent                              $1000
+    Assets:Chequing
+
+= expr account =~ /Food/
+    (Budget:Food)                                 -1
+`
+
+const formatTestWantAuto = `; leading comment
+account Assets:Chequing
+  note  keep   this   as is
+
+2024-1-5=1-6 * (101) Grocery Store   ; header  note
+  ; :food:
+  Expenses:Food  $45.10  ; inline
+  ; posting note
+  Assets:Chequing
+
+2024/01/06 ! Broker
+  Assets:Brokerage  10 "XBAL.TO" {$20.00} [2024/01/02] @ $21.00
+  * [Assets:Budget]                                $-5 = $100
+  (Assets:Tracking)                               = $0
+  Assets:Cash
+
+1/7 Short date
+  Expenses:Misc  5 EUR
+  Assets:Cash
+
+~ Monthly
+  Expenses:Rent  $1000
+  Assets:Chequing
+
+= expr account =~ /Food/
+  (Budget:Food)  -1
+`
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		f       Formatter
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{Formatter{Indent: 4, AmountColumn: 52, DateSeparator: "/"}, formatTest, formatTestWant52, false},
+		{Formatter{Indent: 2}, formatTest, formatTestWantAuto, false},
+		{Formatter{Indent: 4, AmountColumn: 52, DateSeparator: "/"}, formatTestWant52, formatTestWant52, false},
+		{Formatter{Indent: 4, DateSeparator: "-"}, "2024/01/05 x\r\n    a    1\r\n    b\r\n\r\n\r\n2024/01/06 y\r\n  a  1\r\n  b\r\n", "2024-01-05 x\r\n    a  1\r\n    b\r\n\r\n2024-01-06 y\r\n    a  1\r\n    b\r\n", false},
+		{Formatter{}, "", "", false},
+		{Formatter{}, "\n\n", "", false},
+		{Formatter{DateSeparator: "|"}, "", "", true},
+		{Formatter{}, "2024/13/01 x\n", "", true},
+	}
+	for i, test := range tests {
+		got, err := test.f.Format(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%d: Format() = err(%v), want non-nil error %v", i, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%d: Format() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	const in = "2024/01/05 x\n  a    1\n  b\n"
+	const want = "2024/01/05 x\n    a  1\n    b\n"
+	tests := []struct {
+		f        Formatter
+		in       string
+		wantFile string
+		wantOut  string
+		wantErr  error
+	}{
+		{Formatter{Indent: 4}, in, want, "", nil},
+		{Formatter{Indent: 4, Check: true}, want, want, "", nil},
+		{Formatter{Indent: 4, Check: true}, in, in, "", ErrNotFormatted},
+		{Formatter{Indent: 4, Stdout: true}, in, in, want, nil},
+		{Formatter{Indent: 4, Diff: true, Check: true}, in, in, "--- PATH\n+++ PATH (formatted)\n@@ -1,3 +1,3 @@\n 2024/01/05 x\n-  a    1\n-  b\n+    a  1\n+    b\n", ErrNotFormatted},
+	}
+	for i, test := range tests {
+		stubs := gostub.New()
+		var b bytes.Buffer
+		stubs.Stub(&outWriter, &b)
+
+		path := filepath.Join(t.TempDir(), "test.ledger")
+		if err := ioutil.WriteFile(path, []byte(test.in), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+
+		if err := test.f.FormatFile(path); err != test.wantErr {
+			t.Errorf("%d: FormatFile() = err(%v), want %v", i, err, test.wantErr)
+		}
+		if got, err := ioutil.ReadFile(path); err != nil || string(got) != test.wantFile {
+			t.Errorf("%d: FormatFile() left file as %q (err(%v)), want %q", i, got, err, test.wantFile)
+		}
+		if wantOut := strings.ReplaceAll(test.wantOut, "PATH", path); b.String() != wantOut {
+			t.Errorf("%d: FormatFile() printed %q, want %q", i, b.String(), wantOut)
+		}
+
+		stubs.Reset()
+	}
+}
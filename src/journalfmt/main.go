@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/journalfmt/lib"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	indent        = flag.Int("indent", lib.DefaultIndent, "Number of spaces to indent postings by.")
+	amountColumn  = flag.Int("amount-column", lib.DefaultAmountColumn, "Column to right-align posting amounts to. 0 aligns them within each transaction instead.")
+	dateSeparator = flag.String("date-separator", "", "Separator to write transaction dates with (\"/\", \"-\" or \".\"). Empty to leave dates as they are.")
+	check         = flag.Bool("check", false, "Don't modify the file; exit with an error if it isn't already formatted.")
+	diff          = flag.BoolP("diff", "d", false, "Don't modify the file; print a unified diff of what formatting would change.")
+	stdout        = flag.Bool("stdout", false, "Don't modify the file; print the formatted journal to stdout.")
+	backups       = flag.IntP("backups", "b", 0, "Number of backup copies of the original file to keep (as <file>.bak, <file>.bak.1, etc).")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+	if *diff && *stdout {
+		fmt.Fprintf(os.Stderr, "--diff and --stdout can't be used together\n")
+		os.Exit(1)
+	}
+
+	f := &lib.Formatter{
+		Indent:        *indent,
+		AmountColumn:  *amountColumn,
+		DateSeparator: *dateSeparator,
+		Check:         *check,
+		Diff:          *diff,
+		Stdout:        *stdout,
+		Backups:       *backups,
+	}
+	err := f.FormatFile(flag.Arg(0))
+	if errors.Is(err, lib.ErrNotFormatted) {
+		fmt.Fprintf(os.Stderr, "%s is not formatted\n", flag.Arg(0))
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,272 @@
+package lib
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	assertions "github.com/glennhartmann/ledger-tools/src/checkassertions/lib"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// check is the state of a single LintFile.
+type check struct {
+	*Linter
+	problems []*Problem
+
+	// declared accounts (and their parents), commodities and payees
+	accounts    map[string]bool
+	commodities map[string]bool
+	payees      map[string]bool
+	// closed accounts, and the date they were closed on (or a zero time if
+	// they can't be posted to at all)
+	closed map[string]time.Time
+	// commodities with prices, and the ones prices are given in
+	prices map[string]bool
+	styles assertions.Styles
+	// reported holds the accounts, commodities, etc that problems have
+	// already been reported for, so that each is only reported once
+	reported map[string]bool
+}
+
+func (c *check) enabled(r Rule) bool {
+	return !slices.Contains(c.Disabled, r)
+}
+
+func (c *check) report(path string, line int, r Rule, format string, args ...interface{}) {
+	c.problems = append(c.problems, &Problem{Path: path, Line: line, Rule: r, Message: fmt.Sprintf(format, args...)})
+}
+
+// reportOnce is like report, but only reports each key once per rule.
+func (c *check) reportOnce(key, path string, line int, r Rule, format string, args ...interface{}) {
+	key = r.String() + "\x1f" + key
+	if c.reported[key] {
+		return
+	}
+	c.reported[key] = true
+	c.report(path, line, r, format, args...)
+}
+
+// directive records the declarations in d.
+func (c *check) directive(d *journal.Directive) error {
+	arg, comment, _ := strings.Cut(d.Arg, ";")
+	arg = strings.TrimSpace(arg)
+	switch d.Name {
+	case "account":
+		for a := arg; a != ""; {
+			c.accounts[a] = true
+			i := strings.LastIndexByte(a, ':')
+			if i < 0 {
+				break
+			}
+			a = a[:i]
+		}
+		notes := []string{comment}
+		for _, line := range d.Body {
+			if l := strings.TrimSpace(line); strings.HasPrefix(l, ";") {
+				notes = append(notes, l[1:])
+			}
+		}
+		if v, ok := journal.ParseTags(notes).Get(ClosedTag); ok {
+			var date time.Time
+			if v != "" {
+				var err error
+				if date, err = journal.ParseDate(v, 0); err != nil {
+					return errors.Wrapf(err, "journal.ParseDate(%s)", v)
+				}
+			}
+			c.closed[arg] = date
+		}
+	case "commodity":
+		if strings.ContainsAny(arg, "0123456789") {
+			a, err := journal.ParseAmount(arg)
+			if err != nil {
+				return errors.Wrapf(err, "journal.ParseAmount(%s)", arg)
+			}
+			arg = a.Commodity
+		}
+		c.commodities[arg] = true
+	case "payee":
+		c.payees[arg] = true
+	case "P":
+		return c.priceDirective(arg)
+	}
+	return nil
+}
+
+// priceDirective records the commodities in a `P DATE [TIME] SYMBOL PRICE`
+// directive's argument.
+func (c *check) priceDirective(arg string) error {
+	fields := strings.Fields(arg)
+	if len(fields) > 1 && strings.Contains(fields[1], ":") {
+		fields = fields[1:]
+	}
+	if len(fields) < 3 {
+		return errors.Errorf("invalid price directive %q", arg)
+	}
+	price, err := journal.ParseAmount(strings.Join(fields[2:], " "))
+	if err != nil {
+		return errors.Wrapf(err, "journal.ParseAmount(%s)", strings.Join(fields[2:], " "))
+	}
+	c.prices[fields[1]] = true
+	c.prices[price.Commodity] = true
+	return nil
+}
+
+// transactions runs the checks that only need each transaction on its own,
+// or the ones before it in the same file.
+func (c *check) transactions(blocks []*assertions.Block) {
+	y, m, d := journal.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	last := make(map[string]*journal.Transaction)
+	codes := make(map[string]string)
+
+	for _, b := range blocks {
+		if c.Sorter.Separates(b.Block) {
+			delete(last, b.Path)
+		}
+		t, ok := b.Block.(*journal.Transaction)
+		if !ok {
+			continue
+		}
+		line := t.StartLine()
+
+		if c.enabled(FutureDate) && t.Date.After(today) {
+			c.report(b.Path, line, FutureDate, "dated %s, after today", t.Date.Format(journal.DateFormat))
+		}
+		if prev, ok := last[b.Path]; ok && c.enabled(DateOrder) && c.Sorter.Compare(prev, t) > 0 {
+			c.report(b.Path, line, DateOrder, "out of order: should come before the transaction at line %d", prev.StartLine())
+		}
+		last[b.Path] = t
+
+		if t.Code != "" && c.enabled(DuplicateCode) {
+			if at, ok := codes[t.Code]; ok {
+				c.report(b.Path, line, DuplicateCode, "code (%s) is also used at %s", t.Code, at)
+			} else {
+				codes[t.Code] = fmt.Sprintf("%s:%d", b.Path, line)
+			}
+		}
+		if len(c.payees) > 0 && len(t.Postings) > 0 && !c.payees[t.Payee] && c.enabled(UnknownPayee) {
+			c.reportOnce(t.Payee, b.Path, line, UnknownPayee, "payee %q isn't in the allowlist", t.Payee)
+		}
+
+		for i, p := range t.Postings {
+			c.posting(b.Path, t, p, b.Accounts[i])
+		}
+	}
+}
+
+// posting runs the checks on a single posting of t, to account.
+func (c *check) posting(path string, t *journal.Transaction, p *journal.Posting, account string) {
+	if len(c.accounts) > 0 && !c.accounts[account] && c.enabled(UndeclaredAccount) {
+		c.reportOnce(account, path, p.Line, UndeclaredAccount, "account %q isn't declared", account)
+	}
+	if closed, date, ok := c.closing(account); ok && (date.IsZero() || t.Date.After(date)) && c.enabled(ClosedAccount) {
+		if date.IsZero() {
+			c.report(path, p.Line, ClosedAccount, "account %q is closed", closed)
+		} else {
+			c.report(path, p.Line, ClosedAccount, "account %q was closed on %s", closed, date.Format(journal.DateFormat))
+		}
+	}
+
+	amounts := []*journal.Amount{p.Amount, p.Assertion}
+	if p.Amount != nil {
+		amounts = append(amounts, p.Amount.LotPrice)
+	}
+	if p.Cost != nil {
+		amounts = append(amounts, p.Cost.Amount)
+	}
+	for _, a := range amounts {
+		if a == nil || a.Commodity == "" {
+			continue
+		}
+		if len(c.commodities) > 0 && !c.commodities[a.Commodity] && c.enabled(UndeclaredCommodity) {
+			c.reportOnce(a.Commodity, path, p.Line, UndeclaredCommodity, "commodity %s isn't declared", a.Commodity)
+		}
+	}
+	if p.Amount != nil && p.Amount.Commodity != "" && c.PriceDB != "" && !c.prices[p.Amount.Commodity] && c.enabled(MissingPrice) {
+		c.reportOnce(p.Amount.Commodity, path, p.Line, MissingPrice, "commodity %s has no prices", p.Amount.Commodity)
+	}
+}
+
+// closing returns the closest of account and its parents that's closed, and
+// the date it was closed on. ok is false if none of them are.
+func (c *check) closing(account string) (closed string, date time.Time, ok bool) {
+	for a := account; a != ""; {
+		if date, ok := c.closed[a]; ok {
+			return a, date, true
+		}
+		i := strings.LastIndexByte(a, ':')
+		if i < 0 {
+			break
+		}
+		a = a[:i]
+	}
+	return "", time.Time{}, false
+}
+
+// balances checks that every transaction balances. Transactions are applied
+// in date order (like checkassertions does), so that balance assignments get
+// the right amounts.
+func (c *check) balances(blocks []*assertions.Block) {
+	if !c.enabled(Unbalanced) {
+		return
+	}
+	var txns []*assertions.Block
+	for _, b := range blocks {
+		if _, ok := b.Block.(*journal.Transaction); ok {
+			txns = append(txns, b)
+		}
+	}
+	sort.SliceStable(txns, func(i, j int) bool {
+		return txns[i].Block.(*journal.Transaction).Date.Before(txns[j].Block.(*journal.Transaction).Date)
+	})
+
+	bs := make(assertions.Balances)
+	for _, b := range txns {
+		t := b.Block.(*journal.Transaction)
+		amounts, err := assertions.PostingAmounts(t, b.Accounts, bs)
+		if err != nil {
+			c.report(b.Path, t.StartLine(), Unbalanced, "%v", err)
+			continue
+		}
+		for i, a := range amounts {
+			bs.Add(b.Accounts[i], a)
+		}
+
+		real, virtual, err := assertions.Residuals(t, amounts)
+		if err != nil {
+			c.report(b.Path, t.StartLine(), Unbalanced, "%v", err)
+			continue
+		}
+		if off := c.significant(real); !off.IsZero() {
+			c.report(b.Path, t.StartLine(), Unbalanced, "transaction doesn't balance: off by %s", c.styles.FormatBalance(off))
+		}
+		if off := c.significant(virtual); !off.IsZero() {
+			c.report(b.Path, t.StartLine(), Unbalanced, "balanced virtual postings don't balance: off by %s", c.styles.FormatBalance(off))
+		}
+	}
+}
+
+// significant returns the commodities in b that are big enough to show up
+// with the precision they're written with.
+func (c *check) significant(b assertions.Balance) assertions.Balance {
+	out := make(assertions.Balance)
+	for commodity, q := range b {
+		precision := 0
+		if style, ok := c.styles[commodity]; ok {
+			precision = style.Precision
+		}
+		// half of the smallest unit that can be written
+		tolerance := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Mul(big.NewInt(2), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)))
+		if new(big.Rat).Abs(q).Cmp(tolerance) >= 0 {
+			out[commodity] = q
+		}
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	assertions "github.com/glennhartmann/ledger-tools/src/checkassertions/lib"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+// Rule is a kind of problem that LintFile looks for.
+type Rule int
+
+const (
+	// UndeclaredAccount is a posting to an account without an `account`
+	// directive, if there are any. Declaring an account also declares its
+	// parents.
+	UndeclaredAccount Rule = iota
+	// UndeclaredCommodity is an amount in a commodity without a `commodity`
+	// directive, if there are any.
+	UndeclaredCommodity
+	// Unbalanced is a transaction whose postings don't add up to zero (to
+	// within the precision their commodities are written with).
+	Unbalanced
+	// ClosedAccount is a posting to an account after the date in the
+	// `closed:` metadata of its `account` directive (or at all, if it has no
+	// date).
+	ClosedAccount
+	// FutureDate is a transaction dated after today.
+	FutureDate
+	// DateOrder is a transaction that transactionsorter would move earlier in
+	// its file.
+	DateOrder
+	// DuplicateCode is a transaction with the same code as an earlier one.
+	DuplicateCode
+	// UnknownPayee is a payee that isn't in the allowlist (or declared with a
+	// `payee` directive), if there is one.
+	UnknownPayee
+	// MissingPrice is a commodity that has no prices in the price database,
+	// and isn't what any prices are given in.
+	MissingPrice
+)
+
+// RuleIDs holds the name of each Rule, as used in output and flags.
+var RuleIDs = map[Rule][]string{
+	UndeclaredAccount:   {"undeclared-account"},
+	UndeclaredCommodity: {"undeclared-commodity"},
+	Unbalanced:          {"unbalanced"},
+	ClosedAccount:       {"closed-account"},
+	FutureDate:          {"future-date"},
+	DateOrder:           {"date-order"},
+	DuplicateCode:       {"duplicate-code"},
+	UnknownPayee:        {"unknown-payee"},
+	MissingPrice:        {"missing-price"},
+}
+
+func (r Rule) String() string {
+	return RuleIDs[r][0]
+}
+
+func (r Rule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// ClosedTag is the `account` directive metadata tag that marks an account as
+// closed.
+const ClosedTag = "closed"
+
+// Format is how problems are written.
+type Format int
+
+const (
+	// Text writes one `FILE:LINE: RULE: MESSAGE` line per problem.
+	Text Format = iota
+	// JSON writes an array of objects with `file`, `line`, `rule` and
+	// `message` fields.
+	JSON
+)
+
+// Problem is something LintFile found.
+type Problem struct {
+	Path    string `json:"file"`
+	Line    int    `json:"line"`
+	Rule    Rule   `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", p.Path, p.Line, p.Rule, p.Message)
+}
+
+type Linter struct {
+	// Disabled rules aren't checked.
+	Disabled []Rule
+	// Sorter gives the order DateOrder expects transactions to be in.
+	Sorter sorter.Sorter
+	// Payees are allowed on top of any declared with `payee` directives.
+	// UnknownPayee is only checked if there are some either way.
+	Payees []string
+	// PriceDB is the price database MissingPrice checks against (along with
+	// any `P` directives in the journal). MissingPrice is only checked if
+	// it's set.
+	PriceDB string
+}
+
+// LintFile checks the journal at path, and everything it includes. Problems
+// are returned sorted by file and line.
+func (l *Linter) LintFile(path string) ([]*Problem, error) {
+	blocks, err := assertions.Load(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load(%s)", path)
+	}
+
+	c := &check{
+		Linter:      l,
+		accounts:    make(map[string]bool),
+		commodities: make(map[string]bool),
+		closed:      make(map[string]time.Time),
+		payees:      make(map[string]bool),
+		prices:      make(map[string]bool),
+		styles:      make(assertions.Styles),
+		reported:    make(map[string]bool),
+	}
+	for _, p := range l.Payees {
+		c.payees[p] = true
+	}
+	if l.PriceDB != "" {
+		if err := c.loadPriceDB(l.PriceDB); err != nil {
+			return nil, errors.Wrapf(err, "loadPriceDB(%s)", l.PriceDB)
+		}
+	}
+	for _, b := range blocks {
+		if d, ok := b.Block.(*journal.Directive); ok {
+			if err := c.directive(d); err != nil {
+				return nil, errors.Wrapf(err, "%s:%d", b.Path, d.StartLine())
+			}
+		}
+		if t, ok := b.Block.(*journal.Transaction); ok {
+			// like ledger, costs don't affect commodities' precision
+			for _, p := range t.Postings {
+				c.styles.Learn(p.Amount)
+				c.styles.Learn(p.Assertion)
+			}
+		}
+	}
+
+	c.transactions(blocks)
+	c.balances(blocks)
+
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		a, b := c.problems[i], c.problems[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	return c.problems, nil
+}
+
+// LoadPayees reads an allowlist of payees, one per line. Blank lines and
+// lines starting with ';' or '#' are ignored.
+func LoadPayees(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	var payees []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		payees = append(payees, line)
+	}
+	return payees, nil
+}
+
+// WriteProblems writes problems to w in format f.
+func WriteProblems(w io.Writer, problems []*Problem, f Format) error {
+	if f == JSON {
+		if problems == nil {
+			problems = []*Problem{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.Wrap(enc.Encode(problems), "enc.Encode()")
+	}
+	for _, p := range problems {
+		if _, err := fmt.Fprintln(w, p); err != nil {
+			return errors.Wrap(err, "fmt.Fprintln()")
+		}
+	}
+	return nil
+}
+
+// loadPriceDB records the commodities that have prices, and the ones prices
+// are given in.
+func (c *check) loadPriceDB(path string) error {
+	db, err := pricedb.ReadFile(path, pricedb.Strict)
+	if err != nil {
+		return errors.Wrapf(err, "pricedb.ReadFile(%s)", path)
+	}
+	for _, e := range db.Prices() {
+		c.prices[e.Symbol] = true
+		c.prices[e.Amount.Commodity] = true
+	}
+	return nil
+}
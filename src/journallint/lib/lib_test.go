@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"testing"
+
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prashantv/gostub"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+const lintTest = `account Assets:Chequing
+account Assets:Old
+    ; closed: 2024/01/31
+account Expenses:Food
+account Income
+commodity $
+commodity 1,000.00 CAD
+payee Grocer
+payee Employer
+P 2024/01/01 CAD $0.75
+
+2024/01/10 (101) Grocer
+    Expenses:Food             $20.00
+    Assets:Chequing
+
+2024/01/05 (101) Employer
+    Assets:Chequing          100 CAD
+    Income
+
+2024/02/01 Grocer
+    Expenses:Food             $20.00
+    Assets:Old               $-19.99
+
+2024/02/02 Grocer
+    Expenses:Food               5 EUR @ $1.50
+    Expenses:Fun                5 AAPL
+    Assets:Chequing           $-7.50
+    Expenses:Food               -5 AAPL
+    [Assets:Budget]           $1
+    [Assets:Chequing]
+
+2024/02/03 Corner Store
+    Expenses:Food               3 CAD @ $0.3333
+    Assets:Chequing             $-1.00
+
+2030/01/01 Grocer
+    Expenses:Food             $1
+    Assets:Chequing
+`
+
+const lintTestWant = `DIR/test.ledger:16: date-order: out of order: should come before the transaction at line 12
+DIR/test.ledger:16: duplicate-code: code (101) is also used at DIR/test.ledger:12
+DIR/test.ledger:20: unbalanced: transaction doesn't balance: off by $0.01
+DIR/test.ledger:22: closed-account: account "Assets:Old" was closed on 2024/01/31
+DIR/test.ledger:25: undeclared-commodity: commodity EUR isn't declared
+DIR/test.ledger:25: missing-price: commodity EUR has no prices
+DIR/test.ledger:26: undeclared-account: account "Expenses:Fun" isn't declared
+DIR/test.ledger:26: undeclared-commodity: commodity AAPL isn't declared
+DIR/test.ledger:29: undeclared-account: account "Assets:Budget" isn't declared
+DIR/test.ledger:32: unknown-payee: payee "Corner Store" isn't in the allowlist
+DIR/test.ledger:36: future-date: dated 2030/01/01, after today
+`
+
+func TestLintFile(t *testing.T) {
+	stubs := gostub.New()
+	defer stubs.Reset()
+	stubs.Stub(&journal.Now, func() time.Time {
+		return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.ledger")
+	if err := ioutil.WriteFile(path, []byte(lintTest), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	priceDBPath := filepath.Join(dir, "price.db")
+	if err := ioutil.WriteFile(priceDBPath, []byte("P 2024/01/01 00:00:00 AAPL $100.00\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+
+	tests := []struct {
+		l    Linter
+		want string
+	}{
+		{Linter{PriceDB: priceDBPath}, lintTestWant},
+		{
+			Linter{Disabled: []Rule{UndeclaredAccount, UndeclaredCommodity, DateOrder, Unbalanced}, Payees: []string{"Corner Store"}},
+			"DIR/test.ledger:16: duplicate-code: code (101) is also used at DIR/test.ledger:12\n" +
+				"DIR/test.ledger:22: closed-account: account \"Assets:Old\" was closed on 2024/01/31\n" +
+				"DIR/test.ledger:36: future-date: dated 2030/01/01, after today\n",
+		},
+	}
+	for i, test := range tests {
+		problems, err := test.l.LintFile(path)
+		if err != nil {
+			t.Errorf("%d: LintFile() = err(%v)", i, err)
+			continue
+		}
+		var b bytes.Buffer
+		if err := WriteProblems(&b, problems, Text); err != nil {
+			t.Errorf("%d: WriteProblems() = err(%v)", i, err)
+		}
+		if got := strings.ReplaceAll(b.String(), dir, "DIR"); got != test.want {
+			t.Errorf("%d: LintFile() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestWriteProblemsJSON(t *testing.T) {
+	tests := []struct {
+		in   []*Problem
+		want string
+	}{
+		{nil, "[]\n"},
+		{
+			[]*Problem{{Path: "a.ledger", Line: 3, Rule: FutureDate, Message: "dated 2030/01/01, after today"}},
+			"[\n  {\n    \"file\": \"a.ledger\",\n    \"line\": 3,\n    \"rule\": \"future-date\",\n    \"message\": \"dated 2030/01/01, after today\"\n  }\n]\n",
+		},
+	}
+	for i, test := range tests {
+		var b bytes.Buffer
+		if err := WriteProblems(&b, test.in, JSON); err != nil {
+			t.Errorf("%d: WriteProblems() = err(%v)", i, err)
+		}
+		if b.String() != test.want {
+			t.Errorf("%d: WriteProblems() = %q, want %q", i, b.String(), test.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/journallint/lib"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var formatIDs = map[lib.Format][]string{
+	lib.Text: {"text"},
+	lib.JSON: {"json"},
+}
+
+var (
+	payees  = flag.String("payees", "", "File listing allowed payees, one per line (on top of any payee directives).")
+	priceDB = flag.StringP("price-db", "p", "", "price.db file to check that commodities have prices in.")
+	reverse = flag.BoolP("reverse", "r", false, "Expect transactions to be sorted newest-first.")
+
+	format        lib.Format
+	disabled      []lib.Rule
+	directiveMode sorter.DirectiveMode
+	dateKey       sorter.DateKey
+	sortKeys      []sorter.SortKey
+)
+
+func main() {
+	flag.Var(enumflag.New(&format, "format", formatIDs, enumflag.EnumCaseInsensitive), "format", fmt.Sprintf("Output format: %q or %q.", formatIDs[lib.Text][0], formatIDs[lib.JSON][0]))
+	flag.Var(enumflag.NewSlice(&disabled, "rule", lib.RuleIDs, enumflag.EnumCaseInsensitive), "disable", "Comma-separated rules not to check.")
+	flag.Var(enumflag.New(&directiveMode, "directiveMode", sorter.DirectiveModeIDs, enumflag.EnumCaseInsensitive), "directives", fmt.Sprintf("How transactionsorter treats directives, for the %q rule: %q or %q.", lib.DateOrder, sorter.DirectiveModeIDs[sorter.PinDirectives][0], sorter.DirectiveModeIDs[sorter.HoistDirectives][0]))
+	flag.Var(enumflag.New(&dateKey, "dateKey", sorter.DateKeyIDs, enumflag.EnumCaseInsensitive), "date", fmt.Sprintf("Which date transactions are sorted by, for the %q rule: %q or %q.", lib.DateOrder, sorter.DateKeyIDs[sorter.PrimaryDate][0], sorter.DateKeyIDs[sorter.AuxDate][0]))
+	flag.VarP(enumflag.NewSlice(&sortKeys, "sortKey", sorter.SortKeyIDs, enumflag.EnumCaseInsensitive), "sort-keys", "k", fmt.Sprintf("Comma-separated tie-breakers for transactions on the same date, as for transactionsorter, for the %q rule.", lib.DateOrder))
+
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	l := &lib.Linter{
+		Disabled: disabled,
+		Sorter: sorter.Sorter{
+			Directives: directiveMode,
+			Date:       dateKey,
+			Keys:       sortKeys,
+			Reverse:    *reverse,
+		},
+		PriceDB: *priceDB,
+	}
+	if *payees != "" {
+		var err error
+		if l.Payees, err = lib.LoadPayees(*payees); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	problems, err := l.LintFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	if err := lib.WriteProblems(os.Stdout, problems, format); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,204 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+// SourceMode controls how merged transactions record which file they came
+// from.
+type SourceMode int
+
+const (
+	NoSource SourceMode = iota
+	// SourceComment adds a `; from <file>:<line>` comment to each transaction.
+	SourceComment
+	// SourceTag adds a `; <SourceTag>: <file>` metadata tag to each
+	// transaction, so it can be queried (eg `ledger reg %source=bank.ledger`).
+	SourceTag
+)
+
+const DefaultSourceTag = "source"
+
+type Merger struct {
+	// Sorter controls how the merged transactions are ordered. Its
+	// Check/Diff/Stdout/Backups fields are ignored.
+	Sorter sorter.Sorter
+
+	// FollowIncludes replaces `include` directives with the (recursively
+	// merged) contents of the files they name. Otherwise, they're treated
+	// like any other directive.
+	FollowIncludes bool
+
+	Source SourceMode
+	// SourceTag is the metadata tag name used by SourceTag mode. Defaults to
+	// DefaultSourceTag.
+	SourceTag string
+
+	// paths maps each loaded transaction to the file it came from.
+	paths map[*journal.Transaction]string
+}
+
+// Duplicate is a transaction found by the Sorter's Dedupe, along with the
+// files that it and the transaction it duplicates came from.
+type Duplicate struct {
+	sorter.Duplicate
+	Path   string
+	OfPath string
+}
+
+// Merge merges the journals at paths into a single sorted journal, and
+// returns any duplicates found.
+//
+// Anything before the first transaction or directive of each file (typically
+// a header comment) goes at the top of the output, in file order. Everything
+// else is sorted as by transactionsorter.
+func (m *Merger) Merge(paths []string) (string, []Duplicate, error) {
+	m.paths = make(map[*journal.Transaction]string)
+	var leading, rest []journal.Block
+	for _, path := range paths {
+		blocks, err := m.load(path, nil)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "load(%s)", path)
+		}
+		i := 0
+		for i < len(blocks) && !isAnchor(blocks[i]) {
+			i++
+		}
+		leading = append(leading, blocks[:i]...)
+		rest = append(rest, blocks[i:]...)
+	}
+
+	lines, sdups := m.Sorter.SortBlocks(append(leading, rest...))
+	if len(lines) > 0 && lines[len(lines)-1] != "" {
+		lines = append(lines, "")
+	}
+
+	dups := make([]Duplicate, 0, len(sdups))
+	for _, d := range sdups {
+		dups = append(dups, Duplicate{Duplicate: d, Path: m.paths[d.Transaction], OfPath: m.paths[d.Of]})
+	}
+	return strings.Join(lines, "\n"), dups, nil
+}
+
+// load parses the journal at path, following includes and adding source
+// annotations as necessary. stack holds the absolute paths of the files
+// currently being loaded, to detect include cycles.
+func (m *Merger) load(path string, stack []string) ([]journal.Block, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "filepath.Abs(%s)", path)
+	}
+	for _, s := range stack {
+		if s == abs {
+			return nil, errors.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	j, err := journal.Parse(strings.TrimSuffix(string(b), "\n"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "journal.Parse(%s)", path)
+	}
+
+	blocks := make([]journal.Block, 0, len(j.Blocks)+1)
+	for _, b := range j.Blocks {
+		switch b := b.(type) {
+		case *journal.Transaction:
+			m.paths[b] = path
+			m.annotate(b, path)
+		case *journal.Directive:
+			if m.FollowIncludes && b.Name == "include" {
+				included, err := m.include(path, b, stack)
+				if err != nil {
+					return nil, errors.Wrapf(err, "line %d", b.StartLine())
+				}
+				blocks = append(blocks, included...)
+				continue
+			}
+		}
+		blocks = append(blocks, b)
+	}
+
+	// make sure the last transaction of one file doesn't run into the first
+	// of the next
+	if n := len(blocks); n > 0 {
+		if _, ok := blocks[n-1].(*journal.Blank); !ok {
+			blocks = append(blocks, &journal.Blank{Source: journal.Source{Raw: []string{""}}})
+		}
+	}
+	return blocks, nil
+}
+
+// include loads the files named by the include directive d, which appears in
+// the file at path. As in ledger, relative paths are relative to the
+// including file, and globs are expanded.
+func (m *Merger) include(path string, d *journal.Directive, stack []string) ([]journal.Block, error) {
+	pattern := strings.TrimSpace(d.Arg)
+	if pattern == "" {
+		return nil, errors.New("include without a file name")
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(path), pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "filepath.Glob(%s)", pattern)
+	}
+	if len(matches) == 0 {
+		return nil, errors.Errorf("no files match include %q", d.Arg)
+	}
+
+	var blocks []journal.Block
+	for _, match := range matches {
+		b, err := m.load(match, stack)
+		if err != nil {
+			return nil, errors.Wrapf(err, "load(%s)", match)
+		}
+		blocks = append(blocks, b...)
+	}
+	return blocks, nil
+}
+
+func (m *Merger) annotate(t *journal.Transaction, path string) {
+	switch m.Source {
+	case SourceComment:
+		note := fmt.Sprintf(" from %s:%d", path, t.StartLine())
+		for _, n := range t.Notes {
+			if n == note {
+				return
+			}
+		}
+		t.AddNote(note)
+	case SourceTag:
+		tag := m.SourceTag
+		if tag == "" {
+			tag = DefaultSourceTag
+		}
+		// don't pile up tags when re-merging already-merged files
+		if t.Tags.Has(tag) {
+			return
+		}
+		t.AddNote(fmt.Sprintf(" %s: %s", tag, path))
+	}
+}
+
+// isAnchor reports whether b is something other than blank lines or comments.
+func isAnchor(b journal.Block) bool {
+	switch b.(type) {
+	case *journal.Blank, *journal.Comment, *journal.Unknown:
+		return false
+	}
+	return true
+}
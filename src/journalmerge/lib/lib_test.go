@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("os.MkdirAll() = err(%v)", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+	}
+	return dir
+}
+
+func TestMerge(t *testing.T) {
+	files := map[string]string{
+		"a.ledger":       "; bank A\n\naccount Assets:A\n\n2024/01/03 c\n    Assets:A  $1\n    Income\n\n2024/01/01 a\n    Assets:A  $1\n    Income\n",
+		"b.ledger":       "2024/01/02 b\n    Assets:B  $2\n    Income\n\ninclude sub/*.ledger\n",
+		"sub/z.ledger":   "2023/12/31 z\n    Assets:Z  $3\n    Income\n",
+		"tagged.ledger":  "2024/01/02 t\n    ; source: elsewhere\n    Assets:B  $2\n    Income",
+		"cycle.ledger":   "include cycle2.ledger\n",
+		"cycle2.ledger":  "include cycle.ledger\n",
+		"missing.ledger": "include nope.ledger\n",
+	}
+
+	tests := []struct {
+		m       Merger
+		paths   []string
+		want    string
+		wantErr bool
+	}{
+		{
+			Merger{Sorter: sorter.Sorter{Directives: sorter.HoistDirectives}},
+			[]string{"a.ledger", "b.ledger"},
+			"; bank A\n\naccount Assets:A\n\ninclude sub/*.ledger\n\n" +
+				"2024/01/01 a\n    Assets:A  $1\n    Income\n\n" +
+				"2024/01/02 b\n    Assets:B  $2\n    Income\n\n" +
+				"2024/01/03 c\n    Assets:A  $1\n    Income\n",
+			false,
+		},
+		{
+			Merger{Sorter: sorter.Sorter{Directives: sorter.HoistDirectives}, FollowIncludes: true, Source: SourceTag},
+			[]string{"b.ledger"},
+			"2023/12/31 z\n    ; source: DIR/sub/z.ledger\n    Assets:Z  $3\n    Income\n\n" +
+				"2024/01/02 b\n    ; source: DIR/b.ledger\n    Assets:B  $2\n    Income\n",
+			false,
+		},
+		{
+			Merger{Source: SourceComment},
+			[]string{"b.ledger", "tagged.ledger"},
+			"2024/01/02 b\n    ; from DIR/b.ledger:1\n    Assets:B  $2\n    Income\n\ninclude sub/*.ledger\n\n" +
+				"2024/01/02 t\n    ; source: elsewhere\n    ; from DIR/tagged.ledger:1\n    Assets:B  $2\n    Income\n",
+			false,
+		},
+		{
+			Merger{Source: SourceTag},
+			[]string{"tagged.ledger"},
+			"2024/01/02 t\n    ; source: elsewhere\n    Assets:B  $2\n    Income\n",
+			false,
+		},
+		{
+			Merger{Source: SourceTag, SourceTag: "file"},
+			[]string{"tagged.ledger"},
+			"2024/01/02 t\n    ; source: elsewhere\n    ; file: DIR/tagged.ledger\n    Assets:B  $2\n    Income\n",
+			false,
+		},
+		{Merger{FollowIncludes: true}, []string{"cycle.ledger"}, "", true},
+		{Merger{FollowIncludes: true}, []string{"missing.ledger"}, "", true},
+		{Merger{}, []string{"missing.ledger"}, "include nope.ledger\n", false},
+		{Merger{}, []string{"nonexistent.ledger"}, "", true},
+	}
+	for i, test := range tests {
+		dir := writeFiles(t, files)
+		paths := make([]string, 0, len(test.paths))
+		for _, p := range test.paths {
+			paths = append(paths, filepath.Join(dir, p))
+		}
+
+		got, _, err := test.m.Merge(paths)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%d: Merge() = err(%v), want non-nil error %v", i, err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if want := strings.ReplaceAll(test.want, "DIR", dir); got != want {
+			t.Errorf("%d: Merge() = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.ledger": "2024/01/01 Coffee\n    Expenses:Coffee  $3\n    Assets:Checking\n",
+		"b.ledger": "\n2024/01/02 COFFEE\n    Expenses:Unknown  $3\n    Assets:Checking\n",
+	})
+	m := Merger{Sorter: sorter.Sorter{Dedupe: sorter.Dedupe{Mode: sorter.DropDuplicates, Days: 1, Similarity: 1}}}
+	a, b := filepath.Join(dir, "a.ledger"), filepath.Join(dir, "b.ledger")
+
+	got, dups, err := m.Merge([]string{a, b})
+	if err != nil {
+		t.Fatalf("Merge() = err(%v)", err)
+	}
+	if want := "\n2024/01/01 Coffee\n    Expenses:Coffee  $3\n    Assets:Checking\n"; got != want {
+		t.Errorf("Merge() = %q, want %q", got, want)
+	}
+	if len(dups) != 1 {
+		t.Fatalf("Merge() found %d duplicates, want 1", len(dups))
+	}
+	if d := dups[0]; d.Path != b || d.Transaction.StartLine() != 2 || d.OfPath != a || d.Of.StartLine() != 1 {
+		t.Errorf("Merge() duplicate = %s:%d of %s:%d, want %s:2 of %s:1", d.Path, d.Transaction.StartLine(), d.OfPath, d.Of.StartLine(), b, a)
+	}
+}
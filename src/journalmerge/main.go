@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journalmerge/lib"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var sourceModeIDs = map[lib.SourceMode][]string{
+	lib.NoSource:      {"none"},
+	lib.SourceComment: {"comment"},
+	lib.SourceTag:     {"tag"},
+}
+
+var (
+	reverse        = flag.BoolP("reverse", "r", false, "Sort newest-first.")
+	followIncludes = flag.BoolP("follow-includes", "i", false, "Replace include directives with the (recursively merged) contents of the files they name.")
+	sourceTag      = flag.String("source-tag", lib.DefaultSourceTag, "Metadata tag name to use with --source=tag.")
+	outPath        = flag.StringP("out", "o", "", "File to write the merged journal to. Defaults to stdout.")
+	backups        = flag.IntP("backups", "b", 0, "Number of backup copies of an existing --out file to keep (as <file>.bak, <file>.bak.1, etc).")
+
+	dedupeDays       = flag.Int("dedupe-days", sorter.DefaultDedupeDays, "Maximum number of days apart that duplicate transactions can be.")
+	dedupeSimilarity = flag.Float64("dedupe-similarity", sorter.DefaultDedupeSimilarity, "Minimum payee similarity (from 0 to 1) for transactions to be considered duplicates.")
+	dedupeIDTags     = flag.StringSlice("dedupe-id-tags", sorter.DefaultIDTags, "Metadata tags holding unique import IDs. Transactions with the same value for one of them are duplicates, and ones with different values aren't.")
+
+	directiveMode = sorter.HoistDirectives
+	dateKey       sorter.DateKey
+	sortKeys      []sorter.SortKey
+	sourceMode    lib.SourceMode
+	dedupeMode    sorter.DedupeMode
+)
+
+func main() {
+	flag.Var(enumflag.New(&directiveMode, "directiveMode", sorter.DirectiveModeIDs, enumflag.EnumCaseInsensitive), "directives", fmt.Sprintf("What to do with directives (account, commodity, alias, etc). %q (the default) moves them to the top of the output; %q keeps them in place, sorting transactions around them (but not across order-sensitive ones like apply, year or include).", sorter.DirectiveModeIDs[sorter.HoistDirectives][0], sorter.DirectiveModeIDs[sorter.PinDirectives][0]))
+	flag.Var(enumflag.New(&dateKey, "dateKey", sorter.DateKeyIDs, enumflag.EnumCaseInsensitive), "date", fmt.Sprintf("Which date to sort by. %q uses the transaction date; %q (aliases %q) uses the auxiliary date where there is one.", sorter.DateKeyIDs[sorter.PrimaryDate][0], sorter.DateKeyIDs[sorter.AuxDate][0], sorter.DateKeyIDs[sorter.AuxDate][1:]))
+	flag.VarP(enumflag.NewSlice(&sortKeys, "sortKey", sorter.SortKeyIDs, enumflag.EnumCaseInsensitive), "sort-keys", "k", fmt.Sprintf("Comma-separated tie-breakers for transactions on the same date, applied in order. Valid values are %q, %q, %q, %q, %q and %q (the value of the %q metadata tag).", sorter.SortKeyIDs[sorter.PayeeKey][0], sorter.SortKeyIDs[sorter.StateKey][0], sorter.SortKeyIDs[sorter.CodeKey][0], sorter.SortKeyIDs[sorter.AccountKey][0], sorter.SortKeyIDs[sorter.AmountKey][0], sorter.SortKeyIDs[sorter.TimeKey][0], sorter.TimeTag+":"))
+	flag.Var(enumflag.New(&sourceMode, "sourceMode", sourceModeIDs, enumflag.EnumCaseInsensitive), "source", fmt.Sprintf("How to record which file each transaction came from. %q adds a `; from <file>:<line>` comment; %q adds a `; <source-tag>: <file>` metadata tag.", sourceModeIDs[lib.SourceComment][0], sourceModeIDs[lib.SourceTag][0]))
+	flag.Var(enumflag.New(&dedupeMode, "dedupeMode", sorter.DedupeModeIDs, enumflag.EnumCaseInsensitive), "dedupe", fmt.Sprintf("What to do with likely duplicate transactions. %q lists them on stderr; %q removes them; %q comments them out.", sorter.DedupeModeIDs[sorter.ReportDuplicates][0], sorter.DedupeModeIDs[sorter.DropDuplicates][0], sorter.DedupeModeIDs[sorter.CommentDuplicates][0]))
+
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	m := &lib.Merger{
+		Sorter: sorter.Sorter{
+			Directives: directiveMode,
+			Date:       dateKey,
+			Keys:       sortKeys,
+			Reverse:    *reverse,
+			Dedupe: sorter.Dedupe{
+				Mode:       dedupeMode,
+				Days:       *dedupeDays,
+				Similarity: *dedupeSimilarity,
+				IDTags:     *dedupeIDTags,
+			},
+		},
+		FollowIncludes: *followIncludes,
+		Source:         sourceMode,
+		SourceTag:      *sourceTag,
+	}
+	merged, dups, err := m.Merge(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, d := range dups {
+		fmt.Fprintf(os.Stderr, "%s:%d: duplicate of %s:%d (%s)\n", d.Path, d.Transaction.StartLine(), d.OfPath, d.Of.StartLine(), d.Reason)
+	}
+
+	if *outPath == "" {
+		_, err = io.WriteString(os.Stdout, merged)
+	} else {
+		err = fs.WriteFileAtomic(*outPath, []byte(merged), 0644, *backups)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+}
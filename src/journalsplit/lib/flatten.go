@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	assertions "github.com/glennhartmann/ledger-tools/src/checkassertions/lib"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// Flatten returns the contents of the journal at path with its `include`
+// directives replaced by the (recursively flattened) files they name, in
+// order. The opening and closing balance transactions that SplitFile writes
+// are dropped, since they'd cancel out anyway.
+func Flatten(path string) (string, error) {
+	blocks, err := assertions.Load(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "Load(%s)", path)
+	}
+
+	var lines []string
+	prev := path
+	skipBlank := false
+	for _, b := range blocks {
+		if t, ok := b.Block.(*journal.Transaction); ok && t.Tags.Has(BalancesTag) {
+			skipBlank = true
+			continue
+		}
+		if _, ok := b.Block.(*journal.Blank); ok && skipBlank {
+			skipBlank = false
+			continue
+		}
+		skipBlank = false
+		if b.Path != prev {
+			if n := len(lines); n > 0 && strings.TrimSpace(lines[n-1]) != "" {
+				lines = append(lines, "")
+			}
+			prev = b.Path
+		}
+		lines = append(lines, b.Block.Lines()...)
+	}
+	return joinLines(lines), nil
+}
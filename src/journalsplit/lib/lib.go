@@ -0,0 +1,399 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	assertions "github.com/glennhartmann/ledger-tools/src/checkassertions/lib"
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+)
+
+var (
+	// overridable for testing
+	outWriter io.Writer = os.Stdout
+)
+
+// SplitMode is what a journal is split by.
+type SplitMode int
+
+const (
+	// ByYear puts each year's transactions in a `YEAR.ledger` file.
+	ByYear SplitMode = iota
+	// ByAccount puts transactions in a file named after the first AccountDepth
+	// levels of their first posting's account, like `Assets-Chequing.ledger`.
+	ByAccount
+)
+
+const (
+	DefaultAccountDepth   = 1
+	DefaultOpeningAccount = "Equity:Opening Balances"
+
+	// BalancesTag marks the opening and closing balance transactions that
+	// SplitFile writes, so that FlattenFile can drop them again.
+	BalancesTag = "split-balances"
+)
+
+// DefaultBalanceAccounts are the accounts (and their subaccounts) that are
+// carried over from one year to the next.
+var DefaultBalanceAccounts = []string{"Assets", "Liabilities", "Equity"}
+
+type Splitter struct {
+	By           SplitMode
+	AccountDepth int
+
+	// Dir is the directory the split files are written to. Defaults to the
+	// journal's directory.
+	Dir string
+	// Root is the file the `include` directives (along with the journal's
+	// other directives) are written to. Defaults to the journal itself.
+	Root string
+
+	// OpeningBalances (for ByYear) starts each year's file with a transaction
+	// that opens the BalanceAccounts at their balances from the end of the
+	// year before, balanced against OpeningAccount, and ends the year before's
+	// file with one that closes them again. The two cancel out when all the
+	// years are included together.
+	OpeningBalances bool
+	OpeningAccount  string
+	BalanceAccounts []string
+
+	// Report lists the files that would be written, without writing them.
+	Report bool
+	// Backups is the number of backup copies of the root file to keep when
+	// it's overwritten.
+	Backups int
+}
+
+// File is a file written by SplitFile.
+type File struct {
+	Path         string
+	Transactions int
+	lines        []string
+}
+
+func (f *File) String() string {
+	return fmt.Sprintf("%s: %d transactions", f.Path, f.Transactions)
+}
+
+// hunk is a transaction (or directive) and whatever comments and blank lines
+// follow it.
+type hunk struct {
+	lines []string
+}
+
+// SplitFile splits the journal at path into separate files, and rewrites its
+// root file to include them. The files are returned, root last.
+//
+// Directives (and automated and periodic transactions) go in the root file,
+// followed by the `include` directives, in order of year or account, and any
+// transactions without postings. Transactions keep their order, along with
+// the comments after them. Transactions dated without a year are given one,
+// so `year` directives aren't needed anymore; other directives that change
+// the meaning of the transactions after them (like `apply account`) can't be
+// split up, so they're only allowed before the first transaction.
+func (s *Splitter) SplitFile(path string) ([]*File, error) {
+	j, err := journal.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "journal.ReadFile(%s)", path)
+	}
+	dir, root := s.Dir, s.Root
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	if root == "" {
+		root = path
+	}
+
+	var leading []string
+	var directives, orphans []*hunk
+	var txns []*journal.Transaction
+	groups := make(map[string][]*hunk)
+	var cur *hunk
+	for _, b := range j.Blocks {
+		switch b := b.(type) {
+		case *journal.Transaction:
+			txns = append(txns, b)
+			cur = &hunk{lines: withFullDates(b)}
+			if key := s.key(b); key == "" {
+				orphans = append(orphans, cur)
+			} else {
+				groups[key] = append(groups[key], cur)
+			}
+			continue
+		case *journal.Directive:
+			if len(txns) > 0 && sorter.IsScoped(b) {
+				switch b.Name {
+				case "year", "Y", "apply year", "end apply year":
+					continue
+				}
+				return nil, errors.Errorf("%s:%d: can't split a journal with %q directives after its first transaction", path, b.StartLine(), b.Name)
+			}
+			cur = &hunk{lines: b.Lines()}
+			directives = append(directives, cur)
+			continue
+		case *journal.AutomatedTransaction, *journal.PeriodicTransaction:
+			cur = &hunk{lines: b.Lines()}
+			directives = append(directives, cur)
+			continue
+		}
+		if cur == nil {
+			leading = append(leading, b.Lines()...)
+		} else {
+			cur.lines = append(cur.lines, b.Lines()...)
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var files []*File
+	for _, k := range keys {
+		f := &File{Path: filepath.Join(dir, k+".ledger"), Transactions: len(groups[k])}
+		for _, h := range groups[k] {
+			f.lines = AppendHunk(f.lines, h.lines)
+		}
+		files = append(files, f)
+	}
+	if s.OpeningBalances && s.By == ByYear {
+		if err := s.addBalances(files, keys, txns); err != nil {
+			return nil, errors.Wrap(err, "addBalances()")
+		}
+	}
+
+	r := &File{Path: root, Transactions: len(orphans), lines: leading}
+	for _, h := range directives {
+		r.lines = append(r.lines, h.lines...)
+	}
+	var includes []string
+	for _, f := range files {
+		rel, err := filepath.Rel(filepath.Dir(root), f.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "filepath.Rel(%s)", f.Path)
+		}
+		includes = append(includes, "include "+filepath.ToSlash(rel))
+	}
+	r.lines = AppendHunk(r.lines, includes)
+	for _, h := range orphans {
+		r.lines = AppendHunk(r.lines, h.lines)
+	}
+	files = append(files, r)
+
+	if s.Report {
+		for _, f := range files {
+			if _, err := fmt.Fprintln(outWriter, f); err != nil {
+				return nil, errors.Wrap(err, "fmt.Fprintln()")
+			}
+		}
+		return files, nil
+	}
+
+	for _, f := range files[:len(files)-1] {
+		if _, err := os.Stat(f.Path); err == nil {
+			return nil, errors.Errorf("%s already exists", f.Path)
+		}
+	}
+	for i, f := range files {
+		backups := 0
+		if i == len(files)-1 {
+			backups = s.Backups
+		}
+		if err := fs.WriteFileAtomic(f.Path, []byte(joinLines(f.lines)), 0644, backups); err != nil {
+			return nil, errors.Wrapf(err, "fs.WriteFileAtomic(%s)", f.Path)
+		}
+	}
+	return files, nil
+}
+
+// key returns the name of the file t goes in, or "" if it goes in the root
+// file.
+func (s *Splitter) key(t *journal.Transaction) string {
+	if s.By == ByYear {
+		return strconv.Itoa(t.Date.Year())
+	}
+	if len(t.Postings) == 0 {
+		return ""
+	}
+	parts := strings.Split(t.Postings[0].Account, ":")
+	if len(parts) > s.AccountDepth {
+		parts = parts[:s.AccountDepth]
+	}
+	return strings.NewReplacer("/", "-", `\`, "-").Replace(strings.Join(parts, "-"))
+}
+
+// addBalances adds opening and closing balance transactions to the files of
+// each year (in keys) after the first.
+func (s *Splitter) addBalances(files []*File, keys []string, txns []*journal.Transaction) error {
+	sorted := make([]*journal.Transaction, len(txns))
+	copy(sorted, txns)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+	styles := make(assertions.Styles)
+	for _, t := range sorted {
+		for _, p := range t.Postings {
+			styles.Learn(p.Amount)
+			styles.Learn(p.Assertion)
+		}
+	}
+
+	bs := make(assertions.Balances)
+	next := 0
+	for i := 1; i < len(keys); i++ {
+		year, err := strconv.Atoi(keys[i])
+		if err != nil {
+			return errors.Wrapf(err, "strconv.Atoi(%s)", keys[i])
+		}
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		for ; next < len(sorted) && sorted[next].Date.Before(start); next++ {
+			t := sorted[next]
+			var accounts []string
+			for _, p := range t.Postings {
+				accounts = append(accounts, p.Account)
+			}
+			amounts, err := assertions.PostingAmounts(t, accounts, bs)
+			if err != nil {
+				return errors.Wrapf(err, "line %d", t.StartLine())
+			}
+			for j, a := range amounts {
+				bs.Add(accounts[j], a)
+			}
+		}
+
+		opening := s.balancesTransaction(start, "Opening balances", "opening", bs, styles, false)
+		closing := s.balancesTransaction(start.AddDate(0, 0, -1), "Closing balances", "closing", bs, styles, true)
+		if opening == nil {
+			continue
+		}
+		files[i].lines = AppendHunk(opening, files[i].lines)
+		files[i-1].lines = AppendHunk(files[i-1].lines, closing)
+		files[i].Transactions++
+		files[i-1].Transactions++
+	}
+	return nil
+}
+
+// balancesTransaction returns the lines of a transaction that opens (or, if
+// negate is set, closes) the balances in bs of the BalanceAccounts, or nil if
+// they're all zero.
+func (s *Splitter) balancesTransaction(date time.Time, payee, kind string, bs assertions.Balances, styles assertions.Styles, negate bool) []string {
+	var postings []Posting
+	accounts := make([]string, 0, len(bs))
+	for a := range bs {
+		accounts = append(accounts, a)
+	}
+	sort.Strings(accounts)
+	for _, a := range accounts {
+		if a == s.OpeningAccount || !UnderAny(a, s.BalanceAccounts) {
+			continue
+		}
+		for _, c := range bs[a].Commodities() {
+			q := bs[a][c]
+			if negate {
+				q = new(big.Rat).Neg(q)
+			}
+			postings = append(postings, Posting{a, styles.Format(c, q)})
+		}
+	}
+	return BalancesTransaction(date, payee, []string{BalancesTag + ": " + kind}, postings, s.OpeningAccount)
+}
+
+// Posting is an account and its (formatted) amount, in a BalancesTransaction.
+type Posting struct {
+	Account string
+	Amount  string
+}
+
+// BalancesTransaction returns the lines of a transaction with notes (as
+// comments) and postings, with their amounts lined up, balanced by an elided
+// posting to counter. It returns nil if there are no postings.
+func BalancesTransaction(date time.Time, payee string, notes []string, postings []Posting, counter string) []string {
+	if len(postings) == 0 {
+		return nil
+	}
+
+	width := 0
+	for _, p := range postings {
+		width = max(width, utf8.RuneCountInString(p.Account)+2+utf8.RuneCountInString(p.Amount))
+	}
+	lines := []string{date.Format(journal.DateFormat) + " " + payee}
+	for _, n := range notes {
+		lines = append(lines, "    ; "+n)
+	}
+	for _, p := range postings {
+		pad := width - utf8.RuneCountInString(p.Account) - utf8.RuneCountInString(p.Amount)
+		lines = append(lines, "    "+p.Account+strings.Repeat(" ", pad)+p.Amount)
+	}
+	return append(lines, "    "+counter)
+}
+
+// withFullDates returns t's lines, with years added to its dates if they were
+// written without them.
+func withFullDates(t *journal.Transaction) []string {
+	lines := t.Lines()
+	dates := fullDate(t.DateText, t.Date)
+	if t.AuxDateText != "" {
+		dates += "=" + fullDate(t.AuxDateText, t.AuxDate)
+	}
+	if !strings.HasPrefix(lines[0], dates) {
+		lines = append([]string{dates + lines[0][strings.IndexAny(lines[0]+" ", " \t"):]}, lines[1:]...)
+	}
+	return lines
+}
+
+// fullDate returns text (which date was parsed from), with date's year added
+// if it doesn't have one.
+func fullDate(text string, date time.Time) string {
+	i := strings.IndexAny(text, "/-.")
+	if i < 0 || strings.IndexAny(text[i+1:], "/-.") >= 0 {
+		return text
+	}
+	return strconv.Itoa(date.Year()) + text[i:i+1] + text
+}
+
+// UnderAny returns whether account is one of parents, or a subaccount of one.
+func UnderAny(account string, parents []string) bool {
+	for _, p := range parents {
+		if account == p || strings.HasPrefix(account, p+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendHunk appends lines to out, with a blank line between them if there
+// isn't one already.
+func AppendHunk(out, lines []string) []string {
+	if len(lines) == 0 {
+		return out
+	}
+	if n := len(out); n > 0 && strings.TrimSpace(out[n-1]) != "" {
+		out = append(out, "")
+	}
+	return append(out, lines...)
+}
+
+// joinLines joins lines into a file's contents, ending in a single newline.
+func joinLines(lines []string) string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,209 @@
+package lib
+
+import (
+	"testing"
+
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashantv/gostub"
+)
+
+const splitTest = `; my journal
+
+account Assets:Chequing
+account Expenses:Food
+year 2023
+
+12/30 Employer
+    Assets:Chequing          $100.00
+    Income:Salary
+; end of 2023
+
+2024/01/05 Grocer
+    Expenses:Food             $20.00
+    Assets:Chequing
+
+year 2024
+02/01 * Grocer
+    Expenses:Food              $5.5
+    Liabilities:Visa
+`
+
+const splitTestRoot = `; my journal
+
+account Assets:Chequing
+account Expenses:Food
+year 2023
+
+include 2023.ledger
+include 2024.ledger
+`
+
+const splitTest2023 = `2023/12/30 Employer
+    Assets:Chequing          $100.00
+    Income:Salary
+; end of 2023
+`
+
+const splitTest2024 = `2024/01/05 Grocer
+    Expenses:Food             $20.00
+    Assets:Chequing
+
+2024/02/01 * Grocer
+    Expenses:Food              $5.5
+    Liabilities:Visa
+`
+
+func TestSplitFile(t *testing.T) {
+	tests := []struct {
+		s    Splitter
+		want map[string]string
+	}{
+		{
+			Splitter{By: ByYear},
+			map[string]string{"test.ledger": splitTestRoot, "2023.ledger": splitTest2023, "2024.ledger": splitTest2024},
+		},
+		{
+			Splitter{By: ByYear, OpeningBalances: true, OpeningAccount: DefaultOpeningAccount, BalanceAccounts: DefaultBalanceAccounts},
+			map[string]string{
+				"test.ledger": splitTestRoot,
+				"2023.ledger": splitTest2023 + `
+2023/12/31 Closing balances
+    ; split-balances: closing
+    Assets:Chequing  $-100.00
+    Equity:Opening Balances
+`,
+				"2024.ledger": `2024/01/01 Opening balances
+    ; split-balances: opening
+    Assets:Chequing  $100.00
+    Equity:Opening Balances
+
+` + splitTest2024,
+			},
+		},
+		{
+			Splitter{By: ByAccount, AccountDepth: 2, Root: "DIR/main.ledger"},
+			map[string]string{
+				"test.ledger":            splitTest,
+				"main.ledger":            strings.Replace(splitTestRoot, "include 2023.ledger\ninclude 2024.ledger", "include Assets-Chequing.ledger\ninclude Expenses-Food.ledger", 1),
+				"Assets-Chequing.ledger": splitTest2023,
+				"Expenses-Food.ledger":   splitTest2024,
+			},
+		},
+	}
+	for i, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "test.ledger")
+		if err := ioutil.WriteFile(path, []byte(splitTest), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+		test.s.Root = strings.ReplaceAll(test.s.Root, "DIR", dir)
+		if _, err := test.s.SplitFile(path); err != nil {
+			t.Errorf("%d: SplitFile() = err(%v)", i, err)
+			continue
+		}
+
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("ioutil.ReadDir() = err(%v)", err)
+		}
+		if len(infos) != len(test.want) {
+			t.Errorf("%d: SplitFile() wrote %d files, want %d", i, len(infos), len(test.want))
+		}
+		for name, want := range test.want {
+			b, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Errorf("%d: ioutil.ReadFile(%s) = err(%v)", i, name, err)
+				continue
+			}
+			if string(b) != want {
+				t.Errorf("%d: SplitFile() wrote %s = %q, want %q", i, name, string(b), want)
+			}
+		}
+	}
+}
+
+func TestSplitFileErrors(t *testing.T) {
+	tests := []struct {
+		in       string
+		existing string
+		want     string
+	}{
+		{"2024/01/01 A\n    a  $1\n    b\n\napply account Foo\n", "", "can't split a journal with \"apply account\" directives after its first transaction"},
+		{"2024/01/01 A\n    a  $1\n    b\n", "2024.ledger", "2024.ledger already exists"},
+	}
+	for i, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "test.ledger")
+		if err := ioutil.WriteFile(path, []byte(test.in), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+		if test.existing != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, test.existing), nil, 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+			}
+		}
+		s := &Splitter{By: ByYear}
+		if _, err := s.SplitFile(path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%d: SplitFile() = err(%v), want an error containing %q", i, err, test.want)
+		}
+	}
+}
+
+func TestSplitFileReport(t *testing.T) {
+	var b bytes.Buffer
+	stubs := gostub.Stub(&outWriter, &b)
+	defer stubs.Reset()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.ledger")
+	if err := ioutil.WriteFile(path, []byte(splitTest), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	s := &Splitter{By: ByYear, Report: true}
+	if _, err := s.SplitFile(path); err != nil {
+		t.Fatalf("SplitFile() = err(%v)", err)
+	}
+
+	want := "DIR/2023.ledger: 1 transactions\nDIR/2024.ledger: 2 transactions\nDIR/test.ledger: 0 transactions\n"
+	if got := strings.ReplaceAll(b.String(), dir, "DIR"); got != want {
+		t.Errorf("SplitFile() reported %q, want %q", got, want)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir() = err(%v)", err)
+	}
+	if len(infos) != 1 {
+		t.Errorf("SplitFile() wrote %d files, want none", len(infos)-1)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []Splitter{
+		{By: ByYear},
+		{By: ByYear, OpeningBalances: true, OpeningAccount: DefaultOpeningAccount, BalanceAccounts: DefaultBalanceAccounts},
+	}
+	want := strings.NewReplacer("12/30", "2023/12/30", "02/01", "2024/02/01", "\nyear 2024", "").Replace(splitTest)
+	for i, s := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "test.ledger")
+		if err := ioutil.WriteFile(path, []byte(splitTest), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+		if _, err := s.SplitFile(path); err != nil {
+			t.Errorf("%d: SplitFile() = err(%v)", i, err)
+			continue
+		}
+		got, err := Flatten(path)
+		if err != nil {
+			t.Errorf("%d: Flatten() = err(%v)", i, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%d: Flatten() = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journalsplit/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var splitModeIDs = map[lib.SplitMode][]string{
+	lib.ByYear:    {"year"},
+	lib.ByAccount: {"account"},
+}
+
+var (
+	accountDepth    = flag.Int("account-depth", lib.DefaultAccountDepth, "Number of levels of the account name to split by, with --by=account.")
+	dir             = flag.String("dir", "", "Directory to write the split files to. Defaults to the journal's directory.")
+	root            = flag.String("root", "", "File to write the include directives to, along with the journal's other directives. Defaults to the journal itself.")
+	openingBalances = flag.Bool("opening-balances", false, "With --by=year, start each year's file with a transaction opening the balance accounts at their balances from the year before, and end the year before's file with one closing them.")
+	openingAccount  = flag.String("opening-account", lib.DefaultOpeningAccount, "Account to balance the opening and closing balance transactions against.")
+	balanceAccounts = flag.StringSlice("balance-accounts", lib.DefaultBalanceAccounts, "Comma-separated accounts (with their subaccounts) whose balances are carried over between years.")
+	report          = flag.Bool("report", false, "Don't write anything; list the files that would be written, and how many transactions each would have.")
+	flatten         = flag.Bool("flatten", false, "Instead of splitting, write the journal with its include directives replaced by the contents of the files they name.")
+	outPath         = flag.StringP("out", "o", "", "File to write the flattened journal to, with --flatten. Defaults to stdout.")
+	backups         = flag.IntP("backups", "b", 0, "Number of backup copies of an overwritten root (or --out) file to keep (as <file>.bak, <file>.bak.1, etc).")
+
+	splitMode lib.SplitMode
+)
+
+func main() {
+	flag.Var(enumflag.New(&splitMode, "splitMode", splitModeIDs, enumflag.EnumCaseInsensitive), "by", fmt.Sprintf("What to split the journal by: %q or %q (the top-level account of each transaction's first posting).", splitModeIDs[lib.ByYear][0], splitModeIDs[lib.ByAccount][0]))
+
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+	if *flatten && *report {
+		fmt.Fprintf(os.Stderr, "--flatten and --report can't be used together\n")
+		os.Exit(1)
+	}
+	if *openingBalances && splitMode != lib.ByYear {
+		fmt.Fprintf(os.Stderr, "--opening-balances can only be used with --by=%s\n", splitModeIDs[lib.ByYear][0])
+		os.Exit(1)
+	}
+
+	if *flatten {
+		flat, err := lib.Flatten(flag.Arg(0))
+		if err == nil {
+			if *outPath == "" {
+				_, err = io.WriteString(os.Stdout, flat)
+			} else {
+				err = fs.WriteFileAtomic(*outPath, []byte(flat), 0644, *backups)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	s := &lib.Splitter{
+		By:              splitMode,
+		AccountDepth:    *accountDepth,
+		Dir:             *dir,
+		Root:            *root,
+		OpeningBalances: *openingBalances,
+		OpeningAccount:  *openingAccount,
+		BalanceAccounts: *balanceAccounts,
+		Report:          *report,
+		Backups:         *backups,
+	}
+	files, err := s.SplitFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	if !*report {
+		for _, f := range files {
+			fmt.Fprintf(os.Stderr, "wrote %s\n", f)
+		}
+	}
+}
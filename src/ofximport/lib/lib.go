@@ -0,0 +1,650 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+const (
+	// DefaultIDTag is the metadata tag transaction IDs are stored in. It's the
+	// same one ledger-autosync uses, with the same `FID.ACCTID.FITID` values.
+	DefaultIDTag = "ofxid"
+
+	DefaultCurrency          = "$"
+	DefaultExpenseAccount    = "Expenses:Unknown"
+	DefaultIncomeAccount     = "Income:Unknown"
+	DefaultCommissionAccount = "Expenses:Commissions"
+)
+
+// DefaultIncomeAccounts are the accounts investment income is balanced
+// against, by OFX INCOMETYPE.
+var DefaultIncomeAccounts = map[string]string{
+	"DIV":      "Income:Dividends",
+	"INTEREST": "Income:Interest",
+	"CGLONG":   "Income:Capital Gains",
+	"CGSHORT":  "Income:Capital Gains",
+	"MISC":     DefaultIncomeAccount,
+}
+
+var incomeTypeNames = map[string]string{
+	"DIV":      "Dividend",
+	"INTEREST": "Interest",
+	"CGLONG":   "Capital gains distribution",
+	"CGSHORT":  "Capital gains distribution",
+}
+
+type Importer struct {
+	// Accounts maps OFX account IDs to ledger accounts. Other accounts are
+	// named after their type and ID, like `Assets:Bank:1234`.
+	Accounts map[string]string
+	// Currency is written for amounts in a statement's default currency.
+	// Other currencies are written as their ISO codes.
+	Currency string
+	// ExpenseAccount and IncomeAccount balance bank and credit card
+	// transactions that take money out of, or put money into, an account.
+	ExpenseAccount string
+	IncomeAccount  string
+	// CommissionAccount gets the commissions, fees and taxes of investment
+	// transactions.
+	CommissionAccount string
+	// IncomeAccounts maps OFX INCOMETYPEs (DIV, INTEREST, CGLONG, CGSHORT and
+	// MISC) to the accounts investment income is balanced against.
+	// IncomeAccount is used for any others.
+	IncomeAccounts map[string]string
+	// IDTag is the metadata tag each transaction's ID is stored in.
+	IDTag string
+	importer.Appender
+}
+
+// Import is what was read from an OFX file.
+type Import struct {
+	// Transactions are the imported ledger transactions, sorted.
+	Transactions string
+	// Prices are the security prices seen, in date order. Their Symbol is the
+	// security's ticker symbol (quoted if necessary), or its CUSIP if it
+	// doesn't have one.
+	Prices []*pricedb.Price
+	// Skipped describes investment transactions of unsupported types, which
+	// were left out.
+	Skipped []string
+}
+
+// statement holds what's common to the transactions of one statement.
+type statement struct {
+	account string
+	// currency is the statement's default currency (CURDEF).
+	currency string
+	// idPrefix is prepended to FITIDs to make IDs.
+	idPrefix string
+}
+
+// security is an entry in the OFX security list.
+type security struct {
+	symbol string
+	name   string
+}
+
+// Convert reads an OFX file from r.
+func (im *Importer) Convert(r io.Reader) (*Import, error) {
+	ofx, err := parseOFX(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseOFX()")
+	}
+	c := &converter{Importer: im, ofx: ofx, prices: make(map[string]*pricedb.Price)}
+	if err := c.convert(); err != nil {
+		return nil, errors.Wrap(err, "convert()")
+	}
+
+	out, err := im.Sort(c.transactions)
+	if err != nil {
+		return nil, errors.Wrap(err, "Sort()")
+	}
+
+	imp := &Import{Transactions: out, Skipped: c.skipped}
+	for _, p := range c.prices {
+		imp.Prices = append(imp.Prices, p)
+	}
+	sort.Slice(imp.Prices, func(i, j int) bool {
+		a, b := imp.Prices[i], imp.Prices[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.Symbol < b.Symbol
+	})
+	return imp, nil
+}
+
+// ConvertFile is like Convert, reading the OFX file at path.
+func (im *Importer) ConvertFile(path string) (*Import, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.Open(%s)", path)
+	}
+	defer f.Close()
+	imp, err := im.Convert(f)
+	return imp, errors.Wrapf(err, "Convert(%s)", path)
+}
+
+// AppendPrices appends prices to the price.db at path, in the format
+// pricedbfetcher writes, skipping any symbols that already have a price for
+// the same day. The file is replaced atomically, keeping backups copies of
+// the original. It returns the number of prices added.
+func AppendPrices(path string, prices []*pricedb.Price, backups int) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	existing := string(b)
+
+	db, err := pricedb.Parse(existing, pricedb.Strict)
+	if err != nil {
+		return 0, errors.Wrapf(err, "pricedb.Parse(%s)", path)
+	}
+	items, err := db.GetSortedTimeSeriesItemWithSymbol(pricedb.DefaultCloseTime, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "db.GetSortedTimeSeriesItemWithSymbol(%s)", path)
+	}
+	have := make(map[string]bool, len(items))
+	for _, item := range items {
+		have[priceKey(item.Date, item.Symbol)] = true
+	}
+
+	var add []*pricedb.Price
+	for _, p := range prices {
+		if have[priceKey(p.Date, p.Symbol)] {
+			continue
+		}
+		d, err := pricedb.AtCloseTime(p.Date, pricedb.DefaultCloseTime)
+		if err != nil {
+			return 0, errors.Wrap(err, "pricedb.AtCloseTime()")
+		}
+		add = append(add, &pricedb.Price{Date: d, Symbol: p.Symbol, Commodity: p.Commodity, Amount: p.Amount})
+	}
+	if len(add) == 0 {
+		return 0, nil
+	}
+
+	var out strings.Builder
+	if existing != "" {
+		// separate the new prices from the old ones, like pricedbfetcher
+		// separates days
+		out.WriteString(strings.TrimRight(existing, "\n") + "\n\n")
+	}
+	w := pricedb.NewDBWriter(nil)
+	if err := w.Write(&out, add); err != nil {
+		return 0, errors.Wrap(err, "w.Write()")
+	}
+	if err := fs.WriteFileAtomic(path, []byte(out.String()), 0644, backups); err != nil {
+		return 0, errors.Wrapf(err, "fs.WriteFileAtomic(%s)", path)
+	}
+	return len(add), nil
+}
+
+func priceKey(date time.Time, symbol string) string {
+	return date.Format(journal.DateFormat) + " " + symbol
+}
+
+// converter holds the state of a single Convert.
+type converter struct {
+	*Importer
+	ofx          *element
+	securities   map[string]*security
+	transactions []*importer.Transaction
+	prices       map[string]*pricedb.Price
+	skipped      []string
+}
+
+func (c *converter) convert() error {
+	fid := c.ofx.get("SIGNONMSGSRSV1", "SONRS", "FI", "FID")
+
+	for _, rs := range c.ofx.child("BANKMSGSRSV1").all("STMTTRNRS") {
+		stmt := rs.child("STMTRS")
+		if err := c.bankStatement(stmt, stmt.get("BANKACCTFROM", "ACCTID"), "Assets:Bank", fid); err != nil {
+			return errors.Wrap(err, "bankStatement()")
+		}
+	}
+	for _, rs := range c.ofx.child("CREDITCARDMSGSRSV1").all("CCSTMTTRNRS") {
+		stmt := rs.child("CCSTMTRS")
+		if err := c.bankStatement(stmt, stmt.get("CCACCTFROM", "ACCTID"), "Liabilities:Credit Card", fid); err != nil {
+			return errors.Wrap(err, "bankStatement()")
+		}
+	}
+
+	invs := c.ofx.child("INVSTMTMSGSRSV1").all("INVSTMTTRNRS")
+	// the security list doesn't have its own currency, so assume it's the
+	// same as the first investment statement
+	currency := ""
+	if len(invs) > 0 {
+		currency = invs[0].get("INVSTMTRS", "CURDEF")
+	}
+	if err := c.securityList(currency); err != nil {
+		return errors.Wrap(err, "securityList()")
+	}
+	for _, rs := range invs {
+		if err := c.investmentStatement(rs.child("INVSTMTRS"), fid); err != nil {
+			return errors.Wrap(err, "investmentStatement()")
+		}
+	}
+	return nil
+}
+
+func (c *converter) statement(acctID, defaultAccount, currency, fid string) *statement {
+	account, ok := c.Accounts[acctID]
+	if !ok {
+		account = defaultAccount + ":" + acctID
+	}
+	var prefix string
+	for _, s := range []string{fid, acctID} {
+		if s != "" {
+			prefix += s + "."
+		}
+	}
+	return &statement{account: account, currency: currency, idPrefix: prefix}
+}
+
+func (c *converter) bankStatement(stmt *element, acctID, defaultAccount, fid string) error {
+	if stmt == nil {
+		return nil
+	}
+	s := c.statement(acctID, defaultAccount, stmt.get("CURDEF"), fid)
+	for _, trn := range stmt.child("BANKTRANLIST").all("STMTTRN") {
+		if err := c.bankTransaction(s, trn); err != nil {
+			return errors.Wrapf(err, "FITID %s", trn.get("FITID"))
+		}
+	}
+	return nil
+}
+
+func (c *converter) bankTransaction(s *statement, trn *element) error {
+	t, err := c.newTransaction(s, trn.get("FITID"), trn.get("DTPOSTED"))
+	if err != nil {
+		return errors.Wrap(err, "newTransaction()")
+	}
+	if trn.get("DTUSER") != "" {
+		if t.AuxDate, err = parseDate(trn.get("DTUSER")); err != nil {
+			return errors.Wrap(err, "parseDate(DTUSER)")
+		}
+	}
+	t.Code = trn.get("CHECKNUM")
+
+	memo := trn.get("MEMO")
+	t.Payee = trn.get("NAME")
+	if t.Payee == "" {
+		t.Payee = trn.get("PAYEE", "NAME")
+	}
+	switch {
+	case t.Payee == "":
+		t.Payee = memo
+	case memo != "" && memo != t.Payee:
+		t.Notes = append([]string{memo}, t.Notes...)
+	}
+	if t.Payee == "" {
+		t.Payee = trn.get("TRNTYPE")
+	}
+
+	q, prec, err := parseAmount(trn.get("TRNAMT"))
+	if err != nil {
+		return errors.Wrap(err, "parseAmount(TRNAMT)")
+	}
+	other := c.ExpenseAccount
+	if q.Sign() > 0 {
+		other = c.IncomeAccount
+	}
+	t.Postings = []*importer.Posting{
+		{Account: s.account, Amount: c.format(q, prec, s.currency, s.currency)},
+		{Account: other},
+	}
+	c.transactions = append(c.transactions, t)
+	return nil
+}
+
+// newTransaction starts a cleared transaction with an ID note.
+func (c *converter) newTransaction(s *statement, fitid, date string) (*importer.Transaction, error) {
+	d, err := parseDate(date)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseDate()")
+	}
+	// OFX transactions have already posted
+	t := &importer.Transaction{Date: d, State: journal.Cleared}
+	if fitid != "" && c.IDTag != "" {
+		t.Notes = append(t.Notes, fmt.Sprintf("%s: %s%s", c.IDTag, s.idPrefix, fitid))
+	}
+	return t, nil
+}
+
+func (c *converter) securityList(currency string) error {
+	c.securities = make(map[string]*security)
+	for _, info := range c.ofx.child("SECLISTMSGSRSV1", "SECLIST").elements() {
+		sec := info.child("SECINFO")
+		if sec == nil {
+			continue
+		}
+		id := sec.get("SECID", "UNIQUEID")
+		symbol := sec.get("TICKER")
+		if symbol == "" {
+			symbol = id
+		}
+		c.securities[id] = &security{symbol: journal.QuoteCommodity(symbol), name: sec.get("SECNAME")}
+		if err := c.addPrice(id, sec.get("UNITPRICE"), sec.get("DTASOF"), sec.get("CURRENCY", "CURSYM"), currency); err != nil {
+			return errors.Wrapf(err, "security %s", id)
+		}
+	}
+	return nil
+}
+
+// security returns the security with the given ID, even if it's not in the
+// security list.
+func (c *converter) security(id string) *security {
+	if sec, ok := c.securities[id]; ok {
+		return sec
+	}
+	return &security{symbol: journal.QuoteCommodity(id)}
+}
+
+// addPrice records a price, if there is one. Later prices for the same day
+// replace earlier ones.
+func (c *converter) addPrice(id, price, date, currency, defaultCurrency string) error {
+	if price == "" || date == "" {
+		return nil
+	}
+	q, err := priceutils.ParseDecimal(numberString(price))
+	if err != nil {
+		return errors.Wrap(err, "priceutils.ParseDecimal(UNITPRICE)")
+	}
+	if q.Sign() <= 0 {
+		return nil
+	}
+	d, err := parseDate(date)
+	if err != nil {
+		return errors.Wrap(err, "parseDate()")
+	}
+	symbol := c.security(id).symbol
+	c.prices[priceKey(d, symbol)] = &pricedb.Price{Date: d, Symbol: symbol, Commodity: c.currency(currency, defaultCurrency), Amount: q}
+	return nil
+}
+
+func (c *converter) investmentStatement(stmt *element, fid string) error {
+	if stmt == nil {
+		return nil
+	}
+	s := c.statement(stmt.get("INVACCTFROM", "ACCTID"), "Assets:Investments", stmt.get("CURDEF"), fid)
+	for _, trn := range stmt.child("INVTRANLIST").elements() {
+		var err error
+		switch {
+		case trn.name == "INVBANKTRAN":
+			err = c.bankTransaction(s, trn.child("STMTTRN"))
+		case strings.HasPrefix(trn.name, "BUY"):
+			err = c.trade(s, trn, trn.child("INVBUY"), false)
+		case strings.HasPrefix(trn.name, "SELL"):
+			err = c.trade(s, trn, trn.child("INVSELL"), true)
+		case trn.name == "INCOME":
+			err = c.income(s, trn)
+		case trn.name == "REINVEST":
+			err = c.reinvest(s, trn)
+		case trn.name == "DTSTART" || trn.name == "DTEND":
+		default:
+			c.skipped = append(c.skipped, fmt.Sprintf("%s %s (FITID %s)", trn.get("INVTRAN", "DTTRADE"), trn.name, trn.get("INVTRAN", "FITID")))
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s", trn.name)
+		}
+	}
+
+	for _, pos := range stmt.child("INVPOSLIST").elements() {
+		p := pos.child("INVPOS")
+		if p == nil {
+			continue
+		}
+		if err := c.addPrice(p.get("SECID", "UNIQUEID"), p.get("UNITPRICE"), p.get("DTPRICEASOF"), p.get("CURRENCY", "CURSYM"), s.currency); err != nil {
+			return errors.Wrap(err, "addPrice()")
+		}
+	}
+	return nil
+}
+
+// investment holds the fields shared by buys, sells and reinvestments.
+type investment struct {
+	t        *importer.Transaction
+	sec      *security
+	currency string
+	units    *big.Rat
+	unitsStr string
+	price    *big.Rat
+	priceStr string
+	// costs are commissions, fees, taxes and loads.
+	costs     *big.Rat
+	costsPrec int
+	total     *big.Rat
+	totalPrec int
+}
+
+// investment reads the fields of an investment transaction, where inv is the
+// element holding INVTRAN, SECID, UNITS, etc.
+func (c *converter) investment(s *statement, inv *element, verb string) (*investment, error) {
+	if inv == nil {
+		return nil, errors.New("missing details")
+	}
+	tran := inv.child("INVTRAN")
+	i := &investment{sec: c.security(inv.get("SECID", "UNIQUEID")), currency: inv.get("CURRENCY", "CURSYM"), costs: new(big.Rat)}
+	var err error
+	if i.t, err = c.newTransaction(s, tran.get("FITID"), tran.get("DTTRADE")); err != nil {
+		return nil, errors.Wrap(err, "newTransaction()")
+	}
+	if memo := tran.get("MEMO"); memo != "" {
+		i.t.Notes = append([]string{memo}, i.t.Notes...)
+	}
+	name := i.sec.name
+	if name == "" {
+		name = strings.Trim(i.sec.symbol, `"`)
+	}
+	i.t.Payee = verb + " " + name
+
+	if i.units, _, err = parseAmount(inv.get("UNITS")); err != nil {
+		return nil, errors.Wrap(err, "parseAmount(UNITS)")
+	}
+	i.unitsStr = numberString(inv.get("UNITS"))
+	if i.price, _, err = parseAmount(inv.get("UNITPRICE")); err != nil {
+		return nil, errors.Wrap(err, "parseAmount(UNITPRICE)")
+	}
+	i.priceStr = numberString(inv.get("UNITPRICE"))
+	for _, name := range []string{"COMMISSION", "FEES", "TAXES", "LOAD"} {
+		if inv.get(name) == "" {
+			continue
+		}
+		q, prec, err := parseAmount(inv.get(name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parseAmount(%s)", name)
+		}
+		i.costs.Add(i.costs, q)
+		i.costsPrec = max(i.costsPrec, prec)
+	}
+	if i.total, i.totalPrec, err = parseAmount(inv.get("TOTAL")); err != nil {
+		return nil, errors.Wrap(err, "parseAmount(TOTAL)")
+	}
+	if err := c.addPrice(inv.get("SECID", "UNIQUEID"), inv.get("UNITPRICE"), tran.get("DTTRADE"), i.currency, s.currency); err != nil {
+		return nil, errors.Wrap(err, "addPrice()")
+	}
+	return i, nil
+}
+
+// principal returns the value of the units, as implied by the total and
+// costs, and whether it matches the units and price. For buys the total is
+// negative, and for sells it's positive.
+func (i *investment) principal() (*big.Rat, bool) {
+	p := new(big.Rat).Abs(i.total)
+	if i.total.Sign() < 0 {
+		p.Sub(p, i.costs)
+	} else {
+		p.Add(p, i.costs)
+	}
+	value := new(big.Rat).Mul(i.units, i.price)
+	return p, value.Abs(value).Cmp(p) == 0
+}
+
+// trade adds a buy or sell. Bought units are recorded as a lot with their
+// cost, and sold ones with their sale price.
+func (c *converter) trade(s *statement, trn, inv *element, sell bool) error {
+	verb := "Buy"
+	if sell {
+		verb = "Sell"
+	}
+	i, err := c.investment(s, inv, verb)
+	if err != nil {
+		return errors.Wrap(err, "investment()")
+	}
+	if sell && i.units.Sign() > 0 {
+		// some institutions write sold units as positive
+		i.units.Neg(i.units)
+		i.unitsStr = "-" + i.unitsStr
+	}
+
+	principal, exact := i.principal()
+	units := i.unitsStr + " " + i.sec.symbol
+	price := c.format(i.price, decimals(i.priceStr), i.currency, s.currency)
+	total := c.format(principal, max(i.totalPrec, i.costsPrec), i.currency, s.currency)
+	switch {
+	case sell && exact:
+		units += " @ " + price
+	case sell:
+		units += " @@ " + total
+	case exact:
+		units += fmt.Sprintf(" {%s} [%s]", price, i.t.Date.Format(journal.DateFormat))
+	default:
+		units += fmt.Sprintf(" {{%s}} [%s]", total, i.t.Date.Format(journal.DateFormat))
+	}
+
+	i.t.Postings = append(i.t.Postings, &importer.Posting{Account: s.account, Amount: units})
+	c.addCosts(i, s)
+	i.t.Postings = append(i.t.Postings, &importer.Posting{Account: s.account, Amount: c.format(i.total, i.totalPrec, i.currency, s.currency)})
+	c.transactions = append(c.transactions, i.t)
+	return nil
+}
+
+func (c *converter) addCosts(i *investment, s *statement) {
+	if i.costs.Sign() != 0 {
+		i.t.Postings = append(i.t.Postings, &importer.Posting{Account: c.CommissionAccount, Amount: c.format(i.costs, i.costsPrec, i.currency, s.currency)})
+	}
+}
+
+func (c *converter) incomeAccount(incomeType string) string {
+	if a, ok := c.IncomeAccounts[incomeType]; ok {
+		return a
+	}
+	return c.IncomeAccount
+}
+
+func incomeTypeName(incomeType string) string {
+	if n, ok := incomeTypeNames[incomeType]; ok {
+		return n
+	}
+	return "Income"
+}
+
+// income adds a dividend, interest or other income paid out in cash.
+func (c *converter) income(s *statement, trn *element) error {
+	tran := trn.child("INVTRAN")
+	t, err := c.newTransaction(s, tran.get("FITID"), tran.get("DTTRADE"))
+	if err != nil {
+		return errors.Wrap(err, "newTransaction()")
+	}
+	if memo := tran.get("MEMO"); memo != "" {
+		t.Notes = append([]string{memo}, t.Notes...)
+	}
+	sec := c.security(trn.get("SECID", "UNIQUEID"))
+	name := sec.name
+	if name == "" {
+		name = strings.Trim(sec.symbol, `"`)
+	}
+	incomeType := trn.get("INCOMETYPE")
+	t.Payee = incomeTypeName(incomeType) + " " + name
+
+	q, prec, err := parseAmount(trn.get("TOTAL"))
+	if err != nil {
+		return errors.Wrap(err, "parseAmount(TOTAL)")
+	}
+	t.Postings = []*importer.Posting{
+		{Account: s.account, Amount: c.format(q, prec, trn.get("CURRENCY", "CURSYM"), s.currency)},
+		{Account: c.incomeAccount(incomeType)},
+	}
+	c.transactions = append(c.transactions, t)
+	return nil
+}
+
+// reinvest adds income that was used to buy more units.
+func (c *converter) reinvest(s *statement, trn *element) error {
+	incomeType := trn.get("INCOMETYPE")
+	i, err := c.investment(s, trn, "Reinvest "+strings.ToLower(incomeTypeName(incomeType)))
+	if err != nil {
+		return errors.Wrap(err, "investment()")
+	}
+
+	principal, exact := i.principal()
+	date := i.t.Date.Format(journal.DateFormat)
+	units := i.unitsStr + " " + i.sec.symbol
+	if exact {
+		units += fmt.Sprintf(" {%s} [%s]", c.format(i.price, decimals(i.priceStr), i.currency, s.currency), date)
+	} else {
+		units += fmt.Sprintf(" {{%s}} [%s]", c.format(principal, max(i.totalPrec, i.costsPrec), i.currency, s.currency), date)
+	}
+
+	i.t.Postings = append(i.t.Postings, &importer.Posting{Account: s.account, Amount: units})
+	c.addCosts(i, s)
+	i.t.Postings = append(i.t.Postings, &importer.Posting{Account: c.incomeAccount(incomeType), Amount: c.format(i.total, i.totalPrec, i.currency, s.currency)})
+	c.transactions = append(c.transactions, i.t)
+	return nil
+}
+
+// format formats q in currency, which is the statement's defaultCurrency if
+// empty.
+func (c *converter) format(q *big.Rat, prec int, currency, defaultCurrency string) string {
+	return importer.FormatAmount(q, prec, c.currency(currency, defaultCurrency), false)
+}
+
+// currency returns the commodity to write an amount in currency with, given
+// its statement's defaultCurrency.
+func (c *converter) currency(currency, defaultCurrency string) string {
+	if currency == "" || currency == defaultCurrency {
+		if c.Currency != "" {
+			return c.Currency
+		}
+		return defaultCurrency
+	}
+	return currency
+}
+
+// parseAmount parses an OFX amount, which may use `,` as its decimal mark.
+// It also returns the number of digits after the decimal mark.
+func parseAmount(s string) (*big.Rat, int, error) {
+	n := numberString(s)
+	q, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return nil, 0, errors.Errorf("invalid amount %q", s)
+	}
+	return q, decimals(n), nil
+}
+
+// numberString normalizes an OFX amount, like `+1,50`, to `1.50`.
+func numberString(s string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), "+")
+}
+
+func decimals(n string) int {
+	if i := strings.IndexByte(n, '.'); i >= 0 {
+		return len(n) - i - 1
+	}
+	return 0
+}
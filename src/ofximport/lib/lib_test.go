@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"testing"
+
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+const bankOFX = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS>
+<STATUS><CODE>0<SEVERITY>INFO</STATUS>
+<FI><ORG>Bank<FID>1234</FI>
+</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>CAD
+<BANKACCTFROM><BANKID>001<ACCTID>555<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240101<DTEND>20240110
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240105120000[-5:EST]
+<DTUSER>20240104
+<TRNAMT>-12.50
+<FITID>A1
+<NAME>LOBLAWS &amp; CO
+<MEMO>POS PURCHASE
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20240103
+<TRNAMT>+1000,00
+<FITID>A2
+<CHECKNUM>101
+<MEMO>Payroll
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CURDEF>CAD
+<CCACCTFROM><ACCTID>4111</CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240102<TRNAMT>-5<FITID>C1<PAYEE><NAME>Coffee</PAYEE></STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+const investmentOFX = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE"?>
+<OFX>
+  <INVSTMTMSGSRSV1>
+    <INVSTMTTRNRS>
+      <INVSTMTRS>
+        <DTASOF>20240131</DTASOF>
+        <CURDEF>CAD</CURDEF>
+        <INVACCTFROM><BROKERID>broker.com</BROKERID><ACCTID>999</ACCTID></INVACCTFROM>
+        <INVTRANLIST>
+          <DTSTART>20240101</DTSTART>
+          <DTEND>20240131</DTEND>
+          <BUYSTOCK>
+            <INVBUY>
+              <INVTRAN><FITID>B1</FITID><DTTRADE>20240105</DTTRADE><MEMO>Bought</MEMO></INVTRAN>
+              <SECID><UNIQUEID>CUSIP1</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+              <UNITS>10</UNITS>
+              <UNITPRICE>100.00</UNITPRICE>
+              <COMMISSION>9.95</COMMISSION>
+              <TOTAL>-1009.95</TOTAL>
+              <SUBACCTSEC>CASH</SUBACCTSEC>
+              <SUBACCTFUND>CASH</SUBACCTFUND>
+            </INVBUY>
+            <BUYTYPE>BUY</BUYTYPE>
+          </BUYSTOCK>
+          <SELLMF>
+            <INVSELL>
+              <INVTRAN><FITID>S1</FITID><DTTRADE>20240110</DTTRADE></INVTRAN>
+              <SECID><UNIQUEID>CUSIP2</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+              <UNITS>-3</UNITS>
+              <UNITPRICE>33.333</UNITPRICE>
+              <TOTAL>100.00</TOTAL>
+              <CURRENCY><CURRATE>1.35</CURRATE><CURSYM>USD</CURSYM></CURRENCY>
+            </INVSELL>
+            <SELLTYPE>SELL</SELLTYPE>
+          </SELLMF>
+          <INCOME>
+            <INVTRAN><FITID>I1</FITID><DTTRADE>20240115</DTTRADE></INVTRAN>
+            <SECID><UNIQUEID>CUSIP1</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+            <INCOMETYPE>DIV</INCOMETYPE>
+            <TOTAL>12.34</TOTAL>
+          </INCOME>
+          <REINVEST>
+            <INVTRAN><FITID>R1</FITID><DTTRADE>20240120</DTTRADE></INVTRAN>
+            <SECID><UNIQUEID>CUSIP1</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+            <INCOMETYPE>DIV</INCOMETYPE>
+            <TOTAL>-20.50</TOTAL>
+            <UNITS>0.2</UNITS>
+            <UNITPRICE>102.50</UNITPRICE>
+          </REINVEST>
+          <INVBANKTRAN>
+            <STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20240102</DTPOSTED><TRNAMT>500</TRNAMT><FITID>T1</FITID><NAME>Deposit</NAME></STMTTRN>
+            <SUBACCTFUND>CASH</SUBACCTFUND>
+          </INVBANKTRAN>
+          <TRANSFER>
+            <INVTRAN><FITID>X1</FITID><DTTRADE>20240125</DTTRADE></INVTRAN>
+          </TRANSFER>
+        </INVTRANLIST>
+        <INVPOSLIST>
+          <POSSTOCK>
+            <INVPOS>
+              <SECID><UNIQUEID>CUSIP1</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+              <HELDINACCT>CASH</HELDINACCT>
+              <POSTYPE>LONG</POSTYPE>
+              <UNITS>10.2</UNITS>
+              <UNITPRICE>105.10</UNITPRICE>
+              <MKTVAL>1072.02</MKTVAL>
+              <DTPRICEASOF>20240131</DTPRICEASOF>
+            </INVPOS>
+          </POSSTOCK>
+        </INVPOSLIST>
+      </INVSTMTRS>
+    </INVSTMTTRNRS>
+  </INVSTMTMSGSRSV1>
+  <SECLISTMSGSRSV1>
+    <SECLIST>
+      <STOCKINFO><SECINFO>
+        <SECID><UNIQUEID>CUSIP1</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+        <SECNAME>Vanguard S&amp;P 500</SECNAME>
+        <TICKER>VFV.TO</TICKER>
+        <UNITPRICE>104.00</UNITPRICE>
+        <DTASOF>20240131</DTASOF>
+      </SECINFO></STOCKINFO>
+      <MFINFO><SECINFO>
+        <SECID><UNIQUEID>CUSIP2</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+        <SECNAME>Some Fund</SECNAME>
+        <TICKER>FUND</TICKER>
+      </SECINFO></MFINFO>
+    </SECLIST>
+  </SECLISTMSGSRSV1>
+</OFX>
+`
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		im          Importer
+		in          string
+		want        string
+		wantPrices  []string
+		wantSkipped int
+	}{
+		{
+			Importer{Currency: DefaultCurrency, ExpenseAccount: DefaultExpenseAccount, IncomeAccount: DefaultIncomeAccount, IDTag: DefaultIDTag},
+			bankOFX,
+			"2024/01/02 * Coffee\n    ; ofxid: 1234.4111.C1\n    Liabilities:Credit Card:4111  $-5\n    Expenses:Unknown\n\n" +
+				"2024/01/03 * (101) Payroll\n    ; ofxid: 1234.555.A2\n    Assets:Bank:555  $1000.00\n    Income:Unknown\n\n" +
+				"2024/01/05=2024/01/04 * LOBLAWS & CO\n    ; POS PURCHASE\n    ; ofxid: 1234.555.A1\n    Assets:Bank:555  $-12.50\n    Expenses:Unknown\n",
+			nil,
+			0,
+		},
+		{
+			Importer{
+				Accounts:          map[string]string{"999": "Assets:Brokerage"},
+				Currency:          DefaultCurrency,
+				ExpenseAccount:    DefaultExpenseAccount,
+				IncomeAccount:     DefaultIncomeAccount,
+				CommissionAccount: DefaultCommissionAccount,
+				IncomeAccounts:    DefaultIncomeAccounts,
+				IDTag:             DefaultIDTag,
+			},
+			investmentOFX,
+			"2024/01/02 * Deposit\n    ; ofxid: 999.T1\n    Assets:Brokerage  $500\n    Income:Unknown\n\n" +
+				"2024/01/05 * Buy Vanguard S&P 500\n    ; Bought\n    ; ofxid: 999.B1\n    Assets:Brokerage  10 \"VFV.TO\" {$100.00} [2024/01/05]\n    Expenses:Commissions  $9.95\n    Assets:Brokerage  $-1009.95\n\n" +
+				"2024/01/10 * Sell Some Fund\n    ; ofxid: 999.S1\n    Assets:Brokerage  -3 FUND @@ USD 100.00\n    Assets:Brokerage  USD 100.00\n\n" +
+				"2024/01/15 * Dividend Vanguard S&P 500\n    ; ofxid: 999.I1\n    Assets:Brokerage  $12.34\n    Income:Dividends\n\n" +
+				"2024/01/20 * Reinvest dividend Vanguard S&P 500\n    ; ofxid: 999.R1\n    Assets:Brokerage  0.2 \"VFV.TO\" {$102.50} [2024/01/20]\n    Income:Dividends  $-20.50\n",
+			[]string{
+				"2024/01/05 \"VFV.TO\" $ 100.00",
+				"2024/01/10 FUND USD 33.333",
+				"2024/01/20 \"VFV.TO\" $ 102.50",
+				"2024/01/31 \"VFV.TO\" $ 105.10",
+			},
+			1,
+		},
+	}
+	for i, test := range tests {
+		imp, err := test.im.Convert(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("%d: Convert() = err(%v)", i, err)
+			continue
+		}
+		if imp.Transactions != test.want {
+			t.Errorf("%d: Convert().Transactions = %q, want %q", i, imp.Transactions, test.want)
+		}
+		var prices []string
+		for _, p := range imp.Prices {
+			prices = append(prices, p.Date.Format("2006/01/02")+" "+p.Symbol+" "+p.Commodity+" "+p.Amount.String())
+		}
+		if strings.Join(prices, "\n") != strings.Join(test.wantPrices, "\n") {
+			t.Errorf("%d: Convert().Prices = %q, want %q", i, prices, test.wantPrices)
+		}
+		if len(imp.Skipped) != test.wantSkipped {
+			t.Errorf("%d: Convert().Skipped = %q, want %d", i, imp.Skipped, test.wantSkipped)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []string{
+		"no ofx here",
+		"<OFX><A>1</B></OFX>",
+		"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST><STMTTRN><DTPOSTED>2024<TRNAMT>1</STMTTRN></BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>",
+		"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST><STMTTRN><DTPOSTED>20240101<TRNAMT>x</STMTTRN></BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>",
+		"<OFX><!-- unterminated",
+		"<OFX><A",
+	}
+	im := &Importer{Currency: DefaultCurrency, ExpenseAccount: DefaultExpenseAccount, IncomeAccount: DefaultIncomeAccount}
+	for i, test := range tests {
+		if _, err := im.Convert(strings.NewReader(test)); err == nil {
+			t.Errorf("%d: Convert(%q) = nil error, want non-nil", i, test)
+		}
+	}
+}
+
+func TestAppendPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "price.db")
+	if err := ioutil.WriteFile(path, []byte("; prices\nP 2024/01/05 22:45:00 \"VFV.TO\"  $99.00\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	d := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	prices := []*pricedb.Price{
+		{Date: d(5), Symbol: `"VFV.TO"`, Commodity: "$", Amount: priceutils.MustParseDecimal("100.00")},
+		{Date: d(5), Symbol: "FUND", Commodity: "USD", Amount: priceutils.MustParseDecimal("33.333")},
+		{Date: d(31), Symbol: `"VFV.TO"`, Commodity: "$", Amount: priceutils.MustParseDecimal("105.10")},
+	}
+	n, err := AppendPrices(path, prices, 0)
+	if err != nil {
+		t.Fatalf("AppendPrices() = err(%v)", err)
+	}
+	if n != 2 {
+		t.Errorf("AppendPrices() = %d, want 2", n)
+	}
+
+	want := "; prices\nP 2024/01/05 22:45:00 \"VFV.TO\"  $99.00\n\n" +
+		"P 2024/01/05 22:45:00 FUND      USD33.333\n\n" +
+		"P 2024/01/31 22:45:00 \"VFV.TO\"  $105.10\n"
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile() = err(%v)", err)
+	}
+	if string(got) != want {
+		t.Errorf("AppendPrices() left price.db as %q, want %q", got, want)
+	}
+}
+
+func TestParseOFX(t *testing.T) {
+	// SGML leaves are closed by the next tag, or an enclosing end tag
+	e, err := parseOFX(strings.NewReader("<OFX><A><B>1<C>2</A><D/><E>x &lt; y</E></OFX>"))
+	if err != nil {
+		t.Fatalf("parseOFX() = err(%v)", err)
+	}
+	if got := e.get("A", "B"); got != "1" {
+		t.Errorf("A.B = %q, want 1", got)
+	}
+	if got := e.get("A", "C"); got != "2" {
+		t.Errorf("A.C = %q, want 2", got)
+	}
+	if e.child("D") == nil {
+		t.Errorf("D = nil, want non-nil")
+	}
+	if got := e.get("E"); got != "x < y" {
+		t.Errorf("E = %q, want %q", got, "x < y")
+	}
+}
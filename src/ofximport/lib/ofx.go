@@ -0,0 +1,179 @@
+package lib
+
+import (
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// element is an OFX element: either an aggregate with children, or a leaf
+// with a value.
+type element struct {
+	name     string
+	value    string
+	children []*element
+}
+
+// child returns the first descendant at the given path of element names, or
+// nil.
+func (e *element) child(path ...string) *element {
+	for _, name := range path {
+		if e == nil {
+			return nil
+		}
+		var next *element
+		for _, c := range e.children {
+			if c.name == name {
+				next = c
+				break
+			}
+		}
+		e = next
+	}
+	return e
+}
+
+// get returns the value at the given path, or "".
+func (e *element) get(path ...string) string {
+	if c := e.child(path...); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// elements returns the children of e, which may be nil.
+func (e *element) elements() []*element {
+	if e == nil {
+		return nil
+	}
+	return e.children
+}
+
+// all returns the children of e with the given name.
+func (e *element) all(name string) []*element {
+	if e == nil {
+		return nil
+	}
+	var all []*element
+	for _, c := range e.children {
+		if c.name == name {
+			all = append(all, c)
+		}
+	}
+	return all
+}
+
+// parseOFX parses an OFX 1.x (SGML) or 2.x (XML) file, returning its <OFX>
+// element.
+//
+// In SGML files, leaf elements don't have to be closed, so an element is
+// closed by the end tag of any element that encloses it, and a leaf is also
+// closed by the next start tag.
+func parseOFX(r io.Reader) (*element, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "ioutil.ReadAll()")
+	}
+	s := string(b)
+	start := strings.Index(strings.ToUpper(s), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("no <OFX> element")
+	}
+	s = s[start:]
+
+	root := &element{}
+	stack := []*element{root}
+	top := func() *element { return stack[len(stack)-1] }
+	for s != "" {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			lt = len(s)
+		}
+		if text := strings.TrimSpace(s[:lt]); text != "" {
+			if len(stack) == 1 {
+				return nil, errors.Errorf("text %q outside of <OFX>", text)
+			}
+			top().value = html.UnescapeString(text)
+		}
+		s = s[lt:]
+		if s == "" {
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			s = s[end+3:]
+			continue
+		case strings.HasPrefix(s, "<?"):
+			end := strings.Index(s, "?>")
+			if end < 0 {
+				return nil, errors.New("unterminated processing instruction")
+			}
+			s = s[end+2:]
+			continue
+		}
+
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			return nil, errors.Errorf("unterminated tag %q", s)
+		}
+		tag := strings.TrimSpace(s[1:gt])
+		s = s[gt+1:]
+
+		if name, ok := strings.CutPrefix(tag, "/"); ok {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			i := len(stack) - 1
+			for i > 0 && stack[i].name != name {
+				i--
+			}
+			if i == 0 {
+				return nil, errors.Errorf("unexpected </%s>", name)
+			}
+			stack = stack[:i]
+			if len(stack) == 1 {
+				break
+			}
+			continue
+		}
+
+		selfClosing := strings.HasSuffix(tag, "/")
+		name := strings.ToUpper(strings.Fields(strings.TrimSuffix(tag, "/") + " ")[0])
+		if name == "" {
+			return nil, errors.New("empty tag")
+		}
+		if t := top(); t != root && t.value != "" {
+			// an unclosed SGML leaf
+			stack = stack[:len(stack)-1]
+		}
+		e := &element{name: name}
+		top().children = append(top().children, e)
+		if !selfClosing {
+			stack = append(stack, e)
+		}
+	}
+
+	if len(root.children) == 0 || root.children[0].name != "OFX" {
+		return nil, errors.New("no <OFX> element")
+	}
+	return root.children[0], nil
+}
+
+// parseDate parses an OFX date, like `20240105`, `20240105120000.000` or
+// `20240105120000.000[-5:EST]`. Only the date is kept: OFX times are usually
+// midnight or noon in some time zone, which would only make the date less
+// accurate.
+func parseDate(s string) (time.Time, error) {
+	if len(s) < 8 {
+		return time.Time{}, errors.Errorf("invalid date %q", s)
+	}
+	d, err := time.Parse("20060102", s[:8])
+	return d, errors.Wrapf(err, "time.Parse(%s)", s)
+}
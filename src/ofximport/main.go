@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/ofximport/lib"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var (
+	journalPath       = flag.StringP("journal", "j", "", "Journal to add the imported transactions to, in sorted order. Defaults to printing them to stdout.")
+	priceDBPath       = flag.String("price-db", "", "price.db file to append any security prices in the OFX file to.")
+	backups           = flag.IntP("backups", "b", 0, "Number of backup copies of the original journal and price.db to keep (as <file>.bak, <file>.bak.1, etc).")
+	accounts          = flag.StringToString("account", nil, "Ledger account for an OFX account ID, as ACCTID=ACCOUNT. Can be repeated. Unlisted accounts are named after their type and ID, like Assets:Bank:<ACCTID>.")
+	currency          = flag.String("currency", lib.DefaultCurrency, "Currency symbol to write for amounts in a statement's default currency. Empty to use its ISO code.")
+	expenseAccount    = flag.String("expense-account", lib.DefaultExpenseAccount, "Account that bank and credit card withdrawals are balanced against.")
+	incomeAccount     = flag.String("income-account", lib.DefaultIncomeAccount, "Account that bank and credit card deposits, and unlisted types of investment income, are balanced against.")
+	commissionAccount = flag.String("commission-account", lib.DefaultCommissionAccount, "Account for commissions, fees and taxes on investment transactions.")
+	incomeAccounts    = flag.StringToString("income-accounts", lib.DefaultIncomeAccounts, "Accounts that investment income is balanced against, by OFX income type (DIV, INTEREST, CGLONG, CGSHORT, MISC).")
+	idTag             = flag.String("id-tag", lib.DefaultIDTag, "Metadata tag to store each transaction's OFX ID (FITID) in. Empty to leave IDs out.")
+
+	dedupeMode sorter.DedupeMode
+)
+
+func main() {
+	flag.Var(enumflag.New(&dedupeMode, "dedupeMode", sorter.DedupeModeIDs, enumflag.EnumCaseInsensitive), "dedupe", fmt.Sprintf("What to do with likely duplicate transactions (eg from importing the same statement twice) when adding to a --journal. %q lists them on stderr; %q removes them; %q comments them out.", sorter.DedupeModeIDs[sorter.ReportDuplicates][0], sorter.DedupeModeIDs[sorter.DropDuplicates][0], sorter.DedupeModeIDs[sorter.CommentDuplicates][0]))
+
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	idTags := sorter.DefaultIDTags
+	if *idTag != "" {
+		idTags = append([]string{*idTag}, idTags...)
+	}
+	im := &lib.Importer{
+		Accounts:          *accounts,
+		Currency:          *currency,
+		ExpenseAccount:    *expenseAccount,
+		IncomeAccount:     *incomeAccount,
+		CommissionAccount: *commissionAccount,
+		IncomeAccounts:    *incomeAccounts,
+		IDTag:             *idTag,
+		Appender: importer.Appender{
+			Sorter: sorter.Sorter{
+				Dedupe: sorter.Dedupe{
+					Mode:       dedupeMode,
+					Days:       sorter.DefaultDedupeDays,
+					Similarity: sorter.DefaultDedupeSimilarity,
+					IDTags:     idTags,
+				},
+			},
+		},
+	}
+
+	imp, err := im.ConvertFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, s := range imp.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped unsupported transaction: %s\n", s)
+	}
+
+	if *journalPath == "" {
+		_, err = io.WriteString(os.Stdout, imp.Transactions)
+	} else {
+		var dups []sorter.Duplicate
+		dups, err = im.AppendFile(imp.Transactions, *journalPath, *backups)
+		for _, d := range dups {
+			fmt.Fprintf(os.Stderr, "%s %s: duplicate of %s %s (%s)\n", d.Transaction.DateText, d.Transaction.Payee, d.Of.DateText, d.Of.Payee, d.Reason)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+
+	if *priceDBPath != "" {
+		n, err := lib.AppendPrices(*priceDBPath, imp.Prices, *backups)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "added %d prices\n", n)
+	}
+}
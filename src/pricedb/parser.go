@@ -0,0 +1,594 @@
+package pricedb
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+// EntryKind is the kind of a line in a price database.
+type EntryKind int
+
+const (
+	BlankEntry EntryKind = iota
+	// CommentEntry is a line starting with one of ledger's comment characters
+	// (`;`, `#`, `%`, `|` or `*`).
+	CommentEntry
+	// PriceEntry is a `P DATE [TIME] SYMBOL PRICE` directive.
+	PriceEntry
+	// DefaultCommodityEntry is a `D AMOUNT` directive, which sets the default
+	// commodity (and its format).
+	DefaultCommodityEntry
+	// NoMarketEntry is an `N SYMBOL` directive, which tells ledger not to
+	// download prices for the commodity.
+	NoMarketEntry
+	// ConversionEntry is a `C AMOUNT = AMOUNT` directive, which defines a
+	// commodity in terms of another.
+	ConversionEntry
+	// InvalidEntry is a line that couldn't be parsed, in Lenient mode.
+	InvalidEntry
+)
+
+// ParseMode is what parsing does with lines that can't be parsed.
+type ParseMode int
+
+const (
+	// Strict fails on the first line that can't be parsed.
+	Strict ParseMode = iota
+	// Lenient keeps lines that can't be parsed as InvalidEntries (so they're
+	// otherwise ignored), and records why in the DB's Skipped.
+	Lenient
+)
+
+// ParseModeIDs are the enumflag IDs for ParseMode.
+var ParseModeIDs = map[ParseMode][]string{
+	Strict:  {"strict"},
+	Lenient: {"lenient"},
+}
+
+// commentChars are the characters that start a comment line.
+const commentChars = ";#%|*"
+
+// Entry is a single line of a price database. Raw is always the line exactly
+// as it was written; the other fields depend on Kind.
+type Entry struct {
+	Line int
+	Raw  string
+	Kind EntryKind
+
+	// Date is a PriceEntry's date and time. Time is the time as written (as
+	// HH:MM:SS), or "" if there wasn't one.
+	Date time.Time
+	Time string
+	// Symbol is the commodity a PriceEntry gives the price of, or a
+	// NoMarketEntry's commodity. Quoted symbols keep their quotes.
+	Symbol string
+	// Amount is a PriceEntry's price, a DefaultCommodityEntry's amount, or
+	// what a ConversionEntry converts from. To is what it converts to.
+	Amount *Amount
+	To     *Amount
+	// Comment is the text of a CommentEntry after its comment character, or
+	// of a trailing `;` comment on any other kind of entry.
+	Comment string
+}
+
+// Amount is a quantity of a commodity, like `$1,234.50`, `100 EUR` or
+// `"XBAL.TO" -5`.
+type Amount struct {
+	// Text is the amount as written.
+	Text      string
+	Commodity string
+	// Quantity is the exact quantity, with any sign and exponent applied. Its
+	// scale is the precision it was written with.
+	Quantity priceutils.Decimal
+	// Prefix is set if the commodity is written before the quantity, and
+	// Spaced if there is whitespace between them.
+	Prefix bool
+	Spaced bool
+}
+
+func (a *Amount) String() string {
+	return a.Text
+}
+
+// ParseError describes a line that couldn't be parsed. Path is empty if the
+// entries didn't come from a file.
+type ParseError struct {
+	Path   string
+	Line   int
+	Column int
+	Text   string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d, column %d: %v (line: %q)", e.Line, e.Column, e.Err, e.Text)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v (line: %q)", e.Path, e.Line, e.Column, e.Err, e.Text)
+}
+
+func (e *ParseError) Cause() error {
+	return e.Err
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DB is a parsed price database.
+type DB struct {
+	Path    string
+	Entries []*Entry
+	// Skipped holds why each InvalidEntry couldn't be parsed.
+	Skipped []*ParseError
+}
+
+// ReadFile reads and parses the price database at path.
+func ReadFile(path string, mode ParseMode) (*DB, error) {
+	data, err := GetData(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetData(%s)", path)
+	}
+	db, err := Parse(string(data), mode)
+	if err != nil {
+		if pe, ok := err.(*ParseError); ok {
+			pe.Path = path
+		}
+		return nil, err
+	}
+	db.Path = path
+	for _, pe := range db.Skipped {
+		pe.Path = path
+	}
+	return db, nil
+}
+
+// Parse parses the contents of a price database. A trailing newline doesn't
+// make an extra blank entry.
+func Parse(s string, mode ParseMode) (*DB, error) {
+	return ParseLines(strings.Split(strings.TrimSuffix(s, "\n"), "\n"), mode)
+}
+
+// ParseLines parses the lines of a price database, numbering them from 1.
+func ParseLines(lines []string, mode ParseMode) (*DB, error) {
+	db := &DB{Entries: make([]*Entry, 0, len(lines))}
+	for i, line := range lines {
+		e, err := ParseLine(line)
+		if err != nil {
+			pe, ok := err.(*ParseError)
+			if !ok {
+				return nil, err
+			}
+			pe.Line = i + 1
+			if mode == Strict {
+				return nil, pe
+			}
+			db.Skipped = append(db.Skipped, pe)
+			e = &Entry{Raw: line, Kind: InvalidEntry}
+		}
+		e.Line = i + 1
+		db.Entries = append(db.Entries, e)
+	}
+	return db, nil
+}
+
+// WriteSkipped writes a summary of the lines that were skipped to w, if there
+// were any.
+func (db *DB) WriteSkipped(w io.Writer) error {
+	if len(db.Skipped) == 0 {
+		return nil
+	}
+	name := db.Path
+	if name == "" {
+		name = "price database"
+	}
+	if _, err := fmt.Fprintf(w, "warning: skipped %d unparseable line(s) in %s:\n", len(db.Skipped), name); err != nil {
+		return errors.Wrap(err, "fmt.Fprintf()")
+	}
+	for _, pe := range db.Skipped {
+		if _, err := fmt.Fprintf(w, "    %v\n", pe); err != nil {
+			return errors.Wrap(err, "fmt.Fprintf()")
+		}
+	}
+	return nil
+}
+
+// ParseLine parses a single line of a price database. Errors are
+// *ParseErrors, without a line number.
+func ParseLine(line string) (*Entry, error) {
+	s := &scanner{line: strings.TrimSuffix(line, "\r")}
+	e := &Entry{Raw: line}
+	if err := s.entry(e); err != nil {
+		return nil, &ParseError{Column: utf8.RuneCountInString(s.line[:s.errPos]) + 1, Text: line, Err: err}
+	}
+	return e, nil
+}
+
+// String returns the database exactly as it was parsed.
+func (db *DB) String() string {
+	var b strings.Builder
+	for _, e := range db.Entries {
+		b.WriteString(e.Raw)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Prices returns the database's PriceEntries.
+func (db *DB) Prices() []*Entry {
+	var ret []*Entry
+	for _, e := range db.Entries {
+		if e.Kind == PriceEntry {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// scanner tokenizes a single line. pos is the current position, and errPos
+// the position an error was found at.
+type scanner struct {
+	line   string
+	pos    int
+	errPos int
+}
+
+func (s *scanner) errorf(pos int, format string, args ...interface{}) error {
+	s.errPos = pos
+	return errors.Errorf(format, args...)
+}
+
+func (s *scanner) done() bool {
+	return s.pos >= len(s.line)
+}
+
+func (s *scanner) peek() byte {
+	if s.done() {
+		return 0
+	}
+	return s.line[s.pos]
+}
+
+// skipSpace skips whitespace, and reports whether there was any.
+func (s *scanner) skipSpace() bool {
+	start := s.pos
+	for !s.done() && (s.line[s.pos] == ' ' || s.line[s.pos] == '\t') {
+		s.pos++
+	}
+	return s.pos > start
+}
+
+// field returns the text up to the next whitespace.
+func (s *scanner) field() string {
+	start := s.pos
+	for !s.done() && s.line[s.pos] != ' ' && s.line[s.pos] != '\t' {
+		s.pos++
+	}
+	return s.line[start:s.pos]
+}
+
+// requireSpace skips the whitespace that has to come before the next token,
+// named what.
+func (s *scanner) requireSpace(what string) error {
+	if s.done() {
+		return s.errorf(s.pos, "missing %s", what)
+	}
+	if !s.skipSpace() {
+		return s.errorf(s.pos, "expected whitespace before %s", what)
+	}
+	if s.done() {
+		return s.errorf(s.pos, "missing %s", what)
+	}
+	return nil
+}
+
+func (s *scanner) entry(e *Entry) error {
+	if strings.TrimSpace(s.line) == "" {
+		e.Kind = BlankEntry
+		return nil
+	}
+	if strings.IndexByte(commentChars, s.line[0]) >= 0 {
+		e.Kind = CommentEntry
+		e.Comment = s.line[1:]
+		return nil
+	}
+	if s.skipSpace() && s.peek() == ';' {
+		e.Kind = CommentEntry
+		e.Comment = s.line[s.pos+1:]
+		return nil
+	}
+
+	directive := s.field()
+	var err error
+	switch directive {
+	case "P":
+		e.Kind = PriceEntry
+		err = s.price(e)
+	case "D":
+		e.Kind = DefaultCommodityEntry
+		if err = s.requireSpace("amount"); err == nil {
+			e.Amount, err = s.amount()
+		}
+	case "N":
+		e.Kind = NoMarketEntry
+		if err = s.requireSpace("commodity"); err == nil {
+			e.Symbol, err = s.commodity()
+		}
+	case "C":
+		e.Kind = ConversionEntry
+		err = s.conversion(e)
+	default:
+		return s.errorf(s.pos-len(directive), "unknown directive %q", directive)
+	}
+	if err != nil {
+		return err
+	}
+	return s.trailer(e)
+}
+
+// price parses the rest of a `P DATE [TIME] SYMBOL PRICE` line.
+func (s *scanner) price(e *Entry) error {
+	if err := s.requireSpace("date"); err != nil {
+		return err
+	}
+	start := s.pos
+	field := s.field()
+	// there are no `year` directives to take a year from, so it's required
+	date, err := journal.ParseDate(field, 0)
+	if err == nil && date.Year() == 0 {
+		err = errors.Errorf("invalid year in date %q", field)
+	}
+	if err != nil {
+		return s.errorf(start, "%v", err)
+	}
+	if err := s.requireSpace("commodity"); err != nil {
+		return err
+	}
+
+	// a time is digits and colons, which a commodity can't start with
+	if c := s.peek(); c >= '0' && c <= '9' {
+		start := s.pos
+		t, err := parseTime(s.field())
+		if err != nil {
+			return s.errorf(start, "%v", err)
+		}
+		e.Time = t.Format("15:04:05")
+		date = date.Add(timeOfDay(t))
+		if err := s.requireSpace("commodity"); err != nil {
+			return err
+		}
+	}
+	e.Date = date
+
+	if e.Symbol, err = s.commodity(); err != nil {
+		return err
+	}
+	if err := s.requireSpace("price"); err != nil {
+		return err
+	}
+	e.Amount, err = s.amount()
+	return err
+}
+
+// conversion parses the rest of a `C AMOUNT = AMOUNT` line.
+func (s *scanner) conversion(e *Entry) error {
+	if err := s.requireSpace("amount"); err != nil {
+		return err
+	}
+	var err error
+	if e.Amount, err = s.amount(); err != nil {
+		return err
+	}
+	s.skipSpace()
+	if s.peek() != '=' {
+		return s.errorf(s.pos, "expected '='")
+	}
+	s.pos++
+	s.skipSpace()
+	if s.done() {
+		return s.errorf(s.pos, "missing amount")
+	}
+	e.To, err = s.amount()
+	return err
+}
+
+// trailer parses what's left of a line after its entry: nothing but
+// whitespace and an optional `;` comment.
+func (s *scanner) trailer(e *Entry) error {
+	s.skipSpace()
+	if s.done() {
+		return nil
+	}
+	if s.peek() == ';' {
+		e.Comment = s.line[s.pos+1:]
+		return nil
+	}
+	return s.errorf(s.pos, "unexpected %q", s.line[s.pos:])
+}
+
+// commodity parses a quoted or unquoted commodity symbol.
+func (s *scanner) commodity() (string, error) {
+	start := s.pos
+	if s.peek() == '"' {
+		end := strings.IndexByte(s.line[s.pos+1:], '"')
+		if end < 0 {
+			return "", s.errorf(start, "unterminated quoted commodity")
+		}
+		if end == 0 {
+			return "", s.errorf(start, "empty quoted commodity")
+		}
+		s.pos += end + 2
+		return s.line[start:s.pos], nil
+	}
+	for !s.done() {
+		r, size := utf8.DecodeRuneInString(s.line[s.pos:])
+		if r < utf8.RuneSelf && strings.IndexByte(journal.CommodityStopChars, byte(r)) >= 0 {
+			break
+		}
+		s.pos += size
+	}
+	if s.pos == start {
+		return "", s.errorf(start, "expected a commodity")
+	}
+	return s.line[start:s.pos], nil
+}
+
+// amount parses an amount, with its commodity before or after the quantity
+// (or neither), and the sign before either.
+func (s *scanner) amount() (*Amount, error) {
+	start := s.pos
+	a := &Amount{}
+
+	neg := false
+	if c := s.peek(); c == '-' || c == '+' {
+		neg = c == '-'
+		s.pos++
+	}
+	if c := s.peek(); !(c >= '0' && c <= '9') && c != '.' && c != ',' {
+		var err error
+		if a.Commodity, err = s.commodity(); err != nil {
+			return nil, err
+		}
+		a.Prefix = true
+		a.Spaced = s.skipSpace()
+		if c := s.peek(); (c == '-' || c == '+') && !neg {
+			neg = c == '-'
+			s.pos++
+		}
+	}
+
+	q, err := s.quantity()
+	if err != nil {
+		return nil, err
+	}
+	if neg {
+		q = q.Neg()
+	}
+	a.Quantity = q
+
+	if !a.Prefix {
+		end := s.pos
+		spaced := s.skipSpace()
+		if c := s.peek(); c != 0 && c != ';' && c != '=' {
+			if a.Commodity, err = s.commodity(); err != nil {
+				return nil, err
+			}
+			a.Spaced = spaced
+		} else {
+			s.pos = end
+		}
+	}
+	a.Text = s.line[start:s.pos]
+	return a, nil
+}
+
+// quantity parses an unsigned number, which can have thousands separators
+// (`,`, `.` or `'`), a decimal mark (`.` or `,`) and an exponent.
+func (s *scanner) quantity() (priceutils.Decimal, error) {
+	start := s.pos
+	for !s.done() && strings.IndexByte("0123456789.,'", s.peek()) >= 0 {
+		s.pos++
+	}
+	text := s.line[start:s.pos]
+	if strings.Trim(text, ".,'") == "" {
+		return priceutils.Decimal{}, s.errorf(start, "expected a number")
+	}
+
+	exp := 0
+	if c := s.peek(); c == 'e' || c == 'E' {
+		i := s.pos + 1
+		if i < len(s.line) && (s.line[i] == '-' || s.line[i] == '+') {
+			i++
+		}
+		j := i
+		for j < len(s.line) && s.line[j] >= '0' && s.line[j] <= '9' {
+			j++
+		}
+		// otherwise it's the start of a commodity, like `100 EUR` written
+		// without the space
+		if j > i {
+			var err error
+			if exp, err = strconv.Atoi(s.line[s.pos+1 : j]); err != nil {
+				return priceutils.Decimal{}, s.errorf(s.pos, "invalid exponent")
+			}
+			s.pos = j
+		}
+	}
+
+	intPart, fracPart, err := splitDecimal(text)
+	if err != nil {
+		return priceutils.Decimal{}, s.errorf(start, "%v", err)
+	}
+	q, err := priceutils.ParseDecimal(intPart + "." + fracPart + "e" + strconv.Itoa(exp))
+	if err != nil {
+		return priceutils.Decimal{}, s.errorf(start, "%v", err)
+	}
+	return q, nil
+}
+
+// splitDecimal splits a number written with thousands separators into its
+// integer and fractional digits. If both `.` and `,` appear, the last one is
+// the decimal mark. A lone `,` followed by exactly three digits is a
+// thousands separator (as ledger assumes by default); otherwise a single `.`
+// or `,` is the decimal mark, and a repeated one is a thousands separator.
+func splitDecimal(text string) (intPart, fracPart string, err error) {
+	mark := -1
+	dots, commas := strings.Count(text, "."), strings.Count(text, ",")
+	switch {
+	case dots > 0 && commas > 0:
+		mark = max(strings.LastIndexByte(text, '.'), strings.LastIndexByte(text, ','))
+	case dots == 1:
+		mark = strings.IndexByte(text, '.')
+	case commas == 1 && len(text)-strings.IndexByte(text, ',')-1 != 3:
+		mark = strings.IndexByte(text, ',')
+	}
+	intText := text
+	if mark >= 0 {
+		intText = text[:mark]
+		if strings.ContainsAny(text[mark+1:], ".,'") {
+			return "", "", errors.Errorf("invalid number %q", text)
+		}
+	}
+	// thousands separators have to all be the same, with groups of three
+	// digits after each of them
+	if i := strings.IndexAny(intText, ".,'"); i >= 0 {
+		groups := strings.Split(intText, intText[i:i+1])
+		for j, g := range groups {
+			if (j == 0 && (g == "" || len(g) > 3)) || (j > 0 && len(g) != 3) || strings.ContainsAny(g, ".,'") {
+				return "", "", errors.Errorf("invalid number %q", text)
+			}
+		}
+	}
+
+	digits := func(s string) string {
+		return strings.NewReplacer(",", "", ".", "", "'", "").Replace(s)
+	}
+	if mark < 0 {
+		return digits(text), "", nil
+	}
+	return digits(intText), text[mark+1:], nil
+}
+
+// parseTime parses an `HH:MM[:SS]` time.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid time %q", s)
+}
+
+// timeOfDay returns how long after midnight t is.
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
@@ -0,0 +1,162 @@
+package pricedb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+func TestParseLine(t *testing.T) {
+	date := func(s string) time.Time {
+		return mustParseTime(s)
+	}
+	dec := priceutils.MustParseDecimal
+	tests := []struct {
+		in   string
+		want *Entry
+	}{
+		{"", &Entry{Kind: BlankEntry}},
+		{"  \t", &Entry{Kind: BlankEntry}},
+		{"; a comment", &Entry{Kind: CommentEntry, Comment: " a comment"}},
+		{"# another", &Entry{Kind: CommentEntry, Comment: " another"}},
+		{"   ; indented", &Entry{Kind: CommentEntry, Comment: " indented"}},
+		{
+			"P 2021/01/18 19:23:00 GOOG    £2362.428722",
+			&Entry{Kind: PriceEntry, Date: date("2021/01/18 19:23:00"), Time: "19:23:00", Symbol: "GOOG", Amount: &Amount{Text: "£2362.428722", Commodity: "£", Quantity: dec("2362.428722"), Prefix: true}},
+		},
+		{
+			"P 2024-03-05 AAPL 100 EUR",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 00:00:00"), Symbol: "AAPL", Amount: &Amount{Text: "100 EUR", Commodity: "EUR", Quantity: dec("100"), Spaced: true}},
+		},
+		{
+			"P 2024.03.05 9:30 \"XBAL.TO\" $ -1,234.5 ; note",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 09:30:00"), Time: "09:30:00", Symbol: `"XBAL.TO"`, Amount: &Amount{Text: "$ -1,234.5", Commodity: "$", Quantity: dec("-1234.5"), Prefix: true, Spaced: true}, Comment: " note"},
+		},
+		{
+			"P 2024/03/05 BTC 1.5e-3EUR",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 00:00:00"), Symbol: "BTC", Amount: &Amount{Text: "1.5e-3EUR", Commodity: "EUR", Quantity: dec("0.0015")}},
+		},
+		{
+			"P 2024/03/05 X -$2E3",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 00:00:00"), Symbol: "X", Amount: &Amount{Text: "-$2E3", Commodity: "$", Quantity: dec("-2000"), Prefix: true}},
+		},
+		{
+			"P 2024/03/05 X 1.234.567,89 EUR",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 00:00:00"), Symbol: "X", Amount: &Amount{Text: "1.234.567,89 EUR", Commodity: "EUR", Quantity: dec("1234567.89"), Spaced: true}},
+		},
+		{
+			"P 2024/03/05 X CHF 1'000.05",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 00:00:00"), Symbol: "X", Amount: &Amount{Text: "CHF 1'000.05", Commodity: "CHF", Quantity: dec("1000.05"), Prefix: true, Spaced: true}},
+		},
+		{
+			"P 2024/03/05 X 6,25 EUR",
+			&Entry{Kind: PriceEntry, Date: date("2024/03/05 00:00:00"), Symbol: "X", Amount: &Amount{Text: "6,25 EUR", Commodity: "EUR", Quantity: dec("6.25"), Spaced: true}},
+		},
+		{"D $1,000.00", &Entry{Kind: DefaultCommodityEntry, Amount: &Amount{Text: "$1,000.00", Commodity: "$", Quantity: dec("1000.00"), Prefix: true}}},
+		{"N $ ; no prices", &Entry{Kind: NoMarketEntry, Symbol: "$", Comment: " no prices"}},
+		{
+			"C 1.00 Kb = 1024 bytes",
+			&Entry{
+				Kind:   ConversionEntry,
+				Amount: &Amount{Text: "1.00 Kb", Commodity: "Kb", Quantity: dec("1.00"), Spaced: true},
+				To:     &Amount{Text: "1024 bytes", Commodity: "bytes", Quantity: dec("1024"), Spaced: true},
+			},
+		},
+	}
+	for i, test := range tests {
+		got, err := ParseLine(test.in)
+		if err != nil {
+			t.Errorf("%d: ParseLine(%q) = err(%v)", i, test.in, err)
+			continue
+		}
+		test.want.Raw = test.in
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: ParseLine(%q) = %+v, want %+v", i, test.in, got, test.want)
+			if got.Amount != nil && test.want.Amount != nil {
+				t.Errorf("%d: Amount = %+v, want %+v", i, got.Amount, test.want.Amount)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"P 2024/01/01 AAPL $1\nQ foo", "line 2, column 1: unknown directive \"Q\""},
+		{"P 2024/13/01 AAPL $1", "line 1, column 3: invalid month in date \"2024/13/01\""},
+		{"P 01/02 AAPL $1", "line 1, column 3: invalid year in date \"01/02\""},
+		{"P 2024/01/01 25:00 AAPL $1", "line 1, column 14: invalid time \"25:00\""},
+		{"P 2024/01/01 AAPL", "line 1, column 18: missing price"},
+		{"P 2024/01/01 AAPL $", "line 1, column 20: expected a number"},
+		{"P 2024/01/01 AAPL $1 extra", "line 1, column 22: unexpected \"extra\""},
+		{"P 2024/01/01 \"AAPL $1", "line 1, column 14: unterminated quoted commodity"},
+		{"P 2024/01/01 £ 1,2,3.4,5", "line 1, column 16: invalid number \"1,2,3.4,5\""},
+		{"C 1 Kb 1024 bytes", "line 1, column 8: expected '='"},
+	}
+	for i, test := range tests {
+		_, err := Parse(test.in, Strict)
+		if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%d: Parse(%q) = err(%v), want an error starting with %q", i, test.in, err, test.want)
+		}
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	in := "P 2024/01/01 AAPL $1\nP 2024/01/02 AAPL\nbogus\nP 2024/01/03 AAPL $3\n"
+	db, err := Parse(in, Lenient)
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+	if got := db.String(); got != in {
+		t.Errorf("Parse().String() = %q, want %q", got, in)
+	}
+	if got := len(db.Prices()); got != 2 {
+		t.Errorf("len(Parse().Prices()) = %d, want 2", got)
+	}
+
+	var b strings.Builder
+	if err := db.WriteSkipped(&b); err != nil {
+		t.Errorf("WriteSkipped() = err(%v)", err)
+	}
+	want := "warning: skipped 2 unparseable line(s) in price database:\n" +
+		"    line 2, column 18: missing price (line: \"P 2024/01/02 AAPL\")\n" +
+		"    line 3, column 1: unknown directive \"bogus\" (line: \"bogus\")\n"
+	if got := b.String(); got != want {
+		t.Errorf("WriteSkipped() = %q, want %q", got, want)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	in := "; prices\nD $1,000.00\n\nP 2024/01/01 AAPL $1  ; first\nP 2024-01-02 AAPL 2 EUR\n"
+	db, err := Parse(in, Strict)
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+	if got := db.String(); got != in {
+		t.Errorf("Parse().String() = %q, want %q", got, in)
+	}
+	if got := len(db.Prices()); got != 2 {
+		t.Errorf("len(Parse().Prices()) = %d, want 2", got)
+	}
+}
+
+func TestGetSortedTimeSeriesItemWithSymbolDateOnly(t *testing.T) {
+	got, err := GetSortedTimeSeriesItemWithSymbol([]string{"P 2024/01/02 AAPL 185.5 USD ; close", "N USD"}, DefaultCloseTime, nil)
+	if err != nil {
+		t.Fatalf("GetSortedTimeSeriesItemWithSymbol() = err(%v)", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("GetSortedTimeSeriesItemWithSymbol() = %d items, want 1", len(got))
+	}
+	if want := mustParseTime("2024/01/02 " + DefaultCloseTime); !got[0].Date.Equal(want) {
+		t.Errorf("GetSortedTimeSeriesItemWithSymbol()[0].Date = %v, want %v", got[0].Date, want)
+	}
+	if want := (&PriceData{priceutils.MustParseDecimal("185.5"), "USD"}); !reflect.DeepEqual(got[0].Data, want) {
+		t.Errorf("GetSortedTimeSeriesItemWithSymbol()[0].Data = %v, want %v", got[0].Data, want)
+	}
+}
@@ -4,43 +4,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/glennhartmann/ledger-tools/src/common"
+	"github.com/glennhartmann/ledger-tools/src/journal"
 	"github.com/glennhartmann/ledger-tools/src/priceutils"
 )
 
 const (
 	DefaultCloseTime = "22:45:00"
 	DateTimeFormat   = "2006/01/02 15:04:05"
-
-	unquotedCommodityRxStr = `[^\s"]+`
-	quotedCommodityRxStr   = `"[^"]+"`
-	lineRxFmt              = `^P\s+(\d\d\d\d\/\d\d\/\d\d \d\d:\d\d:\d\d)\s+((%s)|(%s))\s+([^\d]+)((\d,?)+(\.\d+)?)$`
 )
 
 var (
 	DefaultFile = filepath.Join(common.DefaultDataDir, "price.db")
-
-	lineRx = regexp.MustCompile(fmt.Sprintf(lineRxFmt, unquotedCommodityRxStr, quotedCommodityRxStr))
 )
 
 type PriceData struct {
-	LastPrice    string
+	LastPrice    priceutils.Decimal
 	LastCurrency string
 }
 
-func (pd *PriceData) GetLastPrice() string {
+func (pd *PriceData) GetLastPrice() priceutils.Decimal {
 	return pd.LastPrice
 }
 
 func (pd *PriceData) String() string {
-	return fmt.Sprintf("{%q, %q}", pd.LastPrice, pd.LastCurrency)
+	return fmt.Sprintf("{%q, %q}", pd.LastPrice.String(), pd.LastCurrency)
 }
 
 var (
@@ -48,26 +41,30 @@ var (
 	GetData = ioutil.ReadFile
 )
 
+// ReadPriceDB returns the lines of the price database at path that aren't
+// blank or comments.
+//
+// Deprecated: use ReadFile, which keeps (and parses) every line.
 func ReadPriceDB(path string) ([]string, error) {
-	data, err := GetData(path)
+	db, err := ReadFile(path, Lenient)
 	if err != nil {
-		return nil, errors.Wrapf(err, "GetData(%s)", path)
+		return nil, errors.Wrapf(err, "ReadFile(%s)", path)
 	}
-
-	sp := strings.Split(string(data), "\n")
-	ret := make([]string, 0, len(sp))
-	for _, line := range sp {
-		if !IsWhitespaceOrComment(line) {
-			ret = append(ret, line)
+	ret := make([]string, 0, len(db.Entries))
+	for _, e := range db.Entries {
+		if e.Kind != BlankEntry && e.Kind != CommentEntry {
+			ret = append(ret, e.Raw)
 		}
 	}
-
 	return ret, nil
 }
 
+// IsWhitespaceOrComment returns whether s is a blank or comment line.
+//
+// Deprecated: use ParseLine, and check the Entry's Kind.
 func IsWhitespaceOrComment(s string) bool {
-	s2 := strings.TrimSpace(s)
-	return s2 == "" || strings.HasPrefix(s2, ";")
+	e, err := ParseLine(s)
+	return err == nil && (e.Kind == BlankEntry || e.Kind == CommentEntry)
 }
 
 func GetSortedTimeSeriesItemWithSymbol(lines []string, closeTime string, symbolMap map[string]string) ([]*priceutils.TimeSeriesItemWithSymbol, error) {
@@ -75,46 +72,112 @@ func GetSortedTimeSeriesItemWithSymbol(lines []string, closeTime string, symbolM
 }
 
 func GetDedupedSortedTimeSeriesItemWithSymbol(lines []string, closeTime string, symbolMap map[string]string, others []*priceutils.TimeSeriesItemWithSymbol) ([]*priceutils.TimeSeriesItemWithSymbol, error) {
-	ret := make([]*priceutils.TimeSeriesItemWithSymbol, 0, len(lines))
-	ds := makeDateSymbolSet(others)
-	for _, line := range lines {
-		tl := strings.TrimSpace(line)
-		r := lineRx.FindStringSubmatch(tl)
-		const expectedMatches = 9
-		if len(r) != expectedMatches {
-			return nil, errors.Errorf("expected %d Rx submatches, got %d (line: %s)", expectedMatches, len(r), line)
-		}
-		dateTimeStr := r[1]
-		symbol := r[2]
+	db, err := ParseLines(lines, Strict)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseLines()")
+	}
+	return db.GetDedupedSortedTimeSeriesItemWithSymbol(closeTime, symbolMap, others)
+}
+
+func (db *DB) GetSortedTimeSeriesItemWithSymbol(closeTime string, symbolMap map[string]string) ([]*priceutils.TimeSeriesItemWithSymbol, error) {
+	return db.GetDedupedSortedTimeSeriesItemWithSymbol(closeTime, symbolMap, nil)
+}
+
+// GetDedupedSortedTimeSeriesItemWithSymbol returns db's prices, sorted, and
+// without the ones that others has a price for on the same date (unless
+// they're from before closeTime). Prices without a time are taken to be at
+// closeTime.
+func (db *DB) GetDedupedSortedTimeSeriesItemWithSymbol(closeTime string, symbolMap map[string]string, others []*priceutils.TimeSeriesItemWithSymbol) ([]*priceutils.TimeSeriesItemWithSymbol, error) {
+	entries, err := db.DedupedPrices(closeTime, symbolMap, others)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.DedupedPrices()")
+	}
+	ret := make([]*priceutils.TimeSeriesItemWithSymbol, 0, len(entries))
+	for _, e := range entries {
+		symbol := e.Symbol
 		if s, ok := symbolMap[symbol]; ok {
 			symbol = s
 		}
-		currency := r[5]
-		price := r[6]
-		dts := strings.Split(dateTimeStr, " ")
-		if len(dts) != 2 {
-			return nil, errors.Errorf("expected 2 string split pieces, got %d", len(dts))
+		d, err := e.DateAt(closeTime)
+		if err != nil {
+			return nil, errors.Wrap(err, "e.DateAt()")
+		}
+		ret = append(ret, &priceutils.TimeSeriesItemWithSymbol{Date: d, Symbol: symbol, Data: &PriceData{e.Amount.Quantity, e.Amount.Commodity}})
+	}
+	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{TSIWS: ret})
+	return ret, nil
+}
+
+// DedupedPrices is like GetDedupedSortedTimeSeriesItemWithSymbol, but
+// returns the PriceEntries themselves, in the order they're in db. Symbols
+// are compared without their quotes (see journal.UnquoteCommodity), so
+// symbolMap's keys should be unquoted too.
+func (db *DB) DedupedPrices(closeTime string, symbolMap map[string]string, others []*priceutils.TimeSeriesItemWithSymbol) ([]*Entry, error) {
+	var ret []*Entry
+	ds := makeDateSymbolSet(others)
+	for _, e := range db.Prices() {
+		symbol := journal.UnquoteCommodity(e.Symbol)
+		if s, ok := symbolMap[symbol]; ok {
+			symbol = s
 		}
-		timeOnlyStr := dts[1]
-		d, err := time.Parse(DateTimeFormat, dateTimeStr)
+		d, err := e.DateAt(closeTime)
 		if err != nil {
-			return nil, errors.Wrapf(err, "time.Parse(%s)", dateTimeStr)
+			return nil, errors.Wrap(err, "e.DateAt()")
+		}
+		timeOnlyStr := e.Time
+		if timeOnlyStr == "" {
+			timeOnlyStr = closeTime
 		}
-		fds := formatDateSymbol(d, symbol)
-		if _, ok := ds[fds]; !ok || timeOnlyStr < closeTime {
-			ret = append(ret, &priceutils.TimeSeriesItemWithSymbol{d, symbol, &PriceData{price, currency}})
+		if _, ok := ds[formatDateSymbol(d, symbol)]; !ok || timeOnlyStr < closeTime {
+			ret = append(ret, e)
 		}
 	}
-	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{ret})
 	return ret, nil
 }
 
+// DateAt returns a PriceEntry's date and time, taking prices without a time
+// to be at closeTime.
+func (e *Entry) DateAt(closeTime string) (time.Time, error) {
+	if e.Time != "" {
+		return e.Date, nil
+	}
+	d, err := AtCloseTime(e.Date, closeTime)
+	return d, errors.Wrap(err, "AtCloseTime()")
+}
+
+// Context returns the lines around prices, which are some of db's
+// PriceEntries, in order: for each price, the lines since the previous one
+// (or the start of the file), and the lines after the last one. These are
+// comments, D, N and C directives, and InvalidEntries, exactly as they were
+// written. Blank lines are left out.
+func (db *DB) Context(prices []*Entry) (leading map[*Entry][]string, trailing []string) {
+	keep := make(map[*Entry]bool, len(prices))
+	for _, e := range prices {
+		keep[e] = true
+	}
+	leading = make(map[*Entry][]string)
+	var pending []string
+	for _, e := range db.Entries {
+		switch e.Kind {
+		case BlankEntry:
+		case PriceEntry:
+			if keep[e] && len(pending) > 0 {
+				leading[e] = pending
+				pending = nil
+			}
+		default:
+			pending = append(pending, e.Raw)
+		}
+	}
+	return leading, pending
+}
+
 type dateSymbolSet map[string]struct{}
 
 func makeDateSymbolSet(others []*priceutils.TimeSeriesItemWithSymbol) dateSymbolSet {
 	ds := make(dateSymbolSet, len(others))
 	for _, item := range others {
-		ds[formatDateSymbol(item.Date, item.Symbol)] = struct{}{}
+		ds[formatDateSymbol(item.Date, journal.UnquoteCommodity(item.Symbol))] = struct{}{}
 	}
 	return ds
 }
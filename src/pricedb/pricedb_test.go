@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prashantv/gostub"
+
 	"github.com/glennhartmann/ledger-tools/src/priceutils"
 )
 
@@ -20,6 +22,41 @@ func TestGetDedupedSortedTimeSeriesItemWithSymbol(t *testing.T) {
 	}
 }
 
+func TestReadPriceDB(t *testing.T) {
+	stubs := gostub.New()
+	defer stubs.Reset()
+	stubs.StubFunc(&GetData, []byte("; prices\nP 2024/01/02 AAPL $185.50\n\n  ; indented\nN $\nbogus\n"), nil)
+
+	got, err := ReadPriceDB("price.db")
+	if err != nil {
+		t.Fatalf("ReadPriceDB() = err(%v)", err)
+	}
+	want := []string{"P 2024/01/02 AAPL $185.50", "N $", "bogus"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadPriceDB() = %q, want %q", got, want)
+	}
+}
+
+func TestIsWhitespaceOrComment(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"", true},
+		{"  \t", true},
+		{"; comment", true},
+		{"  ; comment", true},
+		{"# comment", true},
+		{"P 2024/01/02 AAPL $185.50", false},
+		{"bogus", false},
+	}
+	for i, test := range tests {
+		if got := IsWhitespaceOrComment(test.in); got != test.want {
+			t.Errorf("%d: IsWhitespaceOrComment(%q) = %v, want %v", i, test.in, got, test.want)
+		}
+	}
+}
+
 func mustParseTime(s string) time.Time {
 	parsed, err := time.Parse(DateTimeFormat, s)
 	if err != nil {
@@ -47,62 +84,62 @@ var (
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/01/18 19:23:00"),
 			Symbol: "GOOG",
-			Data:   &PriceData{"2362.428722", "£"},
+			Data:   &PriceData{priceutils.MustParseDecimal("2362.428722"), "£"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/01/18 19:23:00"),
 			Symbol: "£",
-			Data:   &PriceData{"6.23635", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("6.23635"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/19 12:42:40"),
 			Symbol: "BTC",
-			Data:   &PriceData{"25135.3262473", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("25135.3262473"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/19 12:42:40"),
 			Symbol: "DOGE",
-			Data:   &PriceData{"99.2384627935711", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("99.2384627935711"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/19 12:51:44"),
 			Symbol: "BTC",
-			Data:   &PriceData{"34826.23897923", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("34826.23897923"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/19 12:51:44"),
 			Symbol: "DOGE",
-			Data:   &PriceData{"0.112382582858", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("0.112382582858"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/19 18:30:01"),
 			Symbol: "BTC",
-			Data:   &PriceData{"22384.1824282", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("22384.1824282"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/19 18:30:01"),
 			Symbol: "DOGE",
-			Data:   &PriceData{"0.0000000342354", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("0.0000000342354"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/26 18:30:02"),
 			Symbol: "BTC",
-			Data:   &PriceData{"22932.24982324", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("22932.24982324"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/26 18:30:02"),
 			Symbol: "DOGE",
-			Data:   &PriceData{"8.35983489234236", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("8.35983489234236"), "$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/27 22:45:00"),
 			Symbol: "GOOG",
-			Data:   &PriceData{"4382.385283", "USD$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("4382.385283"), "USD$"},
 		},
 		&priceutils.TimeSeriesItemWithSymbol{
 			Date:   mustParseTime("2021/02/27 22:45:00"),
 			Symbol: "£",
-			Data:   &PriceData{"2.38532", "$"},
+			Data:   &PriceData{priceutils.MustParseDecimal("2.38532"), "$"},
 		},
 	}
 )
@@ -0,0 +1,205 @@
+package pricedb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+const DateFormat = "2006/01/02"
+
+// Grouping is how a Writer orders prices, and where it puts blank lines
+// between them.
+type Grouping int
+
+const (
+	// GroupByDate sorts prices by date (then symbol), with a blank line
+	// between dates.
+	GroupByDate Grouping = iota
+	// GroupBySymbol sorts prices by symbol (then date), with a blank line
+	// between symbols.
+	GroupBySymbol
+	// NoGrouping sorts prices by date (then symbol), without blank lines.
+	NoGrouping
+)
+
+// Quoting is when a Writer puts commodities in double quotes.
+type Quoting int
+
+const (
+	// QuoteAsNeeded quotes commodities that ledger can't read unquoted, like
+	// `"XBAL.TO"`.
+	QuoteAsNeeded Quoting = iota
+	// QuoteAlways quotes every commodity.
+	QuoteAlways
+	// QuoteNever writes commodities as they are.
+	QuoteNever
+)
+
+// Price is a single price to be written, like
+// `P 2024/01/02 22:45:00 AAPL $185.50`: Symbol is priced at Amount of
+// Commodity.
+type Price struct {
+	Date      time.Time
+	Symbol    string
+	Commodity string
+	Amount    priceutils.Decimal
+	// Suffix writes Commodity after Amount, like `185.50 USD`. Spaced puts a
+	// space between them, even if the Writer isn't Spaced.
+	Suffix bool
+	Spaced bool
+	// Leading are lines (like comments) to write just before the price, as
+	// they are.
+	Leading []string
+}
+
+// Writer writes `P` directives. The zero value writes timestamped prices
+// grouped by date, with a single space after each symbol, quoting as needed,
+// and amounts exactly as they are.
+type Writer struct {
+	// DateOnly writes dates without times.
+	DateOnly bool
+	// Align pads symbols so that all of the amounts line up, two spaces after
+	// the longest symbol.
+	Align    bool
+	Grouping Grouping
+	Quoting  Quoting
+	// Spaced puts a space between commodities made of letters (like `USD`)
+	// and their amounts. Symbols (like `$`) are written right next to their
+	// amounts, unless the Price is Spaced.
+	Spaced bool
+	// Precision is the number of digits after the decimal point to write
+	// amounts with, by symbol. Amounts for symbols that aren't in it are
+	// written as they are.
+	Precision map[string]int
+	Rounding  priceutils.RoundingMode
+}
+
+// NewDBWriter returns the Writer that pricedbfetcher writes price.db files
+// with, which the other tools that write them use too: aligned, grouped by
+// date, with the amounts of the symbols in precision rounded to that many
+// digits after the decimal point.
+func NewDBWriter(precision map[string]int) *Writer {
+	return &Writer{Align: true, Precision: precision}
+}
+
+// Write writes prices to out, sorted as described by w.Grouping. prices
+// itself isn't modified.
+func (w *Writer) Write(out io.Writer, prices []*Price) error {
+	sorted := make([]*Price, len(prices))
+	copy(sorted, prices)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if w.Grouping == GroupBySymbol && a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.Symbol < b.Symbol
+	})
+
+	width := 0
+	if w.Align {
+		for _, p := range sorted {
+			width = max(width, utf8.RuneCountInString(w.quote(p.Symbol)))
+		}
+	}
+
+	lastGroup := ""
+	for i, p := range sorted {
+		date := w.date(p.Date)
+		group := date
+		if w.Grouping == GroupBySymbol {
+			group = p.Symbol
+		}
+		if i > 0 && group != lastGroup && w.Grouping != NoGrouping {
+			if _, err := fmt.Fprintln(out); err != nil {
+				return errors.Wrap(err, "fmt.Fprintln()")
+			}
+		}
+		lastGroup = group
+
+		for _, l := range p.Leading {
+			if _, err := fmt.Fprintln(out, l); err != nil {
+				return errors.Wrap(err, "fmt.Fprintln()")
+			}
+		}
+		symbol := w.quote(p.Symbol)
+		pad := " "
+		if w.Align {
+			pad = strings.Repeat(" ", width+2-utf8.RuneCountInString(symbol))
+		}
+		if _, err := fmt.Fprintf(out, "P %s %s%s%s\n", date, symbol, pad, w.amount(p)); err != nil {
+			return errors.Wrapf(err, "fmt.Fprintf(%s %s)", date, p.Symbol)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) date(t time.Time) string {
+	if w.DateOnly {
+		return t.Format(DateFormat)
+	}
+	return t.Format(DateTimeFormat)
+}
+
+func (w *Writer) amount(p *Price) string {
+	n := p.Amount.String()
+	if precision, ok := w.Precision[p.Symbol]; ok {
+		n = p.Amount.Format(precision, w.Rounding)
+	}
+	commodity := w.quote(p.Commodity)
+	sep := ""
+	if p.Spaced || (w.Spaced && strings.IndexFunc(commodity, unicode.IsLetter) >= 0) {
+		sep = " "
+	}
+	if p.Suffix && commodity != "" {
+		return n + sep + commodity
+	}
+	return commodity + sep + n
+}
+
+// AmountString returns p's amount and commodity, like `$185.50` or
+// `185.50 USD`, the way the zero Writer writes them.
+func (p *Price) AmountString() string {
+	return (&Writer{}).amount(p)
+}
+
+func (w *Writer) quote(commodity string) string {
+	if commodity == "" || w.Quoting == QuoteNever || strings.HasPrefix(commodity, `"`) {
+		return commodity
+	}
+	if w.Quoting == QuoteAlways {
+		return `"` + commodity + `"`
+	}
+	return journal.QuoteCommodity(commodity)
+}
+
+// AtCloseTime returns date's day at closeTime, which is in `15:04:05` format.
+func AtCloseTime(date time.Time, closeTime string) (time.Time, error) {
+	ct, err := time.Parse("15:04:05", closeTime)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "time.Parse(%s)", closeTime)
+	}
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, date.Location()).Add(timeOfDay(ct)), nil
+}
+
+// Price returns e as a Price, or nil if it isn't a PriceEntry.
+func (e *Entry) Price() *Price {
+	if e.Kind != PriceEntry {
+		return nil
+	}
+	a := e.Amount
+	return &Price{Date: e.Date, Symbol: e.Symbol, Commodity: a.Commodity, Amount: a.Quantity, Suffix: !a.Prefix, Spaced: a.Spaced}
+}
@@ -0,0 +1,145 @@
+package pricedb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+func TestWriter(t *testing.T) {
+	dec := priceutils.MustParseDecimal
+	prices := []*Price{
+		{Date: mustParseTime("2024/01/02 22:45:00"), Symbol: "GOOG", Commodity: "$", Amount: dec("140.935")},
+		{Date: mustParseTime("2024/01/01 22:45:00"), Symbol: "XBAL.TO", Commodity: "$", Amount: dec("27.5")},
+		{Date: mustParseTime("2024/01/01 22:45:00"), Symbol: "GBP", Commodity: "CAD", Amount: dec("1.6875")},
+		{Date: mustParseTime("2024/01/02 22:45:00"), Symbol: "GBP", Commodity: "CAD", Amount: dec("1.69")},
+	}
+	tests := []struct {
+		w    Writer
+		want string
+	}{
+		{
+			Writer{},
+			"P 2024/01/01 22:45:00 GBP CAD1.6875\n" +
+				"P 2024/01/01 22:45:00 \"XBAL.TO\" $27.5\n\n" +
+				"P 2024/01/02 22:45:00 GBP CAD1.69\n" +
+				"P 2024/01/02 22:45:00 GOOG $140.935\n",
+		},
+		{
+			Writer{DateOnly: true, Align: true, Spaced: true},
+			"P 2024/01/01 GBP        CAD 1.6875\n" +
+				"P 2024/01/01 \"XBAL.TO\"  $27.5\n\n" +
+				"P 2024/01/02 GBP        CAD 1.69\n" +
+				"P 2024/01/02 GOOG       $140.935\n",
+		},
+		{
+			Writer{DateOnly: true, Grouping: GroupBySymbol, Quoting: QuoteAlways},
+			"P 2024/01/01 \"GBP\" \"CAD\"1.6875\n" +
+				"P 2024/01/02 \"GBP\" \"CAD\"1.69\n\n" +
+				"P 2024/01/02 \"GOOG\" \"$\"140.935\n\n" +
+				"P 2024/01/01 \"XBAL.TO\" \"$\"27.5\n",
+		},
+		{
+			Writer{DateOnly: true, Grouping: NoGrouping, Quoting: QuoteNever, Precision: map[string]int{"GBP": 2, "XBAL.TO": 2}},
+			"P 2024/01/01 GBP CAD1.69\n" +
+				"P 2024/01/01 XBAL.TO $27.50\n" +
+				"P 2024/01/02 GBP CAD1.69\n" +
+				"P 2024/01/02 GOOG $140.935\n",
+		},
+		{
+			Writer{DateOnly: true, Grouping: NoGrouping, Precision: map[string]int{"GBP": 2}, Rounding: priceutils.Down},
+			"P 2024/01/01 GBP CAD1.68\n" +
+				"P 2024/01/01 \"XBAL.TO\" $27.5\n" +
+				"P 2024/01/02 GBP CAD1.69\n" +
+				"P 2024/01/02 GOOG $140.935\n",
+		},
+	}
+	for i, test := range tests {
+		var b strings.Builder
+		if err := test.w.Write(&b, prices); err != nil {
+			t.Errorf("%d: Write() = err(%v)", i, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%d: Write() = %q, want %q", i, got, test.want)
+		}
+	}
+	if prices[0].Symbol != "GOOG" {
+		t.Errorf("Write() reordered its input")
+	}
+}
+
+func TestWriterSuffix(t *testing.T) {
+	dec := priceutils.MustParseDecimal
+	prices := []*Price{
+		{Date: mustParseTime("2024/01/01 22:45:00"), Symbol: "FOO", Commodity: "EUR", Amount: dec("100"), Suffix: true, Spaced: true},
+		{Date: mustParseTime("2024/01/01 22:45:00"), Symbol: "BAR", Commodity: "EUR", Amount: dec("2.5"), Suffix: true},
+		{Date: mustParseTime("2024/01/01 22:45:00"), Symbol: "BAZ", Commodity: "$", Amount: dec("3"), Spaced: true},
+	}
+	tests := []struct {
+		w    Writer
+		want string
+	}{
+		{
+			Writer{DateOnly: true},
+			"P 2024/01/01 BAR 2.5EUR\n" +
+				"P 2024/01/01 BAZ $ 3\n" +
+				"P 2024/01/01 FOO 100 EUR\n",
+		},
+		{
+			Writer{DateOnly: true, Spaced: true, Quoting: QuoteAlways, Precision: map[string]int{"FOO": 2}},
+			"P 2024/01/01 \"BAR\" 2.5 \"EUR\"\n" +
+				"P 2024/01/01 \"BAZ\" \"$\" 3\n" +
+				"P 2024/01/01 \"FOO\" 100.00 \"EUR\"\n",
+		},
+	}
+	for i, test := range tests {
+		var b strings.Builder
+		if err := test.w.Write(&b, prices); err != nil {
+			t.Errorf("%d: Write() = err(%v)", i, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%d: Write() = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	in := "P 2024/01/01 22:45:00 \"XBAL.TO\"  $27.50\n" +
+		"P 2024/01/01 22:45:00 EUR        1.4575 CAD\n" +
+		"P 2024/01/01 22:45:00 GBP        CAD1.6875\n\n" +
+		"P 2024/01/02 09:30:00 EUR        1.46CAD\n" +
+		"P 2024/01/02 09:30:00 GBP        CAD 1.69\n"
+	db, err := Parse(in, Strict)
+	if err != nil {
+		t.Fatalf("Parse() = err(%v)", err)
+	}
+	var prices []*Price
+	for _, e := range db.Prices() {
+		prices = append(prices, e.Price())
+	}
+	var b strings.Builder
+	w := &Writer{Align: true}
+	if err := w.Write(&b, prices); err != nil {
+		t.Fatalf("Write() = err(%v)", err)
+	}
+	if got := b.String(); got != in {
+		t.Errorf("Write() = %q, want %q", got, in)
+	}
+}
+
+func TestAtCloseTime(t *testing.T) {
+	got, err := AtCloseTime(time.Date(2024, 1, 2, 13, 14, 15, 0, time.UTC), DefaultCloseTime)
+	if err != nil {
+		t.Fatalf("AtCloseTime() = err(%v)", err)
+	}
+	if want := mustParseTime("2024/01/02 22:45:00"); !got.Equal(want) {
+		t.Errorf("AtCloseTime() = %v, want %v", got, want)
+	}
+	if _, err := AtCloseTime(got, "25:00"); err == nil {
+		t.Errorf("AtCloseTime(25:00) = nil error, want an error")
+	}
+}
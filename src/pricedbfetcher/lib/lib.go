@@ -3,19 +3,21 @@ package lib
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/pkg/errors"
 
 	"github.com/glennhartmann/ledger-tools/src/alphavantage"
 	"github.com/glennhartmann/ledger-tools/src/coinbase"
 	"github.com/glennhartmann/ledger-tools/src/common"
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journal"
 	"github.com/glennhartmann/ledger-tools/src/pricedb"
 	"github.com/glennhartmann/ledger-tools/src/priceutils"
 	"github.com/glennhartmann/ledger-tools/src/questrade"
@@ -28,12 +30,15 @@ type Conn struct {
 	ConfigFile                  string
 	AlphavantageAPIKeyFile      string
 	PriceDBFile                 string
+	ParseMode                   pricedb.ParseMode
 	OutFile                     string
+	OutFileBackups              int
 	CloseTime                   string
 	AlphavantageBackoffDuration time.Duration
 	AlphavantageBackoffRetry    int
 	QuestradeOAuthURLFmt        string
 	QuestradeTokenFile          string
+	QuestradeTokenFileBackups   int
 	QuestradeAccountNumbersFile string
 	Now                         time.Time
 	CoinbaseBaseURL             string
@@ -47,6 +52,7 @@ func (c *Conn) Fetch() error {
 		CloseTime:                   c.CloseTime,
 		QuestradeOAuthURLFmt:        c.QuestradeOAuthURLFmt,
 		QuestradeTokenFile:          c.QuestradeTokenFile,
+		QuestradeTokenFileBackups:   c.QuestradeTokenFileBackups,
 		Now:                         c.Now,
 		CoinbaseBaseURL:             c.CoinbaseBaseURL,
 	}
@@ -72,20 +78,19 @@ func (c *Conn) Fetch() error {
 	}
 	rc.AlphavantageAPIKey = strings.TrimSpace(string(alphavantageAPIKeyBytes))
 
-	priceDBData, err := pricedb.ReadPriceDB(c.PriceDBFile)
+	priceDB, err := pricedb.ReadFile(c.PriceDBFile, c.ParseMode)
 	if err != nil {
-		return errors.Wrapf(err, "pricedb.ReadPriceDB(%s)", c.PriceDBFile)
+		return errors.Wrapf(err, "pricedb.ReadFile(%s)", c.PriceDBFile)
 	}
-	rc.PriceDBData = priceDBData
+	if err := priceDB.WriteSkipped(os.Stderr); err != nil {
+		return errors.Wrap(err, "priceDB.WriteSkipped()")
+	}
+	rc.PriceDB = priceDB
 
-	outFileOpen := func() (*os.File, error) { return os.Stdout, nil }
-	outFileClose := func(f *os.File) {}
+	rc.OutFileOpen = func() (io.WriteCloser, error) { return nopCloser{os.Stdout}, nil }
 	if c.OutFile != "" {
-		outFileOpen = func() (*os.File, error) { return os.OpenFile(c.OutFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640) }
-		outFileClose = func(f *os.File) { f.Close() }
+		rc.OutFileOpen = func() (io.WriteCloser, error) { return fs.CreateAtomic(c.OutFile, 0640, c.OutFileBackups) }
 	}
-	rc.OutFileOpen = outFileOpen
-	rc.OutFileClose = outFileClose
 
 	rc.QuestradeAccountNumbers, err = readQuestradeAccountNumbers(c.QuestradeAccountNumbersFile)
 	if err != nil {
@@ -106,6 +111,9 @@ type Config struct {
 type CommodityConfig struct {
 	Currency string `json:"currency"`
 	Display  string `json:"display"`
+	// Precision is the number of digits after the decimal point to write
+	// prices with. If unset, they're written as the source returned them.
+	Precision *int `json:"precision"`
 }
 
 type ResolvedConn struct {
@@ -116,14 +124,16 @@ type ResolvedConn struct {
 	AlphavantageBackoffDuration time.Duration
 	AlphavantageBackoffRetry    int
 	CloseTime                   string
-	PriceDBData                 []string
-	OutFileOpen                 func() (*os.File, error)
-	OutFileClose                func(f *os.File)
-	QuestradeOAuthURLFmt        string
-	QuestradeTokenFile          string
-	QuestradeAccountNumbers     []string
-	Now                         time.Time
-	CoinbaseBaseURL             string
+	PriceDB                     *pricedb.DB
+	// OutFileOpen returns where to write the output. Nothing is committed
+	// until the returned io.WriteCloser is closed.
+	OutFileOpen               func() (io.WriteCloser, error)
+	QuestradeOAuthURLFmt      string
+	QuestradeTokenFile        string
+	QuestradeTokenFileBackups int
+	QuestradeAccountNumbers   []string
+	Now                       time.Time
+	CoinbaseBaseURL           string
 }
 
 func (c *ResolvedConn) Fetch() error {
@@ -147,6 +157,7 @@ func (c *ResolvedConn) Fetch() error {
 		Conf:           c.Conf.QuestradeConfig,
 		OAuthURLFmt:    c.QuestradeOAuthURLFmt,
 		TokenFile:      c.QuestradeTokenFile,
+		TokenBackups:   c.QuestradeTokenFileBackups,
 		AccountNumbers: c.QuestradeAccountNumbers,
 		CloseTime:      c.CloseTime,
 		Now:            c.Now,
@@ -169,61 +180,95 @@ func (c *ResolvedConn) Fetch() error {
 
 	sr = append(append(sr, sr2...), sr3...)
 
-	sr4, err := pricedb.GetDedupedSortedTimeSeriesItemWithSymbol(c.PriceDBData, c.CloseTime, makeReverseSymbolMap(c.Conf.Commodity), sr)
+	existing, err := c.PriceDB.DedupedPrices(c.CloseTime, makeReverseSymbolMap(c.Conf.Commodity), sr)
 	if err != nil {
-		return errors.Wrap(err, "pricedb.GetDedupedSortedTimeSeriesItemWithSymbol()")
+		return errors.Wrap(err, "c.PriceDB.DedupedPrices()")
 	}
 
-	sr = append(sr, sr4...)
-	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{sr})
+	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{TSIWS: sr})
 
 	sr = c.filterOutPreStartDate(sr)
-	if err := c.outputAsLedger(sr); err != nil {
+	if err := c.outputAsLedger(sr, existing); err != nil {
 		return errors.Wrap(err, "c.outputAsLedger()")
 	}
 	return nil
 }
 
-func (c *ResolvedConn) outputAsLedger(sr []*priceutils.TimeSeriesItemWithSymbol) error {
-	f, err := c.OutFileOpen()
-	if err != nil {
-		return errors.Wrap(err, "c.OutFileOpen()")
-	}
-	defer c.OutFileClose(f)
-
-	maxCommodityLength := c.getMaxCommodityLength(sr)
-
-	blankDate := time.Time{}
-	lastDate := blankDate
+// outputAsLedger writes the fetched prices in sr along with the existing
+// ones, which keep their own commodities and formatting. The other lines of
+// the existing price.db (comments, D, N and C directives, and lines that
+// couldn't be parsed) are kept before the price they came before.
+func (c *ResolvedConn) outputAsLedger(sr []*priceutils.TimeSeriesItemWithSymbol, existing []*pricedb.Entry) error {
+	prices := make([]*pricedb.Price, 0, len(sr)+len(existing))
+	precision := make(map[string]int)
 	for _, item := range sr {
-		if item.Date != lastDate && lastDate != blankDate {
-			fmt.Fprintf(f, "\n")
-		}
 		currency, display := c.getCurrencyAndDisplay(item)
 		// TODO: do I need to convert time zone? likely not...
-		fmt.Fprintf(f, "P %s %s%s%s%s\n", item.Date.Format(pricedb.DateTimeFormat), display, spaces(utf8.RuneCountInString(display), maxCommodityLength), currency, item.Data.GetLastPrice())
-		lastDate = item.Date
+		prices = append(prices, &pricedb.Price{Date: item.Date, Symbol: display, Commodity: currency, Amount: item.Data.GetLastPrice()})
+		if config, ok := c.Conf.Commodity[item.Symbol]; ok && config.Precision != nil {
+			precision[display] = *config.Precision
+		}
 	}
-	return nil
-}
 
-func (c *ResolvedConn) getMaxCommodityLength(sr []*priceutils.TimeSeriesItemWithSymbol) int {
-	if len(sr) == 0 {
-		return 0
+	reverseSymbolMap := makeReverseSymbolMap(c.Conf.Commodity)
+	var kept []*pricedb.Entry
+	var keptPrices []*pricedb.Price
+	for _, e := range existing {
+		p := e.Price()
+		var err error
+		if p.Date, err = e.DateAt(c.CloseTime); err != nil {
+			return errors.Wrap(err, "e.DateAt()")
+		}
+		if p.Date.Before(c.StartDate) {
+			continue
+		}
+		// sort and round it like the fetched prices, which are unquoted
+		p.Symbol = journal.UnquoteCommodity(p.Symbol)
+		kept = append(kept, e)
+		keptPrices = append(keptPrices, p)
+
+		symbol := p.Symbol
+		if s, ok := reverseSymbolMap[symbol]; ok {
+			symbol = s
+		}
+		if config, ok := c.Conf.Commodity[symbol]; ok && config.Precision != nil {
+			precision[p.Symbol] = *config.Precision
+		}
 	}
-	max := c.getCommodityLength(sr[0])
-	for _, item := range sr {
-		l := c.getCommodityLength(item)
-		if l > max {
-			max = l
+	leading, trailing := c.PriceDB.Context(kept)
+	for i, e := range kept {
+		keptPrices[i].Leading = leading[e]
+	}
+	prices = append(prices, keptPrices...)
+
+	f, err := c.OutFileOpen()
+	if err != nil {
+		return errors.Wrap(err, "c.OutFileOpen()")
+	}
+	w := pricedb.NewDBWriter(precision)
+	err = w.Write(f, prices)
+	for _, l := range trailing {
+		if err != nil {
+			break
 		}
+		_, err = fmt.Fprintln(f, l)
+	}
+	if err != nil {
+		// closing an atomic file after a failed write discards it
+		f.Close()
+		return errors.Wrap(err, "w.Write()")
 	}
-	return max
+	// for an atomic file, this is what actually replaces the old one (unless
+	// any of the writes above failed)
+	return errors.Wrap(f.Close(), "f.Close()")
+}
+
+type nopCloser struct {
+	io.Writer
 }
 
-func (c *ResolvedConn) getCommodityLength(item *priceutils.TimeSeriesItemWithSymbol) int {
-	_, display := c.getCurrencyAndDisplay(item)
-	return utf8.RuneCountInString(display)
+func (nopCloser) Close() error {
+	return nil
 }
 
 func (c *ResolvedConn) getCurrencyAndDisplay(item *priceutils.TimeSeriesItemWithSymbol) (currency, display string) {
@@ -234,7 +279,7 @@ func (c *ResolvedConn) getCurrencyAndDisplay(item *priceutils.TimeSeriesItemWith
 			currency = config.Currency
 		}
 		if config.Display != "" {
-			display = config.Display
+			display = journal.UnquoteCommodity(config.Display)
 		}
 	}
 	return currency, display
@@ -254,17 +299,11 @@ func (c *ResolvedConn) filterOutPreStartDate(sr []*priceutils.TimeSeriesItemWith
 	return sr[firstValid:]
 }
 
-func spaces(commodityLength, maxCommodityLength int) string {
-	desiredLength := maxCommodityLength + 2
-	spacesNeeded := desiredLength - commodityLength
-	return strings.Repeat(" ", spacesNeeded)
-}
-
 func makeReverseSymbolMap(c map[string]*CommodityConfig) map[string]string {
 	m := make(map[string]string, len(c))
 	for k, v := range c {
 		if v.Display != "" {
-			m[v.Display] = k
+			m[journal.UnquoteCommodity(v.Display)] = k
 		}
 	}
 	return m
@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+	"github.com/glennhartmann/ledger-tools/src/priceutils"
+)
+
+type builderCloser struct {
+	strings.Builder
+}
+
+func (*builderCloser) Close() error {
+	return nil
+}
+
+func TestOutputAsLedgerRoundTrip(t *testing.T) {
+	in := `; prices
+D $1,000.00
+N FOO
+C 1.00 Kb = 1024 b
+P 2020/01/01 22:45:00 FOO 100 EUR
+P 2020/01/01 22:45:00 GOOG $1000
+; ABC is cheap
+P 2020/01/02 22:45:00 ABC CAD1.5
+# the end
+`
+	want := `; prices
+D $1,000.00
+N FOO
+C 1.00 Kb = 1024 b
+P 2020/01/01 22:45:00 FOO   100 EUR
+P 2020/01/01 22:45:00 GOOG  $1000.00
+
+; ABC is cheap
+P 2020/01/02 22:45:00 ABC   CAD1.5
+P 2020/01/02 22:45:00 GOOG  $1010.00
+# the end
+`
+	db, err := pricedb.Parse(in, pricedb.Strict)
+	if err != nil {
+		t.Fatalf("pricedb.Parse() = err(%v)", err)
+	}
+	precision := 2
+	var out builderCloser
+	c := &ResolvedConn{
+		Conf:        &Config{Commodity: map[string]*CommodityConfig{"GOOG": {Precision: &precision}}},
+		CloseTime:   pricedb.DefaultCloseTime,
+		PriceDB:     db,
+		OutFileOpen: func() (io.WriteCloser, error) { return &out, nil },
+	}
+	fetched := []*priceutils.TimeSeriesItemWithSymbol{
+		{Date: mustParseTime(t, "2020/01/02 22:45:00"), Symbol: "GOOG", Data: &pricedb.PriceData{LastPrice: priceutils.MustParseDecimal("1010")}},
+	}
+	existing, err := db.DedupedPrices(c.CloseTime, nil, fetched)
+	if err != nil {
+		t.Fatalf("db.DedupedPrices() = err(%v)", err)
+	}
+	if err := c.outputAsLedger(fetched, existing); err != nil {
+		t.Fatalf("outputAsLedger() = err(%v)", err)
+	}
+	if got := out.String(); got != want {
+		t.Errorf("outputAsLedger() = %q, want %q", got, want)
+	}
+}
+
+func TestOutputAsLedgerLenient(t *testing.T) {
+	in := "P 2020/01/01 22:45:00 FOO $1\nbogus line\nP 2020/01/02 22:45:00 FOO $2\nP 2020/01/03 oops\n"
+	want := "P 2020/01/01 22:45:00 FOO  $1\n\nbogus line\nP 2020/01/02 22:45:00 FOO  $2\nP 2020/01/03 oops\n"
+	db, err := pricedb.Parse(in, pricedb.Lenient)
+	if err != nil {
+		t.Fatalf("pricedb.Parse() = err(%v)", err)
+	}
+	var out builderCloser
+	c := &ResolvedConn{
+		Conf:        &Config{},
+		CloseTime:   pricedb.DefaultCloseTime,
+		PriceDB:     db,
+		OutFileOpen: func() (io.WriteCloser, error) { return &out, nil },
+	}
+	if err := c.outputAsLedger(nil, db.Prices()); err != nil {
+		t.Fatalf("outputAsLedger() = err(%v)", err)
+	}
+	if got := out.String(); got != want {
+		t.Errorf("outputAsLedger() = %q, want %q", got, want)
+	}
+}
+
+func TestOutputAsLedgerQuotedDisplay(t *testing.T) {
+	in := "P 2020/01/01 22:45:00 \"XBAL.TO\" $27.5\nP 2020/01/02 22:45:00 \"XBAL.TO\" $27.9\n"
+	want := "P 2020/01/01 22:45:00 \"XBAL.TO\"  $27.50\n\nP 2020/01/02 22:45:00 \"XBAL.TO\"  $28.12\n"
+	for i, display := range []string{`"XBAL.TO"`, "XBAL.TO"} {
+		db, err := pricedb.Parse(in, pricedb.Strict)
+		if err != nil {
+			t.Fatalf("pricedb.Parse() = err(%v)", err)
+		}
+		precision := 2
+		var out builderCloser
+		c := &ResolvedConn{
+			Conf:        &Config{Commodity: map[string]*CommodityConfig{"XBAL": {Display: display, Precision: &precision}}},
+			CloseTime:   pricedb.DefaultCloseTime,
+			PriceDB:     db,
+			OutFileOpen: func() (io.WriteCloser, error) { return &out, nil },
+		}
+		fetched := []*priceutils.TimeSeriesItemWithSymbol{
+			{Date: mustParseTime(t, "2020/01/02 22:45:00"), Symbol: "XBAL", Data: &pricedb.PriceData{LastPrice: priceutils.MustParseDecimal("28.123")}},
+		}
+		existing, err := db.DedupedPrices(c.CloseTime, makeReverseSymbolMap(c.Conf.Commodity), fetched)
+		if err != nil {
+			t.Fatalf("db.DedupedPrices() = err(%v)", err)
+		}
+		if err := c.outputAsLedger(fetched, existing); err != nil {
+			t.Fatalf("outputAsLedger() = err(%v)", err)
+		}
+		if got := out.String(); got != want {
+			t.Errorf("%d: outputAsLedger() = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	d, err := time.Parse(pricedb.DateTimeFormat, s)
+	if err != nil {
+		t.Fatalf("time.Parse(%s) = err(%v)", s, err)
+	}
+	return d
+}
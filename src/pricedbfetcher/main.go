@@ -14,6 +14,7 @@ import (
 	"github.com/glennhartmann/ledger-tools/src/pricedbfetcher/lib"
 
 	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
 )
 
 var (
@@ -22,29 +23,38 @@ var (
 	alphavantageAPIKeyFile      = flag.StringP("alphavantage-api-key-file", "a", alphavantage.DefaultAPIKeyFile, "Alpha Vantage API Key file location.")
 	priceDBFile                 = flag.StringP("price-db-file", "p", pricedb.DefaultFile, "price.db file location.")
 	outFile                     = flag.StringP("out-path", "o", pricedb.DefaultFile, "Where to write output. Empty means stdout. It's safe to make this the same as -price-db-file.")
+	backups                     = flag.Int("backups", 0, "Number of backup copies of -out-path to keep when it's overwritten.")
 	closeTime                   = flag.StringP("close-time", "e", pricedb.DefaultCloseTime, "The time to use for close prices.")
 	alphavantageBackoffDuration = flag.DurationP("alphavantage-backoff-duration", "b", alphavantage.DefaultBackoffDuration, "How long to back off for after hitting the rate limit. Must be parseable by https://golang.org/pkg/time/#ParseDuration.")
 	alphavantageBackoffRetry    = flag.IntP("alphavantage-backoff-retry", "r", alphavantage.DefaultBackoffRetry, "Number of times to retry after hitting rate limit before giving up.")
 	questradeOAuthURLFmt        = flag.String("questrade-oauth-url-fmt", questrade.DefaultOAuthURLFmt, "Format-string for questrade OAuth URL.")
 	questradeTokenFile          = flag.StringP("questrade-token-file", "t", questrade.DefaultTokenFile, "File to find questrade OAuth token.")
+	questradeTokenBackups       = flag.Int("questrade-token-backups", 0, "Number of backup copies of -questrade-token-file to keep when it's overwritten.")
 	questradeAccountNumbersFile = flag.StringP("questrade-account-numbers-file", "q", questrade.DefaultAccountNumbersFile, "File to find questrade account numbers.")
 	now                         = flag.StringP("now", "n", "", fmt.Sprintf("Override 'time.Now()' value if not blank. Must be RFC3339 ('%s') format.", time.RFC3339))
 	coinbaseBaseURL             = flag.String("coinbase-base-url", coinbase.DefaultBaseURL, "Coinbase base API URL.")
+
+	parseMode pricedb.ParseMode
 )
 
 func main() {
+	flag.Var(enumflag.New(&parseMode, "parseMode", pricedb.ParseModeIDs, enumflag.EnumCaseInsensitive), "parse-mode", fmt.Sprintf("What to do with -price-db-file lines that can't be parsed. %q (the default) fails; %q lists them on stderr, and writes them to the output as they are.", pricedb.ParseModeIDs[pricedb.Strict][0], pricedb.ParseModeIDs[pricedb.Lenient][0]))
+
 	flag.Parse()
 	c := &lib.Conn{
 		AlphavantageBaseURL:         *alphavantageBaseURL,
 		ConfigFile:                  *configFile,
 		AlphavantageAPIKeyFile:      *alphavantageAPIKeyFile,
 		PriceDBFile:                 *priceDBFile,
+		ParseMode:                   parseMode,
 		OutFile:                     *outFile,
+		OutFileBackups:              *backups,
 		CloseTime:                   *closeTime,
 		AlphavantageBackoffDuration: *alphavantageBackoffDuration,
 		AlphavantageBackoffRetry:    *alphavantageBackoffRetry,
 		QuestradeOAuthURLFmt:        *questradeOAuthURLFmt,
 		QuestradeTokenFile:          *questradeTokenFile,
+		QuestradeTokenFileBackups:   *questradeTokenBackups,
 		QuestradeAccountNumbersFile: *questradeAccountNumbersFile,
 		Now:                         setupNow(strings.TrimSpace(*now)),
 		CoinbaseBaseURL:             *coinbaseBaseURL,
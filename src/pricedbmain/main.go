@@ -33,21 +33,27 @@ var (
 	closeTime   = flag.StringP("close-time", "c", pricedb.DefaultCloseTime, "Close time in '15:04:05' format.")
 
 	outputTypeFlag outputType
+	parseMode      pricedb.ParseMode
 )
 
 func main() {
 	flag.VarP(enumflag.New(&outputTypeFlag, "outputType", outputTypeIDs, enumflag.EnumCaseInsensitive), "output-type", "o", fmt.Sprintf("Format of output. Valid values are %q (aliases %q), %q (aliases %q), or %q (aliases %q)", outputTypeIDs[json][0], outputTypeIDs[json][1:], outputTypeIDs[protoText][0], outputTypeIDs[protoText][1:], outputTypeIDs[protoWire][0], outputTypeIDs[protoWire][1:]))
+	flag.Var(enumflag.New(&parseMode, "parseMode", pricedb.ParseModeIDs, enumflag.EnumCaseInsensitive), "parse-mode", fmt.Sprintf("What to do with price.db lines that can't be parsed. %q (the default) fails; %q skips them, listing them on stderr.", pricedb.ParseModeIDs[pricedb.Strict][0], pricedb.ParseModeIDs[pricedb.Lenient][0]))
 
 	flag.Parse()
 
-	lines, err := pricedb.ReadPriceDB(*pricedbPath)
+	db, err := pricedb.ReadFile(*pricedbPath, parseMode)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "pricedb.ReadPriceDB(): %+v\n", err)
+		fmt.Fprintf(os.Stderr, "pricedb.ReadFile(): %+v\n", err)
+		os.Exit(1)
+	}
+	if err := db.WriteSkipped(os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "db.WriteSkipped(): %+v\n", err)
 		os.Exit(1)
 	}
 
 	symbolMap := make(map[string]string)
-	tsiws, err := pricedb.GetSortedTimeSeriesItemWithSymbol(lines, *closeTime, symbolMap)
+	tsiws, err := db.GetSortedTimeSeriesItemWithSymbol(*closeTime, symbolMap)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "pricebd.GetSortedTimeSeriesItemWithSymbol(): %+v\n", err)
 		os.Exit(1)
@@ -0,0 +1,282 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+)
+
+// Policy is which price to keep when several files have a closing price for
+// the same symbol on the same day (or prices at the same time earlier in it).
+type Policy int
+
+const (
+	// PreferFirst keeps the price from the first file (and the first line
+	// within it).
+	PreferFirst Policy = iota
+	// PreferLast keeps the price from the last file (and the last line within
+	// it).
+	PreferLast
+	// PreferPriority keeps the price from the file that comes first in
+	// Merger.Priority, and otherwise acts like PreferFirst.
+	PreferPriority
+	// FailOnDisagreement acts like PreferFirst, unless the prices differ by
+	// more than Merger.Tolerance, which is an error.
+	FailOnDisagreement
+)
+
+var (
+	// overridable for testing
+	errWriter io.Writer = os.Stderr
+)
+
+type Merger struct {
+	Policy Policy
+	// Priority is the files to prefer prices from with PreferPriority, most
+	// trusted first. Files that aren't in it rank after the ones that are.
+	// Paths match if they name the same file, so `./a.db` matches `a.db`.
+	Priority []string
+	// Tolerance is how far apart (relative to the larger of them) prices can
+	// be with FailOnDisagreement, like 0.01 for 1%.
+	Tolerance float64
+	// CloseTime is the time of prices written without one.
+	CloseTime string
+	ParseMode pricedb.ParseMode
+	// Precision is the number of digits after the decimal point to write
+	// amounts with, by symbol, like pricedbfetcher's `precision` commodity
+	// setting. Amounts for symbols that aren't in it are written as they are.
+	Precision map[string]int
+}
+
+// Merged is the result of a Merge.
+type Merged struct {
+	// Prices are sorted by date then symbol. Each keeps the lines (comments,
+	// D, N and C directives, and lines that couldn't be parsed) that came
+	// before it in its file as its Leading lines. Lines before a price that
+	// wasn't kept go with the next price from the same file that was.
+	Prices []*pricedb.Price
+	// Trailing are the lines after the last kept price of each file, in the
+	// order the files were given.
+	Trailing  []string
+	Conflicts []*Conflict
+}
+
+// Source is a price, and where it came from.
+type Source struct {
+	Path  string
+	Line  int
+	Price *pricedb.Price
+	rank  int
+	entry *pricedb.Entry
+}
+
+func (s *Source) String() string {
+	return fmt.Sprintf("%s (%s:%d)", s.Price.AmountString(), s.Path, s.Line)
+}
+
+// Conflict is a symbol with different closing prices on the same day (or
+// different prices at the same time earlier in it). Kept is the price that
+// was merged; Dropped are the ones that weren't (other than any that were the
+// same as Kept).
+type Conflict struct {
+	Kept    *Source
+	Dropped []*Source
+}
+
+func (c *Conflict) String() string {
+	dropped := make([]string, 0, len(c.Dropped))
+	for _, s := range c.Dropped {
+		dropped = append(dropped, s.String())
+	}
+	return fmt.Sprintf("%s %s: kept %s, dropped %s", c.Kept.Price.Date.Format(pricedb.DateFormat), c.Kept.Price.Symbol, c.Kept, strings.Join(dropped, ", "))
+}
+
+// Merge reads the price databases at paths, and returns all of their prices,
+// with one closing price per symbol per day (see key).
+func (m *Merger) Merge(paths []string) (*Merged, error) {
+	rank := make(map[string]int, len(m.Priority))
+	for i, p := range m.Priority {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "filepath.Abs(%s)", p)
+		}
+		if _, ok := rank[abs]; !ok {
+			rank[abs] = i
+		}
+	}
+
+	var dbs []*pricedb.DB
+	var keys []string
+	byKey := make(map[string][]*Source)
+	for _, path := range paths {
+		db, err := pricedb.ReadFile(path, m.ParseMode)
+		if err != nil {
+			return nil, errors.Wrapf(err, "pricedb.ReadFile(%s)", path)
+		}
+		if err := db.WriteSkipped(errWriter); err != nil {
+			return nil, errors.Wrap(err, "db.WriteSkipped()")
+		}
+		dbs = append(dbs, db)
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "filepath.Abs(%s)", path)
+		}
+		r, ok := rank[abs]
+		if !ok {
+			r = len(m.Priority)
+		}
+		for _, e := range db.Prices() {
+			p := e.Price()
+			if p.Date, err = e.DateAt(m.CloseTime); err != nil {
+				return nil, errors.Wrap(err, "e.DateAt()")
+			}
+			// so that `"AAPL"` and `AAPL` are the same symbol; they're
+			// quoted again as needed when they're written
+			p.Symbol = journal.UnquoteCommodity(p.Symbol)
+			key, err := m.key(p)
+			if err != nil {
+				return nil, errors.Wrap(err, "m.key()")
+			}
+			if _, ok := byKey[key]; !ok {
+				keys = append(keys, key)
+			}
+			byKey[key] = append(byKey[key], &Source{Path: path, Line: e.Line, Price: p, rank: r, entry: e})
+		}
+	}
+
+	merged := &Merged{}
+	var kept []*Source
+	var disagreements []string
+	for _, key := range keys {
+		k, c := m.pick(byKey[key])
+		kept = append(kept, k)
+		if c == nil {
+			continue
+		}
+		merged.Conflicts = append(merged.Conflicts, c)
+		if m.Policy == FailOnDisagreement && m.disagree(c) {
+			disagreements = append(disagreements, c.String())
+		}
+	}
+	if len(disagreements) > 0 {
+		return nil, errors.Errorf("prices disagree by more than %v:\n    %s", m.Tolerance, strings.Join(disagreements, "\n    "))
+	}
+
+	var entries []*pricedb.Entry
+	for _, k := range kept {
+		entries = append(entries, k.entry)
+	}
+	for _, db := range dbs {
+		// Context only looks at db's own entries, so the others don't matter
+		leading, trailing := db.Context(entries)
+		for _, k := range kept {
+			if l, ok := leading[k.entry]; ok {
+				k.Price.Leading = l
+			}
+		}
+		merged.Trailing = append(merged.Trailing, trailing...)
+	}
+
+	for _, k := range kept {
+		merged.Prices = append(merged.Prices, k.Price)
+	}
+	sort.SliceStable(merged.Prices, func(i, j int) bool {
+		a, b := merged.Prices[i], merged.Prices[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		return a.Symbol < b.Symbol
+	})
+	return merged, nil
+}
+
+// key returns the key of prices that p conflicts with. Like pricedbfetcher,
+// there's one closing price per symbol per day, at or after m.CloseTime, but
+// prices from earlier in the day only conflict with prices at the same time.
+func (m *Merger) key(p *pricedb.Price) (string, error) {
+	close, err := pricedb.AtCloseTime(p.Date, m.CloseTime)
+	if err != nil {
+		return "", errors.Wrap(err, "pricedb.AtCloseTime()")
+	}
+	if p.Date.Before(close) {
+		return p.Date.Format(pricedb.DateTimeFormat) + " " + p.Symbol, nil
+	}
+	return p.Date.Format(pricedb.DateFormat) + " " + p.Symbol, nil
+}
+
+// pick returns the price to keep out of sources, which are in file then line
+// order, and the conflict, if they don't all agree.
+func (m *Merger) pick(sources []*Source) (*Source, *Conflict) {
+	kept := sources[0]
+	for _, s := range sources[1:] {
+		switch {
+		case m.Policy == PreferLast:
+			kept = s
+		case m.Policy == PreferPriority && s.rank < kept.rank:
+			kept = s
+		}
+	}
+
+	c := &Conflict{Kept: kept}
+	for _, s := range sources {
+		if s != kept && !same(s.Price, kept.Price) {
+			c.Dropped = append(c.Dropped, s)
+		}
+	}
+	if len(c.Dropped) == 0 {
+		return kept, nil
+	}
+	return kept, c
+}
+
+// disagree returns whether any of c's prices are in a different commodity, or
+// differ by more than m.Tolerance.
+func (m *Merger) disagree(c *Conflict) bool {
+	tolerance := new(big.Rat).SetFloat64(m.Tolerance)
+	if tolerance == nil {
+		tolerance = new(big.Rat)
+	}
+	a := c.Kept.Price.Amount.Rat()
+	for _, s := range c.Dropped {
+		if s.Price.Commodity != c.Kept.Price.Commodity {
+			return true
+		}
+		b := s.Price.Amount.Rat()
+		diff := new(big.Rat).Abs(new(big.Rat).Sub(a, b))
+		largest := new(big.Rat).Abs(a)
+		if bb := new(big.Rat).Abs(b); bb.Cmp(largest) > 0 {
+			largest = bb
+		}
+		if diff.Cmp(new(big.Rat).Mul(largest, tolerance)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func same(a, b *pricedb.Price) bool {
+	return a.Commodity == b.Commodity && a.Amount.Cmp(b.Amount) == 0
+}
+
+// Format writes merged the way pricedbfetcher does, with m.Precision.
+func (m *Merger) Format(merged *Merged) (string, error) {
+	var b strings.Builder
+	w := pricedb.NewDBWriter(m.Precision)
+	if err := w.Write(&b, merged.Prices); err != nil {
+		return "", errors.Wrap(err, "w.Write()")
+	}
+	for _, l := range merged.Trailing {
+		b.WriteString(l + "\n")
+	}
+	return b.String(), nil
+}
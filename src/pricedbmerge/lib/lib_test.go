@@ -0,0 +1,278 @@
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prashantv/gostub"
+
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+)
+
+const (
+	dbA = `; machine A
+P 2024/01/02 22:45:00 AAPL  $185.50
+P 2024/01/02 22:45:00 GOOG  $140.00
+
+P 2024/01/03 22:45:00 AAPL  $184.00
+`
+	dbB = `P 2024/01/02 AAPL $185.5
+P 2024/01/02 GOOG $141.00
+P 2024/01/04 "XBAL.TO" $27.50
+`
+	dbC = `P 2024/01/03 AAPL 184.10 USD
+`
+)
+
+func writeDBs(t *testing.T) (dir string, paths []string) {
+	dir = t.TempDir()
+	for name, s := range map[string]string{"a.db": dbA, "b.db": dbB, "c.db": dbC} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+	}
+	return dir, []string{filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db"), filepath.Join(dir, "c.db")}
+}
+
+func TestMerge(t *testing.T) {
+	dir, paths := writeDBs(t)
+
+	tests := []struct {
+		m             Merger
+		want          string
+		wantConflicts []string
+	}{
+		{
+			Merger{Policy: PreferFirst},
+			`; machine A
+P 2024/01/02 22:45:00 AAPL       $185.50
+P 2024/01/02 22:45:00 GOOG       $140.00
+
+P 2024/01/03 22:45:00 AAPL       $184.00
+
+P 2024/01/04 22:45:00 "XBAL.TO"  $27.50
+`,
+			[]string{
+				"2024/01/02 GOOG: kept $140.00 (DIR/a.db:3), dropped $141.00 (DIR/b.db:2)",
+				"2024/01/03 AAPL: kept $184.00 (DIR/a.db:5), dropped 184.10 USD (DIR/c.db:1)",
+			},
+		},
+		{
+			Merger{Policy: PreferLast},
+			`P 2024/01/02 22:45:00 AAPL       $185.5
+P 2024/01/02 22:45:00 GOOG       $141.00
+
+P 2024/01/03 22:45:00 AAPL       184.10 USD
+
+P 2024/01/04 22:45:00 "XBAL.TO"  $27.50
+; machine A
+`,
+			[]string{
+				"2024/01/02 GOOG: kept $141.00 (DIR/b.db:2), dropped $140.00 (DIR/a.db:3)",
+				"2024/01/03 AAPL: kept 184.10 USD (DIR/c.db:1), dropped $184.00 (DIR/a.db:5)",
+			},
+		},
+		{
+			Merger{Policy: PreferPriority, Priority: []string{paths[1]}},
+			`P 2024/01/02 22:45:00 AAPL       $185.5
+P 2024/01/02 22:45:00 GOOG       $141.00
+
+; machine A
+P 2024/01/03 22:45:00 AAPL       $184.00
+
+P 2024/01/04 22:45:00 "XBAL.TO"  $27.50
+`,
+			[]string{
+				"2024/01/02 GOOG: kept $141.00 (DIR/b.db:2), dropped $140.00 (DIR/a.db:3)",
+				"2024/01/03 AAPL: kept $184.00 (DIR/a.db:5), dropped 184.10 USD (DIR/c.db:1)",
+			},
+		},
+	}
+	for i, test := range tests {
+		test.m.CloseTime = pricedb.DefaultCloseTime
+		merged, err := test.m.Merge(paths)
+		if err != nil {
+			t.Errorf("%d: Merge() = err(%v)", i, err)
+			continue
+		}
+		got, err := test.m.Format(merged)
+		if err != nil {
+			t.Errorf("%d: Format() = err(%v)", i, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%d: Merge() = %q, want %q", i, got, test.want)
+		}
+		var gotConflicts []string
+		for _, c := range merged.Conflicts {
+			gotConflicts = append(gotConflicts, strings.ReplaceAll(c.String(), dir, "DIR"))
+		}
+		if strings.Join(gotConflicts, "\n") != strings.Join(test.wantConflicts, "\n") {
+			t.Errorf("%d: Merge() conflicts = %q, want %q", i, gotConflicts, test.wantConflicts)
+		}
+	}
+}
+
+func TestMergePriorityPaths(t *testing.T) {
+	dir, paths := writeDBs(t)
+	t.Chdir(dir)
+
+	for i, priority := range []string{"b.db", "./b.db", "../" + filepath.Base(dir) + "/b.db", paths[1]} {
+		m := &Merger{Policy: PreferPriority, Priority: []string{priority}, CloseTime: pricedb.DefaultCloseTime}
+		merged, err := m.Merge([]string{"a.db", "./b.db"})
+		if err != nil {
+			t.Errorf("%d: Merge() = err(%v)", i, err)
+			continue
+		}
+		if len(merged.Conflicts) != 1 || merged.Conflicts[0].Kept.Path != "./b.db" {
+			t.Errorf("%d: Merge() with --priority=%s conflicts = %v, want b.db's price kept", i, priority, merged.Conflicts)
+		}
+	}
+}
+
+func TestMergeContext(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db")}
+	for i, s := range []string{
+		`; from machine A
+D $1,000.00
+P 2024/01/02 AAPL $185.5012
+; dropped
+P 2024/01/03 AAPL $184
+P 2024/01/04 AAPL 183.123 EUR
+; the end
+`,
+		`N "XBAL.TO"
+P 2024/01/03 AAPL $184.50
+C 1.00 Kb = 1024 b
+P 2024/01/03 "XBAL.TO" $27.5
+`,
+	} {
+		if err := ioutil.WriteFile(paths[i], []byte(s), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+	}
+
+	m := &Merger{Policy: PreferLast, CloseTime: pricedb.DefaultCloseTime, Precision: map[string]int{"AAPL": 2}}
+	merged, err := m.Merge(paths)
+	if err != nil {
+		t.Fatalf("Merge() = err(%v)", err)
+	}
+	got, err := m.Format(merged)
+	if err != nil {
+		t.Fatalf("Format() = err(%v)", err)
+	}
+	want := `; from machine A
+D $1,000.00
+P 2024/01/02 22:45:00 AAPL       $185.50
+
+N "XBAL.TO"
+P 2024/01/03 22:45:00 AAPL       $184.50
+C 1.00 Kb = 1024 b
+P 2024/01/03 22:45:00 "XBAL.TO"  $27.5
+
+; dropped
+P 2024/01/04 22:45:00 AAPL       183.12 EUR
+; the end
+`
+	if got != want {
+		t.Errorf("Merge() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeIntraday(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.db"), filepath.Join(dir, "b.db")}
+	for i, s := range []string{
+		"P 2024/01/02 10:00 AAPL $180\nP 2024/01/02 14:00 AAPL $182\nP 2024/01/02 AAPL $185\n",
+		"P 2024/01/02 14:00:00 AAPL $182\nP 2024/01/02 23:00:00 AAPL $186\n",
+	} {
+		if err := ioutil.WriteFile(paths[i], []byte(s), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+	}
+
+	// the closing prices are about 0.5% apart, but the earlier ones aren't
+	// compared with them
+	m := &Merger{Policy: FailOnDisagreement, Tolerance: 0.01, CloseTime: pricedb.DefaultCloseTime}
+	merged, err := m.Merge(paths)
+	if err != nil {
+		t.Fatalf("Merge() = err(%v)", err)
+	}
+	got, err := m.Format(merged)
+	if err != nil {
+		t.Fatalf("Format() = err(%v)", err)
+	}
+	want := `P 2024/01/02 10:00:00 AAPL  $180
+
+P 2024/01/02 14:00:00 AAPL  $182
+
+P 2024/01/02 22:45:00 AAPL  $185
+`
+	if got != want {
+		t.Errorf("Merge() = %q, want %q", got, want)
+	}
+	if len(merged.Conflicts) != 1 || merged.Conflicts[0].Kept.Line != 3 || merged.Conflicts[0].Dropped[0].Line != 2 {
+		t.Errorf("Merge() conflicts = %v, want a.db:3 kept over b.db:2", merged.Conflicts)
+	}
+}
+
+func TestMergeFailOnDisagreement(t *testing.T) {
+	_, paths := writeDBs(t)
+
+	tests := []struct {
+		paths     []string
+		tolerance float64
+		wantErr   bool
+	}{
+		// $140.00 vs $141.00 is about 0.7% apart
+		{paths[:2], 0.01, false},
+		{paths[:2], 0.005, true},
+		// different commodities always disagree
+		{[]string{paths[0], paths[2]}, 0.5, true},
+	}
+	for i, test := range tests {
+		m := &Merger{Policy: FailOnDisagreement, Tolerance: test.tolerance, CloseTime: pricedb.DefaultCloseTime}
+		merged, err := m.Merge(test.paths)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%d: Merge() = err(%v), want error: %v", i, err, test.wantErr)
+			continue
+		}
+		if err == nil && len(merged.Prices) != 4 {
+			t.Errorf("%d: Merge() = %d prices, want 4", i, len(merged.Prices))
+		}
+	}
+}
+
+func TestMergeLenient(t *testing.T) {
+	stubs := gostub.New()
+	defer stubs.Reset()
+
+	var errOut bytes.Buffer
+	stubs.Stub(&errWriter, &errOut)
+
+	path := filepath.Join(t.TempDir(), "bad.db")
+	if err := ioutil.WriteFile(path, []byte("P 2024/01/02 AAPL $1\nbogus\n"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+
+	m := &Merger{CloseTime: pricedb.DefaultCloseTime}
+	if _, err := m.Merge([]string{path}); err == nil {
+		t.Errorf("Merge() = err(nil), want an error")
+	}
+
+	m.ParseMode = pricedb.Lenient
+	merged, err := m.Merge([]string{path})
+	if err != nil {
+		t.Fatalf("Merge() = err(%v)", err)
+	}
+	if len(merged.Prices) != 1 {
+		t.Errorf("Merge() = %d prices, want 1", len(merged.Prices))
+	}
+	if !strings.Contains(errOut.String(), "skipped 1 unparseable line(s)") {
+		t.Errorf("Merge() wrote %q to stderr, want a skipped line warning", errOut.String())
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/pricedb"
+	"github.com/glennhartmann/ledger-tools/src/pricedbmerge/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var policyIDs = map[lib.Policy][]string{
+	lib.PreferFirst:        {"prefer-first", "first"},
+	lib.PreferLast:         {"prefer-last", "last"},
+	lib.PreferPriority:     {"prefer-source-priority", "priority"},
+	lib.FailOnDisagreement: {"fail-on-disagreement", "fail"},
+}
+
+var (
+	priority  = flag.StringSlice("priority", nil, "Comma-separated input files to prefer prices from with --policy=prefer-source-priority, most trusted first. Files that aren't listed rank after the ones that are.")
+	tolerance = flag.Float64("tolerance", 0, "How far apart (relative to the larger price) conflicting prices can be with --policy=fail-on-disagreement, like 0.01 for 1%.")
+	precision = flag.StringToInt("precision", nil, "Comma-separated SYMBOL=N pairs giving the number of digits after the decimal point to write SYMBOL's prices with, like pricedbfetcher's \"precision\" setting. Other prices are written as they are.")
+	closeTime = flag.StringP("close-time", "c", pricedb.DefaultCloseTime, "The time to use for prices without one.")
+	outPath   = flag.StringP("out", "o", "", "File to write the merged price.db to. Defaults to stdout.")
+	backups   = flag.IntP("backups", "b", 0, "Number of backup copies of an existing --out file to keep (as <file>.bak, <file>.bak.1, etc).")
+
+	policy    lib.Policy
+	parseMode pricedb.ParseMode
+)
+
+func main() {
+	flag.Var(enumflag.New(&policy, "policy", policyIDs, enumflag.EnumCaseInsensitive), "policy", fmt.Sprintf("Which price to keep when files have different prices for a symbol on the same day. %q (the default) keeps the first file's; %q keeps the last file's; %q keeps the one from the file that comes first in --priority; %q keeps the first file's, but fails if they differ by more than --tolerance.", policyIDs[lib.PreferFirst][0], policyIDs[lib.PreferLast][0], policyIDs[lib.PreferPriority][0], policyIDs[lib.FailOnDisagreement][0]))
+	flag.Var(enumflag.New(&parseMode, "parseMode", pricedb.ParseModeIDs, enumflag.EnumCaseInsensitive), "parse-mode", fmt.Sprintf("What to do with price.db lines that can't be parsed. %q (the default) fails; %q skips them, listing them on stderr.", pricedb.ParseModeIDs[pricedb.Strict][0], pricedb.ParseModeIDs[pricedb.Lenient][0]))
+
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	m := &lib.Merger{
+		Policy:    policy,
+		Priority:  *priority,
+		Tolerance: *tolerance,
+		CloseTime: *closeTime,
+		ParseMode: parseMode,
+		Precision: *precision,
+	}
+	merged, err := m.Merge(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, c := range merged.Conflicts {
+		fmt.Fprintf(os.Stderr, "conflict: %s\n", c)
+	}
+
+	out, err := m.Format(merged)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	if *outPath == "" {
+		_, err = io.WriteString(os.Stdout, out)
+	} else {
+		err = fs.WriteFileAtomic(*outPath, []byte(out), 0644, *backups)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+}
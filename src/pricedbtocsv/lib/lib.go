@@ -14,16 +14,20 @@ import (
 var (
 	// overridable for testing
 	outWriter io.Writer = os.Stdout
+	errWriter io.Writer = os.Stderr
 )
 
-func ToCSV(priceFile, closeTime string) error {
-	lines, err := pricedb.ReadPriceDB(priceFile)
+func ToCSV(priceFile, closeTime string, mode pricedb.ParseMode) error {
+	db, err := pricedb.ReadFile(priceFile, mode)
 	if err != nil {
-		return errors.Wrap(err, "pricedb.ReadPriceDB()")
+		return errors.Wrap(err, "pricedb.ReadFile()")
+	}
+	if err := db.WriteSkipped(errWriter); err != nil {
+		return errors.Wrap(err, "db.WriteSkipped()")
 	}
 
 	symbolMap := make(map[string]string)
-	tsiws, err := pricedb.GetSortedTimeSeriesItemWithSymbol(lines, closeTime, symbolMap)
+	tsiws, err := db.GetSortedTimeSeriesItemWithSymbol(closeTime, symbolMap)
 	if err != nil {
 		return errors.Wrap(err, "pricebd.GetSortedTimeSeriesItemWithSymbol()")
 	}
@@ -37,7 +41,7 @@ func ToCSV(priceFile, closeTime string) error {
 		}
 		for _, ts := range tsiws {
 			lastCurrency := "UNK" // "unknown"
-			lastPrice := ts.Data.GetLastPrice()
+			lastPrice := ts.Data.GetLastPrice().String()
 			if pc, ok := ts.Data.(*pricedb.PriceData); ok {
 				lastCurrency = pc.LastCurrency
 			} else {
@@ -19,7 +19,7 @@ func TestToCSV(t *testing.T) {
 	stubs.Stub(&outWriter, &b)
 
 	stubs.StubFunc(&pricedb.GetData, []byte(priceDB), nil)
-	if err := ToCSV("", pricedb.DefaultCloseTime); err != nil {
+	if err := ToCSV("", pricedb.DefaultCloseTime, pricedb.Strict); err != nil {
 		t.Errorf("ToCSV() = err(%+v)", err)
 	}
 	got := b.String()
@@ -28,11 +28,34 @@ func TestToCSV(t *testing.T) {
 	}
 
 	stubs.StubFunc(&pricedb.GetData, nil, fmt.Errorf("error"))
-	if err := ToCSV("", pricedb.DefaultCloseTime); err == nil {
+	if err := ToCSV("", pricedb.DefaultCloseTime, pricedb.Strict); err == nil {
 		t.Error("ToCSV() = err(nil), wanted an error")
 	}
 }
 
+func TestToCSVLenient(t *testing.T) {
+	stubs := gostub.New()
+	defer stubs.Reset()
+
+	var out, errOut bytes.Buffer
+	stubs.Stub(&outWriter, &out)
+	stubs.Stub(&errWriter, &errOut)
+
+	stubs.StubFunc(&pricedb.GetData, []byte("P 2021/01/18 19:23:00 GOOG    £2362.428722\nP 2021/01/18 oops\n"), nil)
+	if err := ToCSV("price.db", pricedb.DefaultCloseTime, pricedb.Strict); err == nil {
+		t.Error("ToCSV(Strict) = err(nil), wanted an error")
+	}
+	if err := ToCSV("price.db", pricedb.DefaultCloseTime, pricedb.Lenient); err != nil {
+		t.Errorf("ToCSV(Lenient) = err(%+v)", err)
+	}
+	if want := "timestamp,symbol,currency,price\n2021/01/18 19:23:00,GOOG,£,2362.428722\n"; out.String() != want {
+		t.Errorf("ToCSV(Lenient) = %q, wanted %q", out.String(), want)
+	}
+	if want := "warning: skipped 1 unparseable line(s) in price.db:\n    price.db:2:18: missing price (line: \"P 2021/01/18 oops\")\n"; errOut.String() != want {
+		t.Errorf("ToCSV(Lenient) wrote %q to stderr, wanted %q", errOut.String(), want)
+	}
+}
+
 const priceDB = `
 P 2021/01/18 19:23:00 £       $6.23635
 P 2021/01/18 19:23:00 GOOG    £2362.428722
@@ -9,16 +9,21 @@ import (
 	"github.com/glennhartmann/ledger-tools/src/pricedbtocsv/lib"
 
 	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
 )
 
 var (
 	closeTime   = flag.StringP("close-time", "c", pricedb.DefaultCloseTime, "The time to use for close prices.")
 	priceDBFile = flag.StringP("price-db-file", "p", pricedb.DefaultFile, "price.db file location.")
+
+	parseMode pricedb.ParseMode
 )
 
 func main() {
+	flag.Var(enumflag.New(&parseMode, "parseMode", pricedb.ParseModeIDs, enumflag.EnumCaseInsensitive), "parse-mode", fmt.Sprintf("What to do with price.db lines that can't be parsed. %q (the default) fails; %q skips them, listing them on stderr.", pricedb.ParseModeIDs[pricedb.Strict][0], pricedb.ParseModeIDs[pricedb.Lenient][0]))
+
 	flag.Parse()
-	if err := lib.ToCSV(*priceDBFile, *closeTime); err != nil {
+	if err := lib.ToCSV(*priceDBFile, *closeTime, parseMode); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,292 @@
+package priceutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RoundingMode is how a Decimal is rounded to fewer digits.
+type RoundingMode int
+
+const (
+	// HalfEven rounds to the nearest value, and ties to the even one (aka
+	// banker's rounding).
+	HalfEven RoundingMode = iota
+	// HalfUp rounds to the nearest value, and ties away from zero.
+	HalfUp
+	// HalfDown rounds to the nearest value, and ties towards zero.
+	HalfDown
+	// Down rounds towards zero (ie truncates).
+	Down
+	// Up rounds away from zero.
+	Up
+	// Floor rounds towards negative infinity.
+	Floor
+	// Ceiling rounds towards positive infinity.
+	Ceiling
+)
+
+// Decimal is an exact decimal number, with a fixed number of digits after the
+// decimal point (its scale). The zero value is 0. Decimals are immutable, so
+// they can be copied and shared freely.
+type Decimal struct {
+	// the number is unscaled × 10^-scale; nil means 0
+	unscaled *big.Int
+	scale    int
+}
+
+// NewDecimal returns unscaled × 10^-scale.
+func NewDecimal(unscaled int64, scale int) Decimal {
+	if scale < 0 {
+		return Decimal{unscaled: new(big.Int).Mul(big.NewInt(unscaled), pow10(-scale))}
+	}
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// ParseDecimal parses a number like `-1234.50` or `1.5e-3`. Its scale is the
+// number of digits written after the decimal point, adjusted for any
+// exponent.
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.Atoi(s[i+1:]); err != nil || exp > 1000 || exp < -1000 {
+			return Decimal{}, errors.Errorf("invalid exponent in %q", s)
+		}
+		mantissa = s[:i]
+	}
+	neg := false
+	if mantissa != "" && (mantissa[0] == '-' || mantissa[0] == '+') {
+		neg = mantissa[0] == '-'
+		mantissa = mantissa[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Decimal{}, errors.Errorf("invalid decimal %q", s)
+	}
+
+	u, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, errors.Errorf("invalid decimal %q", s)
+	}
+	if neg {
+		u.Neg(u)
+	}
+	scale := len(fracPart) - exp
+	if scale < 0 {
+		u.Mul(u, pow10(-scale))
+		scale = 0
+	}
+	return Decimal{unscaled: u, scale: scale}, nil
+}
+
+// MustParseDecimal is like ParseDecimal, but panics if s isn't valid.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// Scale returns the number of digits d has after the decimal point.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Sign returns -1, 0 or 1, depending on the sign of d.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Cmp returns -1, 0 or 1 if d is less than, equal to or greater than o.
+// Decimals with different scales can be equal, like 1.5 and 1.50.
+func (d Decimal) Cmp(o Decimal) int {
+	a, b := align(d, o)
+	return a.Cmp(b)
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Add returns d + o, with the larger of their scales.
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b := align(d, o)
+	return Decimal{unscaled: a.Add(a, b), scale: max(d.scale, o.scale)}
+}
+
+// Sub returns d - o, with the larger of their scales.
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+// Mul returns d × o exactly, with the sum of their scales.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), o.int()), scale: d.scale + o.scale}
+}
+
+// Div returns d / o, rounded to scale digits after the decimal point.
+func (d Decimal) Div(o Decimal, scale int, mode RoundingMode) (Decimal, error) {
+	if o.IsZero() {
+		return Decimal{}, errors.New("division by zero")
+	}
+	// d / o = (d.unscaled / o.unscaled) × 10^(o.scale - d.scale), so the
+	// result's unscaled value is that × 10^scale
+	num := new(big.Int).Set(d.int())
+	den := new(big.Int).Set(o.int())
+	if shift := scale + o.scale - d.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	return Decimal{unscaled: roundQuo(num, den, mode), scale: scale}, nil
+}
+
+// Round returns d with scale digits after the decimal point, rounding if it
+// had more, and adding zeros if it had fewer. A negative scale rounds to tens,
+// hundreds, etc.
+func (d Decimal) Round(scale int, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{unscaled: new(big.Int).Mul(d.int(), pow10(scale-d.scale)), scale: scale}
+	}
+	u := roundQuo(d.int(), pow10(d.scale-scale), mode)
+	if scale < 0 {
+		return Decimal{unscaled: u.Mul(u, pow10(-scale))}
+	}
+	return Decimal{unscaled: u, scale: scale}
+}
+
+// Trim returns d without any trailing zeros after the decimal point.
+func (d Decimal) Trim() Decimal {
+	u, scale := new(big.Int).Set(d.int()), d.scale
+	ten, r := big.NewInt(10), new(big.Int)
+	for scale > 0 {
+		q, _ := new(big.Int).QuoRem(u, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		u, scale = q, scale-1
+	}
+	return Decimal{unscaled: u, scale: scale}
+}
+
+// Rat returns d as a big.Rat.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.int(), pow10(d.scale))
+}
+
+// String writes d with all of its digits, like `-1234.50`.
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	if d.scale > 0 {
+		if len(digits) <= d.scale {
+			digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.scale] + "." + digits[len(digits)-d.scale:]
+	}
+	if d.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Format writes d rounded to precision digits after the decimal point.
+func (d Decimal) Format(precision int, mode RoundingMode) string {
+	return d.Round(precision, mode).String()
+}
+
+// MarshalJSON writes d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON reads d from a JSON number or string, exactly as written.
+// null and empty strings (like APIs use for missing prices) leave d unset.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	s := string(b)
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return errors.Wrap(err, "json.Unmarshal()")
+		}
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return errors.Wrap(err, "ParseDecimal()")
+	}
+	*d = parsed
+	return nil
+}
+
+// align returns the unscaled values of a and b, scaled to the larger of their
+// scales. They're new big.Ints, so they can be modified.
+func align(a, b Decimal) (*big.Int, *big.Int) {
+	x, y := new(big.Int).Set(a.int()), new(big.Int).Set(b.int())
+	if a.scale < b.scale {
+		x.Mul(x, pow10(b.scale-a.scale))
+	} else if b.scale < a.scale {
+		y.Mul(y, pow10(a.scale-b.scale))
+	}
+	return x, y
+}
+
+// roundQuo returns num / den, rounded to an integer with mode.
+func roundQuo(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	sign := num.Sign() * den.Sign()
+	// how the remainder compares to half of den
+	half := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).CmpAbs(den)
+
+	var away bool
+	switch mode {
+	case HalfEven:
+		away = half > 0 || (half == 0 && q.Bit(0) == 1)
+	case HalfUp:
+		away = half >= 0
+	case HalfDown:
+		away = half > 0
+	case Down:
+		away = false
+	case Up:
+		away = true
+	case Floor:
+		away = sign < 0
+	case Ceiling:
+		away = sign > 0
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(sign)))
+	}
+	return q
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
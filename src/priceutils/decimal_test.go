@@ -0,0 +1,185 @@
+package priceutils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in        string
+		want      string
+		wantScale int
+	}{
+		{"0", "0", 0},
+		{"123", "123", 0},
+		{"-1234.50", "-1234.50", 2},
+		{"+.5", "0.5", 1},
+		{"7.", "7", 0},
+		{"1.5e-3", "0.0015", 4},
+		{"-2E3", "-2000", 0},
+		{"1.25e1", "12.5", 1},
+		{"0.0000000342354", "0.0000000342354", 13},
+	}
+	for i, test := range tests {
+		got, err := ParseDecimal(test.in)
+		if err != nil {
+			t.Errorf("%d: ParseDecimal(%q) = err(%v)", i, test.in, err)
+			continue
+		}
+		if got.String() != test.want || got.Scale() != test.wantScale {
+			t.Errorf("%d: ParseDecimal(%q) = %s (scale %d), want %s (scale %d)", i, test.in, got, got.Scale(), test.want, test.wantScale)
+		}
+	}
+
+	for i, in := range []string{"", "-", ".", "1.2.3", "1,000", "abc", "1e", "1e5000", "0x10"} {
+		if _, err := ParseDecimal(in); err == nil {
+			t.Errorf("%d: ParseDecimal(%q) = nil error, want an error", i, in)
+		}
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	d := MustParseDecimal
+	tests := []struct {
+		got  Decimal
+		want string
+	}{
+		{d("1.5").Add(d("2.25")), "3.75"},
+		{d("1.50").Sub(d("2")), "-0.50"},
+		{d("-1.5").Mul(d("0.2")), "-0.30"},
+		{d("0.1").Add(d("0.2")), "0.3"},
+		{d("12.3400").Trim(), "12.34"},
+		{d("100").Trim(), "100"},
+		{d("-0.5").Neg(), "0.5"},
+		{Decimal{}.Add(d("1.0")), "1.0"},
+		{NewDecimal(12345, 2), "123.45"},
+		{NewDecimal(5, -2), "500"},
+	}
+	for i, test := range tests {
+		if got := test.got.String(); got != test.want {
+			t.Errorf("%d: got %s, want %s", i, got, test.want)
+		}
+	}
+
+	if got := d("1.5").Cmp(d("1.50")); got != 0 {
+		t.Errorf("Cmp(1.5, 1.50) = %d, want 0", got)
+	}
+	if got := d("-1").Cmp(d("0.5")); got != -1 {
+		t.Errorf("Cmp(-1, 0.5) = %d, want -1", got)
+	}
+	if got := d("1").Rat().String(); got != "1/1" {
+		t.Errorf("Rat(1) = %s, want 1/1", got)
+	}
+	if got := d("-0.25").Rat().String(); got != "-1/4" {
+		t.Errorf("Rat(-0.25) = %s, want -1/4", got)
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale int
+		mode  RoundingMode
+		want  string
+	}{
+		{"2.5", 0, HalfEven, "2"},
+		{"3.5", 0, HalfEven, "4"},
+		{"-2.5", 0, HalfEven, "-2"},
+		{"2.5", 0, HalfUp, "3"},
+		{"-2.5", 0, HalfUp, "-3"},
+		{"2.5", 0, HalfDown, "2"},
+		{"2.51", 0, HalfDown, "3"},
+		{"-1.99", 1, Down, "-1.9"},
+		{"1.91", 1, Up, "2.0"},
+		{"-1.91", 1, Floor, "-2.0"},
+		{"1.91", 1, Floor, "1.9"},
+		{"-1.99", 1, Ceiling, "-1.9"},
+		{"1.01", 1, Ceiling, "1.1"},
+		{"1.5", 3, HalfEven, "1.500"},
+		{"1234.5678", -2, HalfEven, "1200"},
+	}
+	for i, test := range tests {
+		if got := MustParseDecimal(test.in).Format(test.scale, test.mode); got != test.want {
+			t.Errorf("%d: Format(%s, %d, %d) = %s, want %s", i, test.in, test.scale, test.mode, got, test.want)
+		}
+	}
+}
+
+func TestDecimalDiv(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		scale int
+		mode  RoundingMode
+		want  string
+	}{
+		{"1", "3", 4, HalfEven, "0.3333"},
+		{"2", "3", 4, HalfEven, "0.6667"},
+		{"2", "3", 4, Down, "0.6666"},
+		{"-1", "8", 2, HalfEven, "-0.12"},
+		{"-1", "8", 2, HalfUp, "-0.13"},
+		{"10.00", "0.5", 0, HalfEven, "20"},
+		{"1", "0.001", 1, HalfEven, "1000.0"},
+	}
+	for i, test := range tests {
+		got, err := MustParseDecimal(test.a).Div(MustParseDecimal(test.b), test.scale, test.mode)
+		if err != nil {
+			t.Errorf("%d: Div(%s, %s) = err(%v)", i, test.a, test.b, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("%d: Div(%s, %s) = %s, want %s", i, test.a, test.b, got, test.want)
+		}
+	}
+
+	if _, err := MustParseDecimal("1").Div(Decimal{}, 2, HalfEven); err == nil {
+		t.Errorf("Div(1, 0) = nil error, want an error")
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v struct {
+		Number Decimal  `json:"number"`
+		String Decimal  `json:"string"`
+		Null   *Decimal `json:"null"`
+		Unset  Decimal  `json:"unset"`
+		Empty  Decimal  `json:"empty"`
+	}
+	if err := json.Unmarshal([]byte(`{"number": 35.12, "string": "0.00001234", "null": null, "unset": null, "empty": " "}`), &v); err != nil {
+		t.Fatalf("json.Unmarshal() = err(%v)", err)
+	}
+	if got := v.Number.String(); got != "35.12" {
+		t.Errorf("Number = %s, want 35.12", got)
+	}
+	if got := v.String.String(); got != "0.00001234" {
+		t.Errorf("String = %s, want 0.00001234", got)
+	}
+	if v.Null != nil {
+		t.Errorf("Null = %s, want nil", v.Null)
+	}
+	if !v.Unset.IsZero() || !v.Empty.IsZero() {
+		t.Errorf("Unset, Empty = %s, %s, want 0, 0", v.Unset, v.Empty)
+	}
+
+	// null and "" don't overwrite what's already there
+	for _, in := range []string{`null`, `""`} {
+		if err := json.Unmarshal([]byte(in), &v.Number); err != nil {
+			t.Errorf("json.Unmarshal(%s) = err(%v)", in, err)
+		}
+		if got := v.Number.String(); got != "35.12" {
+			t.Errorf("json.Unmarshal(%s) changed Number to %s, want 35.12", in, got)
+		}
+	}
+
+	b, err := json.Marshal(v.Number)
+	if err != nil {
+		t.Fatalf("json.Marshal() = err(%v)", err)
+	}
+	if string(b) != "35.12" {
+		t.Errorf("json.Marshal() = %s, want 35.12", b)
+	}
+
+	if err := json.Unmarshal([]byte(`"nope"`), &v.Number); err == nil {
+		t.Errorf("json.Unmarshal(\"nope\") = nil error, want an error")
+	}
+}
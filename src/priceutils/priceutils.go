@@ -12,7 +12,7 @@ import (
 )
 
 type PriceData interface {
-	GetLastPrice() string
+	GetLastPrice() Decimal
 }
 
 type TimeSeriesItemWithSymbol struct {
@@ -26,7 +26,7 @@ func (tsiws *TimeSeriesItemWithSymbol) String() string {
 	if pdc, ok := tsiws.Data.(fmt.Stringer); ok {
 		pds = pdc.String()
 	} else {
-		pds = fmt.Sprintf("%q", tsiws.Data.GetLastPrice())
+		pds = fmt.Sprintf("%q", tsiws.Data.GetLastPrice().String())
 	}
 
 	return fmt.Sprintf("{%q, %q, %s}", tsiws.Date.String(), tsiws.Symbol, pds)
@@ -37,7 +37,7 @@ func (tsiws *TimeSeriesItemWithSymbol) ToProto() *pb.TimeSeriesItemWithSymbol {
 		TimeInUnixMicros: proto.Int64(tsiws.Date.UnixMicro()),
 		Symbol:           proto.String(tsiws.Symbol),
 		Data: pb.PriceData_builder{
-			LastPrice: proto.String(tsiws.Data.GetLastPrice()),
+			LastPrice: proto.String(tsiws.Data.GetLastPrice().String()),
 		}.Build(),
 	}.Build()
 }
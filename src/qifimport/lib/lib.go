@@ -0,0 +1,643 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// DateOrder is the order of the day and month in QIF dates. Years can be
+// first (`2024-01-05`) with either.
+type DateOrder int
+
+const (
+	MonthFirst DateOrder = iota
+	DayFirst
+)
+
+const (
+	DefaultAccount               = "Assets:Unknown"
+	DefaultCurrency              = "$"
+	DefaultExpenseAccount        = "Expenses:Unknown"
+	DefaultIncomeAccount         = "Income:Unknown"
+	DefaultCommissionAccount     = "Expenses:Commissions"
+	DefaultOpeningBalanceAccount = "Equity:Opening Balances"
+	DefaultIDTag                 = "import-id"
+)
+
+// DefaultIncomeAccounts are the accounts investment income is balanced
+// against, by QIF action (without the `X` suffix or `Reinv` prefix).
+var DefaultIncomeAccounts = map[string]string{
+	"div":     "Income:Dividends",
+	"intinc":  "Income:Interest",
+	"cglong":  "Income:Capital Gains",
+	"cgmid":   "Income:Capital Gains",
+	"cgshort": "Income:Capital Gains",
+	"miscinc": DefaultIncomeAccount,
+}
+
+// reinvestActions maps the actions for reinvested income to the actions for
+// the same income paid in cash.
+var reinvestActions = map[string]string{
+	"reinvdiv": "div",
+	"reinvint": "intinc",
+	"reinvlg":  "cglong",
+	"reinvmd":  "cgmid",
+	"reinvsh":  "cgshort",
+}
+
+type Importer struct {
+	Mapping *Mapping
+	// Account is the ledger account for transactions that aren't after an
+	// `!Account` record. Other QIF accounts are named after their type and
+	// name, like `Assets:Bank:Checking`, unless they're in the Mapping.
+	Account      string
+	DateOrder    DateOrder
+	DecimalComma bool
+	Currency     string
+	// ExpenseAccount and IncomeAccount balance transactions without a
+	// category that take money out of, or put money into, an account.
+	// Unmapped categories are put under them too.
+	ExpenseAccount string
+	IncomeAccount  string
+	// CommissionAccount gets the commissions of investment transactions.
+	CommissionAccount string
+	// OpeningBalanceAccount balances the transfers from accounts to
+	// themselves that QIF uses for opening balances.
+	OpeningBalanceAccount string
+	// IncomeAccounts maps QIF investment income actions (div, intinc, cglong,
+	// cgmid, cgshort and miscinc) to accounts.
+	IncomeAccounts map[string]string
+	// IDTag is the metadata tag for the ID made from each QIF record.
+	IDTag string
+	importer.Appender
+}
+
+// Import is what was read from a QIF file.
+type Import struct {
+	// Transactions are the imported ledger transactions, sorted.
+	Transactions string
+	// Skipped describes records that were left out because they're of
+	// unsupported types.
+	Skipped []string
+}
+
+// Convert reads a QIF file from r.
+func (im *Importer) Convert(r io.Reader) (*Import, error) {
+	records, err := readRecords(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "readRecords()")
+	}
+	c := &converter{
+		Importer:     im,
+		accountTypes: make(map[string]string),
+		categories:   make(map[string]bool),
+		securities:   make(map[string]string),
+		seen:         make(map[string]int),
+		dropped:      make(map[*importer.Transaction]bool),
+	}
+	if err := c.convert(records); err != nil {
+		return nil, errors.Wrap(err, "convert()")
+	}
+
+	var kept []*importer.Transaction
+	for _, t := range c.transactions {
+		if !c.dropped[t] {
+			kept = append(kept, t)
+		}
+	}
+	out, err := im.Sort(kept)
+	if err != nil {
+		return nil, errors.Wrap(err, "Sort()")
+	}
+	return &Import{Transactions: out, Skipped: c.skipped}, nil
+}
+
+// ConvertFile is like Convert, reading the QIF file at path.
+func (im *Importer) ConvertFile(path string) (*Import, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "os.Open(%s)", path)
+	}
+	defer f.Close()
+	imp, err := im.Convert(f)
+	return imp, errors.Wrapf(err, "Convert(%s)", path)
+}
+
+// converter holds the state of a single Convert.
+type converter struct {
+	*Importer
+	// accountTypes maps QIF account names to their lower-cased types.
+	accountTypes map[string]string
+	// categories maps top-level categories from the category list to whether
+	// they're income categories.
+	categories map[string]bool
+	// securities maps security names to symbols, from the security list.
+	securities map[string]string
+	// transfers are the transfers between QIF accounts, so that the copy of
+	// each one in the other account can be dropped.
+	transfers []*transfer
+	// dropped are the transactions that are the other account's copy of a
+	// transfer.
+	dropped map[*importer.Transaction]bool
+	// seen counts identical records in each account, so that they get
+	// different IDs.
+	seen map[string]int
+
+	// name and account are the QIF and ledger names of the current account.
+	name    string
+	account string
+
+	transactions []*importer.Transaction
+	skipped      []string
+}
+
+func (c *converter) convert(records []*record) error {
+	// the lists can come after the transactions that use them
+	for _, r := range records {
+		switch r.section {
+		case "account":
+			c.accountTypes[r.get('N')] = strings.ToLower(r.get('T'))
+		case "cat":
+			name, _, _ := strings.Cut(r.get('N'), ":")
+			c.categories[name] = r.has('I')
+		case "security":
+			if s := r.get('S'); s != "" {
+				c.securities[r.get('N')] = s
+			}
+		}
+	}
+
+	c.account = c.Account
+	skipped := make(map[string]int)
+	var skippedOrder []string
+	for _, r := range records {
+		var err error
+		switch r.section {
+		case "account":
+			c.name = r.get('N')
+			c.account = c.accountFor(c.name)
+		case "bank", "cash", "ccard", "oth a", "oth l":
+			err = c.bankTransaction(r)
+		case "invst":
+			err = c.investment(r)
+		case "cat", "class", "security", "memorized", "prices":
+			// lists, and memorized transactions (which are only templates)
+		default:
+			if skipped[r.section] == 0 {
+				skippedOrder = append(skippedOrder, r.section)
+			}
+			skipped[r.section]++
+		}
+		if err != nil {
+			return errors.Wrapf(err, "line %d", r.line)
+		}
+	}
+	for _, s := range skippedOrder {
+		c.skipped = append(c.skipped, fmt.Sprintf("%d records in !Type:%s section", skipped[s], s))
+	}
+	c.dropMirroredTransfers()
+	return nil
+}
+
+// accountFor returns the ledger account for a QIF account.
+func (c *converter) accountFor(name string) string {
+	if a, ok := c.Mapping.account(name); ok {
+		return a
+	}
+	switch c.accountTypes[name] {
+	case "bank":
+		return "Assets:Bank:" + name
+	case "ccard":
+		return "Liabilities:Credit Card:" + name
+	case "cash":
+		return "Assets:Cash:" + name
+	case "oth l":
+		return "Liabilities:" + name
+	case "invst", "port", "401(k)/403(b)", "mutual":
+		return "Assets:Investments:" + name
+	}
+	return "Assets:" + name
+}
+
+// newTransaction starts a transaction with the fields common to all records.
+func (c *converter) newTransaction(r *record) (*importer.Transaction, error) {
+	d, err := c.parseDate(r.get('D'))
+	if err != nil {
+		return nil, errors.Wrap(err, "parseDate()")
+	}
+	t := &importer.Transaction{Date: d, Payee: r.get('P')}
+	switch r.get('C') {
+	case "":
+	case "*", "c", "X", "R":
+		t.State = journal.Cleared
+	default:
+		return nil, errors.Errorf("invalid cleared status %q", r.get('C'))
+	}
+	if m := r.get('M'); m != "" {
+		t.Notes = append(t.Notes, m)
+	}
+	if c.IDTag != "" {
+		key := c.account + "\x1f" + r.text
+		t.Notes = append(t.Notes, fmt.Sprintf("%s: %s", c.IDTag, importer.RowID(key, c.seen[key])))
+		c.seen[key]++
+	}
+	return t, nil
+}
+
+type split struct {
+	category string
+	memo     string
+	amount   string
+}
+
+func (c *converter) bankTransaction(r *record) error {
+	t, err := c.newTransaction(r)
+	if err != nil {
+		return errors.Wrap(err, "newTransaction()")
+	}
+	t.Code = r.get('N')
+	q, prec, err := c.amount(r)
+	if err != nil {
+		return errors.Wrap(err, "amount()")
+	}
+
+	var splits []*split
+	for _, f := range r.fields {
+		switch f.code {
+		case 'S':
+			splits = append(splits, &split{category: f.value})
+		case 'E', '$':
+			if len(splits) == 0 {
+				return errors.Errorf("split field %c%s before any S field", f.code, f.value)
+			}
+			s := splits[len(splits)-1]
+			if f.code == 'E' {
+				s.memo = f.value
+			} else {
+				s.amount = f.value
+			}
+		}
+	}
+
+	if len(splits) == 0 {
+		account, notes, transfer := c.target(r.get('L'), q.Sign())
+		c.addTransfer(t, transfer, q, true)
+		t.Postings = []*importer.Posting{
+			{Account: c.account, Amount: c.format(q, prec)},
+			{Account: account, Notes: notes},
+		}
+		c.transactions = append(c.transactions, t)
+		return nil
+	}
+
+	t.Postings = []*importer.Posting{{Account: c.account, Amount: c.format(q, prec)}}
+	for _, s := range splits {
+		sq, sprec, err := c.parseAmount(s.amount)
+		if err != nil {
+			return errors.Wrapf(err, "parseAmount(%s)", s.amount)
+		}
+		account, notes, transfer := c.target(s.category, sq.Sign())
+		c.addTransfer(t, transfer, sq, false)
+		if s.memo != "" {
+			notes = append([]string{s.memo}, notes...)
+		}
+		t.Postings = append(t.Postings, &importer.Posting{Account: account, Amount: c.format(new(big.Rat).Neg(sq), sprec), Notes: notes})
+	}
+	c.transactions = append(c.transactions, t)
+	return nil
+}
+
+// target returns the account for a QIF category or `[Account]` transfer
+// (which can be followed by `/Class`), along with any notes for the posting
+// and the QIF account name if it's a transfer. sign is the sign of the
+// amount being categorized.
+func (c *converter) target(category string, sign int) (account string, notes []string, transfer string) {
+	if i := strings.LastIndexByte(category, '/'); i >= 0 {
+		if class := strings.TrimSpace(category[i+1:]); class != "" {
+			notes = append(notes, "class: "+class)
+		}
+		category = category[:i]
+	}
+	category = strings.TrimSpace(category)
+
+	if strings.HasPrefix(category, "[") && strings.HasSuffix(category, "]") {
+		name := category[1 : len(category)-1]
+		if name == c.name {
+			return c.OpeningBalanceAccount, notes, ""
+		}
+		return c.accountFor(name), notes, name
+	}
+	if a, ok := c.Mapping.category(category); ok {
+		return a, notes, ""
+	}
+
+	top, _, _ := strings.Cut(category, ":")
+	income, listed := c.categories[top]
+	if !listed {
+		income = sign > 0
+	}
+	prefix := c.ExpenseAccount
+	if income {
+		prefix = c.IncomeAccount
+	}
+	// Quicken's internal categories, like `_DivInc`, don't mean anything
+	// outside of it
+	if category == "" || strings.HasPrefix(category, "_") {
+		return prefix, notes, ""
+	}
+	// put unmapped categories under eg `Expenses` rather than
+	// `Expenses:Unknown`
+	if i := strings.LastIndexByte(prefix, ':'); i >= 0 {
+		prefix = prefix[:i]
+	}
+	return prefix + ":" + category, notes, ""
+}
+
+// transfer is an amount moved between two QIF accounts. Each account's
+// transactions have their own copy of it.
+type transfer struct {
+	t              *importer.Transaction
+	account, other string
+	// q is the amount moved into account from other.
+	q *big.Rat
+	// droppable is set if t is only the transfer, so it can be dropped if
+	// the other account has a copy.
+	droppable bool
+}
+
+// addTransfer records that t (in the current account) includes a transfer
+// of q from the QIF account named other, if other isn't empty.
+func (c *converter) addTransfer(t *importer.Transaction, other string, q *big.Rat, droppable bool) {
+	if other != "" {
+		c.transfers = append(c.transfers, &transfer{t, c.name, other, q, droppable})
+	}
+}
+
+func (tr *transfer) key(account, other string, q *big.Rat) string {
+	return fmt.Sprintf("%s\x1f%s\x1f%s\x1f%s", tr.t.Date.Format(journal.DateFormat), account, other, q.RatString())
+}
+
+// dropMirroredTransfers pairs up the two copies of each transfer, and drops
+// one of them. A transaction that's more than just the transfer (like a
+// split, or an investment transaction) is kept over one that isn't, and
+// otherwise the first is kept.
+func (c *converter) dropMirroredTransfers() {
+	unmatched := make(map[string][]*transfer)
+	for _, tr := range c.transfers {
+		mirror := tr.key(tr.other, tr.account, new(big.Rat).Neg(tr.q))
+		if ms := unmatched[mirror]; len(ms) > 0 {
+			m := ms[0]
+			unmatched[mirror] = ms[1:]
+			switch {
+			case tr.droppable:
+				c.dropped[tr.t] = true
+			case m.droppable:
+				c.dropped[m.t] = true
+			}
+			continue
+		}
+		key := tr.key(tr.account, tr.other, tr.q)
+		unmatched[key] = append(unmatched[key], tr)
+	}
+}
+
+// investment adds an investment transaction. Cash is kept in the investment
+// account, except for actions ending in `X`, whose cash is transferred to or
+// from the account in the L field.
+func (c *converter) investment(r *record) error {
+	t, err := c.newTransaction(r)
+	if err != nil {
+		return errors.Wrap(err, "newTransaction()")
+	}
+	action := strings.ToLower(r.get('N'))
+	security := r.get('Y')
+	symbol := security
+	if s, ok := c.Mapping.security(security); ok {
+		symbol = s
+	} else if s, ok := c.securities[security]; ok {
+		symbol = s
+	}
+	symbol = journal.QuoteCommodity(symbol)
+	if t.Payee == "" {
+		t.Payee = strings.TrimSpace(r.get('N') + " " + security)
+	}
+
+	total, totalPrec, err := c.amount(r)
+	if err != nil {
+		return errors.Wrap(err, "amount()")
+	}
+
+	cashAccount := c.account
+	base := action
+	if strings.HasSuffix(action, "x") && action != "xin" && action != "xout" {
+		base = strings.TrimSuffix(action, "x")
+		var transfer string
+		cashAccount, _, transfer = c.target(r.get('L'), 0)
+		// as if the cash was moved into this account and back out
+		q := new(big.Rat).Neg(total)
+		if base == "buy" || base == "miscexp" {
+			q = total
+		}
+		c.addTransfer(t, transfer, q, false)
+	}
+	commission, commissionPrec, err := c.parseAmount(r.get('O'))
+	if err != nil {
+		return errors.Wrapf(err, "parseAmount(%s)", r.get('O'))
+	}
+	units := r.get('Q')
+	price := r.get('I')
+
+	switch {
+	case base == "buy" || reinvestActions[base] != "":
+		// the total includes the commission
+		cost := new(big.Rat).Sub(total, commission)
+		lot, err := c.lot(units, price, cost, max(totalPrec, commissionPrec), "{%s}", "{{%s}}")
+		if err != nil {
+			return errors.Wrap(err, "lot()")
+		}
+		t.Postings = append(t.Postings, &importer.Posting{Account: c.account, Amount: fmt.Sprintf("%s %s %s [%s]", numberString(units, c.DecimalComma), symbol, lot, t.Date.Format(journal.DateFormat))})
+		c.addCommission(t, commission, commissionPrec)
+		other := cashAccount
+		if income := reinvestActions[base]; income != "" {
+			other = c.incomeAccount(income, r.get('L'))
+		}
+		t.Postings = append(t.Postings, &importer.Posting{Account: other, Amount: c.format(new(big.Rat).Neg(total), totalPrec)})
+	case base == "sell":
+		// the total is after the commission
+		proceeds := new(big.Rat).Add(total, commission)
+		sale, err := c.lot(units, price, proceeds, max(totalPrec, commissionPrec), "@ %s", "@@ %s")
+		if err != nil {
+			return errors.Wrap(err, "lot()")
+		}
+		t.Postings = append(t.Postings, &importer.Posting{Account: c.account, Amount: fmt.Sprintf("-%s %s %s", strings.TrimPrefix(numberString(units, c.DecimalComma), "-"), symbol, sale)})
+		c.addCommission(t, commission, commissionPrec)
+		t.Postings = append(t.Postings, &importer.Posting{Account: cashAccount, Amount: c.format(total, totalPrec)})
+	case DefaultIncomeAccounts[base] != "":
+		t.Postings = []*importer.Posting{
+			{Account: cashAccount, Amount: c.format(total, totalPrec)},
+			{Account: c.incomeAccount(base, r.get('L'))},
+		}
+	case base == "miscexp":
+		t.Postings = []*importer.Posting{
+			{Account: cashAccount, Amount: c.format(new(big.Rat).Neg(total), totalPrec)},
+			{Account: c.ExpenseAccount},
+		}
+	case base == "xin", base == "xout", base == "cash":
+		q := total
+		if base == "xout" {
+			q = new(big.Rat).Neg(total)
+		}
+		account, notes, transfer := c.target(r.get('L'), q.Sign())
+		c.addTransfer(t, transfer, q, true)
+		t.Postings = []*importer.Posting{
+			{Account: c.account, Amount: c.format(q, totalPrec)},
+			{Account: account, Notes: notes},
+		}
+	default:
+		c.skipped = append(c.skipped, fmt.Sprintf("line %d: %s %s %s", r.line, r.get('D'), r.get('N'), security))
+		return nil
+	}
+	c.transactions = append(c.transactions, t)
+	return nil
+}
+
+// lot formats the price of units as a per-unit price with perUnit (eg
+// "{%s}") if it matches total, or total with totalFmt otherwise.
+func (c *converter) lot(units, price string, total *big.Rat, totalPrec int, perUnit, totalFmt string) (string, error) {
+	u, _, err := c.parseAmount(units)
+	if err != nil {
+		return "", errors.Wrapf(err, "parseAmount(%s)", units)
+	}
+	p, pprec, err := c.parseAmount(price)
+	if err != nil {
+		return "", errors.Wrapf(err, "parseAmount(%s)", price)
+	}
+	if price != "" && new(big.Rat).Mul(u.Abs(u), p).Cmp(total) == 0 {
+		return fmt.Sprintf(perUnit, c.format(p, pprec)), nil
+	}
+	return fmt.Sprintf(totalFmt, c.format(total, totalPrec)), nil
+}
+
+func (c *converter) addCommission(t *importer.Transaction, commission *big.Rat, prec int) {
+	if commission.Sign() != 0 {
+		t.Postings = append(t.Postings, &importer.Posting{Account: c.CommissionAccount, Amount: c.format(commission, prec)})
+	}
+}
+
+// incomeAccount returns the account for investment income, using its
+// category if it has a real one.
+func (c *converter) incomeAccount(action, category string) string {
+	if category != "" && !strings.HasPrefix(category, "[") && !strings.HasPrefix(category, "_") {
+		account, _, _ := c.target(category, 1)
+		return account
+	}
+	if a, ok := c.IncomeAccounts[action]; ok {
+		return a
+	}
+	return c.IncomeAccount
+}
+
+// amount returns the record's T (or U) amount.
+func (c *converter) amount(r *record) (*big.Rat, int, error) {
+	s := r.get('T')
+	if s == "" {
+		s = r.get('U')
+	}
+	q, prec, err := c.parseAmount(s)
+	return q, prec, errors.Wrapf(err, "parseAmount(%s)", s)
+}
+
+// parseAmount parses a QIF amount, with optional thousands separators. An
+// empty amount is zero. It also returns the number of digits after the
+// decimal mark.
+func (c *converter) parseAmount(s string) (*big.Rat, int, error) {
+	n := numberString(s, c.DecimalComma)
+	if n == "" {
+		return new(big.Rat), 0, nil
+	}
+	q, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return nil, 0, errors.Errorf("invalid amount %q", s)
+	}
+	prec := 0
+	if i := strings.IndexByte(n, '.'); i >= 0 {
+		prec = len(n) - i - 1
+	}
+	return q, prec, nil
+}
+
+// numberString normalizes a QIF amount, like `1,234.50`, to `1234.50`.
+func numberString(s string, decimalComma bool) string {
+	s = strings.TrimSpace(s)
+	if decimalComma {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	return strings.TrimPrefix(s, "+")
+}
+
+// parseDate parses the many forms of QIF dates: `1/5/24`, `01/05/2024`,
+// `1/ 5'24` (where `'` means the 2000s), `5.1.2024`, `2024-01-05`, etc.
+// Two-digit years without a `'` are in 1950-2049.
+func (c *converter) parseDate(s string) (time.Time, error) {
+	orig := s
+	s = strings.ReplaceAll(s, " ", "")
+	apostrophe := strings.Contains(s, "'")
+	parts := strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune("/-.'", r) })
+	if len(parts) != 3 {
+		return time.Time{}, errors.Errorf("invalid date %q", orig)
+	}
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return time.Time{}, errors.Errorf("invalid date %q", orig)
+		}
+		nums[i] = n
+	}
+
+	var y, m, d int
+	var yearDigits int
+	switch {
+	case len(parts[0]) == 4:
+		y, m, d = nums[0], nums[1], nums[2]
+		yearDigits = 4
+	case c.DateOrder == DayFirst:
+		d, m, y = nums[0], nums[1], nums[2]
+		yearDigits = len(parts[2])
+	default:
+		m, d, y = nums[0], nums[1], nums[2]
+		yearDigits = len(parts[2])
+	}
+	switch {
+	case yearDigits == 4:
+	case yearDigits > 2:
+		return time.Time{}, errors.Errorf("invalid year in date %q", orig)
+	case apostrophe || y < 50:
+		y += 2000
+	default:
+		y += 1900
+	}
+
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if m < 1 || m > 12 || t.Day() != d {
+		return time.Time{}, errors.Errorf("invalid date %q", orig)
+	}
+	return t, nil
+}
+
+// format formats q in c.Currency, like `$-1.50` or `-1.50 EUR`.
+func (c *converter) format(q *big.Rat, prec int) string {
+	return importer.FormatAmount(q, prec, c.Currency, importer.HasLetters(c.Currency))
+}
@@ -0,0 +1,242 @@
+package lib
+
+import (
+	"testing"
+
+	"strings"
+)
+
+const multiAccountQIF = `!Option:AutoSwitch
+!Account
+NChecking
+TBank
+^
+NSavings
+TBank
+^
+NBrokerage
+TInvst
+^
+!Clear:AutoSwitch
+!Type:Cat
+NSalary
+I
+^
+NGroceries
+E
+^
+!Type:Security
+NVanguard S&P 500
+SVFV.TO
+TETF
+^
+!Account
+NChecking
+TBank
+^
+!Type:Bank
+D1/ 1'24
+T1,000.00
+CX
+POpening Balance
+L[Checking]
+^
+D01/05/24
+T-100.00
+N101
+PLoblaws
+MWeekly shop
+SGroceries
+EFood
+$-60.00
+SHousehold/Home
+$-40.00
+^
+D1/6'24
+T-200.00
+PTransfer
+L[Savings]
+^
+D1/7'24
+T2000
+PEmployer
+LSalary
+^
+D1/8'24
+T5
+PRefund
+LShopping
+^
+D1/20'24
+T12.34
+PDividend
+L[Brokerage]
+^
+!Account
+NSavings
+TBank
+^
+!Type:Bank
+D1/6'24
+T200.00
+PTransfer
+L[Checking]
+^
+!Account
+NBrokerage
+TInvst
+^
+!Type:Invst
+D1/10'24
+NBuy
+YVanguard S&P 500
+I100
+Q10
+O9.95
+T1,009.95
+^
+D1/15'24
+NSell
+YUnknown Fund
+I33.333
+Q3
+T100
+^
+D1/20'24
+NDivX
+YVanguard S&P 500
+T12.34
+L[Checking]
+^
+D1/25'24
+NReinvDiv
+YVanguard S&P 500
+I102.5
+Q0.2
+T20.50
+^
+D1/26'24
+NShrsIn
+YVanguard S&P 500
+Q5
+^
+`
+
+func TestConvert(t *testing.T) {
+	im := &Importer{
+		Account:               DefaultAccount,
+		Currency:              DefaultCurrency,
+		ExpenseAccount:        DefaultExpenseAccount,
+		IncomeAccount:         DefaultIncomeAccount,
+		CommissionAccount:     DefaultCommissionAccount,
+		OpeningBalanceAccount: DefaultOpeningBalanceAccount,
+		IncomeAccounts:        DefaultIncomeAccounts,
+		Mapping: &Mapping{
+			Categories: map[string]string{"Household": "Expenses:House"},
+			Accounts:   map[string]string{"Checking": "Assets:Chequing"},
+		},
+	}
+	imp, err := im.Convert(strings.NewReader(multiAccountQIF))
+	if err != nil {
+		t.Fatalf("Convert() = err(%v)", err)
+	}
+
+	want := "2024/01/01 * Opening Balance\n    Assets:Chequing  $1000.00\n    Equity:Opening Balances\n\n" +
+		"2024/01/05 (101) Loblaws\n    ; Weekly shop\n    Assets:Chequing  $-100.00\n    Expenses:Groceries  $60.00\n    ; Food\n    Expenses:House  $40.00\n    ; class: Home\n\n" +
+		"2024/01/06 Transfer\n    Assets:Chequing  $-200.00\n    Assets:Bank:Savings\n\n" +
+		"2024/01/07 Employer\n    Assets:Chequing  $2000\n    Income:Salary\n\n" +
+		"2024/01/08 Refund\n    Assets:Chequing  $5\n    Income:Shopping\n\n" +
+		"2024/01/10 Buy Vanguard S&P 500\n    Assets:Investments:Brokerage  10 \"VFV.TO\" {$100} [2024/01/10]\n    Expenses:Commissions  $9.95\n    Assets:Investments:Brokerage  $-1009.95\n\n" +
+		"2024/01/15 Sell Unknown Fund\n    Assets:Investments:Brokerage  -3 \"Unknown Fund\" @@ $100\n    Assets:Investments:Brokerage  $100\n\n" +
+		"2024/01/20 DivX Vanguard S&P 500\n    Assets:Chequing  $12.34\n    Income:Dividends\n\n" +
+		"2024/01/25 ReinvDiv Vanguard S&P 500\n    Assets:Investments:Brokerage  0.2 \"VFV.TO\" {$102.5} [2024/01/25]\n    Income:Dividends  $-20.50\n"
+	if imp.Transactions != want {
+		t.Errorf("Convert() = %q, want %q", imp.Transactions, want)
+	}
+	if len(imp.Skipped) != 1 || !strings.Contains(imp.Skipped[0], "ShrsIn") {
+		t.Errorf("Convert().Skipped = %q, want the ShrsIn", imp.Skipped)
+	}
+}
+
+func TestConvertIDs(t *testing.T) {
+	im := &Importer{Account: DefaultAccount, Currency: DefaultCurrency, ExpenseAccount: DefaultExpenseAccount, IncomeAccount: DefaultIncomeAccount, IDTag: DefaultIDTag}
+	imp, err := im.Convert(strings.NewReader("!Type:CCard\nD2024-01-02\nT-5\nPCoffee\n^\nD2024-01-02\nT-5\nPCoffee\n^\n"))
+	if err != nil {
+		t.Fatalf("Convert() = err(%v)", err)
+	}
+	want := "2024/01/02 Coffee\n    ; import-id: a31fe0bf8d61f3eb\n    Assets:Unknown  $-5\n    Expenses:Unknown\n\n" +
+		"2024/01/02 Coffee\n    ; import-id: 0e5086cdd7c31cfe\n    Assets:Unknown  $-5\n    Expenses:Unknown\n"
+	if imp.Transactions != want {
+		t.Errorf("Convert() = %q, want %q", imp.Transactions, want)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []string{
+		"D01/01/2024\n",
+		"!Bogus\n",
+		"!Type:Bank\nD13/01/2024\nT1\n^\n",
+		"!Type:Bank\nD01/01/2024\nTabc\n^\n",
+		"!Type:Bank\nD01/01/2024\nT1\nCZ\n^\n",
+		"!Type:Bank\nD01/01/2024\nT1\n$1\n^\n",
+		"!Type:Bank\nD01/01/2024\nT1\n!Type:Cash\n",
+	}
+	im := &Importer{Account: DefaultAccount, ExpenseAccount: DefaultExpenseAccount, IncomeAccount: DefaultIncomeAccount}
+	for i, test := range tests {
+		if _, err := im.Convert(strings.NewReader(test)); err == nil {
+			t.Errorf("%d: Convert(%q) = nil error, want non-nil", i, test)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in      string
+		order   DateOrder
+		want    string
+		wantErr bool
+	}{
+		{"1/5/24", MonthFirst, "2024/01/05", false},
+		{"1/5/98", MonthFirst, "1998/01/05", false},
+		{"1/ 5'04", MonthFirst, "2004/01/05", false},
+		{"01/05/2024", MonthFirst, "2024/01/05", false},
+		{"2024-01-05", DayFirst, "2024/01/05", false},
+		{"5.1.2024", DayFirst, "2024/01/05", false},
+		{"05/01/24", DayFirst, "2024/01/05", false},
+		{"2/30/2024", MonthFirst, "", true},
+		{"13/1/2024", MonthFirst, "", true},
+		{"1/5", MonthFirst, "", true},
+		{"1/5/202", MonthFirst, "", true},
+	}
+	for _, test := range tests {
+		c := &converter{Importer: &Importer{DateOrder: test.order}}
+		got, err := c.parseDate(test.in)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseDate(%q) = err(%v), want non-nil error %v", test.in, err, test.wantErr)
+			continue
+		}
+		if err == nil && got.Format("2006/01/02") != test.want {
+			t.Errorf("parseDate(%q) = %s, want %s", test.in, got.Format("2006/01/02"), test.want)
+		}
+	}
+}
+
+func TestMappingCategory(t *testing.T) {
+	m := &Mapping{Categories: map[string]string{"Auto": "Expenses:Car", "Auto:Fuel": "Expenses:Gas"}}
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"Auto", "Expenses:Car", true},
+		{"Auto:Fuel", "Expenses:Gas", true},
+		{"Auto:Service:Tires", "Expenses:Car:Service:Tires", true},
+		{"Bills", "", false},
+	}
+	for _, test := range tests {
+		got, ok := m.category(test.in)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("category(%q) = %q, %v, want %q, %v", test.in, got, ok, test.want, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Mapping maps QIF names to ledger ones. It's read from a JSON file (see
+// LoadMapping).
+type Mapping struct {
+	// Categories maps QIF categories to ledger accounts. A mapping for a
+	// category also applies to its subcategories, so if "Auto" is mapped to
+	// "Expenses:Car", "Auto:Fuel" becomes "Expenses:Car:Fuel".
+	Categories map[string]string `json:"categories"`
+	// Accounts maps QIF account names (from `!Account` records and
+	// `[Account]` transfers) to ledger accounts.
+	Accounts map[string]string `json:"accounts"`
+	// Securities maps QIF security names to ledger commodities.
+	Securities map[string]string `json:"securities"`
+}
+
+// LoadMapping reads the JSON mapping file at path.
+func LoadMapping(path string) (*Mapping, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	m := &Mapping{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, errors.Wrapf(err, "json.Unmarshal(%s)", path)
+	}
+	return m, nil
+}
+
+// category returns the ledger account for a QIF category, or false if
+// neither it nor any of its parents are mapped.
+func (m *Mapping) category(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	suffix := ""
+	for {
+		if a, ok := m.Categories[name]; ok {
+			return a + suffix, true
+		}
+		i := strings.LastIndexByte(name, ':')
+		if i < 0 {
+			return "", false
+		}
+		suffix = name[i:] + suffix
+		name = name[:i]
+	}
+}
+
+func (m *Mapping) account(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	a, ok := m.Accounts[name]
+	return a, ok
+}
+
+func (m *Mapping) security(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	s, ok := m.Securities[name]
+	return s, ok
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// record is a QIF record: the lines between two `^` lines, each made of a
+// one-character field code and a value.
+type record struct {
+	// section is the lower-cased type of the section the record is in, like
+	// "bank", "invst" or "cat" for `!Type:` sections, or "account" for
+	// `!Account`.
+	section string
+	line    int
+	fields  []field
+	// text is the record as written, for making IDs.
+	text string
+}
+
+type field struct {
+	code  byte
+	value string
+}
+
+// get returns the first value for code, or "".
+func (r *record) get(code byte) string {
+	for _, f := range r.fields {
+		if f.code == code {
+			return f.value
+		}
+	}
+	return ""
+}
+
+// has reports whether r has a field with the given code.
+func (r *record) has(code byte) bool {
+	for _, f := range r.fields {
+		if f.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// readRecords reads all the records of a QIF file. `!Option:` and `!Clear:`
+// lines are ignored.
+func readRecords(r io.Reader) ([]*record, error) {
+	var records []*record
+	section := ""
+	var cur *record
+	var text strings.Builder
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch {
+		case line[0] == '!':
+			if cur != nil {
+				return nil, errors.Errorf("line %d: unterminated record before %q", n, line)
+			}
+			header := strings.ToLower(strings.TrimSpace(line[1:]))
+			switch {
+			case strings.HasPrefix(header, "type:"):
+				section = strings.TrimSpace(strings.TrimPrefix(header, "type:"))
+			case header == "account":
+				section = header
+			case strings.HasPrefix(header, "option:"), strings.HasPrefix(header, "clear:"):
+			default:
+				return nil, errors.Errorf("line %d: unknown header %q", n, line)
+			}
+		case line[0] == '^':
+			if cur == nil {
+				// an empty record
+				continue
+			}
+			cur.text = text.String()
+			records = append(records, cur)
+			cur = nil
+			text.Reset()
+		default:
+			if section == "" {
+				return nil, errors.Errorf("line %d: %q before any !Type header", n, line)
+			}
+			if cur == nil {
+				cur = &record{section: section, line: n}
+			}
+			cur.fields = append(cur.fields, field{line[0], strings.TrimSpace(line[1:])})
+			text.WriteString(line + "\n")
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "s.Scan()")
+	}
+	if cur != nil {
+		// some programs leave out the last `^`
+		cur.text = text.String()
+		records = append(records, cur)
+	}
+	return records, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/qifimport/lib"
+	sorter "github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var dateOrderIDs = map[lib.DateOrder][]string{
+	lib.MonthFirst: {"mdy"},
+	lib.DayFirst:   {"dmy"},
+}
+
+var (
+	mappingPath           = flag.StringP("mapping", "m", "", "JSON file mapping QIF categories, accounts and securities to ledger accounts and commodities.")
+	journalPath           = flag.StringP("journal", "j", "", "Journal to add the imported transactions to, in sorted order. Defaults to printing them to stdout.")
+	backups               = flag.IntP("backups", "b", 0, "Number of backup copies of the original journal to keep (as <file>.bak, <file>.bak.1, etc).")
+	account               = flag.String("account", lib.DefaultAccount, "Ledger account for transactions that aren't after an !Account record (eg in single-account exports).")
+	decimalComma          = flag.Bool("decimal-comma", false, "Amounts are written like 1.234,56.")
+	currency              = flag.String("currency", lib.DefaultCurrency, "Currency to write amounts in.")
+	expenseAccount        = flag.String("expense-account", lib.DefaultExpenseAccount, "Account that uncategorized withdrawals are balanced against. Unmapped expense categories go under its parent.")
+	incomeAccount         = flag.String("income-account", lib.DefaultIncomeAccount, "Account that uncategorized deposits are balanced against. Unmapped income categories go under its parent.")
+	commissionAccount     = flag.String("commission-account", lib.DefaultCommissionAccount, "Account for commissions on investment transactions.")
+	openingBalanceAccount = flag.String("opening-balance-account", lib.DefaultOpeningBalanceAccount, "Account that opening balances (transfers from an account to itself) are balanced against.")
+	incomeAccounts        = flag.StringToString("income-accounts", lib.DefaultIncomeAccounts, "Accounts that investment income is balanced against, by QIF action (div, intinc, cglong, cgmid, cgshort, miscinc), unless it has a category.")
+	idTag                 = flag.String("id-tag", lib.DefaultIDTag, "Metadata tag to store a unique ID for each transaction in. Empty to leave IDs out.")
+
+	dedupeMode sorter.DedupeMode
+	dateOrder  lib.DateOrder
+)
+
+func main() {
+	flag.Var(enumflag.New(&dedupeMode, "dedupeMode", sorter.DedupeModeIDs, enumflag.EnumCaseInsensitive), "dedupe", fmt.Sprintf("What to do with likely duplicate transactions (eg from importing the same file twice) when adding to a --journal. %q lists them on stderr; %q removes them; %q comments them out.", sorter.DedupeModeIDs[sorter.ReportDuplicates][0], sorter.DedupeModeIDs[sorter.DropDuplicates][0], sorter.DedupeModeIDs[sorter.CommentDuplicates][0]))
+	flag.Var(enumflag.New(&dateOrder, "dateOrder", dateOrderIDs, enumflag.EnumCaseInsensitive), "date-order", fmt.Sprintf("Order of the day and month in dates: %q (US) or %q. Dates starting with a 4-digit year are always year-month-day.", dateOrderIDs[lib.MonthFirst][0], dateOrderIDs[lib.DayFirst][0]))
+
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+
+	var mapping *lib.Mapping
+	if *mappingPath != "" {
+		var err error
+		if mapping, err = lib.LoadMapping(*mappingPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	idTags := sorter.DefaultIDTags
+	if *idTag != "" && *idTag != lib.DefaultIDTag {
+		idTags = append([]string{*idTag}, idTags...)
+	}
+	im := &lib.Importer{
+		Mapping:               mapping,
+		Account:               *account,
+		DateOrder:             dateOrder,
+		DecimalComma:          *decimalComma,
+		Currency:              *currency,
+		ExpenseAccount:        *expenseAccount,
+		IncomeAccount:         *incomeAccount,
+		CommissionAccount:     *commissionAccount,
+		OpeningBalanceAccount: *openingBalanceAccount,
+		IncomeAccounts:        *incomeAccounts,
+		IDTag:                 *idTag,
+		Appender: importer.Appender{
+			Sorter: sorter.Sorter{
+				Dedupe: sorter.Dedupe{
+					Mode:       dedupeMode,
+					Days:       sorter.DefaultDedupeDays,
+					Similarity: sorter.DefaultDedupeSimilarity,
+					IDTags:     idTags,
+				},
+			},
+		},
+	}
+
+	imp, err := im.ConvertFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	for _, s := range imp.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped unsupported records: %s\n", s)
+	}
+
+	if *journalPath == "" {
+		_, err = io.WriteString(os.Stdout, imp.Transactions)
+	} else {
+		var dups []sorter.Duplicate
+		dups, err = im.AppendFile(imp.Transactions, *journalPath, *backups)
+		for _, d := range dups {
+			fmt.Fprintf(os.Stderr, "%s %s: duplicate of %s %s (%s)\n", d.Transaction.DateText, d.Transaction.Payee, d.Of.DateText, d.Of.Payee, d.Reason)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/glennhartmann/ledger-tools/src/common"
+	"github.com/glennhartmann/ledger-tools/src/fs"
 	"github.com/glennhartmann/ledger-tools/src/priceutils"
 )
 
@@ -41,6 +42,7 @@ type Conn struct {
 	Conf           *Config
 	OAuthURLFmt    string
 	TokenFile      string
+	TokenBackups   int
 	AccountNumbers []string
 	CloseTime      string
 	Now            time.Time
@@ -54,7 +56,7 @@ func (c *Conn) Fetch() ([]*priceutils.TimeSeriesItemWithSymbol, error) {
 	}
 	token := strings.TrimSpace(string(b))
 
-	oauthResponse, err := Authenticate(token, c.TokenFile, c.OAuthURLFmt)
+	oauthResponse, err := Authenticate(token, c.TokenFile, c.TokenBackups, c.OAuthURLFmt)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Authenticate(%s)", token)
 	}
@@ -74,7 +76,7 @@ func (c *Conn) Fetch() ([]*priceutils.TimeSeriesItemWithSymbol, error) {
 			if err != nil {
 				return nil, errors.Wrap(err, "dateAtCloseTime()")
 			}
-			tsiws = append(tsiws, &priceutils.TimeSeriesItemWithSymbol{d, symbol, candle})
+			tsiws = append(tsiws, &priceutils.TimeSeriesItemWithSymbol{Date: d, Symbol: symbol, Data: candle})
 		}
 	}
 
@@ -88,7 +90,7 @@ func (c *Conn) Fetch() ([]*priceutils.TimeSeriesItemWithSymbol, error) {
 		for _, position := range positions {
 			if _, ok := positionSymbols[position.Symbol]; ok {
 				seenPositionSymbols[position.Symbol] = struct{}{}
-				tsiws = append(tsiws, &priceutils.TimeSeriesItemWithSymbol{c.Now, position.Symbol, position})
+				tsiws = append(tsiws, &priceutils.TimeSeriesItemWithSymbol{Date: c.Now, Symbol: position.Symbol, Data: position})
 			}
 		}
 	}
@@ -96,7 +98,7 @@ func (c *Conn) Fetch() ([]*priceutils.TimeSeriesItemWithSymbol, error) {
 		return nil, errors.Wrap(err, "checkSeenPositionSymbols()")
 	}
 
-	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{tsiws})
+	sort.Sort(priceutils.TimeSeriesItemWithSymbolSorter{TSIWS: tsiws})
 	return tsiws, nil
 }
 
@@ -111,7 +113,7 @@ func (c *Conn) dateAtCloseTime(t time.Time) (time.Time, error) {
 }
 
 // TODO: this whole file is badly in need of a refactor
-func Authenticate(token, tokenFile, oauthURLFmt string) (*oauthResponse, error) {
+func Authenticate(token, tokenFile string, tokenBackups int, oauthURLFmt string) (*oauthResponse, error) {
 	oauthURL := fmt.Sprintf(oauthURLFmt, token)
 	var responseBody []byte
 	if err := func() error {
@@ -139,7 +141,9 @@ func Authenticate(token, tokenFile, oauthURLFmt string) (*oauthResponse, error)
 		return nil, errors.Wrap(err, "json.Unmarshal(oauth response)")
 	}
 
-	if err := ioutil.WriteFile(tokenFile, []byte(oauthResponse.RefreshToken), 0640); err != nil {
+	// the old refresh token stops working as soon as we've used it, so losing
+	// the new one to a partial write would mean re-generating it by hand
+	if err := fs.WriteFileAtomic(tokenFile, []byte(oauthResponse.RefreshToken), 0640, tokenBackups); err != nil {
 		log.Printf("unable to write refresh token back to %s: %v", tokenFile, err)
 	}
 
@@ -1,8 +1,6 @@
 package questrade
 
 import (
-	"fmt"
-
 	"github.com/glennhartmann/ledger-tools/src/priceutils"
 )
 
@@ -38,18 +36,18 @@ type symbolResponse struct {
 }
 
 type Candle struct {
-	Start  string  `json:"start"`
-	End    string  `json:"end"`
-	Low    float32 `json:"low"`
-	High   float32 `json:"high"`
-	Open   float32 `json:"open"`
-	Close  float32 `json:"close"`
-	Volume int     `json:"volume"`
-	VWAP   float32 `json:"VWAP"`
+	Start  string             `json:"start"`
+	End    string             `json:"end"`
+	Low    priceutils.Decimal `json:"low"`
+	High   priceutils.Decimal `json:"high"`
+	Open   priceutils.Decimal `json:"open"`
+	Close  priceutils.Decimal `json:"close"`
+	Volume int                `json:"volume"`
+	VWAP   priceutils.Decimal `json:"VWAP"`
 }
 
-func (c *Candle) GetLastPrice() string {
-	return fmt.Sprintf("%f", c.Close)
+func (c *Candle) GetLastPrice() priceutils.Decimal {
+	return c.Close
 }
 
 type positionsResponse struct {
@@ -57,21 +55,21 @@ type positionsResponse struct {
 }
 
 type Position struct {
-	Symbol             string   `json:"symbol"`
-	SymbolID           int      `json:"symbolId"`
-	OpenQuantity       float32  `json:"openQuantity"`
-	ClosedQuantity     float32  `json:"closedQuantity"`
-	CurrentMarketValue float32  `json:"currentMarketValue"`
-	CurrentPrice       float32  `json:"currentPrice"`
-	AverageEntryPrice  float32  `json:"averageEntryPrice"`
-	DayPNL             *float32 `json:"dayPnl"`
-	ClosedPNL          float32  `json:"closedPnl"`
-	OpenPNL            float32  `json:"openPnl"`
-	TotalCost          float32  `json:"totalCost"`
-	IsRealTime         bool     `json:"isRealTime"`
-	IsUnderReorg       bool     `json:"isUnderReorg"`
+	Symbol             string              `json:"symbol"`
+	SymbolID           int                 `json:"symbolId"`
+	OpenQuantity       priceutils.Decimal  `json:"openQuantity"`
+	ClosedQuantity     priceutils.Decimal  `json:"closedQuantity"`
+	CurrentMarketValue priceutils.Decimal  `json:"currentMarketValue"`
+	CurrentPrice       priceutils.Decimal  `json:"currentPrice"`
+	AverageEntryPrice  priceutils.Decimal  `json:"averageEntryPrice"`
+	DayPNL             *priceutils.Decimal `json:"dayPnl"`
+	ClosedPNL          priceutils.Decimal  `json:"closedPnl"`
+	OpenPNL            priceutils.Decimal  `json:"openPnl"`
+	TotalCost          priceutils.Decimal  `json:"totalCost"`
+	IsRealTime         bool                `json:"isRealTime"`
+	IsUnderReorg       bool                `json:"isUnderReorg"`
 }
 
-func (p *Position) GetLastPrice() string {
-	return fmt.Sprintf("%f", p.CurrentPrice)
+func (p *Position) GetLastPrice() priceutils.Decimal {
+	return p.CurrentPrice
 }
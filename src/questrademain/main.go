@@ -16,6 +16,7 @@ import (
 
 var (
 	tokenFile          = flag.StringP("token-file", "t", questrade.DefaultTokenFile, "File where questrade token is stored.")
+	tokenBackups       = flag.IntP("token-backups", "b", 0, "Number of backup copies of the token file to keep when it's overwritten.")
 	accountNumbersFile = flag.StringP("account-numbers-file", "a", questrade.DefaultAccountNumbersFile, "File where questrade account numbers (comma-separated) are stored.")
 	syms               = flag.StringP("symbols", "s", "BND,ZAG.TO", "Symbols (comma-separated) to search for.")
 	oauthURLFmt        = flag.StringP("oauth-url-fmt", "o", questrade.DefaultOAuthURLFmt, "Format-string for questrade oauth API URL.")
@@ -37,7 +38,7 @@ func main() {
 	}
 	accountNumbers := strings.Split(strings.TrimSpace(string(b)), ",")
 
-	oauthResponse, err := questrade.Authenticate(token, *tokenFile, *oauthURLFmt)
+	oauthResponse, err := questrade.Authenticate(token, *tokenFile, *tokenBackups, *oauthURLFmt)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Authenticate(%s): %+v\n", token, err)
 		os.Exit(1)
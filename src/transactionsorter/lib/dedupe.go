@@ -0,0 +1,287 @@
+package lib
+
+import (
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// DedupeMode controls what happens to likely duplicate transactions.
+type DedupeMode int
+
+const (
+	NoDedupe DedupeMode = iota
+	// ReportDuplicates only reports duplicates, leaving them in place.
+	ReportDuplicates
+	// DropDuplicates removes duplicates, leaving any comments that follow
+	// them.
+	DropDuplicates
+	// CommentDuplicates comments out duplicates.
+	CommentDuplicates
+)
+
+// DefaultIDTags are the metadata tags that hold unique import IDs by default.
+// `MD5Sum` is what icsv2ledger uses.
+var DefaultIDTags = []string{"import-id", "MD5Sum"}
+
+const (
+	DefaultDedupeDays       = 2
+	DefaultDedupeSimilarity = 0.8
+)
+
+// Dedupe configures duplicate detection. Two transactions are duplicates if
+// they have the same value for any of the IDTags (however far apart their
+// dates are). If they have different values for one of them, they aren't.
+// Otherwise, they're duplicates if their dates are at most Days apart, they
+// have a posting to the same account for the same amount (including an
+// inferred amount for a posting with none), and their payees are at least
+// Similarity alike (from 0 to 1, where 1 means identical after ignoring case,
+// punctuation and spacing).
+//
+// The first of each set of duplicates (in sorted order) is kept.
+type Dedupe struct {
+	Mode       DedupeMode
+	Days       int
+	Similarity float64
+	IDTags     []string
+}
+
+// Duplicate is a transaction that was found to duplicate an earlier one.
+type Duplicate struct {
+	Transaction *journal.Transaction
+	Of          *journal.Transaction
+	// Reason is a short human-readable description of why they match.
+	Reason string
+}
+
+// dedupe finds duplicate transactions in hunks (which must already be in
+// their final order), and drops or comments them out according to d.Mode. If
+// newFrom is positive, transactions that start before that line are existing
+// ones: they're never duplicates themselves, and the others are only checked
+// against them, not against each other.
+func (d *Dedupe) dedupe(hunks []hunk, newFrom int) ([]hunk, []Duplicate) {
+	if d.Mode == NoDedupe {
+		return hunks, nil
+	}
+
+	var dups []Duplicate
+	out := make([]hunk, 0, len(hunks))
+	// kept transactions, by day, so each one only has to be compared with
+	// ones in the date window
+	byDay := make(map[time.Time][]*journal.Transaction)
+	byID := make(map[journal.Tag]*journal.Transaction)
+	keep := func(t *journal.Transaction) {
+		byDay[t.Date] = append(byDay[t.Date], t)
+		for _, id := range d.ids(t) {
+			if _, ok := byID[id]; !ok {
+				byID[id] = t
+			}
+		}
+	}
+	existing := func(t *journal.Transaction) bool {
+		return newFrom > 0 && t.StartLine() < newFrom
+	}
+	for _, h := range hunks {
+		if t, ok := h.anchor.(*journal.Transaction); ok && existing(t) {
+			keep(t)
+		}
+	}
+
+	for _, h := range hunks {
+		t, ok := h.anchor.(*journal.Transaction)
+		if !ok || existing(t) {
+			out = append(out, h)
+			continue
+		}
+
+		of, reason := d.find(t, byDay, byID)
+		if of == nil {
+			if newFrom <= 0 {
+				keep(t)
+			}
+			out = append(out, h)
+			continue
+		}
+
+		dups = append(dups, Duplicate{Transaction: t, Of: of, Reason: reason})
+		switch d.Mode {
+		case ReportDuplicates:
+			out = append(out, h)
+		case DropDuplicates:
+			out = append(out, dropLines(h, len(t.Raw)))
+		case CommentDuplicates:
+			out = append(out, commentOut(h, len(t.Raw)))
+		}
+	}
+	return out, dups
+}
+
+// find returns the kept transaction that t duplicates, if any, and why.
+func (d *Dedupe) find(t *journal.Transaction, byDay map[time.Time][]*journal.Transaction, byID map[journal.Tag]*journal.Transaction) (*journal.Transaction, string) {
+	for _, id := range d.ids(t) {
+		if k, ok := byID[id]; ok {
+			return k, "same " + id.Name
+		}
+	}
+	for i := -d.Days; i <= d.Days; i++ {
+		for _, k := range byDay[t.Date.AddDate(0, 0, i)] {
+			if reason := d.match(k, t); reason != "" {
+				return k, reason
+			}
+		}
+	}
+	return nil, ""
+}
+
+// match returns the reason a and b are duplicates, or "" if they aren't.
+// Matching IDs are handled by find.
+func (d *Dedupe) match(a, b *journal.Transaction) string {
+	for _, tag := range d.IDTags {
+		av, aOK := a.Tags.Get(tag)
+		bv, bOK := b.Tags.Get(tag)
+		if aOK && bOK && av != bv {
+			return ""
+		}
+	}
+
+	if !sharePosting(postingAmounts(a), postingAmounts(b)) || similarity(normalizePayee(a.Payee), normalizePayee(b.Payee)) < d.Similarity {
+		return ""
+	}
+	return "similar payee and amount"
+}
+
+// ids returns t's values for d.IDTags, including ones on its postings (which
+// is where transfermatch puts the IDs of the transactions it merges).
+func (d *Dedupe) ids(t *journal.Transaction) []journal.Tag {
+	var ids []journal.Tag
+	add := func(ts journal.Tags) {
+		for _, tag := range d.IDTags {
+			if v, ok := ts.Get(tag); ok {
+				ids = append(ids, journal.Tag{Name: tag, Value: v})
+			}
+		}
+	}
+	add(t.Tags)
+	for _, p := range t.Postings {
+		add(p.Tags)
+	}
+	return ids
+}
+
+// postingAmount is a posting's account and amount.
+type postingAmount struct {
+	account   string
+	commodity string
+	quantity  *big.Rat
+}
+
+// postingAmounts returns the amounts of t's postings, including inferred
+// ones.
+func postingAmounts(t *journal.Transaction) []postingAmount {
+	var pas []postingAmount
+	for _, p := range t.Postings {
+		if c, q, ok := t.PostingAmount(p); ok {
+			pas = append(pas, postingAmount{p.Account, c, q})
+		}
+	}
+	return pas
+}
+
+// sharePosting reports whether a and b have a posting to the same account
+// for the same amount.
+func sharePosting(a, b []postingAmount) bool {
+	for _, ap := range a {
+		for _, bp := range b {
+			if ap.account == bp.account && ap.commodity == bp.commodity && ap.quantity.Cmp(bp.quantity) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizePayee lower-cases s, drops punctuation and collapses whitespace,
+// so that eg "AMAZON.COM*1A2B" and "Amazon.com 1a2b" compare equal.
+func normalizePayee(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// similarity returns how alike a and b are, from 0 to 1, based on their
+// edit distance.
+func similarity(a, b string) float64 {
+	ar, br := []rune(a), []rune(b)
+	n := len(ar)
+	if len(br) > n {
+		n = len(br)
+	}
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ar, br))/float64(n)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// commentOut returns a copy of h with its first n lines (the transaction
+// itself) commented out.
+func commentOut(h hunk, n int) hunk {
+	lines := make([]string, len(h.lines))
+	copy(lines, h.lines)
+	for i := 0; i < n && i < len(lines); i++ {
+		lines[i] = "; " + lines[i]
+	}
+	h.lines = lines
+	return h
+}
+
+// dropLines returns a copy of h without its first n lines (the transaction
+// itself). If all that's left are blank lines, they're dropped too, so that
+// the transaction doesn't leave a gap behind.
+func dropLines(h hunk, n int) hunk {
+	if n > len(h.lines) {
+		n = len(h.lines)
+	}
+	h.lines = h.lines[n:]
+	for _, l := range h.lines {
+		if strings.TrimSpace(l) != "" {
+			return h
+		}
+	}
+	h.lines = nil
+	return h
+}
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"testing"
+
+	"fmt"
+	"strings"
+)
+
+const dedupeTest = `2024/01/01 Coffee Shop
+    Expenses:Coffee  $3.50
+    Assets:Checking
+
+2024/01/02 COFFEE-SHOP
+    Expenses:Unknown  $3.50
+    Assets:Checking
+
+2024/01/05 Coffee Shop
+    Expenses:Coffee  $3.50
+    Assets:Checking
+
+2024/01/01 Bookstore
+    ; import-id: abc
+    Expenses:Books  $20
+    Assets:Checking
+
+2024/01/09 Books Inc
+    ; import-id: abc
+    Expenses:Books  $25
+    Assets:Checking
+
+2024/01/01 Bookstore
+    ; import-id: def
+    Expenses:Books  $20
+    Assets:Checking
+`
+
+func TestDedupe(t *testing.T) {
+	tests := []struct {
+		d        Dedupe
+		wantDups []string // "line->line (reason)"
+		want     []string // payees left in the output, in order
+	}{
+		{
+			Dedupe{},
+			nil,
+			[]string{"Coffee Shop", "Bookstore", "Bookstore", "COFFEE-SHOP", "Coffee Shop", "Books Inc"},
+		},
+		{
+			Dedupe{Mode: ReportDuplicates, Days: 2, Similarity: 0.8, IDTags: DefaultIDTags},
+			[]string{"5->1 (similar payee and amount)", "18->13 (same import-id)"},
+			[]string{"Coffee Shop", "Bookstore", "Bookstore", "COFFEE-SHOP", "Coffee Shop", "Books Inc"},
+		},
+		{
+			Dedupe{Mode: DropDuplicates, Days: 2, Similarity: 0.8, IDTags: DefaultIDTags},
+			[]string{"5->1 (similar payee and amount)", "18->13 (same import-id)"},
+			[]string{"Coffee Shop", "Bookstore", "Bookstore", "Coffee Shop"},
+		},
+		{
+			Dedupe{Mode: DropDuplicates, Days: 0, Similarity: 0.8, IDTags: DefaultIDTags},
+			[]string{"18->13 (same import-id)"},
+			[]string{"Coffee Shop", "Bookstore", "Bookstore", "COFFEE-SHOP", "Coffee Shop"},
+		},
+		{
+			Dedupe{Mode: DropDuplicates, Days: 10, Similarity: 1, IDTags: nil},
+			[]string{"23->13 (similar payee and amount)", "5->1 (similar payee and amount)", "9->1 (similar payee and amount)"},
+			[]string{"Coffee Shop", "Bookstore", "Books Inc"},
+		},
+	}
+	for i, test := range tests {
+		s := &Sorter{Dedupe: test.d}
+		lines, dups, err := s.sortLines(strings.Split(dedupeTest, "\n"))
+		if err != nil {
+			t.Fatalf("%d: sortLines() = err(%v)", i, err)
+		}
+
+		var gotDups []string
+		for _, d := range dups {
+			gotDups = append(gotDups, fmtDup(d))
+		}
+		if strings.Join(gotDups, ", ") != strings.Join(test.wantDups, ", ") {
+			t.Errorf("%d: sortLines() dups = %q, want %q", i, gotDups, test.wantDups)
+		}
+
+		var got []string
+		for _, l := range lines {
+			if strings.HasPrefix(l, "2024/") {
+				got = append(got, l[len("2024/01/01 "):])
+			}
+		}
+		if strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+			t.Errorf("%d: sortLines() payees = %q, want %q", i, got, test.want)
+		}
+	}
+}
+
+func TestDedupeComment(t *testing.T) {
+	in := "2024/01/01 x\n    a  $1\n    b\n\n2024/01/01 x\n    a  $1\n    b\n; note\n"
+	want := "2024/01/01 x\n    a  $1\n    b\n\n; 2024/01/01 x\n;     a  $1\n;     b\n; note\n"
+	s := &Sorter{Dedupe: Dedupe{Mode: CommentDuplicates, Similarity: 1}}
+	lines, dups, err := s.sortLines(strings.Split(in, "\n"))
+	if err != nil {
+		t.Fatalf("sortLines() = err(%v)", err)
+	}
+	if len(dups) != 1 {
+		t.Errorf("sortLines() found %d dups, want 1", len(dups))
+	}
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Errorf("sortLines() = %q, want %q", got, want)
+	}
+}
+
+func TestDedupeDrop(t *testing.T) {
+	in := "2024/01/01 x\n    a  $1\n    b\n\n2024/01/01 x\n    a  $1\n    b\n; note\n\n2024/01/02 y\n    a  $2\n    b\n"
+	want := "2024/01/01 x\n    a  $1\n    b\n\n; note\n\n2024/01/02 y\n    a  $2\n    b\n"
+	s := &Sorter{Dedupe: Dedupe{Mode: DropDuplicates, Similarity: 1}}
+	lines, dups, err := s.sortLines(strings.Split(in, "\n"))
+	if err != nil {
+		t.Fatalf("sortLines() = err(%v)", err)
+	}
+	if len(dups) != 1 {
+		t.Errorf("sortLines() found %d dups, want 1", len(dups))
+	}
+	if got := strings.Join(lines, "\n"); got != want {
+		t.Errorf("sortLines() = %q, want %q", got, want)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"abc", "abc", 1},
+		{"abcd", "abce", 0.75},
+		{"abc", "", 0},
+		{normalizePayee("AMAZON.COM*1A2B"), normalizePayee("Amazon.com 1a2b "), 1},
+	}
+	for _, test := range tests {
+		if got := similarity(test.a, test.b); got != test.want {
+			t.Errorf("similarity(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func fmtDup(d Duplicate) string {
+	return fmt.Sprintf("%d->%d (%s)", d.Transaction.StartLine(), d.Of.StartLine(), d.Reason)
+}
+
+func TestDedupePostingIDs(t *testing.T) {
+	in := "2024/01/01 a\n    Assets:A  $1\n    Assets:B\n    ; import-id: x\n\n2024/03/01 b\n    ; import-id: x\n    Assets:B  $-1\n    Income:Unknown\n"
+	s := &Sorter{Dedupe: Dedupe{Mode: ReportDuplicates, IDTags: DefaultIDTags}}
+	_, dups, err := s.sortLines(strings.Split(in, "\n"))
+	if err != nil {
+		t.Fatalf("sortLines() = err(%v)", err)
+	}
+	if len(dups) != 1 || fmtDup(dups[0]) != "6->1 (same import-id)" {
+		t.Errorf("sortLines() dups = %+v, want 6->1", dups)
+	}
+}
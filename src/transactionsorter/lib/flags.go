@@ -0,0 +1,31 @@
+package lib
+
+// enumflag IDs for the Sorter's settings, shared by the commands that sort
+// journals
+var (
+	DirectiveModeIDs = map[DirectiveMode][]string{
+		PinDirectives:   {"pin"},
+		HoistDirectives: {"hoist"},
+	}
+
+	DateKeyIDs = map[DateKey][]string{
+		PrimaryDate: {"primary"},
+		AuxDate:     {"aux", "auxiliary", "effective"},
+	}
+
+	SortKeyIDs = map[SortKey][]string{
+		PayeeKey:   {"payee"},
+		StateKey:   {"state", "cleared"},
+		CodeKey:    {"code", "check"},
+		AccountKey: {"account"},
+		AmountKey:  {"amount"},
+		TimeKey:    {"time"},
+	}
+
+	DedupeModeIDs = map[DedupeMode][]string{
+		NoDedupe:          {"none"},
+		ReportDuplicates:  {"report"},
+		DropDuplicates:    {"drop"},
+		CommentDuplicates: {"comment"},
+	}
+)
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+// SortKey is a tie-breaker used to order transactions that have the same
+// date.
+type SortKey int
+
+const (
+	PayeeKey SortKey = iota
+	// StateKey puts cleared transactions first, then pending, then uncleared.
+	StateKey
+	// CodeKey compares codes numerically if they're both numbers (e.g. check
+	// numbers), and as strings otherwise.
+	CodeKey
+	// AccountKey compares the first posting's account.
+	AccountKey
+	// AmountKey compares the first posting's amount, by commodity and then by
+	// quantity.
+	AmountKey
+	// TimeKey compares the value of the `time:` metadata tag.
+	TimeKey
+)
+
+// TimeTag is the metadata tag TimeKey sorts on.
+const TimeTag = "time"
+
+var timeFormats = []string{"15:04:05", "15:04"}
+
+// compareKey compares a and b by k. Transactions missing the relevant field
+// sort after ones that have it.
+func compareKey(k SortKey, a, b *journal.Transaction) int {
+	switch k {
+	case PayeeKey:
+		return strings.Compare(a.Payee, b.Payee)
+	case StateKey:
+		return int(b.State) - int(a.State)
+	case CodeKey:
+		return compareCodes(a.Code, b.Code)
+	case AccountKey:
+		return strings.Compare(firstAccount(a), firstAccount(b))
+	case AmountKey:
+		return compareAmounts(firstAmount(a), firstAmount(b))
+	case TimeKey:
+		return compareTimes(a, b)
+	}
+	return 0
+}
+
+func compareCodes(a, b string) int {
+	if c, done := compareMissing(a == "", b == ""); done {
+		return c
+	}
+	ai, aErr := strconv.ParseInt(a, 10, 64)
+	bi, bErr := strconv.ParseInt(b, 10, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func compareAmounts(a, b *journal.Amount) int {
+	if c, done := compareMissing(a == nil, b == nil); done {
+		return c
+	}
+	if c := strings.Compare(a.Commodity, b.Commodity); c != 0 {
+		return c
+	}
+	return a.Quantity.Cmp(b.Quantity)
+}
+
+func compareTimes(a, b *journal.Transaction) int {
+	at, aOK := a.Tags.Get(TimeTag)
+	bt, bOK := b.Tags.Get(TimeTag)
+	if c, done := compareMissing(!aOK, !bOK); done {
+		return c
+	}
+	ap, aErr := parseTime(at)
+	bp, bErr := parseTime(bt)
+	if aErr == nil && bErr == nil {
+		return ap.Compare(bp)
+	}
+	return strings.Compare(at, bt)
+}
+
+// compareMissing orders present values before missing ones. done is false if
+// both are present.
+func compareMissing(aMissing, bMissing bool) (c int, done bool) {
+	switch {
+	case aMissing && bMissing:
+		return 0, true
+	case aMissing:
+		return 1, true
+	case bMissing:
+		return -1, true
+	}
+	return 0, false
+}
+
+func parseTime(s string) (time.Time, error) {
+	var err error
+	for _, f := range timeFormats {
+		var t time.Time
+		t, err = time.Parse(f, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func firstAccount(t *journal.Transaction) string {
+	if len(t.Postings) == 0 {
+		return ""
+	}
+	return t.Postings[0].Account
+}
+
+// firstAmount returns the first posting's amount, or nil if it doesn't have a
+// numeric one.
+func firstAmount(t *journal.Transaction) *journal.Amount {
+	if len(t.Postings) == 0 || t.Postings[0].Amount == nil || t.Postings[0].Amount.Quantity == nil {
+		return nil
+	}
+	return t.Postings[0].Amount
+}
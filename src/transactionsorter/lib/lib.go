@@ -1,107 +1,312 @@
 package lib
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/glennhartmann/ledger-tools/src/diff"
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journal"
 )
 
-func SortFile(path string) error {
+var (
+	// overridable for testing
+	outWriter io.Writer = os.Stdout
+
+	// ErrNotSorted is returned by SortFile in Check mode if the file isn't
+	// already sorted.
+	ErrNotSorted = errors.New("file is not sorted")
+)
+
+// DirectiveMode controls what happens to top-level directives (and
+// automated/periodic transactions) when sorting.
+type DirectiveMode int
+
+const (
+	// PinDirectives keeps directives where they are. Transactions are sorted
+	// around them, but only among the other transactions between the same two
+	// order-sensitive directives (see Separates).
+	PinDirectives DirectiveMode = iota
+	// HoistDirectives moves directives to the top of the file (after any
+	// leading comments), keeping their relative order, and sorts transactions
+	// across the whole file. Scoped directives (see IsScoped) can't be moved
+	// without changing the meaning of the file, so they stay pinned.
+	HoistDirectives
+)
+
+// DateKey selects which of a transaction's dates to sort by.
+type DateKey int
+
+const (
+	PrimaryDate DateKey = iota
+	// AuxDate sorts by the auxiliary (aka effective) date, falling back to the
+	// primary date for transactions that don't have one.
+	AuxDate
+)
+
+type Sorter struct {
+	Directives DirectiveMode
+	Date       DateKey
+	// Keys are used, in order, to break ties between transactions with the
+	// same date. Any remaining ties keep their original order.
+	Keys []SortKey
+	// Reverse sorts newest-first (and reverses all the Keys too).
+	Reverse bool
+
+	// Dedupe configures detection of likely duplicate transactions.
+	Dedupe Dedupe
+
+	// If any of Check, Diff or Stdout are set, the file is left untouched.
+	// Check makes SortFile return ErrNotSorted if sorting would change the
+	// file. Diff prints a unified diff of what sorting would change, and
+	// Stdout prints the sorted file.
+	Check  bool
+	Diff   bool
+	Stdout bool
+
+	// Backups is the number of backup copies of the original file to keep
+	// when sorting in-place.
+	Backups int
+}
+
+// SortFile sorts the journal at path. It returns any duplicate transactions
+// found (if s.Dedupe is enabled), even if it also returns ErrNotSorted.
+func (s *Sorter) SortFile(path string) ([]Duplicate, error) {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("ioutil.ReadFile: %v", err)
+		return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
 	}
 
 	lines := strings.Split(string(b), "\n")
 	if len(lines) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	sortedLines, err := sortLines(lines)
+	sortedLines, dups, err := s.sortLines(lines)
 	if err != nil {
-		return fmt.Errorf("sortLines(): %v", err)
+		return nil, fmt.Errorf("sortLines(): %v", err)
 	}
+	sorted := strings.Join(sortedLines, "\n")
 
-	if err := ioutil.WriteFile(path, []byte(strings.Join(sortedLines, "\n")), 0644); err != nil {
-		return fmt.Errorf("ioutil.WriteFile(): %v", err)
+	if !s.Check && !s.Diff && !s.Stdout {
+		if err := fs.WriteFileAtomic(path, []byte(sorted), 0644, s.Backups); err != nil {
+			return nil, fmt.Errorf("fs.WriteFileAtomic(): %v", err)
+		}
+		return dups, nil
 	}
 
-	return nil
+	if s.Diff {
+		if _, err := io.WriteString(outWriter, diff.Unified(path, path+" (sorted)", string(b), sorted)); err != nil {
+			return nil, fmt.Errorf("io.WriteString(diff): %v", err)
+		}
+	}
+	if s.Stdout {
+		if _, err := io.WriteString(outWriter, sorted); err != nil {
+			return nil, fmt.Errorf("io.WriteString(sorted): %v", err)
+		}
+	}
+	if s.Check && sorted != string(b) {
+		return dups, ErrNotSorted
+	}
+	return dups, nil
 }
 
-func sortLines(lines []string) ([]string, error) {
-	hunks := make(sortableHunks, 0, 50 /* arbitrary */)
+// AddToFile adds transactions (the text of a journal, eg from an importer)
+// to the journal at path, which is then sorted and replaced atomically. path
+// doesn't have to exist yet. Check, Diff and Stdout are ignored. It returns
+// any duplicate transactions found. Only the new transactions are checked
+// for duplicates, and only against the existing ones, which are never
+// dropped or commented out.
+func (s *Sorter) AddToFile(path, transactions string) ([]Duplicate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
 
-	curHunk, linesUsed := startFirstHunk(lines[0])
-	line := ""
-	i := linesUsed
-	expectDate := true
-	for {
-		if i >= len(lines) {
-			break
-		}
-		line = lines[i]
+	existing := string(b)
+	if existing != "" && !strings.HasSuffix(existing, "\n\n") {
+		// keep the last existing transaction separate from the new ones
+		existing = strings.TrimSuffix(existing, "\n") + "\n\n"
+	}
+	j, err := journal.ParseLines(strings.Split(existing+transactions, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("journal.ParseLines(): %v", err)
+	}
+	lines, dups := s.sortBlocks(j.Blocks, strings.Count(existing, "\n")+1)
+	sorted := strings.Join(lines, "\n")
+	if err := fs.WriteFileAtomic(path, []byte(sorted), 0644, s.Backups); err != nil {
+		return nil, fmt.Errorf("fs.WriteFileAtomic(): %v", err)
+	}
+	return dups, nil
+}
 
-		if expectDate {
-			var err error
-			curHunk, i, hunks, expectDate, err = expectDateFlow(line, curHunk, i, hunks)
-			if err != nil {
-				return nil, fmt.Errorf("expectDateFlow(): %v", err)
-			}
-			continue
-		}
+// SortString is like SortFile, but sorts the journal in str and returns it.
+func (s *Sorter) SortString(str string) (string, []Duplicate, error) {
+	sorted, dups, err := s.sortLines(strings.Split(str, "\n"))
+	if err != nil {
+		return "", nil, fmt.Errorf("sortLines(): %v", err)
+	}
+	return strings.Join(sorted, "\n"), dups, nil
+}
+
+func (s *Sorter) sortLines(lines []string) ([]string, []Duplicate, error) {
+	j, err := journal.ParseLines(lines)
+	if err != nil {
+		return nil, nil, fmt.Errorf("journal.ParseLines(): %v", err)
+	}
+	sorted, dups := s.SortBlocks(j.Blocks)
+	return sorted, dups, nil
+}
 
-		curHunk.lines = append(curHunk.lines, line)
-		i++
+// SortBlocks returns the lines of blocks in sorted order, along with any
+// duplicates found.
+func (s *Sorter) SortBlocks(blocks []journal.Block) ([]string, []Duplicate) {
+	return s.sortBlocks(blocks, 0)
+}
+
+// sortBlocks is like SortBlocks, but if newFrom is positive, the blocks that
+// start before that line are existing ones, which are only used to find
+// duplicates of the rest (see Dedupe.dedupe).
+func (s *Sorter) sortBlocks(blocks []journal.Block, newFrom int) ([]string, []Duplicate) {
+	n := 0
+	for _, b := range blocks {
+		n += len(b.Lines())
+	}
+	hunks, dups := s.Dedupe.dedupe(s.arrange(s.makeHunks(blocks)), newFrom)
+	return flattenHunks(hunks, n), dups
+}
 
-		if isWhitespace(line) {
-			expectDate = true
+// makeHunks groups blocks into hunks: each transaction or directive, plus
+// whatever comments, blank lines, etc follow it. Anything before the first
+// of those goes into a leading hunk, which is always returned (even if
+// empty) as the first element.
+func (s *Sorter) makeHunks(blocks []journal.Block) []hunk {
+	hunks := make([]hunk, 0, 50 /* arbitrary */)
+	curHunk := hunk{date: time.Unix(0, 0)}
+	for _, b := range blocks {
+		if isAnchor(b) {
+			hunks = append(hunks, curHunk)
+			curHunk = hunk{lines: make([]string, 0, 5 /* arbitrary */), anchor: b}
+			if t, ok := b.(*journal.Transaction); ok {
+				curHunk.date = s.date(t)
+			}
 		}
+		curHunk.lines = append(curHunk.lines, b.Lines()...)
 	}
-	hunks = append(hunks, curHunk)
+	return append(hunks, curHunk)
+}
 
-	sort.Stable(hunks)
-	return flattenHunks(hunks, len(lines)), nil
+func (s *Sorter) date(t *journal.Transaction) time.Time {
+	if s.Date == AuxDate {
+		return t.AuxDateOrDate()
+	}
+	return t.Date
 }
 
-func expectDateFlow(line string, curHunk hunk, i int, hunks []hunk) (hunk, int, []hunk, bool, error) {
-	expectDate := true
+// arrange puts the output of makeHunks into sorted order.
+func (s *Sorter) arrange(hunks []hunk) []hunk {
+	out := make([]hunk, 0, len(hunks))
+	out = append(out, hunks[0])
+	rest := hunks[1:]
 
-	if isWhitespaceOrCommentOrIgnorable(line) {
-		curHunk.lines = append(curHunk.lines, line)
-		i++
-	} else {
-		date, err := getDate(line)
-		if err != nil {
-			return hunk{}, 0, nil, false, fmt.Errorf("line %d: getDate(): %v", i, err)
+	if s.Directives == HoistDirectives {
+		kept := make([]hunk, 0, len(rest))
+		for _, h := range rest {
+			if d, ok := h.anchor.(*journal.Directive); ok && !IsScoped(d) {
+				out = append(out, h)
+			} else {
+				kept = append(kept, h)
+			}
 		}
+		rest = kept
+	}
 
-		hunks = append(hunks, curHunk)
-		curHunk = hunk{date, make([]string, 0, 5 /* arbitrary */)}
-		expectDate = false
+	var run []hunk
+	flush := func() {
+		// directives in the run keep their places, and the transactions are
+		// sorted around them
+		hs := &hunkSorter{hunks: make([]hunk, 0, len(run)), keys: s.Keys, reverse: s.Reverse}
+		for _, h := range run {
+			if _, ok := h.anchor.(*journal.Directive); !ok {
+				hs.hunks = append(hs.hunks, h)
+			}
+		}
+		sort.Stable(hs)
+		i := 0
+		for _, h := range run {
+			if _, ok := h.anchor.(*journal.Directive); !ok {
+				h = hs.hunks[i]
+				i++
+			}
+			out = append(out, h)
+		}
+		run = run[:0]
+	}
+	for _, h := range rest {
+		if !s.Separates(h.anchor) {
+			run = append(run, h)
+			continue
+		}
+		flush()
+		out = append(out, h)
 	}
+	flush()
+	return out
+}
+
+// Compare compares a and b the way they're sorted: by date, then by each of
+// the Keys, all reversed if Reverse is set. It returns 0 if they tie.
+func (s *Sorter) Compare(a, b *journal.Transaction) int {
+	hs := &hunkSorter{keys: s.Keys}
+	c := hs.compare(hunk{date: s.date(a), anchor: a}, hunk{date: s.date(b), anchor: b})
+	if s.Reverse {
+		return -c
+	}
+	return c
+}
 
-	return curHunk, i, hunks, expectDate, nil
+// Separates reports whether transactions aren't sorted across b: b is an
+// order-sensitive directive (a scoped one, see IsScoped, or an `include`), or
+// an automated or periodic transaction. Other directives, like `account` or
+// `P`, are either hoisted or pinned in place with transactions sorted around
+// them.
+func (s *Sorter) Separates(b journal.Block) bool {
+	switch b := b.(type) {
+	case *journal.Transaction:
+		return false
+	case *journal.Directive:
+		return IsScoped(b) || b.Name == "include"
+	}
+	return isAnchor(b)
 }
 
-func startFirstHunk(line string) (curHunk hunk, linesUsed int) {
-	if isWhitespaceOrCommentOrIgnorable(line) {
-		curHunk.date = time.Unix(0, 0)
-		curHunk.lines = append(curHunk.lines, line)
-		return curHunk, 1
+// isAnchor reports whether b starts a new hunk.
+func isAnchor(b journal.Block) bool {
+	switch b.(type) {
+	case *journal.Transaction, *journal.Directive, *journal.AutomatedTransaction, *journal.PeriodicTransaction:
+		return true
 	}
-	return curHunk, 0
+	return false
 }
 
-func getDate(line string) (time.Time, error) {
-	i := strings.IndexAny(line, " \t")
-	if i < 0 {
-		return time.Time{}, fmt.Errorf("no whitespace found")
+// IsScoped reports whether d affects how the lines after it are interpreted,
+// so that moving it relative to transactions would change their meaning.
+func IsScoped(d *journal.Directive) bool {
+	switch {
+	case strings.HasPrefix(d.Name, "apply "), d.Name == "end", strings.HasPrefix(d.Name, "end "):
+		return true
+	}
+	switch d.Name {
+	case "year", "Y", "A", "bucket", "D":
+		return true
 	}
-	ds := line[:i]
-	return time.Parse("2006/01/02", ds)
+	return false
 }
 
 func flattenHunks(hunks []hunk, size int) []string {
@@ -115,30 +320,48 @@ func flattenHunks(hunks []hunk, size int) []string {
 type hunk struct {
 	date  time.Time
 	lines []string
+	// anchor is the transaction or directive the hunk starts with, or nil for
+	// the leading hunk.
+	anchor journal.Block
 }
 
-type sortableHunks []hunk
-
-func (sh sortableHunks) Len() int {
-	return len(sh)
+// hunkSorter sorts transaction hunks.
+type hunkSorter struct {
+	hunks   []hunk
+	keys    []SortKey
+	reverse bool
 }
 
-func (sh sortableHunks) Less(i, j int) bool {
-	return sh[i].date.Before(sh[j].date)
+func (hs *hunkSorter) Len() int {
+	return len(hs.hunks)
 }
 
-func (sh sortableHunks) Swap(i, j int) {
-	t := sh[i]
-	sh[i] = sh[j]
-	sh[j] = t
+func (hs *hunkSorter) Less(i, j int) bool {
+	if hs.reverse {
+		i, j = j, i
+	}
+	return hs.compare(hs.hunks[i], hs.hunks[j]) < 0
 }
 
-func isWhitespace(s string) bool {
-	return strings.TrimSpace(s) == ""
+func (hs *hunkSorter) compare(a, b hunk) int {
+	if c := a.date.Compare(b.date); c != 0 {
+		return c
+	}
+	at, aOK := a.anchor.(*journal.Transaction)
+	bt, bOK := b.anchor.(*journal.Transaction)
+	if !aOK || !bOK {
+		return 0
+	}
+	for _, k := range hs.keys {
+		if c := compareKey(k, at, bt); c != 0 {
+			return c
+		}
+	}
+	return 0
 }
 
-func isWhitespaceOrCommentOrIgnorable(s string) bool {
-	s2 := strings.TrimSpace(s)
-	return s2 == "" || strings.HasPrefix(s2, ";") ||
-		strings.HasPrefix(s, "apply") || strings.HasPrefix(s, "end apply")
+func (hs *hunkSorter) Swap(i, j int) {
+	t := hs.hunks[i]
+	hs.hunks[i] = hs.hunks[j]
+	hs.hunks[j] = t
 }
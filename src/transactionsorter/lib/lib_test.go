@@ -3,9 +3,18 @@ package lib
 import (
 	"testing"
 
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
+
+	"github.com/prashantv/gostub"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/journal"
 )
 
 func TestSortLines(t *testing.T) {
@@ -23,9 +32,12 @@ func TestSortLines(t *testing.T) {
 		{
 			overallTest3, overallTest3Want, false,
 		},
+		{
+			"\n2020/13/45 bad date\n    x\n", "", true,
+		},
 	}
 	for i, test := range tests {
-		splitGot, err := sortLines(strings.Split(test.in, "\n"))
+		splitGot, _, err := (&Sorter{}).sortLines(strings.Split(test.in, "\n"))
 		if (err != nil) != test.wantErr {
 			t.Errorf("%d: sortLines() = err(%v), want non-nil error %v", i, err, test.wantErr)
 		}
@@ -38,237 +50,292 @@ func TestSortLines(t *testing.T) {
 	}
 }
 
-func TestExpectDateFlow(t *testing.T) {
+func TestSortFile(t *testing.T) {
 	tests := []struct {
-		line           string
-		curHunk        hunk
-		i              int
-		hunks          []hunk
-		wantHunk       hunk
-		wantI          int
-		wantHunks      []hunk
-		wantExpectDate bool
-		wantErr        bool
+		s          Sorter
+		in         string
+		wantFile   string
+		wantOut    string
+		wantErr    error
+		wantAnyErr bool
 	}{
-		{
-			line:           "",
-			curHunk:        hunk{},
-			i:              5,
-			hunks:          []hunk{},
-			wantHunk:       hunk{lines: []string{""}},
-			wantI:          6,
-			wantHunks:      []hunk{},
-			wantExpectDate: true,
-			wantErr:        false,
-		},
-		{
-			line:           "   ;  ",
-			curHunk:        hunk{time.Unix(5, 5), []string{"f"}},
-			i:              8,
-			hunks:          []hunk{},
-			wantHunk:       hunk{time.Unix(5, 5), []string{"f", "   ;  "}},
-			wantI:          9,
-			wantHunks:      []hunk{},
-			wantExpectDate: true,
-			wantErr:        false,
-		},
-		{
-			line:           "bad",
-			curHunk:        hunk{time.Unix(5, 5), []string{"f"}},
-			i:              8,
-			hunks:          []hunk{},
-			wantHunk:       hunk{},
-			wantI:          0,
-			wantHunks:      nil,
-			wantExpectDate: false,
-			wantErr:        true,
-		},
-		{
-			line:           "2020/02/07 ",
-			curHunk:        hunk{time.Unix(5, 5), []string{"f"}},
-			i:              1,
-			hunks:          []hunk{hunk{}},
-			wantHunk:       hunk{time.Date(2020, time.February, 7, 0, 0, 0, 0, time.FixedZone("UTC", 0)), []string{}},
-			wantI:          1,
-			wantHunks:      []hunk{hunk{}, hunk{time.Unix(5, 5), []string{"f"}}},
-			wantExpectDate: false,
-			wantErr:        false,
-		},
+		{Sorter{}, overallTest2, overallTest1, "", nil, false},
+		{Sorter{Check: true}, overallTest1, overallTest1, "", nil, false},
+		{Sorter{Check: true}, overallTest2, overallTest2, "", ErrNotSorted, true},
+		{Sorter{Stdout: true}, overallTest2, overallTest2, overallTest1, nil, false},
+		{Sorter{Diff: true}, overallTest1, overallTest1, "", nil, false},
+		{Sorter{Diff: true, Check: true}, sortFileTest, sortFileTest, sortFileTestDiff, ErrNotSorted, true},
+		{Sorter{}, "2020/13/01 x\n", "2020/13/01 x\n", "", nil, true},
 	}
-	for j, test := range tests {
-		hunk, i, hunks, expectDate, err := expectDateFlow(test.line, test.curHunk, test.i, test.hunks)
-		if !hunk.date.Equal(test.wantHunk.date) || !reflect.DeepEqual(hunk.lines, test.wantHunk.lines) ||
-			i != test.wantI || !reflect.DeepEqual(hunks, test.wantHunks) ||
-			expectDate != test.wantExpectDate || (err != nil) != test.wantErr {
-			t.Errorf("%d: expectDateFlow() = %v, %d, %v, %v, %v", j, hunk, i, hunks, expectDate, err)
+	for i, test := range tests {
+		stubs := gostub.New()
+		var b bytes.Buffer
+		stubs.Stub(&outWriter, &b)
+
+		path := filepath.Join(t.TempDir(), "test.ledger")
+		if err := ioutil.WriteFile(path, []byte(test.in), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
 		}
+
+		_, err := test.s.SortFile(path)
+		if (err != nil) != test.wantAnyErr || (test.wantErr != nil && err != test.wantErr) {
+			t.Errorf("%d: SortFile() = err(%v), want %v", i, err, test.wantErr)
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile() = err(%v)", err)
+		}
+		if string(got) != test.wantFile {
+			t.Errorf("%d: SortFile() left file as %s, want %s", i, got, test.wantFile)
+		}
+		wantOut := strings.ReplaceAll(test.wantOut, "PATH", path)
+		if b.String() != wantOut {
+			t.Errorf("%d: SortFile() printed %s, want %s", i, b.String(), wantOut)
+		}
+		stubs.Reset()
 	}
 }
 
-func TestStartFirstHunk(t *testing.T) {
+func TestSortFileBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.ledger")
+	if err := ioutil.WriteFile(path, []byte(overallTest2), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	if _, err := (&Sorter{Backups: 1}).SortFile(path); err != nil {
+		t.Fatalf("SortFile() = err(%v)", err)
+	}
+	if got, err := ioutil.ReadFile(path); err != nil || string(got) != overallTest1 {
+		t.Errorf("SortFile() left file as %s (err(%v)), want %s", got, err, overallTest1)
+	}
+	if got, err := ioutil.ReadFile(fs.BackupName(path, 0)); err != nil || string(got) != overallTest2 {
+		t.Errorf("backup contains %s (err(%v)), want %s", got, err, overallTest2)
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0600 {
+		t.Errorf("os.Stat() = %v, err(%v), want mode 0600", st.Mode(), err)
+	}
+}
+
+func TestAddToFile(t *testing.T) {
 	tests := []struct {
-		line  string
-		wantH hunk
-		wantI int
+		existing     string
+		transactions string
+		want         string
 	}{
+		{"", "2024/01/02 b\n    a  1\n    b\n", "2024/01/02 b\n    a  1\n    b\n"},
 		{
-			"", hunk{time.Unix(0, 0), []string{""}}, 1,
-		},
-		{
-			"          ", hunk{time.Unix(0, 0), []string{"          "}}, 1,
-		},
-		{
-			"    ;      ", hunk{time.Unix(0, 0), []string{"    ;      "}}, 1,
-		},
-		{
-			"f", hunk{}, 0,
+			"2024/01/03 c\n    a  1\n    b",
+			"2024/01/01 a\n    a  1\n    b\n",
+			"2024/01/01 a\n    a  1\n    b\n\n2024/01/03 c\n    a  1\n    b\n",
 		},
 	}
-	for _, test := range tests {
-		h, i := startFirstHunk(test.line)
-		if !reflect.DeepEqual(h, test.wantH) {
-			t.Errorf("startFirstHunk(%s) = h(%v), want h(%v)", test.line, h, test.wantH)
+	for i, test := range tests {
+		path := filepath.Join(t.TempDir(), "test.ledger")
+		if test.existing != "" {
+			if err := ioutil.WriteFile(path, []byte(test.existing), 0644); err != nil {
+				t.Fatalf("%d: ioutil.WriteFile() = err(%v)", i, err)
+			}
+		}
+		s := &Sorter{}
+		if _, err := s.AddToFile(path, test.transactions); err != nil {
+			t.Errorf("%d: AddToFile() = err(%v)", i, err)
+			continue
 		}
-		if i != test.wantI {
-			t.Errorf("startFirstHunk(%s) = i(%d), want i(%d)", test.line, i, test.wantI)
+		if got, err := ioutil.ReadFile(path); err != nil || string(got) != test.want {
+			t.Errorf("%d: AddToFile() left file as %q, err(%v), want %q", i, got, err, test.want)
 		}
 	}
 }
 
-func TestGetDate(t *testing.T) {
+func TestAddToFileDedupe(t *testing.T) {
+	// the existing file has a pair of duplicates of its own, which are left
+	// alone, and the new transactions include a pair that are only
+	// duplicates of each other, which are both kept
+	existing := "2024/01/03 Coffee\n    a  $3\n    b\n\n2024/01/03 Coffee\n    a  $3\n    b\n"
+	transactions := "2024/01/02 Coffee\n    a  $3\n    b\n\n2024/01/09 Lunch\n    a  $9\n    b\n\n2024/01/09 Lunch\n    a  $9\n    b\n"
+	want := "2024/01/03 Coffee\n    a  $3\n    b\n\n2024/01/03 Coffee\n    a  $3\n    b\n\n" +
+		"2024/01/09 Lunch\n    a  $9\n    b\n\n2024/01/09 Lunch\n    a  $9\n    b\n"
+
+	path := filepath.Join(t.TempDir(), "test.ledger")
+	if err := ioutil.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+	}
+	s := &Sorter{Dedupe: Dedupe{Mode: DropDuplicates, Days: 2, Similarity: 1}}
+	dups, err := s.AddToFile(path, transactions)
+	if err != nil {
+		t.Fatalf("AddToFile() = err(%v)", err)
+	}
+	if len(dups) != 1 || dups[0].Transaction.StartLine() != 9 {
+		t.Errorf("AddToFile() dups = %+v, want just the new 2024/01/02 Coffee", dups)
+	}
+	if got, err := ioutil.ReadFile(path); err != nil || string(got) != want {
+		t.Errorf("AddToFile() left file as %q, err(%v), want %q", got, err, want)
+	}
+}
+
+func TestSortLinesDirectives(t *testing.T) {
 	tests := []struct {
-		line    string
-		want    time.Time
-		wantErr bool
+		mode    DirectiveMode
+		in      string
+		wantOut string
 	}{
-		{
-			"", time.Time{}, true,
-		},
-		{
-			" ", time.Time{}, true,
-		},
-		{
-			"f", time.Time{}, true,
-		},
-		{
-			"f ", time.Time{}, true,
-		},
-		{
-			"2020/02/07", time.Time{}, true,
-		},
-		{
-			"2020/02/07 ", time.Date(2020, time.February, 7, 0, 0, 0, 0, time.FixedZone("UTC", 0)), false,
-		},
+		{PinDirectives, directivesTest, directivesTestWantPin},
+		{HoistDirectives, directivesTest, directivesTestWantHoist},
+		{PinDirectives, pricesTest, pricesTestWantPin},
+		{PinDirectives, includeTest, includeTest},
 	}
-	for _, test := range tests {
-		d, err := getDate(test.line)
-		if (err != nil) != test.wantErr {
-			t.Errorf("getDate(%s) = err(%v), want non-nil error: %v", test.line, err, test.wantErr)
+	for i, test := range tests {
+		s := &Sorter{Directives: test.mode}
+		splitGot, _, err := s.sortLines(strings.Split(test.in, "\n"))
+		if err != nil {
+			t.Errorf("%d: sortLines() = err(%v)", i, err)
+			continue
 		}
-		if err == nil {
-			if !d.Equal(test.want) {
-				t.Errorf("getDate(%s) = %v, want %v", test.line, d, test.want)
-			}
+		if got := strings.Join(splitGot, "\n"); got != test.wantOut {
+			t.Errorf("%d: sortLines() = %s, want %s", i, got, test.wantOut)
 		}
 	}
 }
 
-func TestFlattenHunks(t *testing.T) {
-	h := []hunk{
-		hunk{time.Time{}, []string{"a", "b", "c"}},
-		hunk{time.Time{}, []string{"d", "e"}},
-		hunk{time.Time{}, []string{"f"}},
+func TestSortLinesDates(t *testing.T) {
+	tests := []struct {
+		date    DateKey
+		in      string
+		wantOut string
+	}{
+		{PrimaryDate, datesTest, datesTestWantPrimary},
+		{AuxDate, datesTest, datesTestWantAux},
 	}
-	fh := flattenHunks(h, 6)
-	if !reflect.DeepEqual(fh, []string{"a", "b", "c", "d", "e", "f"}) {
-		t.Errorf("flattenHunks() failed, and I don't want to be helpful")
+	for i, test := range tests {
+		s := &Sorter{Date: test.date}
+		splitGot, _, err := s.sortLines(strings.Split(test.in, "\n"))
+		if err != nil {
+			t.Errorf("%d: sortLines() = err(%v)", i, err)
+			continue
+		}
+		if got := strings.Join(splitGot, "\n"); got != test.wantOut {
+			t.Errorf("%d: sortLines() = %s, want %s", i, got, test.wantOut)
+		}
 	}
 }
 
-func TestIsWhitespace(t *testing.T) {
+func TestSortLinesKeys(t *testing.T) {
 	tests := []struct {
-		s    string
-		want bool
+		keys    []SortKey
+		reverse bool
+		want    []string
 	}{
-		{
-			"", true,
-		},
-		{
-			"    	  ", true,
-		},
-		{
-			"    	  \n", true,
-		},
-		{
-			"   ; 	  \n", false,
-		},
-		{
-			";", false,
-		},
-		{
-			"; sdkfj asldkf jsldkfj", false,
-		},
-		{
-			" sdkfj asldkf jsldkfj", false,
-		},
-		{
-			"apply tag asdfsdf", false,
-		},
-		{
-			"end apply tag asdfsdf", false,
-		},
+		{nil, false, []string{"z", "b", "a", "c", "y"}},
+		{[]SortKey{PayeeKey}, false, []string{"z", "a", "b", "c", "y"}},
+		{[]SortKey{StateKey, PayeeKey}, false, []string{"z", "a", "c", "b", "y"}},
+		{[]SortKey{CodeKey}, false, []string{"z", "c", "a", "b", "y"}},
+		{[]SortKey{AccountKey}, false, []string{"z", "a", "c", "b", "y"}},
+		{[]SortKey{AmountKey}, false, []string{"z", "b", "a", "c", "y"}},
+		{[]SortKey{TimeKey}, false, []string{"z", "a", "b", "c", "y"}},
+		{nil, true, []string{"y", "b", "a", "c", "z"}},
+		{[]SortKey{PayeeKey}, true, []string{"y", "c", "b", "a", "z"}},
+	}
+	for i, test := range tests {
+		s := &Sorter{Keys: test.keys, Reverse: test.reverse}
+		splitGot, _, err := s.sortLines(strings.Split(keysTest, "\n"))
+		if err != nil {
+			t.Errorf("%d: sortLines() = err(%v)", i, err)
+			continue
+		}
+		j, err := journal.ParseLines(splitGot)
+		if err != nil {
+			t.Errorf("%d: journal.ParseLines() = err(%v)", i, err)
+			continue
+		}
+		var got []string
+		for _, x := range j.Transactions() {
+			got = append(got, x.Payee)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: sortLines() order = %q, want %q", i, got, test.want)
+		}
 	}
+}
 
+func TestCompareCodes(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"9", "10", -1},
+		{"10", "9", 1},
+		{"10", "10", 0},
+		{"abc", "abd", -1},
+		{"", "1", 1},
+		{"1", "", -1},
+		{"", "", 0},
+	}
 	for _, test := range tests {
-		got := isWhitespace(test.s)
-		if got != test.want {
-			t.Errorf("isWhitespace(%s) = %v, want %v", test.s, got, test.want)
+		if got := compareCodes(test.a, test.b); got != test.want {
+			t.Errorf("compareCodes(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
 		}
 	}
 }
 
-func TestIsWhitespaceOrCommentOrIgnorable(t *testing.T) {
+func TestIsScoped(t *testing.T) {
 	tests := []struct {
-		s    string
+		name string
 		want bool
 	}{
-		{
-			"", true,
-		},
-		{
-			"    	  ", true,
-		},
-		{
-			"    	  \n", true,
-		},
-		{
-			"   ; 	  \n", true,
-		},
-		{
-			";", true,
-		},
-		{
-			"; sdkfj asldkf jsldkfj", true,
-		},
-		{
-			" sdkfj asldkf jsldkfj", false,
-		},
-		{
-			"apply tag asdfsdf", true,
-		},
-		{
-			"end apply tag asdfsdf", true,
-		},
+		{"apply account", true},
+		{"end apply account", true},
+		{"end", true},
+		{"year", true},
+		{"Y", true},
+		{"account", false},
+		{"commodity", false},
+		{"alias", false},
+		{"define", false},
+		{"P", false},
 	}
-
 	for _, test := range tests {
-		got := isWhitespaceOrCommentOrIgnorable(test.s)
-		if got != test.want {
-			t.Errorf("isWhitespaceOrCommentOrIgnorable(%s) = %v, want %v", test.s, got, test.want)
+		if got := IsScoped(&journal.Directive{Name: test.name}); got != test.want {
+			t.Errorf("IsScoped(%s) = %v, want %v", test.name, got, test.want)
 		}
 	}
 }
 
+func TestMakeHunks(t *testing.T) {
+	j, err := journal.Parse(makeHunksTest)
+	if err != nil {
+		t.Fatalf("journal.Parse() = err(%v)", err)
+	}
+	want := []hunk{
+		hunk{date: time.Unix(0, 0), lines: []string{"; header", ""}},
+		hunk{date: time.Date(2020, time.February, 7, 0, 0, 0, 0, time.UTC), lines: []string{"2020/02/07 a", "    x  $1", "    y", "", "; trailing", ""}},
+		hunk{lines: []string{"account Assets:Cash", "    note cash", ""}},
+		hunk{date: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC), lines: []string{"2019/01/01 b", "    x", ""}},
+	}
+	got := (&Sorter{}).makeHunks(j.Blocks)
+	if len(got) != len(want) {
+		t.Fatalf("makeHunks() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].date.Equal(want[i].date) || !reflect.DeepEqual(got[i].lines, want[i].lines) {
+			t.Errorf("%d: makeHunks() = %v, want %v", i, got[i], want[i])
+		}
+		if (got[i].anchor == nil) != (i == 0) {
+			t.Errorf("%d: makeHunks().anchor = %v", i, got[i].anchor)
+		}
+	}
+}
+
+func TestFlattenHunks(t *testing.T) {
+	h := []hunk{
+		hunk{lines: []string{"a", "b", "c"}},
+		hunk{lines: []string{"d", "e"}},
+		hunk{lines: []string{"f"}},
+	}
+	fh := flattenHunks(h, 6)
+	if !reflect.DeepEqual(fh, []string{"a", "b", "c", "d", "e", "f"}) {
+		t.Errorf("flattenHunks() failed, and I don't want to be helpful")
+	}
+}
+
 const (
 	overallTest1 = `
 ; vim:filetype=ledger
@@ -400,5 +467,249 @@ asdf
 
 
 
+`
+
+	makeHunksTest = `; header
+
+2020/02/07 a
+    x  $1
+    y
+
+; trailing
+
+account Assets:Cash
+    note cash
+
+2019/01/01 b
+    x
+`
+
+	directivesTest = `; accounts
+account Assets:Cash
+alias cash=Assets:Cash
+
+2020/03/01 c
+    cash  $3
+    Income
+
+2020/01/01 a
+    cash  $1
+    Income
+
+commodity CAD
+
+apply account Personal
+2020/05/01 e
+    cash  $5
+    Income
+
+2020/04/01 d
+    cash  $4
+    Income
+
+end apply account
+
+2020/02/01 b
+    cash  $2
+    Income
+`
+
+	directivesTestWantPin = `; accounts
+account Assets:Cash
+alias cash=Assets:Cash
+
+2020/01/01 a
+    cash  $1
+    Income
+
+2020/03/01 c
+    cash  $3
+    Income
+
+commodity CAD
+
+apply account Personal
+2020/04/01 d
+    cash  $4
+    Income
+
+2020/05/01 e
+    cash  $5
+    Income
+
+end apply account
+
+2020/02/01 b
+    cash  $2
+    Income
+`
+
+	directivesTestWantHoist = `; accounts
+account Assets:Cash
+alias cash=Assets:Cash
+
+commodity CAD
+
+2020/01/01 a
+    cash  $1
+    Income
+
+2020/03/01 c
+    cash  $3
+    Income
+
+apply account Personal
+2020/04/01 d
+    cash  $4
+    Income
+
+2020/05/01 e
+    cash  $5
+    Income
+
+end apply account
+
+2020/02/01 b
+    cash  $2
+    Income
+`
+
+	pricesTest = `2024/01/03 c
+    x  $3
+    y
+
+P 2024/01/03 AAPL $185
+
+2024/01/01 a
+    x  $1
+    y
+
+P 2024/01/01 AAPL $184
+
+2024/01/02 b
+    x  $2
+    y
+`
+
+	pricesTestWantPin = `2024/01/01 a
+    x  $1
+    y
+
+P 2024/01/03 AAPL $185
+
+2024/01/02 b
+    x  $2
+    y
+
+P 2024/01/01 AAPL $184
+
+2024/01/03 c
+    x  $3
+    y
+`
+
+	includeTest = `2024/01/03 c
+    x  $3
+    y
+
+include other.ledger
+
+2024/01/01 a
+    x  $1
+    y
+`
+
+	datesTest = `year 2019
+
+2020-03-01 c
+    x  $3
+    y
+
+02/01=2020.04.01 b
+    x  $2
+    y
+
+2020.1.15=02/15 a
+    x  $1
+    y
+`
+
+	datesTestWantPrimary = `year 2019
+
+02/01=2020.04.01 b
+    x  $2
+    y
+
+2020.1.15=02/15 a
+    x  $1
+    y
+
+2020-03-01 c
+    x  $3
+    y
+`
+
+	datesTestWantAux = `year 2019
+
+2020.1.15=02/15 a
+    x  $1
+    y
+
+2020-03-01 c
+    x  $3
+    y
+
+02/01=2020.04.01 b
+    x  $2
+    y
+`
+
+	keysTest = `2020/01/02 z
+    Assets  $1
+    Income
+
+2020/01/05 b
+    ; time: 14:00
+    Expenses:Food  $2.50
+    Assets
+
+2020/01/05 * (10) a
+    ; time: 9:30
+    Assets  $5
+    Income
+
+2020/01/05 ! (9) c
+    ; time: 14:00:01
+    Bank  3 AAPL
+    Income
+
+2020/01/09 y
+    Assets  $1
+    Income
+`
+
+	sortFileTest = `2020/01/02 b
+    x  $2
+    y
+
+2020/01/01 a
+    x  $1
+    y
+`
+
+	sortFileTestDiff = `--- PATH
++++ PATH (sorted)
+@@ -1,7 +1,7 @@
+-2020/01/02 b
+-    x  $2
+-    y
+-
+ 2020/01/01 a
+     x  $1
+     y
++
++2020/01/02 b
++    x  $2
++    y
 `
 )
@@ -1,19 +1,73 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/glennhartmann/ledger-tools/src/transactionsorter/lib"
+
+	flag "github.com/spf13/pflag"
+	enumflag "github.com/thediveo/enumflag/v2"
+)
+
+var (
+	reverse = flag.BoolP("reverse", "r", false, "Sort newest-first.")
+	check   = flag.Bool("check", false, "Don't modify the file; exit with an error if it isn't already sorted.")
+	diff    = flag.BoolP("diff", "d", false, "Don't modify the file; print a unified diff of what sorting would change.")
+	stdout  = flag.Bool("stdout", false, "Don't modify the file; print the sorted journal to stdout.")
+	backups = flag.IntP("backups", "b", 0, "Number of backup copies of the original file to keep (as <file>.bak, <file>.bak.1, etc).")
+
+	dedupeDays       = flag.Int("dedupe-days", lib.DefaultDedupeDays, "Maximum number of days apart that duplicate transactions can be.")
+	dedupeSimilarity = flag.Float64("dedupe-similarity", lib.DefaultDedupeSimilarity, "Minimum payee similarity (from 0 to 1) for transactions to be considered duplicates.")
+	dedupeIDTags     = flag.StringSlice("dedupe-id-tags", lib.DefaultIDTags, "Metadata tags holding unique import IDs. Transactions with the same value for one of them are duplicates, and ones with different values aren't.")
+
+	directiveMode lib.DirectiveMode
+	dateKey       lib.DateKey
+	sortKeys      []lib.SortKey
+	dedupeMode    lib.DedupeMode
 )
 
 func main() {
-	if len(os.Args) != 2 {
+	flag.Var(enumflag.New(&directiveMode, "directiveMode", lib.DirectiveModeIDs, enumflag.EnumCaseInsensitive), "directives", fmt.Sprintf("What to do with directives (account, commodity, alias, etc). %q keeps them in place, sorting transactions around them (but not across order-sensitive ones like apply, year or include); %q moves them to the top of the file.", lib.DirectiveModeIDs[lib.PinDirectives][0], lib.DirectiveModeIDs[lib.HoistDirectives][0]))
+	flag.Var(enumflag.New(&dateKey, "dateKey", lib.DateKeyIDs, enumflag.EnumCaseInsensitive), "date", fmt.Sprintf("Which date to sort by. %q uses the transaction date; %q (aliases %q) uses the auxiliary date where there is one.", lib.DateKeyIDs[lib.PrimaryDate][0], lib.DateKeyIDs[lib.AuxDate][0], lib.DateKeyIDs[lib.AuxDate][1:]))
+	flag.VarP(enumflag.NewSlice(&sortKeys, "sortKey", lib.SortKeyIDs, enumflag.EnumCaseInsensitive), "sort-keys", "k", fmt.Sprintf("Comma-separated tie-breakers for transactions on the same date, applied in order. Valid values are %q, %q, %q, %q, %q and %q (the value of the %q metadata tag).", lib.SortKeyIDs[lib.PayeeKey][0], lib.SortKeyIDs[lib.StateKey][0], lib.SortKeyIDs[lib.CodeKey][0], lib.SortKeyIDs[lib.AccountKey][0], lib.SortKeyIDs[lib.AmountKey][0], lib.SortKeyIDs[lib.TimeKey][0], lib.TimeTag+":"))
+	flag.Var(enumflag.New(&dedupeMode, "dedupeMode", lib.DedupeModeIDs, enumflag.EnumCaseInsensitive), "dedupe", fmt.Sprintf("What to do with likely duplicate transactions. %q lists them on stderr; %q removes them; %q comments them out.", lib.DedupeModeIDs[lib.ReportDuplicates][0], lib.DedupeModeIDs[lib.DropDuplicates][0], lib.DedupeModeIDs[lib.CommentDuplicates][0]))
+
+	flag.Parse()
+	if flag.NArg() != 1 {
 		fmt.Fprintf(os.Stderr, "wrong args\n")
 		os.Exit(1)
 	}
+	if *diff && *stdout {
+		fmt.Fprintf(os.Stderr, "--diff and --stdout can't be used together\n")
+		os.Exit(1)
+	}
 
-	if err := lib.SortFile(os.Args[1]); err != nil {
+	s := &lib.Sorter{
+		Directives: directiveMode,
+		Date:       dateKey,
+		Keys:       sortKeys,
+		Reverse:    *reverse,
+		Dedupe: lib.Dedupe{
+			Mode:       dedupeMode,
+			Days:       *dedupeDays,
+			Similarity: *dedupeSimilarity,
+			IDTags:     *dedupeIDTags,
+		},
+		Check:   *check,
+		Diff:    *diff,
+		Stdout:  *stdout,
+		Backups: *backups,
+	}
+	dups, err := s.SortFile(flag.Arg(0))
+	for _, d := range dups {
+		fmt.Fprintf(os.Stderr, "%s:%d: duplicate of line %d (%s)\n", flag.Arg(0), d.Transaction.StartLine(), d.Of.StartLine(), d.Reason)
+	}
+	if errors.Is(err, lib.ErrNotSorted) {
+		fmt.Fprintf(os.Stderr, "%s is not sorted\n", flag.Arg(0))
+		os.Exit(1)
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,269 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/glennhartmann/ledger-tools/src/fs"
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+var (
+	// overridable for testing
+	outWriter io.Writer = os.Stdout
+)
+
+const DefaultDays = 3
+
+type Matcher struct {
+	// Days is the maximum number of days apart that the two halves of a
+	// transfer can be.
+	Days int
+	// UnknownAccounts are the placeholder accounts (including their
+	// subaccounts) that single-sided transactions are balanced against, like
+	// importer.DefaultUnknownAccounts.
+	UnknownAccounts []string
+	// Accounts, if non-empty, restricts matching to transfers between these
+	// accounts (including their subaccounts).
+	Accounts []string
+
+	// Report lists the proposed merges instead of making them. Stdout prints
+	// the rewritten journal instead of overwriting the file. Either way, the
+	// file is left untouched.
+	Report bool
+	Stdout bool
+
+	// Backups is the number of backup copies of the original file to keep
+	// when rewriting it in-place.
+	Backups int
+}
+
+// Match is a pair of single-sided transactions that make up a transfer.
+type Match struct {
+	// Kept is the earlier transaction, which the transfer is merged into, and
+	// Absorbed is the later one, which is removed.
+	Kept     *journal.Transaction
+	Absorbed *journal.Transaction
+
+	kept, absorbed *candidate
+}
+
+// candidate is a transaction with one posting to a real account and one to an
+// unknown account.
+type candidate struct {
+	t         *journal.Transaction
+	real      *journal.Posting
+	unknown   *journal.Posting
+	commodity string
+	quantity  *big.Rat
+}
+
+// MatchFile finds and merges the transfers in the journal at path. It returns
+// the matches it found (or, in Report mode, would merge).
+func (m *Matcher) MatchFile(path string) ([]Match, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ioutil.ReadFile(%s)", path)
+	}
+	j, err := journal.Parse(string(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "journal.Parse(%s)", path)
+	}
+
+	matches := m.match(j.Transactions())
+	if m.Report {
+		for _, match := range matches {
+			if _, err := fmt.Fprintln(outWriter, match); err != nil {
+				return nil, errors.Wrap(err, "fmt.Fprintln()")
+			}
+		}
+		return matches, nil
+	}
+
+	out := strings.Join(apply(j, matches), "\n")
+	if m.Stdout {
+		_, err := io.WriteString(outWriter, out)
+		return matches, errors.Wrap(err, "io.WriteString()")
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return matches, errors.Wrapf(fs.WriteFileAtomic(path, []byte(out), 0644, m.Backups), "fs.WriteFileAtomic(%s)", path)
+}
+
+// match pairs up transfers. Each candidate is matched with the closest
+// following one (by date) that has an equal and opposite amount in a
+// different account.
+func (m *Matcher) match(ts []*journal.Transaction) []Match {
+	var cands []*candidate
+	for _, t := range ts {
+		if c := m.candidate(t); c != nil {
+			cands = append(cands, c)
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].t.Date.Before(cands[j].t.Date)
+	})
+
+	var matches []Match
+	matched := make(map[*candidate]bool)
+	neg := new(big.Rat)
+	for i, a := range cands {
+		if matched[a] {
+			continue
+		}
+		neg.Neg(a.quantity)
+		limit := a.t.Date.AddDate(0, 0, m.Days)
+		for _, b := range cands[i+1:] {
+			if b.t.Date.After(limit) {
+				break
+			}
+			if matched[b] || b.real.Account == a.real.Account || b.commodity != a.commodity || b.quantity.Cmp(neg) != 0 {
+				continue
+			}
+			matched[a], matched[b] = true, true
+			matches = append(matches, Match{Kept: a.t, Absorbed: b.t, kept: a, absorbed: b})
+			break
+		}
+	}
+	return matches
+}
+
+// candidate returns t as a candidate half of a transfer, or nil if it isn't
+// one.
+func (m *Matcher) candidate(t *journal.Transaction) *candidate {
+	var real, unknown []*journal.Posting
+	for _, p := range t.Postings {
+		switch {
+		case p.Type == journal.Virtual:
+		case importer.InAccounts(p.Account, m.UnknownAccounts):
+			unknown = append(unknown, p)
+		default:
+			real = append(real, p)
+		}
+	}
+	if len(real) != 1 || len(unknown) != 1 {
+		return nil
+	}
+	if len(m.Accounts) > 0 && !importer.InAccounts(real[0].Account, m.Accounts) {
+		return nil
+	}
+	c, q, ok := t.PostingAmount(real[0])
+	if !ok || q.Sign() == 0 {
+		return nil
+	}
+	return &candidate{t: t, real: real[0], unknown: unknown[0], commodity: c, quantity: q}
+}
+
+// apply returns the lines of j with each match merged into a single
+// transaction.
+func apply(j *journal.Journal, matches []Match) []string {
+	merged := make(map[*journal.Transaction][]string)
+	absorbed := make(map[*journal.Transaction]bool)
+	for _, m := range matches {
+		merged[m.Kept] = m.mergedLines()
+		absorbed[m.Absorbed] = true
+	}
+
+	var out []string
+	skipBlank := false
+	for _, b := range j.Blocks {
+		if t, ok := b.(*journal.Transaction); ok && absorbed[t] {
+			// drop the blank lines after the removed transaction too, unless
+			// they're all that separates its neighbours
+			skipBlank = len(out) == 0 || strings.TrimSpace(out[len(out)-1]) == ""
+			continue
+		}
+		if _, ok := b.(*journal.Blank); ok && skipBlank {
+			skipBlank = false
+			continue
+		}
+		skipBlank = false
+
+		if t, ok := b.(*journal.Transaction); ok && merged[t] != nil {
+			out = append(out, merged[t]...)
+			continue
+		}
+		out = append(out, b.Lines()...)
+	}
+	return out
+}
+
+// mergedLines returns the lines of the Kept transaction, with its unknown
+// posting replaced by the Absorbed transaction's real posting. The Absorbed
+// transaction's metadata, and its payee and date (if they're different), are
+// kept as comments on the moved posting, using ledger's `Payee:` tag and
+// `[DATE]` posting date syntax.
+func (m Match) mergedLines() []string {
+	k, a := m.Kept, m.Absorbed
+	kStart, kEnd := k.PostingLines(m.kept.unknown)
+	aStart, aEnd := a.PostingLines(m.absorbed.real)
+
+	posting := a.Raw[aStart]
+	indent := posting[:len(posting)-len(strings.TrimLeft(posting, " \t"))]
+	if a.State != k.State && m.absorbed.real.State == journal.Uncleared && a.State != journal.Uncleared {
+		posting = indent + a.State.String() + " " + strings.TrimLeft(posting, " \t")
+	}
+	// only one posting can have its amount elided
+	if m.kept.real.Amount == nil && m.absorbed.real.Amount == nil {
+		note := ""
+		if i := strings.IndexByte(posting, ';'); i >= 0 {
+			posting, note = strings.TrimRight(posting[:i], " \t"), "  "+posting[i:]
+		}
+		posting += "  " + m.absorbed.amountText() + note
+	}
+
+	lines := make([]string, 0, len(k.Raw)+aEnd-aStart+len(a.Notes)+2)
+	lines = append(lines, k.Raw[:kStart]...)
+	lines = append(lines, posting)
+	if a.Payee != k.Payee {
+		lines = append(lines, indent+"; Payee: "+a.Payee)
+	}
+	if !a.Date.Equal(k.Date) {
+		lines = append(lines, indent+"; ["+a.Date.Format(journal.DateFormat)+"]")
+	}
+	for _, n := range a.Notes {
+		lines = append(lines, indent+";"+n)
+	}
+	lines = append(lines, a.Raw[aStart+1:aEnd]...)
+	return append(lines, k.Raw[kEnd:]...)
+}
+
+func (m Match) String() string {
+	return fmt.Sprintf("%s <-> %s", m.kept, m.absorbed)
+}
+
+func (c *candidate) String() string {
+	return fmt.Sprintf("%d: %s %s (%s %s)", c.t.StartLine(), c.t.Date.Format(journal.DateFormat), c.t.Payee, c.real.Account, c.amountText())
+}
+
+// amountText returns the real posting's amount as written, or formatted like
+// the unknown posting's amount if it was elided.
+func (c *candidate) amountText() string {
+	if c.real.Amount != nil {
+		return c.real.Amount.Text
+	}
+	q := c.quantity.FloatString(0)
+	a := c.unknown.Amount
+	if a == nil {
+		return q
+	}
+	q = c.quantity.FloatString(a.Precision)
+	switch {
+	case a.Commodity == "":
+		return q
+	case a.Prefix && a.Spaced:
+		return a.Commodity + " " + q
+	case a.Prefix:
+		return a.Commodity + q
+	}
+	return q + " " + a.Commodity
+}
@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"testing"
+
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prashantv/gostub"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/journal"
+)
+
+const matchTest = `2024/01/01 Payroll
+    Assets:Chequing  $2000.00
+    Income:Salary
+
+2024/01/02 PAYMENT - VISA
+    ; import-id: chq-1
+    Assets:Chequing  $-500.00
+    Expenses:Unknown
+
+2024/01/03 * PAYMENT THANK YOU
+    ; import-id: visa-9
+    Liabilities:Visa  $500.00  ; online
+    Income:Unknown
+
+2024/01/03 Coffee
+    Liabilities:Visa  $-3.00
+    Expenses:Unknown
+
+2024/01/04 Transfer
+    Assets:Savings
+    Income:Unknown  $-100
+
+2024/01/04 Transfer
+    Assets:Chequing
+    Expenses:Unknown  $100
+`
+
+const matchTestWant = `2024/01/01 Payroll
+    Assets:Chequing  $2000.00
+    Income:Salary
+
+2024/01/02 PAYMENT - VISA
+    ; import-id: chq-1
+    Assets:Chequing  $-500.00
+    * Liabilities:Visa  $500.00  ; online
+    ; Payee: PAYMENT THANK YOU
+    ; [2024/01/03]
+    ; import-id: visa-9
+
+2024/01/03 Coffee
+    Liabilities:Visa  $-3.00
+    Expenses:Unknown
+
+2024/01/04 Transfer
+    Assets:Savings
+    Assets:Chequing  $-100
+`
+
+const matchTestReport = `5: 2024/01/02 PAYMENT - VISA (Assets:Chequing $-500.00) <-> 10: 2024/01/03 PAYMENT THANK YOU (Liabilities:Visa $500.00)
+19: 2024/01/04 Transfer (Assets:Savings $100) <-> 23: 2024/01/04 Transfer (Assets:Chequing $-100)
+`
+
+func TestMatchFile(t *testing.T) {
+	tests := []struct {
+		m           Matcher
+		wantFile    string
+		wantOut     string
+		wantMatches int
+	}{
+		{Matcher{Days: 3, UnknownAccounts: importer.DefaultUnknownAccounts}, matchTestWant, "", 2},
+		{Matcher{Days: 3, UnknownAccounts: importer.DefaultUnknownAccounts, Report: true}, matchTest, matchTestReport, 2},
+		{Matcher{Days: 3, UnknownAccounts: importer.DefaultUnknownAccounts, Stdout: true}, matchTest, matchTestWant, 2},
+		{Matcher{Days: 0, UnknownAccounts: importer.DefaultUnknownAccounts, Report: true}, matchTest, strings.SplitAfter(matchTestReport, "\n")[1], 1},
+		{Matcher{Days: 3, UnknownAccounts: importer.DefaultUnknownAccounts, Accounts: []string{"Assets"}, Report: true}, matchTest, strings.SplitAfter(matchTestReport, "\n")[1], 1},
+		{Matcher{Days: 3, UnknownAccounts: []string{"Expenses:Other"}}, matchTest, "", 0},
+	}
+	for i, test := range tests {
+		stubs := gostub.New()
+		var b bytes.Buffer
+		stubs.Stub(&outWriter, &b)
+
+		path := filepath.Join(t.TempDir(), "test.ledger")
+		if err := ioutil.WriteFile(path, []byte(matchTest), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile() = err(%v)", err)
+		}
+
+		matches, err := test.m.MatchFile(path)
+		if err != nil {
+			t.Errorf("%d: MatchFile() = err(%v)", i, err)
+		}
+		if len(matches) != test.wantMatches {
+			t.Errorf("%d: MatchFile() found %d matches, want %d", i, len(matches), test.wantMatches)
+		}
+		if got, err := ioutil.ReadFile(path); err != nil || string(got) != test.wantFile {
+			t.Errorf("%d: MatchFile() left file as %q (err(%v)), want %q", i, got, err, test.wantFile)
+		}
+		if b.String() != test.wantOut {
+			t.Errorf("%d: MatchFile() printed %q, want %q", i, b.String(), test.wantOut)
+		}
+
+		stubs.Reset()
+	}
+}
+
+func TestMergedLinesElided(t *testing.T) {
+	j, err := journal.Parse("2024/01/02 a\n    Assets:Chequing\n    Expenses:Unknown  $5.00\n\n2024/01/02 a\n    Liabilities:Visa  ; note\n    Income:Unknown  $-5.00\n")
+	if err != nil {
+		t.Fatalf("journal.Parse() = err(%v)", err)
+	}
+	m := &Matcher{UnknownAccounts: importer.DefaultUnknownAccounts}
+	matches := m.match(j.Transactions())
+	if len(matches) != 1 {
+		t.Fatalf("match() found %d matches, want 1", len(matches))
+	}
+	want := "2024/01/02 a\n    Assets:Chequing\n    Liabilities:Visa  $5.00  ; note\n"
+	if got := strings.Join(apply(j, matches), "\n"); got != want {
+		t.Errorf("apply() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/glennhartmann/ledger-tools/src/importer"
+	"github.com/glennhartmann/ledger-tools/src/transfermatch/lib"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	days            = flag.Int("days", lib.DefaultDays, "Maximum number of days apart that the two halves of a transfer can be.")
+	unknownAccounts = flag.StringSlice("unknown-accounts", importer.DefaultUnknownAccounts, "Placeholder accounts (and their subaccounts) that imported single-sided transactions are balanced against.")
+	accounts        = flag.StringSlice("accounts", nil, "Only match transfers between these accounts (and their subaccounts). Defaults to any accounts.")
+	report          = flag.Bool("report", false, "Don't modify the file; list the transfers that would be merged.")
+	stdout          = flag.Bool("stdout", false, "Don't modify the file; print the rewritten journal to stdout.")
+	backups         = flag.IntP("backups", "b", 0, "Number of backup copies of the original file to keep (as <file>.bak, <file>.bak.1, etc).")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "wrong args\n")
+		os.Exit(1)
+	}
+	if *report && *stdout {
+		fmt.Fprintf(os.Stderr, "--report and --stdout can't be used together\n")
+		os.Exit(1)
+	}
+
+	m := &lib.Matcher{
+		Days:            *days,
+		UnknownAccounts: *unknownAccounts,
+		Accounts:        *accounts,
+		Report:          *report,
+		Stdout:          *stdout,
+		Backups:         *backups,
+	}
+	matches, err := m.MatchFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %+v\n", err)
+		os.Exit(1)
+	}
+	if !*report && !*stdout {
+		fmt.Fprintf(os.Stderr, "merged %d transfers\n", len(matches))
+	}
+}
@@ -1,5 +1,23 @@
 #!/bin/bash
 go test -mod=readonly github.com/glennhartmann/ledger-tools/src/transactionsorter/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/journalmerge/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/transfermatch/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/csvimport/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/ofximport/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/qifimport/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/camtimport/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/categorize/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/journalfmt/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/checkassertions/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/journallint/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/journalsplit/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/closebooks/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbfetcher/lib
 go test -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbtocsv/lib
 go test -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedb
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/pricedbmerge/lib
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/priceutils
 go test -mod=readonly github.com/glennhartmann/ledger-tools/src/fs
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/journal
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/diff
+go test -mod=readonly github.com/glennhartmann/ledger-tools/src/importer